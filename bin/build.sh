@@ -165,7 +165,7 @@ list_docs() {
     for f in ${client_dir}/*.yaml; do
         if [ -f "$f" ]; then
             name=$(basename "$f" .yaml)
-            if [ "$name" = "metadata" ]; then
+            if [ "$name" = "metadata" ] || [ "$name" = "variables" ]; then
                 continue
             fi
             echo "  - $name"
@@ -389,6 +389,135 @@ read_yaml_list() {
     ' "$file"
 }
 
+# 从 YAML 读取模块列表（支持带 when 条件的条目）
+# format 条件按当前输出格式筛选；依赖变量值的条件无法在命令行中判断，直接包含并给出警告
+read_yaml_modules() {
+    local file="$1"
+    local format="$2"
+    
+    if [ ! -f "$file" ]; then
+        echo ""
+        return
+    fi
+    
+    awk -v fmt="$format" '
+        function clean(s) {
+            gsub(/^[[:space:]]+|[[:space:]]+$/, "", s)
+            gsub(/^["'"'"']|["'"'"']$/, "", s)
+            return s
+        }
+        function format_allowed(list,    n, i, items) {
+            gsub(/[][]/, "", list)
+            n = split(list, items, ",")
+            for (i = 1; i <= n; i++) if (clean(items[i]) == fmt) return 1
+            return 0
+        }
+        function check(key, val) {
+            if (key == "format") { if (!format_allowed(val)) keep = 0 }
+            else warn = 1
+        }
+        function check_inline(val,    n, i, pairs, kv, seg) {
+            if (val ~ /^\{/) {
+                gsub(/^\{|\}$/, "", val)
+                # 拆分 key: value 对（列表值中的逗号先替换掉）
+                while (match(val, /\[[^]]*\]/)) {
+                    seg = substr(val, RSTART, RLENGTH); gsub(/,/, "|", seg)
+                    val = substr(val, 1, RSTART - 1) seg substr(val, RSTART + RLENGTH)
+                }
+                n = split(val, pairs, ",")
+                for (i = 1; i <= n; i++) {
+                    split(pairs[i], kv, ":")
+                    gsub(/\|/, ",", kv[2])
+                    check(clean(kv[1]), kv[2])
+                }
+                return
+            }
+            val = clean(val)
+            if (match(val, /^format[[:space:]]*==[[:space:]]*["'"'"'][a-z]+["'"'"']$/)) {
+                sub(/^format[[:space:]]*==[[:space:]]*/, "", val)
+                if (clean(val) != fmt) keep = 0
+            } else if (match(val, /^format[[:space:]]*!=[[:space:]]*["'"'"'][a-z]+["'"'"']$/)) {
+                sub(/^format[[:space:]]*!=[[:space:]]*/, "", val)
+                if (clean(val) == fmt) keep = 0
+            } else {
+                warn = 1
+            }
+        }
+        function flush() {
+            if (path != "") {
+                if (warn && keep) print "[警告] 模块 " path " 的条件依赖变量值，命令行构建时直接包含（请通过 Web 界面构建以完整评估）" > "/dev/stderr"
+                if (keep) print path
+            }
+            path = ""; in_when = 0; keep = 1; warn = 0
+        }
+        BEGIN { in_list=0; keep=1 }
+        $0 ~ "^modules:" { in_list=1; next }
+        in_list && /^[[:space:]]*$/ { next }  # 跳过空行
+        in_list && /^[[:space:]]*#/ { next }  # 跳过注释行
+        in_list && /^[[:space:]]+-/ {
+            flush()
+            line = $0
+            sub(/^[[:space:]]+-[[:space:]]*/, "", line)
+            if (line ~ /^path:/) {
+                sub(/^path:[[:space:]]*/, "", line)
+                path = clean(line)
+            } else {
+                line = clean(line)
+                if (line != "") print line
+            }
+            next
+        }
+        in_list && path != "" && /^[[:space:]]+when:/ {
+            line = $0
+            sub(/^[[:space:]]+when:[[:space:]]*/, "", line)
+            if (line == "") in_when = 1
+            else check_inline(line)
+            next
+        }
+        in_list && path != "" && /^[[:space:]]+path:/ {
+            line = $0
+            sub(/^[[:space:]]+path:[[:space:]]*/, "", line)
+            path = clean(line)
+            next
+        }
+        in_list && path != "" && in_when && /^[[:space:]]+[^[:space:]]+:/ {
+            line = $0
+            sub(/^[[:space:]]+/, "", line)
+            key = line; sub(/:.*/, "", key)
+            sub(/^[^:]*:[[:space:]]*/, "", line)
+            check(clean(key), line)
+            next
+        }
+        in_list && /^[^[:space:]-]/ { flush(); in_list=0; exit }  # 遇到新的顶级键退出
+        END { flush() }
+    ' "$file"
+}
+
+# 从 YAML 读取简单映射（如 template_variables），每行输出 key=value
+read_yaml_map() {
+    local file="$1"
+    local key="$2"
+
+    [ -f "$file" ] || return
+
+    awk -v key="$key" '
+        $0 ~ "^"key":" { in_map=1; next }
+        in_map && /^[^[:space:]#]/ { exit }
+        in_map && /^[[:space:]]+[^[:space:]#][^:]*:/ {
+            line=$0
+            sub(/^[[:space:]]+/, "", line)
+            name=line
+            sub(/:.*/, "", name)
+            sub(/^[^:]+:[[:space:]]*/, "", line)
+            # 去除行尾注释和引号
+            sub(/[[:space:]]+#.*$/, "", line)
+            gsub(/["'\'']/, "", line)
+            gsub(/[[:space:]]*$/, "", line)
+            print name "=" line
+        }
+    ' "$file"
+}
+
 # 从 YAML 读取 pdf_options 节
 read_pdf_option() {
     local file="$1"
@@ -426,6 +555,24 @@ read_pdf_option() {
     fi
 }
 
+# 从 YAML 读取 word_options 节
+read_word_option() {
+    local file="$1"
+    local key="$2"
+    local default="$3"
+
+    local value
+    value=$(read_yaml_map "$file" "word_options" | awk -v key="$key" '
+        index($0, key "=") == 1 { print substr($0, length(key) + 2); exit }
+    ')
+
+    if [ -n "$value" ]; then
+        echo "$value"
+    else
+        echo "$default"
+    fi
+}
+
 # 替换占位符
 replace_placeholders() {
     local pattern="$1"
@@ -542,7 +689,7 @@ if [ -n "$DOC_TYPE" ]; then
     CONFIG_FILE="${CLIENT_DIR}/${DOC_TYPE}.yaml"
 else
     # 没有指定文档类型时，尝试查找第一个可用的配置文件
-    first_config=$(find "$CLIENT_DIR" -maxdepth 1 -name "*.yaml" ! -name "metadata.yaml" -type f 2>/dev/null | head -1)
+    first_config=$(find "$CLIENT_DIR" -maxdepth 1 -name "*.yaml" ! -name "metadata.yaml" ! -name "variables.yaml" -type f 2>/dev/null | head -1)
     if [ -n "$first_config" ]; then
         CONFIG_FILE="$first_config"
         DOC_TYPE=$(basename "$first_config" .yaml)
@@ -590,6 +737,12 @@ fi
 # 创建构建目录
 mkdir -p "$BUILD_DIR"
 
+# 配置继承（extends）由 Web 服务解析，命令行只读取配置文件本身
+if grep -q "^extends:" "$CONFIG_FILE"; then
+    echo "[警告] 配置继承自 $(read_yaml_value "$CONFIG_FILE" "extends")，命令行构建不解析继承，只使用该文件中的字段"
+    echo "       请通过 Web 界面构建以使用完整配置"
+fi
+
 # 读取配置
 client_name=$(read_yaml_value "$CONFIG_FILE" "client_name")
 template=$(read_yaml_value "$CONFIG_FILE" "template")
@@ -599,7 +752,7 @@ output_pattern=$(read_yaml_value "$CONFIG_FILE" "output_pattern")
 modules=()
 while IFS= read -r line; do
     [ -n "$line" ] && modules+=("$line")
-done < <(read_yaml_list "$CONFIG_FILE" "modules")
+done < <(read_yaml_modules "$CONFIG_FILE" "$FORMAT")
 
 # 展开通配符模式（如 src/*.md）
 expanded_modules=()
@@ -629,6 +782,12 @@ while IFS= read -r line; do
     [ -n "$line" ] && pandoc_args+=("$line")
 done < <(read_yaml_list "$CONFIG_FILE" "pandoc_args")
 
+# 读取模板变量（PDF 用 -V，Word 用 -M 传给 Pandoc，覆盖 pdf_options 生成的同名参数）
+template_vars=()
+while IFS= read -r line; do
+    [ -n "$line" ] && template_vars+=("$line")
+done < <(read_yaml_map "$CONFIG_FILE" "template_variables")
+
 # 读取 PDF 选项（使用更通用的默认字体）
 pdf_titlepage=$(read_pdf_option "$CONFIG_FILE" "titlepage" "true")
 pdf_titlepage_color=$(read_pdf_option "$CONFIG_FILE" "titlepage-color" "2C3E50")
@@ -648,6 +807,17 @@ pdf_monofont=$(read_pdf_option "$CONFIG_FILE" "monofont" "$default_mono_font")
 pdf_toc=$(read_pdf_option "$CONFIG_FILE" "toc" "true")
 pdf_toc_depth=$(read_pdf_option "$CONFIG_FILE" "toc-depth" "3")
 
+# 读取 Word 选项（未设置的选项沿用 pandoc_args）
+word_toc=$(read_word_option "$CONFIG_FILE" "toc" "")
+word_toc_depth=$(read_word_option "$CONFIG_FILE" "toc-depth" "")
+word_number_sections=$(read_word_option "$CONFIG_FILE" "number-sections" "")
+word_highlight_style=$(read_word_option "$CONFIG_FILE" "highlight-style" "")
+word_page_break=$(read_word_option "$CONFIG_FILE" "page-break-before-chapter" "")
+word_table_style=$(read_word_option "$CONFIG_FILE" "table-style" "")
+word_figure_prefix=$(read_word_option "$CONFIG_FILE" "figure-prefix" "")
+word_table_prefix=$(read_word_option "$CONFIG_FILE" "table-prefix" "")
+word_reference_doc=$(read_word_option "$CONFIG_FILE" "reference-doc" "")
+
 # 默认值
 [ -z "$client_name" ] && client_name="$CLIENT"
 [ -z "$template" ] && template="default.docx"
@@ -668,6 +838,10 @@ valid_modules=()
 for module in "${modules[@]}"; do
     if [ -f "$module" ]; then
         valid_modules+=("$module")
+        # {{include}} 只在 Web 服务构建时展开（Web 服务调用脚本前已在临时目录中展开）
+        if grep -qE '(^|[^\\])\{\{include[[:space:]]+"' "$module"; then
+            echo "[警告] 模块 $module 使用了 {{include}}，命令行构建不展开引用，会原样输出到文档中（请通过 Web 界面构建）"
+        fi
     else
         echo "[警告] 模块不存在: $module"
     fi
@@ -749,10 +923,42 @@ fi
 pandoc_cmd+=(-o "$output_path")
 
 if [ "$FORMAT" = "word" ]; then
+    # word_options.reference-doc 优先于 template
+    [ -n "$word_reference_doc" ] && template="$word_reference_doc"
     template_path="${TEMPLATES_DIR}/${template}"
     if [ -f "$template_path" ]; then
         pandoc_cmd+=(--reference-doc="$template_path")
+    elif [ -n "$word_reference_doc" ]; then
+        echo "[警告] 参考文档不存在: $template_path"
+    fi
+
+    # 目录、章节编号和代码高亮：word_options 中设置的选项替换 pandoc_args 中的同类参数
+    filtered_args=()
+    for arg in "${pandoc_args[@]}"; do
+        case "$arg" in
+            --toc|--table-of-contents) [ -n "$word_toc" ] && continue ;;
+            --toc-depth=*) [ -n "$word_toc$word_toc_depth" ] && continue ;;
+            --number-sections|-N) [ -n "$word_number_sections" ] && continue ;;
+            --highlight-style=*|--no-highlight) [ -n "$word_highlight_style" ] && continue ;;
+        esac
+        filtered_args+=("$arg")
+    done
+    pandoc_args=("${filtered_args[@]}")
+    [ "$word_toc" = "true" ] && pandoc_cmd+=(--toc)
+    [ -n "$word_toc_depth" ] && [ "$word_toc" != "false" ] && pandoc_cmd+=(--toc-depth="$word_toc_depth")
+    [ "$word_number_sections" = "true" ] && pandoc_cmd+=(--number-sections)
+    [ -n "$word_highlight_style" ] && pandoc_cmd+=(--highlight-style="$word_highlight_style")
+
+    # 章节分页和图表标题前缀由 Lua 过滤器处理
+    if [ "$word_page_break" = "true" ] || [ -n "$word_figure_prefix" ] || [ -n "$word_table_prefix" ]; then
+        pandoc_cmd+=(--lua-filter="${BASE_DIR}/bin/filters/word-options.lua")
+        [ "$word_page_break" = "true" ] && pandoc_cmd+=(-M word-page-break=true)
+        [ -n "$word_figure_prefix" ] && pandoc_cmd+=(-M "word-figure-prefix=$word_figure_prefix")
+        [ -n "$word_table_prefix" ] && pandoc_cmd+=(-M "word-table-prefix=$word_table_prefix")
     fi
+
+    # 表格样式由 Web 服务在构建后处理
+    [ -n "$word_table_style" ] && echo "[提示] 表格样式 (word_options.table-style) 在构建完成后由 Web 服务设置（命令行构建不生效）"
 else
     pandoc_cmd+=(--pdf-engine=xelatex)
     pandoc_cmd+=(--template=eisvogel)
@@ -767,6 +973,37 @@ else
     [ "$pdf_toc" = "true" ] && pandoc_cmd+=(--toc --toc-depth="$pdf_toc_depth")
 fi
 
+# 应用模板变量
+if [ ${#template_vars[@]} -gt 0 ]; then
+    var_flag="-M"
+    [ "$FORMAT" = "pdf" ] && var_flag="-V"
+
+    # 去掉与模板变量同名的默认 -V 参数，避免 Pandoc 把它们合并成列表
+    filtered_cmd=()
+    for ((i = 0; i < ${#pandoc_cmd[@]}; i++)); do
+        arg="${pandoc_cmd[$i]}"
+        if [ "$arg" = "-V" ] && [ $((i + 1)) -lt ${#pandoc_cmd[@]} ]; then
+            var_name="${pandoc_cmd[$((i + 1))]%%=*}"
+            overridden=false
+            for tv in "${template_vars[@]}"; do
+                [ "${tv%%=*}" = "$var_name" ] && overridden=true && break
+            done
+            if [ "$overridden" = true ]; then
+                i=$((i + 1))
+                continue
+            fi
+        fi
+        filtered_cmd+=("$arg")
+    done
+    pandoc_cmd=("${filtered_cmd[@]}")
+
+    for tv in "${template_vars[@]}"; do
+        # 布尔值 false 不传（模板中未定义即为关闭）
+        [ "${tv#*=}" = "false" ] && continue
+        pandoc_cmd+=("$var_flag" "$tv")
+    done
+fi
+
 # 构建 resource-path：包含 src 目录及其所有子目录
 resource_paths="$SRC_DIR"
 # 添加所有包含 images 目录的子目录
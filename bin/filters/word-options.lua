@@ -0,0 +1,114 @@
+-- Word 输出选项（word_options）的 Pandoc Lua 过滤器
+-- 由构建脚本通过元数据传入：
+--   word-page-break: true   一级标题前分页（第一个一级标题除外）
+--   word-figure-prefix: 图  图片标题加编号前缀，如 "图 1 系统架构"
+--   word-table-prefix: 表   表格标题加编号前缀，如 "表 1 端口列表"
+
+local page_break = false
+local figure_prefix = nil
+local table_prefix = nil
+local figure_count = 0
+local table_count = 0
+local chapter_count = 0
+
+local function meta_string(value)
+  if value == nil then
+    return nil
+  end
+  local text = pandoc.utils.stringify(value)
+  if text == "" then
+    return nil
+  end
+  return text
+end
+
+local function read_meta(meta)
+  local flag = meta["word-page-break"]
+  page_break = flag == true or meta_string(flag) == "true"
+  figure_prefix = meta_string(meta["word-figure-prefix"])
+  table_prefix = meta_string(meta["word-table-prefix"])
+end
+
+-- 在标题内容前加 "前缀 编号 "
+local function number_inlines(inlines, prefix, number)
+  local label = { pandoc.Str(prefix .. " " .. number), pandoc.Space() }
+  for i = #label, 1, -1 do
+    table.insert(inlines, 1, label[i])
+  end
+  return inlines
+end
+
+-- 在块级标题（Pandoc 3 的 Caption.long）的第一段前加前缀
+local function number_blocks(blocks, prefix, number)
+  if #blocks == 0 or blocks[1].content == nil then
+    return false
+  end
+  number_inlines(blocks[1].content, prefix, number)
+  return true
+end
+
+local function header(el)
+  if not page_break or el.level ~= 1 then
+    return nil
+  end
+  chapter_count = chapter_count + 1
+  if chapter_count == 1 then
+    return nil
+  end
+  local br = pandoc.RawBlock("openxml", '<w:p><w:r><w:br w:type="page"/></w:r></w:p>')
+  return { br, el }
+end
+
+-- Pandoc 3：图片和标题组成 Figure 块
+local function figure(el)
+  if not figure_prefix or #el.caption.long == 0 then
+    return nil
+  end
+  figure_count = figure_count + 1
+  number_blocks(el.caption.long, figure_prefix, figure_count)
+  return el
+end
+
+-- Pandoc 2：带标题的独立图片（title 为 fig:）
+local function image(el)
+  if not figure_prefix or not el.title:match("^fig:") or #el.caption == 0 then
+    return nil
+  end
+  figure_count = figure_count + 1
+  number_inlines(el.caption, figure_prefix, figure_count)
+  return el
+end
+
+local function tbl(el)
+  if not table_prefix then
+    return nil
+  end
+  local caption = el.caption
+  if caption.long ~= nil then
+    if #caption.long == 0 then
+      return nil
+    end
+    table_count = table_count + 1
+    number_blocks(caption.long, table_prefix, table_count)
+  else
+    -- Pandoc 2.10 之前的表格标题是行内元素列表
+    if #caption == 0 then
+      return nil
+    end
+    table_count = table_count + 1
+    number_inlines(caption, table_prefix, table_count)
+  end
+  return el
+end
+
+-- 先读取元数据，再按文档顺序处理标题、图片和表格
+return {
+  { Meta = read_meta },
+  {
+    traverse = "topdown",
+    Header = header,
+    Figure = figure,
+    Image = image,
+    Table = tbl,
+  },
+}
@@ -159,8 +159,8 @@ function Show-Docs {
     Write-Host "客户 [$ClientName] 的文档类型:"
     Get-ChildItem -Path $clientDir -Filter "*.yaml" | ForEach-Object {
         $docName = $_.BaseName
-        if ($docName -eq "metadata") {
-            # 跳过 metadata.yaml
+        if ($docName -eq "metadata" -or $docName -eq "variables") {
+            # 跳过 metadata.yaml 和 variables.yaml
         } else {
             Write-Host "  - $docName"
         }
@@ -440,6 +440,134 @@ function Read-YamlList {
     return $items
 }
 
+# 从 YAML 读取简单映射（如 template_variables），返回有序的键值表
+function Read-YamlMap {
+    param([string]$FilePath, [string]$Key)
+    
+    $map = [ordered]@{}
+    if (-not (Test-Path $FilePath)) { return $map }
+    
+    $content = Get-Content $FilePath -Encoding UTF8
+    $inMap = $false
+    
+    foreach ($line in $content) {
+        if ($line -match "^${Key}:") {
+            $inMap = $true
+            continue
+        }
+        if ($inMap) {
+            if ($line -match "^\s*#") {
+                continue
+            }
+            if ($line -match "^\s+([^\s#][^:]*):\s*(.*)$") {
+                $value = $Matches[2] -replace '\s+#.*$', ''
+                $map[$Matches[1].Trim()] = $value.Trim().Trim('"').Trim("'")
+            }
+            elseif ($line -match "^\S") {
+                break
+            }
+        }
+    }
+    return $map
+}
+
+# 从 YAML 读取模块列表（支持带 when 条件的条目）
+# format 条件按当前输出格式筛选；依赖变量值的条件无法在命令行中判断，直接包含并给出警告
+function Read-YamlModules {
+    param([string]$FilePath, [string]$Format)
+    
+    if (-not (Test-Path $FilePath)) { return @() }
+    
+    $content = Get-Content $FilePath -Encoding UTF8
+    $inList = $false
+    $inWhen = $false
+    $items = New-Object System.Collections.ArrayList
+    $entry = $null
+    
+    # 判断格式是否在允许的列表中（如 pdf 或 [word, pdf]）
+    $formatAllowed = {
+        param([string]$List)
+        $values = $List.Trim().TrimStart('[').TrimEnd(']').Split(',') | ForEach-Object { $_.Trim().Trim('"').Trim("'") }
+        return $values -contains $Format
+    }
+    # 检查一个条件键值
+    $checkCondition = {
+        param([string]$Key, [string]$Value)
+        if ($Key -eq "format") {
+            if (-not (& $formatAllowed $Value)) { $entry.Keep = $false }
+        } else {
+            $entry.Warn = $true
+        }
+    }
+    $flush = {
+        if ($entry) {
+            if ($entry.Keep) {
+                if ($entry.Warn) {
+                    Write-Host "[警告] 模块 $($entry.Path) 的条件依赖变量值，命令行构建时直接包含（请通过 Web 界面构建以完整评估）" -ForegroundColor Yellow
+                }
+                [void]$items.Add($entry.Path)
+            }
+        }
+    }
+    
+    foreach ($line in $content) {
+        if ($line -match "^modules:") {
+            $inList = $true
+            continue
+        }
+        if (-not $inList) { continue }
+        # 跳过注释行和空行
+        if ($line -match "^\s*#" -or $line -match "^\s*$") {
+            continue
+        }
+        if ($line -match "^\s+-\s+path:\s*(.+)$") {
+            & $flush
+            $entry = @{ Path = $Matches[1].Trim().Trim('"').Trim("'"); Keep = $true; Warn = $false }
+            $inWhen = $false
+        }
+        elseif ($line -match "^\s+-\s+(.+)$") {
+            & $flush
+            $entry = $null
+            [void]$items.Add($Matches[1].Trim().Trim('"').Trim("'"))
+        }
+        elseif ($entry -and $line -match "^\s+when:\s*(.*)$") {
+            $when = $Matches[1].Trim()
+            if ($when -eq "") {
+                $inWhen = $true
+            }
+            elseif ($when.StartsWith("{")) {
+                # 行内对象：{format: pdf} 或 {format: [word, pdf]}
+                $body = $when.TrimStart('{').TrimEnd('}')
+                foreach ($pair in [regex]::Split($body, ',(?![^\[]*\])')) {
+                    $kv = $pair.Split(':', 2)
+                    if ($kv.Count -eq 2) { & $checkCondition $kv[0].Trim() $kv[1] }
+                }
+            }
+            else {
+                # 表达式：只能判断 format == "x" / format != "x"
+                $expr = $when.Trim().Trim("'")
+                if ($expr -match '^format\s*==\s*["'']([a-z]+)["'']$') {
+                    if ($Matches[1] -ne $Format) { $entry.Keep = $false }
+                }
+                elseif ($expr -match '^format\s*!=\s*["'']([a-z]+)["'']$') {
+                    if ($Matches[1] -eq $Format) { $entry.Keep = $false }
+                }
+                else {
+                    $entry.Warn = $true
+                }
+            }
+        }
+        elseif ($entry -and $inWhen -and $line -match "^\s+([^\s:]+):\s*(.*)$") {
+            & $checkCondition $Matches[1] $Matches[2]
+        }
+        elseif ($line -match "^\S") {
+            break
+        }
+    }
+    & $flush
+    return $items.ToArray()
+}
+
 # ==========================================
 # PDF 选项读取函数
 # ==========================================
@@ -625,7 +753,7 @@ function Invoke-Build {
     } else {
         # 没有指定文档类型时，尝试查找第一个可用的配置文件
         $firstConfig = Get-ChildItem -Path $clientDir -Filter "*.yaml" -File 2>$null | 
-            Where-Object { $_.Name -ne "metadata.yaml" } | 
+            Where-Object { $_.Name -ne "metadata.yaml" -and $_.Name -ne "variables.yaml" } | 
             Select-Object -First 1
         if ($firstConfig) {
             $configFile = $firstConfig.FullName
@@ -659,12 +787,21 @@ function Invoke-Build {
     Write-Host "构建文档 - 客户: $ClientConfig [$DocType] $formatLabel" -ForegroundColor Cyan
     Write-Host "==========================================" -ForegroundColor Cyan
     
+    # 配置继承（extends）由 Web 服务解析，命令行只读取配置文件本身
+    $extends = Read-YamlValue -FilePath $configFile -Key "extends"
+    if ($extends) {
+        Write-Host "[警告] 配置继承自 $extends，命令行构建不解析继承，只使用该文件中的字段" -ForegroundColor Yellow
+        Write-Host "       请通过 Web 界面构建以使用完整配置" -ForegroundColor Yellow
+    }
+    
     # 读取配置
     $clientNameValue = Read-YamlValue -FilePath $configFile -Key "client_name"
     $template = Read-YamlValue -FilePath $configFile -Key "template"
     $outputPattern = Read-YamlValue -FilePath $configFile -Key "output_pattern"
-    $modules = Read-YamlList -FilePath $configFile -Key "modules"
+    $modules = Read-YamlModules -FilePath $configFile -Format $OutputFormat
     $pandocArgs = Read-YamlList -FilePath $configFile -Key "pandoc_args"
+    $templateVars = Read-YamlMap -FilePath $configFile -Key "template_variables"
+    $wordOptions = Read-YamlMap -FilePath $configFile -Key "word_options"
     
     # 展开通配符模式（如 src/*.md）
     $expandedModules = @()
@@ -717,6 +854,10 @@ function Invoke-Build {
     # 检查模板（仅 Word 格式需要）
     $templatePath = $null
     if ($OutputFormat -eq "word") {
+        # word_options.reference-doc 优先于 template
+        if ($wordOptions["reference-doc"]) {
+            $template = $wordOptions["reference-doc"]
+        }
         $templatePath = Join-Path $TemplatesDir $template
         if (-not (Test-Path $templatePath)) {
             Write-Host "[警告] 模板不存在: $templatePath" -ForegroundColor Yellow
@@ -731,6 +872,10 @@ function Invoke-Build {
         $modulePath = $module -replace "/", "\"
         if (Test-Path $modulePath) {
             $validModules += $modulePath
+            # {{include}} 只在 Web 服务构建时展开（Web 服务调用脚本前已在临时目录中展开）
+            if ((Get-Content $modulePath -Raw -Encoding UTF8) -match '(^|[^\\])\{\{include\s+"') {
+                Write-Host "[警告] 模块 $modulePath 使用了 {{include}}，命令行构建不展开引用，会原样输出到文档中（请通过 Web 界面构建）" -ForegroundColor Yellow
+            }
         } else {
             Write-Host "[警告] 模块不存在: $modulePath" -ForegroundColor Yellow
         }
@@ -839,6 +984,50 @@ function Invoke-Build {
         if ($templatePath) {
             $pandocCmdArgs += "--reference-doc=$templatePath"
         }
+        
+        # 目录、章节编号和代码高亮：word_options 中设置的选项替换 pandoc_args 中的同类参数
+        $wordToc = $wordOptions["toc"]
+        $wordTocDepth = $wordOptions["toc-depth"]
+        $wordNumberSections = $wordOptions["number-sections"]
+        $wordHighlightStyle = $wordOptions["highlight-style"]
+        $pandocArgs = @($pandocArgs | Where-Object {
+            -not (($wordToc -and $_ -in @("--toc", "--table-of-contents")) -or
+                (($wordToc -or $wordTocDepth) -and $_ -like "--toc-depth=*") -or
+                ($wordNumberSections -and $_ -in @("--number-sections", "-N")) -or
+                ($wordHighlightStyle -and ($_ -like "--highlight-style=*" -or $_ -eq "--no-highlight")))
+        })
+        if ($wordToc -eq "true") {
+            $pandocCmdArgs += "--toc"
+        }
+        if ($wordTocDepth -and $wordToc -ne "false") {
+            $pandocCmdArgs += "--toc-depth=$wordTocDepth"
+        }
+        if ($wordNumberSections -eq "true") {
+            $pandocCmdArgs += "--number-sections"
+        }
+        if ($wordHighlightStyle) {
+            $pandocCmdArgs += "--highlight-style=$wordHighlightStyle"
+        }
+        
+        # 章节分页和图表标题前缀由 Lua 过滤器处理
+        $wordPageBreak = $wordOptions["page-break-before-chapter"] -eq "true"
+        if ($wordPageBreak -or $wordOptions["figure-prefix"] -or $wordOptions["table-prefix"]) {
+            $pandocCmdArgs += "--lua-filter=$(Join-Path $BaseDir 'bin/filters/word-options.lua')"
+            if ($wordPageBreak) {
+                $pandocCmdArgs += "-M", "word-page-break=true"
+            }
+            if ($wordOptions["figure-prefix"]) {
+                $pandocCmdArgs += "-M", "word-figure-prefix=$($wordOptions['figure-prefix'])"
+            }
+            if ($wordOptions["table-prefix"]) {
+                $pandocCmdArgs += "-M", "word-table-prefix=$($wordOptions['table-prefix'])"
+            }
+        }
+        
+        # 表格样式需要修改生成的文档，由 Web 服务在构建后处理
+        if ($wordOptions["table-style"]) {
+            Write-Host "[提示] 表格样式 (word_options.table-style) 在构建完成后由 Web 服务设置（命令行构建不生效）" -ForegroundColor Yellow
+        }
     } else {
         # PDF 格式参数
         $pandocCmdArgs += "--pdf-engine=xelatex"
@@ -901,6 +1090,31 @@ function Invoke-Build {
         }
     }
     
+    # 应用模板变量（PDF 用 -V，Word 用 -M，覆盖 pdf_options 生成的同名参数）
+    if ($templateVars.Count -gt 0) {
+        $varFlag = if ($OutputFormat -eq "pdf") { "-V" } else { "-M" }
+        
+        # 去掉与模板变量同名的默认 -V 参数，避免 Pandoc 把它们合并成列表
+        $filteredArgs = @()
+        for ($i = 0; $i -lt $pandocCmdArgs.Count; $i++) {
+            if ($pandocCmdArgs[$i] -eq "-V" -and ($i + 1) -lt $pandocCmdArgs.Count) {
+                $varName = ($pandocCmdArgs[$i + 1] -split '=', 2)[0]
+                if ($templateVars.Contains($varName)) {
+                    $i++
+                    continue
+                }
+            }
+            $filteredArgs += $pandocCmdArgs[$i]
+        }
+        $pandocCmdArgs = $filteredArgs
+        
+        foreach ($name in $templateVars.Keys) {
+            # 布尔值 false 不传（模板中未定义即为关闭）
+            if ($templateVars[$name] -eq "false") { continue }
+            $pandocCmdArgs += $varFlag, "$name=$($templateVars[$name])"
+        }
+    }
+    
     # 构建 resource-path：包含 src 目录及其所有子目录
     $resourcePaths = @($SrcDir)
     # 添加所有包含 images 目录的子目录
@@ -981,7 +1195,7 @@ if ($BuildAll) {
     
     Get-ChildItem -Path $clientDir -Filter "*.yaml" | ForEach-Object {
         $docName = $_.BaseName
-        if ($docName -ne "metadata") {
+        if ($docName -ne "metadata" -and $docName -ne "variables") {
             if ($docName -eq "config") {
                 Invoke-Build -ClientConfig $Client -DocType "" -CustomClientName $ClientName -OutputFormat $Format -VariableValues $VariableValues
             } else {
@@ -4,6 +4,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // Config 应用配置
@@ -22,8 +23,16 @@ type Config struct {
 	FontsDir string
 	// WorkDir 工作目录（项目根目录）
 	WorkDir string
-	// AdminPassword 管理密码（用于锁定/解锁配置）
+	// UsersFile 用户账号文件路径
+	UsersFile string
+	// TokensFile API 令牌文件路径
+	TokensFile string
+	// AuditFile 审计日志文件路径（追加写入的 JSON Lines）
+	AuditFile string
+	// AdminPassword 首次启动时 admin 账号的密码
 	AdminPassword string
+	// WatchInterval 轮询文件变化的间隔，为 0 时不监视
+	WatchInterval time.Duration
 }
 
 // DefaultConfig 返回默认配置
@@ -37,7 +46,11 @@ func DefaultConfig() *Config {
 		SrcDir:        filepath.Join(workDir, getEnv("SRC_DIR", "src")),
 		FontsDir:      filepath.Join(workDir, getEnv("FONTS_DIR", "fonts")),
 		WorkDir:       workDir,
-		AdminPassword: getEnv("ADMIN_PASSWORD", "admin123"),
+		UsersFile:     getEnv("USERS_FILE", filepath.Join(workDir, ".users.json")),
+		TokensFile:    getEnv("TOKENS_FILE", filepath.Join(workDir, ".tokens.json")),
+		AuditFile:     getEnv("AUDIT_FILE", filepath.Join(workDir, ".audit.log")),
+		AdminPassword: getEnv("ADMIN_PASSWORD", ""),
+		WatchInterval: getDuration("WATCH_INTERVAL", 2*time.Second),
 	}
 }
 
@@ -49,6 +62,22 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getDuration 获取时长类型的环境变量（如 2s、500ms，0 表示关闭），无法解析时返回默认值
+func getDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	if value == "0" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return defaultValue
+	}
+	return d
+}
+
 // getWorkDir 获取工作目录
 func getWorkDir() string {
 	// 优先使用环境变量
@@ -3,8 +3,8 @@ package handler
 
 import (
 	"archive/zip"
-	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -31,6 +31,18 @@ const (
 	ErrDocTypeExists        = "DOC_TYPE_EXISTS"
 	ErrConfigNotFound       = "CONFIG_NOT_FOUND"
 	ErrPresetConfigReadonly = "PRESET_CONFIG_READONLY"
+	ErrConfigInUse          = "CONFIG_IN_USE"
+	ErrConfigInvalid        = "CONFIG_INVALID"
+	ErrTemplateNotFound     = "TEMPLATE_NOT_FOUND"
+	ErrPandocArgsRejected   = "PANDOC_ARGS_REJECTED"
+	ErrUnauthorized         = "UNAUTHORIZED"
+	ErrForbidden            = "FORBIDDEN"
+	ErrUserNotFound         = "USER_NOT_FOUND"
+	ErrUserExists           = "USER_EXISTS"
+	ErrTokenNotFound        = "TOKEN_NOT_FOUND"
+	ErrConfigLocked         = "CONFIG_LOCKED"
+	ErrETagRequired         = "ETAG_REQUIRED"
+	ErrEditConflict         = "EDIT_CONFLICT"
 )
 
 // Response API 响应格式
@@ -48,6 +60,8 @@ type GenerateRequest struct {
 	ClientName    string                 `json:"clientName"`    // 自定义客户名称（可选）
 	Format        string                 `json:"format"`        // 输出格式：word 或 pdf（默认: word）
 	Variables     map[string]interface{} `json:"variables"`     // 变量值（可选）
+	WordOptions   *service.WordOptions   `json:"wordOptions"`   // 覆盖配置中的 Word 输出选项（可选）
+	Release       bool                   `json:"release"`       // 正式版：配置被其他人锁定时拒绝生成
 }
 
 // GeneratedFile 生成的文件信息
@@ -58,25 +72,36 @@ type GeneratedFile struct {
 
 // APIHandler API 处理器
 type APIHandler struct {
-	clientSvc     *service.ClientService
-	docSvc        *service.DocumentService
-	buildSvc      *service.BuildService
-	moduleSvc     *service.ModuleService
-	templateSvc   *service.TemplateService
-	configMgr     *service.ConfigManager
-	variableSvc   *service.VariableService
-	editorSvc     *service.EditorService
-	gitSvc        *service.GitService
-	resourceSvc   *service.ResourceService
-	chatSvc       *service.ChatService
-	srcDir        string
-	adminPassword string
+	clientSvc   *service.ClientService
+	docSvc      *service.DocumentService
+	buildSvc    *service.BuildService
+	moduleSvc   *service.ModuleService
+	templateSvc *service.TemplateService
+	configMgr   *service.ConfigManager
+	variableSvc *service.VariableService
+	editorSvc   *service.EditorService
+	gitSvc      *service.GitService
+	resourceSvc *service.ResourceService
+	chatSvc     *service.ChatService
+	overrideSvc *service.OverrideService
+	userSvc     *service.UserService
+	tokenSvc    *service.TokenService
+	auditSvc    *service.AuditService
+	presenceSvc *service.PresenceService
+	watcher     *service.FileWatcher
+	trashSvc    *service.TrashService
+	srcDir      string
+
+	// 生成的文件所属的客户（用于限制按客户授权的用户下载）
+	outputsMu sync.Mutex
+	outputs   map[string]string
 }
 
 // NewAPIHandler 创建 API 处理器实例
-func NewAPIHandler(clientSvc *service.ClientService, docSvc *service.DocumentService, buildSvc *service.BuildService, moduleSvc *service.ModuleService, templateSvc *service.TemplateService, configMgr *service.ConfigManager, editorSvc *service.EditorService, srcDir string, adminPassword string, fontsDir string, templatesDir string, clientsDir string, cfg *config.Config) *APIHandler {
-	// 创建变量服务
+func NewAPIHandler(clientSvc *service.ClientService, docSvc *service.DocumentService, buildSvc *service.BuildService, moduleSvc *service.ModuleService, templateSvc *service.TemplateService, configMgr *service.ConfigManager, editorSvc *service.EditorService, srcDir string, fontsDir string, templatesDir string, clientsDir string, cfg *config.Config, userSvc *service.UserService, tokenSvc *service.TokenService, auditSvc *service.AuditService, watcher *service.FileWatcher, trashSvc *service.TrashService) *APIHandler {
+	// 创建变量服务（重命名变量与编辑器保存使用同一把锁）
 	variableSvc := service.NewVariableService(srcDir)
+	variableSvc.SetSaveLock(editorSvc.SaveLock())
 
 	// 创建 Git 服务（工作目录为 srcDir 的父目录，即项目根目录）
 	workDir := filepath.Dir(srcDir)
@@ -86,6 +111,11 @@ func NewAPIHandler(clientSvc *service.ClientService, docSvc *service.DocumentSer
 	// 创建资源服务
 	resourceSvc := service.NewResourceService(fontsDir, templatesDir, clientsDir)
 
+	// 删除的模块、图片、配置、字体和模板移入回收站
+	editorSvc.SetTrash(trashSvc)
+	configMgr.SetTrash(trashSvc)
+	resourceSvc.SetTrash(trashSvc)
+
 	// 创建聊天服务
 	chatSvc := service.NewChatService(cfg)
 
@@ -96,37 +126,72 @@ func NewAPIHandler(clientSvc *service.ClientService, docSvc *service.DocumentSer
 		log.Printf("[APIHandler] Git 不可用: %v", err)
 	}
 
-	return &APIHandler{
-		clientSvc:     clientSvc,
-		docSvc:        docSvc,
-		buildSvc:      buildSvc,
-		moduleSvc:     moduleSvc,
-		templateSvc:   templateSvc,
-		configMgr:     configMgr,
-		variableSvc:   variableSvc,
-		editorSvc:     editorSvc,
-		gitSvc:        gitSvc,
-		resourceSvc:   resourceSvc,
-		chatSvc:       chatSvc,
-		srcDir:        srcDir,
-		adminPassword: adminPassword,
-	}
+	h := &APIHandler{
+		clientSvc:   clientSvc,
+		docSvc:      docSvc,
+		buildSvc:    buildSvc,
+		moduleSvc:   moduleSvc,
+		templateSvc: templateSvc,
+		configMgr:   configMgr,
+		variableSvc: variableSvc,
+		editorSvc:   editorSvc,
+		gitSvc:      gitSvc,
+		resourceSvc: resourceSvc,
+		chatSvc:     chatSvc,
+		overrideSvc: service.NewOverrideService(workDir, clientsDir),
+		userSvc:     userSvc,
+		tokenSvc:    tokenSvc,
+		auditSvc:    auditSvc,
+		presenceSvc: service.NewPresenceService(),
+		srcDir:      srcDir,
+		outputs:     make(map[string]string),
+	}
+
+	// 订阅文件变化：释放已删除模块的编辑锁，并更新 RAG 索引（界面通过 /api/watch/stream 订阅）
+	watcher.Subscribe("presence", h.releaseDeletedLocks)
+	watcher.Subscribe("rag", h.chatSvc.RAGSvc.FilesChanged)
+	h.watcher = watcher
+	h.trashSvc = trashSvc
+	return h
 }
 
 // RegisterRoutes 注册路由
+// 除 /api/auth/login 外都需要登录（或 API 令牌），用 RequireAuth 包装后生效
 func (h *APIHandler) RegisterRoutes(mux *http.ServeMux) {
+	// 登录和用户管理
+	mux.HandleFunc("/api/auth/login", h.handleAuthLogin)
+	mux.HandleFunc("/api/auth/logout", h.handleAuthLogout)
+	mux.HandleFunc("/api/auth/me", h.handleAuthMe)
+	mux.HandleFunc("/api/auth/password", h.handleAuthPassword)
+	mux.HandleFunc("/api/users", h.handleUsers)
+	mux.HandleFunc("/api/users/", h.handleUserDetail)
+	mux.HandleFunc("/api/tokens", h.handleTokens)
+	mux.HandleFunc("/api/tokens/", h.handleTokenDetail)
+	mux.HandleFunc("/api/audit", h.handleAudit)
+	mux.HandleFunc("/api/watch/stream", h.handleWatchStream)
+	mux.HandleFunc("/api/trash", h.handleTrash)
+	mux.HandleFunc("/api/trash/", h.handleTrashItem)
 	mux.HandleFunc("/api/clients", h.handleClients)
 	mux.HandleFunc("/api/clients/", h.handleClientDocs)
 	mux.HandleFunc("/api/generate", h.handleGenerate)
 	mux.HandleFunc("/api/download/", h.handleDownload)
 	mux.HandleFunc("/api/download-zip", h.handleDownloadZip)
+	mux.HandleFunc("/api/generate/batch", h.handleGenerateBatch)
 	// 新增：自定义配置相关路由
 	mux.HandleFunc("/api/modules", h.handleModules)
 	mux.HandleFunc("/api/templates", h.handleTemplates)
+	mux.HandleFunc("/api/template-variables", h.handleTemplateVariables)
+	mux.HandleFunc("/api/template-variables/", h.handleTemplateVariables)
 	mux.HandleFunc("/api/configs", h.handleConfigs)
 	mux.HandleFunc("/api/configs/", h.handleConfigDetail)
+	mux.HandleFunc("/api/schema/config", h.handleConfigSchema)
 	// 新增：变量模板相关路由
 	mux.HandleFunc("/api/variables", h.handleVariables)
+	mux.HandleFunc("/api/variables/lint", h.handleVariablesLint)
+	mux.HandleFunc("/api/variables/rename", h.handleVariablesRename)
+	mux.HandleFunc("/api/overrides/", h.handleClientOverrides)
+	mux.HandleFunc("/api/upstream", h.handleUpstreamList)
+	mux.HandleFunc("/api/upstream/", h.handleUpstream)
 	// 新增：客户锁定相关路由
 	mux.HandleFunc("/api/lock/", h.handleClientLock)
 	// 新建编辑器相关路由
@@ -138,6 +203,9 @@ func (h *APIHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/editor/image/", h.handleEditorImage)                       // 图片删除路由
 	mux.HandleFunc("/api/editor/attachments", h.handleEditorAttachments)            // 附件列表路由
 	mux.HandleFunc("/api/editor/attachment/rename", h.handleEditorAttachmentRename) // 附件重命名路由
+	mux.HandleFunc("/api/editor/presence", h.handlePresence)                        // 在线状态
+	mux.HandleFunc("/api/editor/presence/stream", h.handlePresenceStream)           // 在线状态和模块变更推送
+	mux.HandleFunc("/api/editor/edit-lock", h.handleEditLock)                       // 编辑锁
 	mux.HandleFunc("/api/src/", h.handleSrcStatic)
 	// 新增：Git 相关路由
 	mux.HandleFunc("/api/git/check", h.handleGitCheck)
@@ -192,6 +260,15 @@ func (h *APIHandler) listClients(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 按客户授权的用户只能看到自己的客户
+	visible := clients[:0]
+	for _, client := range clients {
+		if canAccessClient(r, client.Name) {
+			visible = append(visible, client)
+		}
+	}
+	clients = visible
+
 	h.successResponse(w, map[string]interface{}{
 		"clients": clients,
 	})
@@ -276,12 +353,41 @@ func (h *APIHandler) handleGenerate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	auditTarget(r, req.ClientConfig+"/"+strings.Join(req.DocumentTypes, ","), nil)
+	if h.clientForbidden(w, r, req.ClientConfig) {
+		return
+	}
+
 	// 检查客户是否存在
 	if !h.clientSvc.ClientExists(req.ClientConfig) {
 		h.errorResponse(w, http.StatusNotFound, "客户配置不存在", ErrClientNotFound)
 		return
 	}
 
+	// 请求中的 Word 选项与配置中的选项使用相同的校验规则
+	for _, docType := range req.DocumentTypes {
+		err := h.buildSvc.ValidateWordOptions(service.BuildRequest{
+			ClientName:   req.ClientConfig,
+			DocumentType: docType,
+			WordOptions:  req.WordOptions,
+		})
+		if h.configInvalidResponse(w, err) {
+			return
+		}
+		if err != nil {
+			h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+			return
+		}
+	}
+
+	if req.Release {
+		for _, docType := range req.DocumentTypes {
+			if h.configLocked(w, r, req.ClientConfig, docType) {
+				return
+			}
+		}
+	}
+
 	// 批量生成文档
 	var files []GeneratedFile
 	var errors []string
@@ -299,21 +405,14 @@ func (h *APIHandler) handleGenerate(w http.ResponseWriter, r *http.Request) {
 		go func(dt string) {
 			defer wg.Done()
 
-			// 获取变量值：优先使用请求中的变量，否则从配置中读取
-			variables := req.Variables
-			if len(variables) == 0 {
-				// 尝试从配置中读取变量
-				if cfg, err := h.configMgr.GetConfig(req.ClientConfig, dt); err == nil && cfg != nil {
-					variables = cfg.Variables
-				}
-			}
-
+			// 请求中的变量值优先级最高，全局、客户和文档类型的变量值由构建服务合并
 			buildReq := service.BuildRequest{
 				ClientName:   req.ClientConfig,
 				DocumentType: dt,
 				CustomName:   req.ClientName,
 				Format:       format,
-				Variables:    variables,
+				Variables:    req.Variables,
+				WordOptions:  req.WordOptions,
 			}
 
 			result, err := h.buildSvc.Build(buildReq)
@@ -336,10 +435,16 @@ func (h *APIHandler) handleGenerate(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+			h.recordOutput(result.FileName, req.ClientConfig)
 			files = append(files, GeneratedFile{
 				FileName:    result.FileName,
 				DownloadURL: "/api/download/" + url.PathEscape(result.FileName),
 			})
+			for _, issue := range result.LintIssues {
+				if issue.Severity == service.LintSeverityError {
+					errors = append(errors, dt+": "+issue.String())
+				}
+			}
 		}(docType)
 	}
 
@@ -350,6 +455,21 @@ func (h *APIHandler) handleGenerate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	outputs := make([]string, 0, len(files))
+	fileNames := make([]string, 0, len(files))
+	for _, file := range files {
+		if outputPath, err := h.buildSvc.GetBuildOutput(file.FileName); err == nil {
+			outputs = append(outputs, outputPath)
+		}
+		fileNames = append(fileNames, file.FileName)
+	}
+	auditState(r, filesState(outputs))
+	if req.Release {
+		auditDetail(r, "正式版: %s", strings.Join(fileNames, ", "))
+	} else {
+		auditDetail(r, "%s", strings.Join(fileNames, ", "))
+	}
+
 	response := map[string]interface{}{
 		"files": files,
 	}
@@ -360,6 +480,98 @@ func (h *APIHandler) handleGenerate(w http.ResponseWriter, r *http.Request) {
 	h.successResponse(w, response)
 }
 
+// handleGenerateBatch 处理批量生成请求（邮件合并）
+// multipart 表单: file（CSV/XLSX，列名对应变量名）、clientConfig、documentType、format、nameColumn
+func (h *APIHandler) handleGenerateBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	// 限制上传大小（数据文件加表单字段）
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxBatchFileSize+64<<10)
+	if err := r.ParseMultipartForm(service.MaxBatchFileSize); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			h.errorResponse(w, http.StatusBadRequest, "数据文件过大（最大 5MB）", ErrFileTooLarge)
+			return
+		}
+		h.errorResponse(w, http.StatusBadRequest, "请求过大或格式错误", ErrInvalidInput)
+		return
+	}
+
+	req := service.BatchBuildRequest{
+		ClientName:   r.FormValue("clientConfig"),
+		DocumentType: r.FormValue("documentType"),
+		Format:       r.FormValue("format"),
+		NameColumn:   strings.TrimSpace(r.FormValue("nameColumn")),
+	}
+	if req.ClientName == "" || req.DocumentType == "" {
+		h.errorResponse(w, http.StatusBadRequest, "客户配置和文档类型不能为空", ErrInvalidInput)
+		return
+	}
+	auditTarget(r, req.ClientName+"/"+req.DocumentType, nil)
+	if h.clientForbidden(w, r, req.ClientName) {
+		return
+	}
+	if !h.clientSvc.ClientExists(req.ClientName) {
+		h.errorResponse(w, http.StatusNotFound, "客户配置不存在", ErrClientNotFound)
+		return
+	}
+	release := r.FormValue("release") == "true"
+	if release && h.configLocked(w, r, req.ClientName, req.DocumentType) {
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "请上传 CSV 或 XLSX 数据文件", ErrInvalidInput)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "读取上传文件失败", ErrInvalidInput)
+		return
+	}
+
+	table, err := service.ParseBatchTable(header.Filename, data)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, err.Error(), ErrInvalidInput)
+		return
+	}
+
+	result, err := h.buildSvc.BatchBuild(req, table)
+	if err != nil {
+		if strings.Contains(err.Error(), "不存在") {
+			h.errorResponse(w, http.StatusNotFound, err.Error(), ErrConfigNotFound)
+		} else {
+			h.errorResponse(w, http.StatusBadRequest, err.Error(), ErrInvalidInput)
+		}
+		return
+	}
+
+	response := map[string]interface{}{
+		"report": result,
+	}
+	if result.ZipFileName != "" {
+		if outputPath, err := h.buildSvc.GetBuildOutput(result.ZipFileName); err == nil {
+			auditState(r, fileState(outputPath))
+		}
+		if release {
+			auditDetail(r, "正式版: %s", result.ZipFileName)
+		} else {
+			auditDetail(r, "%s", result.ZipFileName)
+		}
+		h.recordOutput(result.ZipFileName, req.ClientName)
+		response["fileName"] = result.ZipFileName
+		response["downloadUrl"] = "/api/download/" + url.PathEscape(result.ZipFileName)
+	}
+
+	h.successResponse(w, response)
+}
+
 // handleDownload 处理文件下载请求
 func (h *APIHandler) handleDownload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -380,6 +592,11 @@ func (h *APIHandler) handleDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.canDownload(r, fileName) {
+		h.errorResponse(w, http.StatusForbidden, "无权下载该文件", ErrForbidden)
+		return
+	}
+
 	// 获取文件路径
 	filePath, err := h.buildSvc.GetBuildOutput(fileName)
 	if err != nil {
@@ -436,6 +653,8 @@ func GetContentType(fileName string) string {
 		return "application/msword"
 	case ".pdf":
 		return "application/pdf"
+	case ".zip":
+		return "application/zip"
 	default:
 		return "application/octet-stream"
 	}
@@ -473,6 +692,9 @@ func (h *APIHandler) handleDownloadZip(w http.ResponseWriter, r *http.Request) {
 	defer zipWriter.Close()
 
 	for _, fileName := range req.Files {
+		if !h.canDownload(r, fileName) {
+			continue
+		}
 		filePath, err := h.buildSvc.GetBuildOutput(fileName)
 		if err != nil {
 			continue
@@ -500,11 +722,16 @@ type CreateConfigRequest struct {
 	DocTypeName   string                  `json:"docTypeName"`
 	DisplayName   string                  `json:"displayName"`
 	Template      string                  `json:"template"`
-	Modules       []string                `json:"modules"`
+	Modules       []service.ModuleEntry   `json:"modules"`
 	PandocArgs    []string                `json:"pandocArgs"`
 	OutputPattern string                  `json:"outputPattern"`
 	PdfOptions    *service.PdfOptions     `json:"pdfOptions,omitempty"`
+	WordOptions   *service.WordOptions    `json:"wordOptions,omitempty"`
+	Extends       string                  `json:"extends,omitempty"`
+	Upstream      string                  `json:"upstream,omitempty"` // 从标准配置复制（如 标准文档/运维手册），记录来源以便之后同步
 	Variables     map[string]interface{}  `json:"variables,omitempty"`
+	TemplateVars  map[string]interface{}  `json:"templateVariables,omitempty"` // 传给输出模板的变量，可用变量见 /api/template-variables
+	ApproveArgs   bool                    `json:"approvePandocArgs,omitempty"` // 确认保存不在允许列表中的 pandoc_args（需要 admin 角色）
 	Metadata      *service.MetadataConfig `json:"metadata,omitempty"`
 }
 
@@ -549,6 +776,31 @@ func (h *APIHandler) handleTemplates(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleTemplateVariables 返回输出模板的变量目录
+// GET /api/template-variables            所有模板
+// GET /api/template-variables/{template} 指定模板（eisvogel、docx，也可以用输出格式 pdf、word）
+func (h *APIHandler) handleTemplateVariables(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/template-variables"), "/")
+	if name == "" {
+		h.successResponse(w, map[string]interface{}{
+			"catalogs": service.TemplateCatalogs(),
+		})
+		return
+	}
+
+	catalog, ok := service.FindTemplateCatalog(name)
+	if !ok {
+		h.errorResponse(w, http.StatusNotFound, "未知的输出模板: "+name, ErrTemplateNotFound)
+		return
+	}
+	h.successResponse(w, catalog)
+}
+
 // handleConfigs 处理配置创建请求
 func (h *APIHandler) handleConfigs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -571,8 +823,25 @@ func (h *APIHandler) handleConfigs(w http.ResponseWriter, r *http.Request) {
 		PandocArgs:    req.PandocArgs,
 		OutputPattern: req.OutputPattern,
 		PdfOptions:    req.PdfOptions,
+		WordOptions:   req.WordOptions,
 		Variables:     req.Variables,
+		TemplateVars:  req.TemplateVars,
 		Metadata:      req.Metadata,
+		Extends:       req.Extends,
+		Upstream:      req.Upstream,
+	}
+	auditTarget(r, config.ClientName+"/"+config.DocTypeName, fileState(h.configMgr.ConfigPath(config.ClientName, config.DocTypeName)))
+	if h.clientForbidden(w, r, config.ClientName) ||
+		(config.Extends != "" && h.clientForbidden(w, r, referencedClient(config.ClientName, config.Extends, true))) ||
+		(config.Upstream != "" && h.clientForbidden(w, r, referencedClient(config.ClientName, config.Upstream, false))) {
+		return
+	}
+	if h.configLocked(w, r, config.ClientName, "") {
+		return
+	}
+	var ok bool
+	if config.ApprovedBy, ok = h.verifyAdminApproval(w, r, req.ApproveArgs); !ok {
+		return
 	}
 
 	if config.DisplayName == "" {
@@ -582,9 +851,11 @@ func (h *APIHandler) handleConfigs(w http.ResponseWriter, r *http.Request) {
 	if err := h.configMgr.CreateConfig(config); err != nil {
 		// 根据错误类型返回不同的状态码
 		errMsg := err.Error()
-		if strings.Contains(errMsg, "已存在") {
+		if h.configInvalidResponse(w, err) || h.pandocArgsRejectedResponse(w, err) {
+			return
+		} else if strings.Contains(errMsg, "已存在") {
 			h.errorResponse(w, http.StatusConflict, errMsg, ErrDocTypeExists)
-		} else if strings.Contains(errMsg, "不能为空") || strings.Contains(errMsg, "非法字符") || strings.Contains(errMsg, "至少选择") {
+		} else if strings.Contains(errMsg, "不能为空") || strings.Contains(errMsg, "非法字符") || strings.Contains(errMsg, "至少选择") || strings.Contains(errMsg, "继承") || strings.Contains(errMsg, "extends") || strings.Contains(errMsg, "标准配置") {
 			h.errorResponse(w, http.StatusBadRequest, errMsg, ErrInvalidInput)
 		} else if strings.Contains(errMsg, "预置") {
 			h.errorResponse(w, http.StatusForbidden, errMsg, ErrPresetConfigReadonly)
@@ -593,6 +864,7 @@ func (h *APIHandler) handleConfigs(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	h.auditPandocApproval(r, config.ClientName, config.DocTypeName, config.ApprovedBy)
 
 	h.successResponse(w, map[string]interface{}{
 		"message": "配置创建成功",
@@ -624,13 +896,33 @@ func (h *APIHandler) handleConfigDetail(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// 子资源: /api/configs/{client}/{docType}/validate
+	if len(parts) == 3 && parts[2] == "validate" {
+		h.validateConfig(w, r, clientName, docTypeName)
+		return
+	}
+
+	// 子资源: /api/configs/{client}/{docType}/variables/effective
+	if len(parts) == 4 && parts[2] == "variables" && parts[3] == "effective" {
+		h.getEffectiveVariables(w, r, clientName, docTypeName)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		h.getConfig(w, clientName, docTypeName)
 	case http.MethodPut:
+		auditTarget(r, clientName+"/"+docTypeName, fileState(h.configMgr.ConfigPath(clientName, docTypeName)))
+		if h.configLocked(w, r, clientName, docTypeName) {
+			return
+		}
 		h.updateConfig(w, r, clientName, docTypeName)
 	case http.MethodDelete:
-		h.deleteConfig(w, clientName, docTypeName)
+		auditTarget(r, clientName+"/"+docTypeName, fileState(h.configMgr.ConfigPath(clientName, docTypeName)))
+		if h.configLocked(w, r, clientName, docTypeName) {
+			return
+		}
+		h.deleteConfig(w, r, clientName, docTypeName)
 	default:
 		h.methodNotAllowed(w)
 	}
@@ -671,16 +963,31 @@ func (h *APIHandler) updateConfig(w http.ResponseWriter, r *http.Request, client
 		PandocArgs:    req.PandocArgs,
 		OutputPattern: req.OutputPattern,
 		PdfOptions:    req.PdfOptions,
+		WordOptions:   req.WordOptions,
 		Variables:     req.Variables,
+		TemplateVars:  req.TemplateVars,
 		Metadata:      req.Metadata,
+		Extends:       req.Extends,
+	}
+	if config.Extends != "" && h.clientForbidden(w, r, referencedClient(clientName, config.Extends, true)) {
+		return
+	}
+	var ok bool
+	if config.ApprovedBy, ok = h.verifyAdminApproval(w, r, req.ApproveArgs); !ok {
+		return
 	}
 
-	if err := h.configMgr.UpdateConfig(clientName, docTypeName, config); err != nil {
+	diff, err := h.configMgr.UpdateConfig(clientName, docTypeName, config)
+	if err != nil {
 		errMsg := err.Error()
-		if strings.Contains(errMsg, "不存在") {
+		if h.configInvalidResponse(w, err) || h.pandocArgsRejectedResponse(w, err) {
+			return
+		} else if strings.Contains(errMsg, "继承") || strings.Contains(errMsg, "extends") {
+			h.errorResponse(w, http.StatusBadRequest, errMsg, ErrInvalidInput)
+		} else if strings.Contains(errMsg, "不存在") {
 			h.errorResponse(w, http.StatusNotFound, errMsg, ErrConfigNotFound)
 		} else if strings.Contains(errMsg, "已锁定") {
-			h.errorResponse(w, http.StatusForbidden, errMsg, "CONFIG_LOCKED")
+			h.errorResponse(w, http.StatusForbidden, errMsg, ErrConfigLocked)
 		} else if strings.Contains(errMsg, "不能为空") || strings.Contains(errMsg, "至少选择") {
 			h.errorResponse(w, http.StatusBadRequest, errMsg, ErrInvalidInput)
 		} else {
@@ -688,29 +995,204 @@ func (h *APIHandler) updateConfig(w http.ResponseWriter, r *http.Request, client
 		}
 		return
 	}
+	h.auditPandocApproval(r, clientName, docTypeName, config.ApprovedBy)
 
 	h.successResponse(w, map[string]interface{}{
 		"message": "配置更新成功",
+		"diff":    diff, // 配置文件的变更（统一 diff 格式），没有变化时为空
 	})
 }
 
+// configInvalidResponse 配置未通过 Schema 校验时返回 400 和逐项错误，已处理时返回 true
+func (h *APIHandler) configInvalidResponse(w http.ResponseWriter, err error) bool {
+	var validationErr *service.ConfigValidationError
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(Response{
+		Success: false,
+		Data:    map[string]interface{}{"errors": validationErr.Errors},
+		Error:   validationErr.Error(),
+		Code:    ErrConfigInvalid,
+	}); err != nil {
+		log.Printf("[API] JSON 编码失败: %v", err)
+	}
+	return true
+}
+
+// pandocArgsRejectedResponse pandoc_args 中有不在允许列表中的参数时返回 403 和逐项原因，已处理时返回 true
+// 管理员可以在请求中附带 approvePandocArgs: true 确认保存
+func (h *APIHandler) pandocArgsRejectedResponse(w http.ResponseWriter, err error) bool {
+	var argsErr *service.PandocArgsError
+	if !errors.As(err, &argsErr) {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	if err := json.NewEncoder(w).Encode(Response{
+		Success: false,
+		Data:    map[string]interface{}{"errors": argsErr.Errors, "adminRequired": true},
+		Error:   argsErr.Error(),
+		Code:    ErrPandocArgsRejected,
+	}); err != nil {
+		log.Printf("[API] JSON 编码失败: %v", err)
+	}
+	return true
+}
+
+// verifyAdminApproval 检查确认 Pandoc 参数的请求者是否为管理员，返回记录为确认人的用户名
+// 未请求确认时返回空字符串；不是 admin 角色（或令牌没有 admin 权限）时返回 403 且 ok 为 false
+func (h *APIHandler) verifyAdminApproval(w http.ResponseWriter, r *http.Request, approve bool) (approvedBy string, ok bool) {
+	if !approve {
+		return "", true
+	}
+	user := currentUser(r)
+	if !user.Role.Allows(service.RoleAdmin) {
+		h.errorResponse(w, http.StatusForbidden, "权限不足：确认 Pandoc 参数需要 admin 角色", ErrForbidden)
+		return "", false
+	}
+	if token := currentToken(r); token != nil && !token.HasScope(service.ScopeAdmin) {
+		h.errorResponse(w, http.StatusForbidden, "API 令牌权限不足：需要 admin", ErrForbidden)
+		return "", false
+	}
+	return user.Username, true
+}
+
+// auditPandocApproval 在审计记录中写明确认 Pandoc 参数的管理员和保存后配置中不在允许列表中的参数
+func (h *APIHandler) auditPandocApproval(r *http.Request, clientName, docTypeName, approvedBy string) {
+	if approvedBy == "" {
+		return
+	}
+	cfg, err := h.configMgr.GetConfig(clientName, docTypeName)
+	if err != nil {
+		return
+	}
+	var args []string
+	for _, e := range service.ValidatePandocArgs(cfg.PandocArgs) {
+		args = append(args, e.Arg)
+	}
+	if len(args) > 0 {
+		auditDetail(r, "管理员 %s 确认 Pandoc 参数: %s", approvedBy, strings.Join(args, ", "))
+	}
+}
+
+// validateConfig 按 Schema 校验配置文件（包括继承链），用于检查手工编辑的 YAML
+// GET /api/configs/{client}/{docType}/validate
+func (h *APIHandler) validateConfig(w http.ResponseWriter, r *http.Request, clientName, docTypeName string) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+	errs, err := h.configMgr.ValidateConfigFile(clientName, docTypeName)
+	if err != nil {
+		if strings.Contains(err.Error(), "不存在") {
+			h.errorResponse(w, http.StatusNotFound, err.Error(), ErrConfigNotFound)
+		} else {
+			h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+		}
+		return
+	}
+	if errs == nil {
+		errs = []service.ConfigSchemaError{}
+	}
+	h.successResponse(w, map[string]interface{}{
+		"valid":  len(errs) == 0,
+		"errors": errs,
+	})
+}
+
+// handleConfigSchema 返回客户文档配置的 JSON Schema
+// GET /api/schema/config（编辑器可通过 # yaml-language-server: $schema=... 引用）
+func (h *APIHandler) handleConfigSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json; charset=utf-8")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(service.ConfigSchema()); err != nil {
+		log.Printf("[API] JSON 编码失败: %v", err)
+	}
+}
+
 // deleteConfig 删除配置
-func (h *APIHandler) deleteConfig(w http.ResponseWriter, clientName, docTypeName string) {
-	if err := h.configMgr.DeleteConfig(clientName, docTypeName); err != nil {
+func (h *APIHandler) deleteConfig(w http.ResponseWriter, r *http.Request, clientName, docTypeName string) {
+	item, err := h.configMgr.DeleteConfig(clientName, docTypeName, currentUser(r).Username)
+	if err != nil {
 		errMsg := err.Error()
 		if strings.Contains(errMsg, "不存在") {
 			h.errorResponse(w, http.StatusNotFound, errMsg, ErrConfigNotFound)
 		} else if strings.Contains(errMsg, "预置") {
 			h.errorResponse(w, http.StatusForbidden, errMsg, ErrPresetConfigReadonly)
+		} else if strings.Contains(errMsg, "继承") {
+			h.errorResponse(w, http.StatusConflict, errMsg, ErrConfigInUse)
 		} else {
 			h.errorResponse(w, http.StatusInternalServerError, errMsg, "")
 		}
 		return
 	}
 
-	h.successResponse(w, map[string]interface{}{
-		"message": "配置删除成功",
-	})
+	h.successResponse(w, trashedResponse(r, "配置删除成功", item))
+}
+
+// getEffectiveVariables 获取配置中每个变量的最终值及来源
+// GET 只使用配置文件中的值；POST 可以在 body 中传入请求覆盖值 {"variables": {...}}
+// 配置中有条件模块时，可以用 ?format=pdf 指定输出格式
+func (h *APIHandler) getEffectiveVariables(w http.ResponseWriter, r *http.Request, clientName, docTypeName string) {
+	var requestValues map[string]interface{}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			h.errorResponse(w, http.StatusBadRequest, "无效的请求格式", ErrInvalidInput)
+			return
+		}
+		requestValues = req.Variables
+	default:
+		h.methodNotAllowed(w)
+		return
+	}
+
+	config, err := h.configMgr.GetConfig(clientName, docTypeName)
+	if err != nil {
+		if strings.Contains(err.Error(), "不存在") {
+			h.errorResponse(w, http.StatusNotFound, err.Error(), ErrConfigNotFound)
+		} else {
+			h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+		}
+		return
+	}
+
+	sources, err := h.variableSvc.LoadSources(clientName, config.Variables, requestValues)
+	if err != nil {
+		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	// 条件模块按 ?format= 指定的输出格式（默认 word）和变量值筛选
+	modules := service.ModulePaths(config.Modules)
+	if service.HasConditionalModules(config.Modules) {
+		ctx := h.variableSvc.NewModuleContext(clientName, docTypeName, r.URL.Query().Get("format"), config.Modules, sources.Merge())
+		modules, err = service.SelectModules(config.Modules, ctx)
+		if err != nil {
+			h.errorResponse(w, http.StatusBadRequest, err.Error(), ErrInvalidInput)
+			return
+		}
+	}
+
+	effective, err := h.variableSvc.TraceValues(clientName, docTypeName, h.overrideSvc.ResolveModules(clientName, modules), sources)
+	if err != nil {
+		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	h.successResponse(w, effective)
 }
 
 // VariablesRequest 变量提取请求
@@ -778,69 +1260,369 @@ func (h *APIHandler) extractVariables(w http.ResponseWriter, modules []string) {
 	h.successResponse(w, response)
 }
 
-// handleClientLock 处理客户锁定/解锁请求
-func (h *APIHandler) handleClientLock(w http.ResponseWriter, r *http.Request) {
-	// 解析路径: /api/lock/{clientName}
-	clientName := strings.TrimPrefix(r.URL.Path, "/api/lock/")
-	clientName, err := url.PathUnescape(clientName)
+// handleVariablesLint 检查模块的变量使用情况
+// 不带参数时检查整个 src 目录；?modules=a.md,b.md 只检查指定模块
+func (h *APIHandler) handleVariablesLint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	var result *service.LintResult
+	var err error
+	if modulesParam := r.URL.Query().Get("modules"); modulesParam != "" {
+		result, err = h.variableSvc.LintModules(strings.Split(modulesParam, ","))
+	} else {
+		result, err = h.variableSvc.LintSrc()
+	}
+	if err != nil {
+		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	h.successResponse(w, result)
+}
+
+// handleVariablesRename 在所有模块和配置中重命名变量
+// dryRun 为 true 时只返回修改清单；涉及已锁定客户的配置时拒绝执行
+func (h *APIHandler) handleVariablesRename(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	var req struct {
+		OldName string `json:"oldName"`
+		NewName string `json:"newName"`
+		DryRun  bool   `json:"dryRun"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "无效的请求格式", ErrInvalidInput)
+		return
+	}
+
+	preview, err := h.variableSvc.RenameVariable(req.OldName, req.NewName, true)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, err.Error(), ErrInvalidInput)
+		return
+	}
+	if req.DryRun {
+		auditSkip(r)
+		h.successResponse(w, preview)
+		return
+	}
+
+	changed := make([]string, len(preview.Files))
+	for i, file := range preview.Files {
+		changed[i] = h.workFile(file)
+	}
+	auditTarget(r, req.OldName+" -> "+req.NewName, filesState(changed))
+	auditDetail(r, "修改 %d 个文件: %s", len(preview.Files), strings.Join(preview.Files, ", "))
+
+	for _, file := range preview.Files {
+		if h.fileLocked(w, r, file) {
+			return
+		}
+	}
+
+	result, err := h.variableSvc.RenameVariable(req.OldName, req.NewName, false)
+	if err != nil {
+		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	h.successResponse(w, result)
+}
+
+// handleClientOverrides 列出客户覆盖的模块及其与基础模块的差异
+// 路径: /api/overrides/{clientName}，?diff=false 时不返回差异内容
+func (h *APIHandler) handleClientOverrides(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	clientName, err := url.PathUnescape(strings.TrimPrefix(r.URL.Path, "/api/overrides/"))
 	if err != nil || clientName == "" {
 		h.errorResponse(w, http.StatusBadRequest, "无效的客户名称", ErrInvalidInput)
 		return
 	}
+	if !h.clientSvc.ClientExists(clientName) {
+		h.errorResponse(w, http.StatusNotFound, "客户配置不存在", ErrClientNotFound)
+		return
+	}
 
-	switch r.Method {
-	case http.MethodGet:
-		// 获取锁定状态
-		locked := h.configMgr.IsClientLocked(clientName)
-		h.successResponse(w, map[string]interface{}{
-			"clientName": clientName,
-			"locked":     locked,
-		})
-	case http.MethodPost:
-		// 锁定客户 - 需要验证密码
-		var req struct {
-			Password string `json:"password"`
+	overrides, err := h.overrideSvc.ListOverrides(clientName, r.URL.Query().Get("diff") != "false")
+	if err != nil {
+		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	h.successResponse(w, map[string]interface{}{
+		"clientName":  clientName,
+		"overrideDir": "clients/" + clientName + "/overrides/src",
+		"overrides":   overrides,
+	})
+}
+
+// handleUpstreamList 列出所有记录了来源的客户配置，以及它们是否落后于标准配置
+// GET /api/upstream?outdated=true 只返回有未拉取变更的配置
+func (h *APIHandler) handleUpstreamList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	drifts, err := h.configMgr.ListUpstreamDrift()
+	if err != nil {
+		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	outdatedOnly := r.URL.Query().Get("outdated") == "true"
+	visible := []service.ConfigDrift{}
+	for _, drift := range drifts {
+		if (drift.Outdated || !outdatedOnly) && canAccessClient(r, drift.Client) {
+			visible = append(visible, drift)
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	}
+	drifts = visible
+
+	h.successResponse(w, map[string]interface{}{
+		"configs": drifts,
+	})
+}
+
+// UpstreamPullRequest 拉取标准配置变更请求
+type UpstreamPullRequest struct {
+	Changes []string `json:"changes"` // 变更 ID，为空时拉取全部
+}
+
+// handleUpstream 处理单个配置的来源同步请求
+// GET    /api/upstream/{client}/{docType}       查看与标准配置的差异
+// PUT    /api/upstream/{client}/{docType}       记录来源 {"source": "标准文档/运维手册"}（以标准配置当前内容为基线）
+// POST   /api/upstream/{client}/{docType}/pull  拉取选中的变更 {"changes": ["module+:src/05-备份.md"]}
+func (h *APIHandler) handleUpstream(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/upstream/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && parts[2] != "pull") {
+		h.errorResponse(w, http.StatusBadRequest, "无效的请求路径", ErrInvalidInput)
+		return
+	}
+	clientName, err1 := url.PathUnescape(parts[0])
+	docTypeName, err2 := url.PathUnescape(parts[1])
+	if err1 != nil || err2 != nil || clientName == "" || docTypeName == "" {
+		h.errorResponse(w, http.StatusBadRequest, "无效的客户名称或文档类型", ErrInvalidInput)
+		return
+	}
+
+	auditTarget(r, clientName+"/"+docTypeName, fileState(h.configMgr.ConfigPath(clientName, docTypeName)))
+	if r.Method != http.MethodGet && h.configLocked(w, r, clientName, docTypeName) {
+		return
+	}
+
+	var result *service.ConfigDrift
+	var err error
+	switch {
+	case len(parts) == 3 && r.Method == http.MethodPost:
+		var req UpstreamPullRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
 			h.errorResponse(w, http.StatusBadRequest, "无效的请求格式", ErrInvalidInput)
 			return
 		}
-		if subtle.ConstantTimeCompare([]byte(req.Password), []byte(h.adminPassword)) != 1 {
-			h.errorResponse(w, http.StatusUnauthorized, "管理密码错误", "INVALID_PASSWORD")
+		result, err = h.configMgr.PullUpstream(clientName, docTypeName, req.Changes)
+		if err == nil {
+			log.Printf("[API] 已同步标准配置变更: %s/%s <- %s", clientName, docTypeName, result.Source)
+		}
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		result, err = h.configMgr.UpstreamDrift(clientName, docTypeName)
+	case len(parts) == 2 && r.Method == http.MethodPut:
+		var req struct {
+			Source string `json:"source"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Source == "" {
+			h.errorResponse(w, http.StatusBadRequest, "source 不能为空", ErrInvalidInput)
 			return
 		}
-		if err := h.configMgr.LockClient(clientName); err != nil {
-			h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+		if h.clientForbidden(w, r, referencedClient(clientName, req.Source, false)) {
 			return
 		}
-		h.successResponse(w, map[string]interface{}{
-			"message": "客户配置已锁定",
-		})
-	case http.MethodDelete:
-		// 解锁客户 - 需要验证密码
-		var req struct {
-			Password string `json:"password"`
+		if err = h.configMgr.RecordUpstream(clientName, docTypeName, req.Source); err == nil {
+			result, err = h.configMgr.UpstreamDrift(clientName, docTypeName)
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	default:
+		h.methodNotAllowed(w)
+		return
+	}
+
+	if err != nil {
+		errMsg := err.Error()
+		switch {
+		case strings.Contains(errMsg, "已锁定"):
+			h.errorResponse(w, http.StatusForbidden, errMsg, ErrConfigLocked)
+		case strings.Contains(errMsg, "不存在") || strings.Contains(errMsg, "没有来源记录"):
+			h.errorResponse(w, http.StatusNotFound, errMsg, ErrConfigNotFound)
+		case strings.Contains(errMsg, "无效") || strings.Contains(errMsg, "未找到") || strings.Contains(errMsg, "自身"):
+			h.errorResponse(w, http.StatusBadRequest, errMsg, ErrInvalidInput)
+		default:
+			h.errorResponse(w, http.StatusInternalServerError, errMsg, "")
+		}
+		return
+	}
+
+	h.successResponse(w, result)
+}
+
+// handleClientLock 处理配置锁定请求
+// GET    /api/lock/{client}[/{docType}]  查看锁定状态（?history=true 同时返回客户的锁定历史）
+// POST   /api/lock/{client}[/{docType}]  锁定 {"reason": "等待客户确认", "expiresInHours": 48}
+// DELETE /api/lock/{client}[/{docType}]  解锁（锁定人或管理员）
+func (h *APIHandler) handleClientLock(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/lock/"), "/")
+	if len(parts) > 2 {
+		h.errorResponse(w, http.StatusBadRequest, "无效的请求路径", ErrInvalidInput)
+		return
+	}
+	clientName, err := url.PathUnescape(parts[0])
+	if err != nil || clientName == "" {
+		h.errorResponse(w, http.StatusBadRequest, "无效的客户名称", ErrInvalidInput)
+		return
+	}
+	docTypeName := ""
+	if len(parts) == 2 {
+		if docTypeName, err = url.PathUnescape(parts[1]); err != nil || docTypeName == "" {
+			h.errorResponse(w, http.StatusBadRequest, "无效的文档类型", ErrInvalidInput)
+			return
+		}
+	}
+	target := clientName
+	if docTypeName != "" {
+		target += "/" + docTypeName
+	}
+	auditTarget(r, target, fileState(h.configMgr.LockPath(clientName, docTypeName)))
+
+	user := currentUser(r)
+	switch r.Method {
+	case http.MethodGet:
+		response := map[string]interface{}{
+			"clientName": clientName,
+			"docType":    docTypeName,
+			"locked":     h.configMgr.LockFor(clientName, docTypeName) != nil,
+			"lock":       h.configMgr.LockFor(clientName, docTypeName),
+			"locks":      h.configMgr.ListLocks(clientName),
+		}
+		if r.URL.Query().Get("history") == "true" {
+			history, err := h.configMgr.LockHistory(clientName)
+			if err != nil {
+				h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+				return
+			}
+			response["history"] = history
+		}
+		h.successResponse(w, response)
+	case http.MethodPost:
+		var req service.LockInput
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
 			h.errorResponse(w, http.StatusBadRequest, "无效的请求格式", ErrInvalidInput)
 			return
 		}
-		if subtle.ConstantTimeCompare([]byte(req.Password), []byte(h.adminPassword)) != 1 {
-			h.errorResponse(w, http.StatusUnauthorized, "管理密码错误", "INVALID_PASSWORD")
+		lock, err := h.configMgr.Lock(clientName, docTypeName, user.Username, req)
+		if err != nil {
+			errMsg := err.Error()
+			switch {
+			case strings.Contains(errMsg, "已锁定"):
+				h.errorResponse(w, http.StatusConflict, errMsg, ErrConfigLocked)
+			case strings.Contains(errMsg, "不存在"):
+				h.errorResponse(w, http.StatusNotFound, errMsg, ErrConfigNotFound)
+			case strings.Contains(errMsg, "无效"):
+				h.errorResponse(w, http.StatusBadRequest, errMsg, ErrInvalidInput)
+			default:
+				h.errorResponse(w, http.StatusInternalServerError, errMsg, "")
+			}
 			return
 		}
-		if err := h.configMgr.UnlockClient(clientName); err != nil {
-			h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+		auditDetail(r, "%s", lock.Reason)
+		h.successResponse(w, map[string]interface{}{
+			"message": "配置已锁定",
+			"lock":    lock,
+		})
+	case http.MethodDelete:
+		lock, err := h.configMgr.Unlock(clientName, docTypeName, user.Username, user.Role.Allows(service.RoleAdmin))
+		if err != nil {
+			if strings.Contains(err.Error(), "只有锁定人") {
+				h.errorResponse(w, http.StatusForbidden, err.Error(), ErrForbidden)
+			} else {
+				h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+			}
 			return
 		}
+		if lock != nil && lock.Owner != user.Username {
+			auditDetail(r, "解除 %s 的锁定", lock.Owner)
+		}
 		h.successResponse(w, map[string]interface{}{
-			"message": "客户配置已解锁",
+			"message": "配置已解锁",
 		})
 	default:
 		h.methodNotAllowed(w)
 	}
 }
 
+// configLocked 配置被其他人锁定时发送 403 并返回 true
+// docTypeName 为空时只检查整个客户的锁定
+func (h *APIHandler) configLocked(w http.ResponseWriter, r *http.Request, clientName, docTypeName string) bool {
+	username := ""
+	if user := currentUser(r); user != nil {
+		username = user.Username
+	}
+	return h.lockedResponse(w, r, h.configMgr.BlockingLock(clientName, docTypeName, username))
+}
+
+// moduleLocked 模块只被一个客户使用且该客户的配置被其他人锁定时发送 403 并返回 true
+func (h *APIHandler) moduleLocked(w http.ResponseWriter, r *http.Request, modulePath string) bool {
+	modulePath = "src/" + strings.TrimPrefix(filepath.ToSlash(modulePath), "src/")
+	for _, lock := range h.configMgr.ModuleLocks(filepath.Dir(h.srcDir), modulePath) {
+		if h.lockedResponse(w, r, &lock) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileLocked 检查修改项目中的文件（相对于项目根目录）是否被锁定
+// 客户的 variables.yaml 等非文档类型配置影响所有文档类型，客户中任一锁定都会阻止修改
+func (h *APIHandler) fileLocked(w http.ResponseWriter, r *http.Request, file string) bool {
+	parts := strings.Split(file, "/")
+	switch {
+	case len(parts) == 3 && parts[0] == "clients":
+		clientName, docTypeName := parts[1], strings.TrimSuffix(parts[2], filepath.Ext(parts[2]))
+		docTypes, _ := h.configMgr.ListCustomConfigs(clientName)
+		for _, name := range docTypes {
+			if name == docTypeName {
+				return h.configLocked(w, r, clientName, docTypeName)
+			}
+		}
+		for _, lock := range h.configMgr.ListLocks(clientName) {
+			if h.lockedResponse(w, r, &lock) {
+				return true
+			}
+		}
+	case parts[0] == "src":
+		return h.moduleLocked(w, r, file)
+	}
+	return false
+}
+
+// lockedResponse 锁定阻止当前用户修改时发送 403 并返回 true
+func (h *APIHandler) lockedResponse(w http.ResponseWriter, r *http.Request, lock *service.ConfigLock) bool {
+	username := ""
+	if user := currentUser(r); user != nil {
+		username = user.Username
+	}
+	if lock == nil || !lock.Blocks(username) {
+		return false
+	}
+	h.errorResponse(w, http.StatusForbidden, lock.Describe()+"，请先解锁后再修改", ErrConfigLocked)
+	return true
+}
+
 // extractErrorDetail 从构建输出中提取关键错误信息
 func extractErrorDetail(output string) string {
 	var details []string
@@ -920,10 +1702,11 @@ func extractErrorDetail(output string) string {
 
 // ==================== 编辑器相关处理 ====================
 
-// SaveModuleRequest 保存模块请求
+// SaveModuleRequest 保存模块请求（读取时的 ETag 通过 If-Match 请求头传入）
 type SaveModuleRequest struct {
-	Path    string `json:"path"`
-	Content string `json:"content"`
+	Path    string  `json:"path"`
+	Content string  `json:"content"`
+	Base    *string `json:"base,omitempty"` // 读取时的原始内容，提供后其他人的修改不冲突时自动合并
 }
 
 // CreateModuleRequest 创建模块请求
@@ -968,6 +1751,7 @@ func (h *APIHandler) getModule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", content.ETag)
 	h.successResponse(w, content)
 }
 
@@ -983,9 +1767,19 @@ func (h *APIHandler) saveModule(w http.ResponseWriter, r *http.Request) {
 		h.errorResponse(w, http.StatusBadRequest, "path 不能为空", ErrInvalidInput)
 		return
 	}
+	auditTarget(r, req.Path, fileState(h.srcFile(req.Path)))
+	if h.moduleLocked(w, r, req.Path) {
+		return
+	}
 
-	if err := h.editorSvc.SaveModule(req.Path, req.Content); err != nil {
+	result, err := h.editorSvc.SaveModule(req.Path, req.Content, r.Header.Get("If-Match"), req.Base)
+	if err != nil {
+		if h.editConflictResponse(w, err) {
+			return
+		}
 		switch err {
+		case service.ErrETagRequired:
+			h.errorResponse(w, http.StatusPreconditionRequired, err.Error(), ErrETagRequired)
 		case service.ErrFileNotFound:
 			h.errorResponse(w, http.StatusNotFound, err.Error(), ErrFileNotFound)
 		case service.ErrPathForbidden:
@@ -997,12 +1791,46 @@ func (h *APIHandler) saveModule(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-
+	message := "保存成功"
+	if result.Merged {
+		message = "已自动合并其他人的修改并保存"
+		auditDetail(r, "已自动合并其他修改")
+	}
+	h.notifyPresence(r, service.PresenceEvent{Type: service.PresenceEventSaved, Path: req.Path, ETag: result.ETag})
+	w.Header().Set("ETag", result.ETag)
 	h.successResponse(w, map[string]interface{}{
-		"message": "保存成功",
+		"message": message,
+		"etag":    result.ETag,
+		"merged":  result.Merged,
+		"content": result.Content, // 自动合并后的内容，编辑器需要替换为此内容
 	})
 }
 
+// editConflictResponse 模块已被其他人修改时返回 409 和服务器上的当前内容，已处理时返回 true
+// 请求中提供了原始版本时同时返回三方合并结果（冲突处带有标记）
+func (h *APIHandler) editConflictResponse(w http.ResponseWriter, err error) bool {
+	var conflictErr *service.ModuleConflictError
+	if !errors.As(err, &conflictErr) {
+		return false
+	}
+	data := map[string]interface{}{"current": conflictErr.Current}
+	if conflictErr.Merge != nil {
+		data["merge"] = conflictErr.Merge
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("ETag", conflictErr.Current.ETag)
+	w.WriteHeader(http.StatusConflict)
+	if err := json.NewEncoder(w).Encode(Response{
+		Success: false,
+		Data:    data,
+		Error:   conflictErr.Error(),
+		Code:    ErrEditConflict,
+	}); err != nil {
+		log.Printf("[API] JSON 编码失败: %v", err)
+	}
+	return true
+}
+
 // createModule 创建新模块
 func (h *APIHandler) createModule(w http.ResponseWriter, r *http.Request) {
 	var req CreateModuleRequest
@@ -1015,6 +1843,7 @@ func (h *APIHandler) createModule(w http.ResponseWriter, r *http.Request) {
 		h.errorResponse(w, http.StatusBadRequest, "path 不能为空", ErrInvalidInput)
 		return
 	}
+	auditTarget(r, req.Path, fileState(h.srcFile(req.Path)))
 
 	if err := h.editorSvc.CreateModule(req.Path); err != nil {
 		switch err {
@@ -1032,6 +1861,7 @@ func (h *APIHandler) createModule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.notifyPresence(r, service.PresenceEvent{Type: service.PresenceEventCreated, Path: req.Path})
 	h.successResponse(w, map[string]interface{}{
 		"path":    req.Path,
 		"message": "创建成功",
@@ -1074,6 +1904,7 @@ func (h *APIHandler) handleEditorTreeOrder(w http.ResponseWriter, r *http.Reques
 		h.errorResponse(w, http.StatusBadRequest, "请求格式错误", ErrInvalidInput)
 		return
 	}
+	auditTarget(r, req.ParentPath, fileState(h.editorSvc.TreeOrderPath()))
 
 	if err := h.editorSvc.SaveTreeOrder(req.ParentPath, req.Order); err != nil {
 		switch err {
@@ -1093,6 +1924,7 @@ func (h *APIHandler) handleEditorTreeOrder(w http.ResponseWriter, r *http.Reques
 // RenameModuleRequest 重命名模块请求
 type RenameModuleRequest struct {
 	NewPath string `json:"newPath"`
+	DryRun  bool   `json:"dryRun"` // 只返回会修改的引用，不执行
 }
 
 // handleEditorModuleWithPath 处理带路径的编辑器模块请求（DELETE, PUT rename）
@@ -1112,20 +1944,25 @@ func (h *APIHandler) handleEditorModuleWithPath(w http.ResponseWriter, r *http.R
 
 	switch r.Method {
 	case http.MethodDelete:
-		h.deleteModule(w, path)
+		h.deleteModule(w, r, path)
 	default:
 		h.methodNotAllowed(w)
 	}
 }
 
 // deleteModule 删除模块
-func (h *APIHandler) deleteModule(w http.ResponseWriter, path string) {
+func (h *APIHandler) deleteModule(w http.ResponseWriter, r *http.Request, path string) {
 	if path == "" {
 		h.errorResponse(w, http.StatusBadRequest, "path 不能为空", ErrInvalidInput)
 		return
 	}
+	auditTarget(r, path, fileState(h.srcFile(path)))
+	if h.moduleLocked(w, r, path) {
+		return
+	}
 
-	if err := h.editorSvc.DeleteModule(path); err != nil {
+	item, err := h.editorSvc.DeleteModule(path, currentUser(r).Username)
+	if err != nil {
 		switch err {
 		case service.ErrFileNotFound:
 			h.errorResponse(w, http.StatusNotFound, err.Error(), ErrFileNotFound)
@@ -1139,12 +1976,12 @@ func (h *APIHandler) deleteModule(w http.ResponseWriter, path string) {
 		return
 	}
 
-	h.successResponse(w, map[string]interface{}{
-		"message": "删除成功",
-	})
+	h.notifyPresence(r, service.PresenceEvent{Type: service.PresenceEventDeleted, Path: path})
+	h.successResponse(w, trashedResponse(r, "删除成功", item))
 }
 
-// renameModule 重命名模块
+// renameModule 重命名或移动模块文件或目录，同时修改客户配置、文件树排序和其他模块中的引用
+// dryRun 为 true 时只返回修改清单；涉及的文件被锁定时拒绝执行
 func (h *APIHandler) renameModule(w http.ResponseWriter, r *http.Request, oldPath string) {
 	if r.Method != http.MethodPut {
 		h.methodNotAllowed(w)
@@ -1162,28 +1999,72 @@ func (h *APIHandler) renameModule(w http.ResponseWriter, r *http.Request, oldPat
 		return
 	}
 
-	if err := h.editorSvc.RenameModule(oldPath, req.NewPath); err != nil {
-		switch err {
-		case service.ErrFileNotFound:
-			h.errorResponse(w, http.StatusNotFound, err.Error(), ErrFileNotFound)
-		case service.ErrFileExists:
-			h.errorResponse(w, http.StatusConflict, err.Error(), "FILE_EXISTS")
-		case service.ErrPathForbidden:
-			h.errorResponse(w, http.StatusForbidden, err.Error(), "PATH_FORBIDDEN")
-		case service.ErrInvalidFileType:
-			h.errorResponse(w, http.StatusBadRequest, err.Error(), "INVALID_FILE_TYPE")
-		default:
-			h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+	preview, err := h.editorSvc.RenameModule(oldPath, req.NewPath, true)
+	if err != nil {
+		h.renameErrorResponse(w, err)
+		return
+	}
+	if req.DryRun {
+		auditSkip(r)
+		h.successResponse(w, preview)
+		return
+	}
+
+	// 审计前后状态：被移动的模块和修改的文件（修改后按新位置计算）
+	touched := append([]string{"src/" + preview.OldPath}, preview.Files...)
+	before := make([]string, len(touched))
+	for i, file := range touched {
+		before[i] = h.workFile(file)
+	}
+	auditTarget(r, preview.OldPath+" -> "+preview.NewPath, filesState(before))
+	auditDetail(r, "移动 %d 项，修改 %d 个文件: %s", len(preview.Moved), len(preview.Files), strings.Join(preview.Files, ", "))
+
+	if h.moduleLocked(w, r, preview.OldPath) {
+		return
+	}
+	for _, file := range append(preview.Moved, preview.Files...) {
+		if h.fileLocked(w, r, file) {
+			return
 		}
+	}
+
+	result, err := h.editorSvc.RenameModule(oldPath, req.NewPath, false)
+	if err != nil {
+		h.renameErrorResponse(w, err)
 		return
 	}
 
+	after := make([]string, len(touched))
+	for i, file := range touched {
+		after[i] = h.workFile(result.NewLocation(file))
+	}
+	auditState(r, filesState(after))
+	h.notifyPresence(r, service.PresenceEvent{Type: service.PresenceEventRenamed, Path: result.NewPath, OldPath: result.OldPath})
 	h.successResponse(w, map[string]interface{}{
 		"message": "重命名成功",
-		"newPath": req.NewPath,
+		"newPath": result.NewPath,
+		"result":  result,
 	})
 }
 
+// renameErrorResponse 重命名错误转换为响应
+func (h *APIHandler) renameErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrFileNotFound):
+		h.errorResponse(w, http.StatusNotFound, err.Error(), ErrFileNotFound)
+	case errors.Is(err, service.ErrFileExists):
+		h.errorResponse(w, http.StatusConflict, err.Error(), "FILE_EXISTS")
+	case errors.Is(err, service.ErrPathForbidden):
+		h.errorResponse(w, http.StatusForbidden, err.Error(), "PATH_FORBIDDEN")
+	case errors.Is(err, service.ErrInvalidFileType):
+		h.errorResponse(w, http.StatusBadRequest, err.Error(), "INVALID_FILE_TYPE")
+	case errors.Is(err, service.ErrInvalidFilename):
+		h.errorResponse(w, http.StatusBadRequest, err.Error(), ErrInvalidInput)
+	default:
+		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+	}
+}
+
 // handleSrcStatic 处理 src 目录静态文件请求
 func (h *APIHandler) handleSrcStatic(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -1305,6 +2186,7 @@ func (h *APIHandler) handleGitInit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	auditTarget(r, "HEAD", h.gitSvc.HeadCommit)
 	if err := h.gitSvc.Init(); err != nil {
 		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "GIT_ERROR")
 		return
@@ -1334,6 +2216,8 @@ func (h *APIHandler) handleGitCommit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	auditTarget(r, "HEAD", h.gitSvc.HeadCommit)
+	auditDetail(r, "%s", req.Message)
 	hash, err := h.gitSvc.Commit(req.Message, req.Files)
 	if err != nil {
 		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "GIT_ERROR")
@@ -1353,6 +2237,7 @@ func (h *APIHandler) handleGitPush(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	auditTarget(r, "HEAD", h.gitSvc.HeadCommit)
 	if err := h.gitSvc.Push(); err != nil {
 		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "GIT_ERROR")
 		return
@@ -1370,6 +2255,7 @@ func (h *APIHandler) handleGitPull(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	auditTarget(r, "HEAD", h.gitSvc.HeadCommit)
 	conflicts, err := h.gitSvc.Pull()
 	if err != nil {
 		response := map[string]interface{}{
@@ -1452,6 +2338,7 @@ func (h *APIHandler) handleGitRemote(w http.ResponseWriter, r *http.Request) {
 			h.errorResponse(w, http.StatusBadRequest, "无效的请求格式", ErrInvalidInput)
 			return
 		}
+		auditTarget(r, redactURL(req.URL), nil)
 		if err := h.gitSvc.SetRemote(req.URL); err != nil {
 			h.errorResponse(w, http.StatusInternalServerError, err.Error(), "GIT_ERROR")
 			return
@@ -1492,6 +2379,7 @@ func (h *APIHandler) handleGitCredentials(w http.ResponseWriter, r *http.Request
 			h.errorResponse(w, http.StatusBadRequest, "无效的请求格式", ErrInvalidInput)
 			return
 		}
+		auditTarget(r, req.Username, nil)
 		h.gitSvc.SetCredentials(&service.GitCredentials{
 			Username: req.Username,
 			Password: req.Password,
@@ -1528,6 +2416,7 @@ func (h *APIHandler) handleGitStage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	auditTarget(r, strings.Join(req.Files, ", "), h.gitSvc.IndexTree)
 	if err := h.gitSvc.Stage(req.Files); err != nil {
 		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "GIT_ERROR")
 		return
@@ -1556,6 +2445,7 @@ func (h *APIHandler) handleGitUnstage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	auditTarget(r, strings.Join(req.Files, ", "), h.gitSvc.IndexTree)
 	if err := h.gitSvc.Unstage(req.Files); err != nil {
 		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "GIT_ERROR")
 		return
@@ -1573,6 +2463,7 @@ func (h *APIHandler) handleGitStageAll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	auditTarget(r, "*", h.gitSvc.IndexTree)
 	if err := h.gitSvc.StageAll(); err != nil {
 		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "GIT_ERROR")
 		return
@@ -1590,6 +2481,7 @@ func (h *APIHandler) handleGitUnstageAll(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	auditTarget(r, "*", h.gitSvc.IndexTree)
 	if err := h.gitSvc.UnstageAll(); err != nil {
 		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "GIT_ERROR")
 		return
@@ -1618,6 +2510,11 @@ func (h *APIHandler) handleGitDiscard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	discarded := make([]string, len(req.Files))
+	for i, file := range req.Files {
+		discarded[i] = h.workFile(file)
+	}
+	auditTarget(r, strings.Join(req.Files, ", "), filesState(discarded))
 	if err := h.gitSvc.Discard(req.Files); err != nil {
 		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "GIT_ERROR")
 		return
@@ -1648,6 +2545,14 @@ func (h *APIHandler) handleEditorUpload(w http.ResponseWriter, r *http.Request)
 	succMap := make(map[string]string)
 	errFiles := make([]string, 0)
 
+	// 图片保存在模块所在目录的 images 下，模块路径无效时保存到 src/images
+	imagesBase := h.srcDir
+	if absModule, err := h.editorSvc.ValidatePath(modulePath); err == nil {
+		imagesBase = filepath.Dir(absModule)
+	}
+	var savedFiles []string
+	auditTarget(r, modulePath, nil)
+
 	for _, fileHeader := range files {
 		file, err := fileHeader.Open()
 		if err != nil {
@@ -1671,7 +2576,10 @@ func (h *APIHandler) handleEditorUpload(w http.ResponseWriter, r *http.Request)
 		}
 
 		succMap[fileHeader.Filename] = relPath
+		savedFiles = append(savedFiles, filepath.Join(imagesBase, relPath))
 	}
+	auditState(r, filesState(savedFiles))
+	auditDetail(r, "上传成功 %d 个，失败 %d 个", len(succMap), len(errFiles))
 
 	response := map[string]interface{}{
 		"msg":  "",
@@ -1699,15 +2607,35 @@ func (h *APIHandler) handleEditorImage(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodDelete:
-		h.deleteImage(w, path)
+		h.deleteImage(w, r, path)
 	default:
 		h.methodNotAllowed(w)
 	}
 }
 
-// deleteImage 删除图片
-func (h *APIHandler) deleteImage(w http.ResponseWriter, path string) {
-	if err := h.editorSvc.DeleteImage(path); err != nil {
+// deleteImage 删除图片，仍被模块引用时返回 409 和引用位置，?force=true 时仍然删除
+func (h *APIHandler) deleteImage(w http.ResponseWriter, r *http.Request, path string) {
+	auditTarget(r, path, fileState(h.srcFile(path)))
+	force := r.URL.Query().Get("force") == "true"
+	item, err := h.editorSvc.DeleteImage(path, currentUser(r).Username, force)
+	var inUseErr *service.ImageInUseError
+	if errors.As(err, &inUseErr) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusConflict)
+		if err := json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Data: map[string]interface{}{
+				"path":       inUseErr.Path,
+				"references": inUseErr.References,
+			},
+			Error: inUseErr.Error(),
+			Code:  ErrImageInUse,
+		}); err != nil {
+			log.Printf("[API] JSON 编码失败: %v", err)
+		}
+		return
+	}
+	if err != nil {
 		switch err {
 		case service.ErrFileNotFound:
 			h.errorResponse(w, http.StatusNotFound, "图片不存在", ErrFileNotFound)
@@ -1721,9 +2649,16 @@ func (h *APIHandler) deleteImage(w http.ResponseWriter, path string) {
 		return
 	}
 
-	h.successResponse(w, map[string]interface{}{
-		"message": "图片删除成功",
-	})
+	response := trashedResponse(r, "图片删除成功", item)
+	if force {
+		// 保留 trashedResponse 记录的回收站条目
+		detail := "强制删除（不检查模块中的引用）"
+		if item != nil {
+			detail += "，已移入回收站: " + item.ID
+		}
+		auditDetail(r, "%s", detail)
+	}
+	h.successResponse(w, response)
 }
 
 // ==================== 资源管理相关处理 ====================
@@ -1735,6 +2670,7 @@ const (
 	ErrInvalidFilename = "INVALID_FILENAME"
 	ErrFileExists      = "FILE_EXISTS"
 	ErrTemplateInUse   = "TEMPLATE_IN_USE"
+	ErrImageInUse      = "IMAGE_IN_USE"
 	ErrUploadFailed    = "UPLOAD_FAILED"
 	ErrDeleteFailed    = "DELETE_FAILED"
 )
@@ -1781,6 +2717,7 @@ func (h *APIHandler) uploadFont(w http.ResponseWriter, r *http.Request) {
 
 	filename := header.Filename
 	overwrite := r.FormValue("overwrite") == "true"
+	auditTarget(r, "fonts/"+filename, fileState(h.resourceSvc.FontPath(filename)))
 
 	// 检查文件是否已存在
 	if !overwrite && h.resourceSvc.FontExists(filename) {
@@ -1821,15 +2758,17 @@ func (h *APIHandler) handleResourceFontDetail(w http.ResponseWriter, r *http.Req
 
 	switch r.Method {
 	case http.MethodDelete:
-		h.deleteFont(w, filename)
+		h.deleteFont(w, r, filename)
 	default:
 		h.methodNotAllowed(w)
 	}
 }
 
 // deleteFont 删除字体文件
-func (h *APIHandler) deleteFont(w http.ResponseWriter, filename string) {
-	if err := h.resourceSvc.DeleteFont(filename); err != nil {
+func (h *APIHandler) deleteFont(w http.ResponseWriter, r *http.Request, filename string) {
+	auditTarget(r, "fonts/"+filename, fileState(h.resourceSvc.FontPath(filename)))
+	item, err := h.resourceSvc.DeleteFont(filename, currentUser(r).Username)
+	if err != nil {
 		errMsg := err.Error()
 		if strings.Contains(errMsg, "不存在") {
 			h.errorResponse(w, http.StatusNotFound, errMsg, ErrFileNotFound)
@@ -1839,9 +2778,7 @@ func (h *APIHandler) deleteFont(w http.ResponseWriter, filename string) {
 		return
 	}
 
-	h.successResponse(w, map[string]interface{}{
-		"message": "删除成功",
-	})
+	h.successResponse(w, trashedResponse(r, "删除成功", item))
 }
 
 // handleResourceTemplates 处理模板资源请求（列表和上传）
@@ -1886,6 +2823,7 @@ func (h *APIHandler) uploadTemplate(w http.ResponseWriter, r *http.Request) {
 
 	filename := header.Filename
 	overwrite := r.FormValue("overwrite") == "true"
+	auditTarget(r, "templates/"+filename, fileState(h.resourceSvc.TemplatePath(filename)))
 
 	// 检查文件是否已存在
 	if !overwrite && h.resourceSvc.TemplateExists(filename) {
@@ -1944,22 +2882,28 @@ func (h *APIHandler) handleResourceTemplateDetail(w http.ResponseWriter, r *http
 
 	switch r.Method {
 	case http.MethodDelete:
-		h.deleteTemplate(w, filename)
+		h.deleteTemplate(w, r, filename)
 	default:
 		h.methodNotAllowed(w)
 	}
 }
 
 // deleteTemplate 删除模板文件
-func (h *APIHandler) deleteTemplate(w http.ResponseWriter, filename string) {
+func (h *APIHandler) deleteTemplate(w http.ResponseWriter, r *http.Request, filename string) {
+	auditTarget(r, "templates/"+filename, fileState(h.resourceSvc.TemplatePath(filename)))
+
 	// 先检查使用情况
 	usedBy, err := h.resourceSvc.GetTemplateUsage(filename)
 	if err != nil {
 		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
 		return
 	}
+	if len(usedBy) > 0 {
+		auditDetail(r, "被以下配置使用: %s", strings.Join(usedBy, ", "))
+	}
 
-	if err := h.resourceSvc.DeleteTemplate(filename); err != nil {
+	item, err := h.resourceSvc.DeleteTemplate(filename, currentUser(r).Username)
+	if err != nil {
 		errMsg := err.Error()
 		if strings.Contains(errMsg, "不存在") {
 			h.errorResponse(w, http.StatusNotFound, errMsg, ErrFileNotFound)
@@ -1969,9 +2913,7 @@ func (h *APIHandler) deleteTemplate(w http.ResponseWriter, filename string) {
 		return
 	}
 
-	response := map[string]interface{}{
-		"message": "删除成功",
-	}
+	response := trashedResponse(r, "删除成功", item)
 	if len(usedBy) > 0 {
 		response["warning"] = "该模板被以下配置使用"
 		response["usedBy"] = usedBy
@@ -2070,8 +3012,10 @@ func (h *APIHandler) handleEditorAttachmentRename(w http.ResponseWriter, r *http
 		h.errorResponse(w, http.StatusBadRequest, "modulePath, oldName, newName 参数不能为空", ErrInvalidInput)
 		return
 	}
+	imagesDir := filepath.Join(filepath.Dir(h.srcFile(req.ModulePath)), "images")
+	auditTarget(r, req.ModulePath+": "+req.OldName+" -> "+req.NewName, fileState(filepath.Join(imagesDir, req.OldName)))
 
-	newPath, err := h.editorSvc.RenameAttachment(req.ModulePath, req.OldName, req.NewName)
+	newPath, refs, err := h.editorSvc.RenameAttachment(req.ModulePath, req.OldName, req.NewName)
 	if err != nil {
 		switch err {
 		case service.ErrPathForbidden:
@@ -2088,8 +3032,13 @@ func (h *APIHandler) handleEditorAttachmentRename(w http.ResponseWriter, r *http
 		return
 	}
 
+	auditState(r, fileState(filepath.Join(imagesDir, filepath.Base(newPath))))
+	if len(refs) > 0 {
+		auditDetail(r, "修改 %d 处引用", len(refs))
+	}
 	h.successResponse(w, map[string]interface{}{
-		"newPath": newPath,
+		"newPath":    newPath,
+		"references": refs,
 	})
 }
 
@@ -2315,8 +3264,22 @@ func (h *APIHandler) handleRAGIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 调用索引服务
+	// 调用索引服务（incremental=true 时只重新索引上次索引之后变化的文件）
 	ctx := r.Context()
+	if r.URL.Query().Get("incremental") == "true" {
+		count, err := h.chatSvc.RAGSvc.IndexPending(ctx, apiEndpoint, apiKey, embeddingModel)
+		if err != nil {
+			h.errorResponse(w, http.StatusInternalServerError, fmt.Sprintf("failed to index documents: %v", err), service.ErrChatAPIError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": fmt.Sprintf("%d changed documents indexed", count),
+			"files":   count,
+		})
+		return
+	}
 	err := h.chatSvc.RAGSvc.IndexDocuments(ctx, apiEndpoint, apiKey, embeddingModel)
 	if err != nil {
 		h.errorResponse(w, http.StatusInternalServerError, fmt.Sprintf("failed to index documents: %v", err), service.ErrChatAPIError)
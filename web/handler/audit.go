@@ -0,0 +1,328 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"doc-generator-web/service"
+)
+
+// auditAction 需要记录审计日志的接口
+type auditAction struct {
+	method string // 为空时匹配所有写操作
+	path   string // 以 / 结尾时按前缀匹配，否则完全匹配
+	suffix string // 路径需要以此结尾（可选）
+	action string
+}
+
+// auditActions 按顺序匹配，只列出会修改状态的接口
+// POST /api/variables、/api/download-zip、配置校验和 AI 聊天等只读操作不记录
+var auditActions = []auditAction{
+	// 账号和令牌
+	{http.MethodPost, "/api/auth/password", "", "user.password"},
+	{http.MethodPost, "/api/users", "", "user.create"},
+	{http.MethodPut, "/api/users/", "", "user.update"},
+	{http.MethodDelete, "/api/users/", "", "user.delete"},
+	{http.MethodPost, "/api/tokens", "", "token.create"},
+	{http.MethodDelete, "/api/tokens/", "", "token.revoke"},
+	// 文档生成
+	{http.MethodPost, "/api/generate", "", "build.generate"},
+	{http.MethodPost, "/api/generate/batch", "", "build.batch"},
+	// 配置
+	{http.MethodPost, "/api/configs", "", "config.create"},
+	{http.MethodPut, "/api/configs/", "", "config.update"},
+	{http.MethodDelete, "/api/configs/", "", "config.delete"},
+	{http.MethodPost, "/api/upstream/", "/pull", "upstream.pull"},
+	{http.MethodPut, "/api/upstream/", "", "upstream.record"},
+	{http.MethodPost, "/api/lock/", "", "config.lock"},
+	{http.MethodDelete, "/api/lock/", "", "config.unlock"},
+	{http.MethodPost, "/api/variables/rename", "", "variable.rename"},
+	// 模块编辑
+	{http.MethodPut, "/api/editor/module", "", "module.save"},
+	{http.MethodPost, "/api/editor/module", "", "module.create"},
+	{"", "/api/editor/module/", "/rename", "module.rename"},
+	{http.MethodDelete, "/api/editor/module/", "", "module.delete"},
+	{http.MethodPost, "/api/editor/tree/order", "", "module.reorder"},
+	{http.MethodPost, "/api/editor/upload", "", "image.upload"},
+	{http.MethodDelete, "/api/editor/image/", "", "image.delete"},
+	{http.MethodPost, "/api/editor/attachment/rename", "", "attachment.rename"},
+	// Git
+	{http.MethodPost, "/api/git/init", "", "git.init"},
+	{http.MethodPost, "/api/git/commit", "", "git.commit"},
+	{http.MethodPost, "/api/git/push", "", "git.push"},
+	{http.MethodPost, "/api/git/pull", "", "git.pull"},
+	{http.MethodPost, "/api/git/stage", "", "git.stage"},
+	{http.MethodPost, "/api/git/stage-all", "", "git.stage"},
+	{http.MethodPost, "/api/git/unstage", "", "git.unstage"},
+	{http.MethodPost, "/api/git/unstage-all", "", "git.unstage"},
+	{http.MethodPost, "/api/git/discard", "", "git.discard"},
+	{http.MethodPost, "/api/git/remote", "", "git.remote"},
+	{http.MethodPost, "/api/git/credentials", "", "git.credentials"},
+	// 字体和模板资源
+	{http.MethodPost, "/api/resources/fonts", "", "font.upload"},
+	{http.MethodDelete, "/api/resources/fonts/", "", "font.delete"},
+	{http.MethodPost, "/api/resources/templates", "", "template.upload"},
+	{http.MethodDelete, "/api/resources/templates/", "", "template.delete"},
+	// 回收站
+	{http.MethodPost, "/api/trash/", "/restore", "trash.restore"},
+	{http.MethodDelete, "/api/trash/", "", "trash.purge"},
+	{http.MethodDelete, "/api/trash", "", "trash.purge"},
+	// AI 知识库
+	{http.MethodPost, "/api/chat/rag/index", "", "rag.index"},
+}
+
+// findAuditAction 查找请求对应的审计操作（不需要记录时返回空字符串）
+func findAuditAction(r *http.Request) string {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+		return ""
+	}
+	for _, a := range auditActions {
+		if a.method != "" && a.method != r.Method {
+			continue
+		}
+		if r.URL.Path != a.path && !(strings.HasSuffix(a.path, "/") && strings.HasPrefix(r.URL.Path, a.path)) {
+			continue
+		}
+		if a.suffix != "" && !strings.HasSuffix(r.URL.Path, a.suffix) {
+			continue
+		}
+		return a.action
+	}
+	return ""
+}
+
+// auditContextKey 请求上下文中审计记录的键
+type auditContextKey struct{}
+
+// auditRecord 正在处理的请求的审计记录
+type auditRecord struct {
+	entry service.AuditEntry
+	state func() string // 计算操作对象当前状态的哈希，处理完成后用于 After
+	skip  bool          // 预览等没有修改任何内容的请求不记录
+}
+
+// startAudit 为需要审计的请求创建记录，返回记录状态码的 ResponseWriter
+func startAudit(w http.ResponseWriter, r *http.Request, user *service.User, token *service.APIToken) (*auditRecord, *statusRecorder) {
+	action := findAuditAction(r)
+	if action == "" {
+		return nil, nil
+	}
+	via := "session"
+	if token != nil {
+		via = "token:" + token.ID
+	}
+	rec := &auditRecord{entry: service.AuditEntry{
+		Time:       time.Now(),
+		Actor:      user.Username,
+		Via:        via,
+		Action:     action,
+		Target:     strings.TrimPrefix(r.URL.Path, "/api/"),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		RemoteAddr: r.RemoteAddr,
+	}}
+	return rec, &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// finishAudit 请求处理完成后写入审计日志
+func (h *APIHandler) finishAudit(rec *auditRecord, sw *statusRecorder) {
+	if rec.skip {
+		return
+	}
+	if rec.state != nil {
+		rec.entry.After = rec.state()
+	}
+	rec.entry.Status = sw.status
+	rec.entry.Success = sw.status >= 200 && sw.status < 300
+	if err := h.auditSvc.Record(rec.entry); err != nil {
+		log.Printf("[API] %v", err)
+	}
+}
+
+// currentAudit 返回请求的审计记录（不需要审计时返回 nil）
+func currentAudit(r *http.Request) *auditRecord {
+	rec, _ := r.Context().Value(auditContextKey{}).(*auditRecord)
+	return rec
+}
+
+// withAudit 把审计记录放入请求上下文
+func withAudit(ctx context.Context, rec *auditRecord) context.Context {
+	if rec == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, auditContextKey{}, rec)
+}
+
+// auditTarget 设置操作对象；state 不为空时立即计算 Before，处理完成后计算 After
+func auditTarget(r *http.Request, target string, state func() string) {
+	rec := currentAudit(r)
+	if rec == nil {
+		return
+	}
+	rec.entry.Target = target
+	rec.state = state
+	if state != nil {
+		rec.entry.Before = state()
+	}
+}
+
+// auditState 替换计算 After 的函数（如重命名后对象换了位置）
+func auditState(r *http.Request, state func() string) {
+	if rec := currentAudit(r); rec != nil {
+		rec.state = state
+	}
+}
+
+// auditDetail 补充操作说明
+func auditDetail(r *http.Request, format string, args ...interface{}) {
+	if rec := currentAudit(r); rec != nil {
+		rec.entry.Detail = fmt.Sprintf(format, args...)
+	}
+}
+
+// auditSkip 请求没有修改任何内容，不写入审计日志
+func auditSkip(r *http.Request) {
+	if rec := currentAudit(r); rec != nil {
+		rec.skip = true
+	}
+}
+
+// fileState 文件内容哈希
+func fileState(path string) func() string {
+	return func() string {
+		return service.HashFile(path)
+	}
+}
+
+// filesState 多个文件内容的组合哈希（文件都不存在时为空）
+func filesState(paths []string) func() string {
+	return func() string {
+		hash := sha256.New()
+		found := false
+		for _, p := range paths {
+			fileHash := service.HashFile(p)
+			if fileHash != "" {
+				found = true
+			}
+			fmt.Fprintf(hash, "%s\x00%s\n", p, fileHash)
+		}
+		if !found {
+			return ""
+		}
+		return hex.EncodeToString(hash.Sum(nil))
+	}
+}
+
+// srcFile 返回 src 中文件的绝对路径（路径可以带 src/ 前缀，只用于计算哈希）
+func (h *APIHandler) srcFile(relPath string) string {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	if strings.Contains(relPath, "..") {
+		return ""
+	}
+	return filepath.Join(h.srcDir, strings.TrimPrefix(relPath, "src/"))
+}
+
+// workFile 返回项目根目录中文件的绝对路径（只用于计算哈希）
+func (h *APIHandler) workFile(relPath string) string {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	if strings.Contains(relPath, "..") {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(h.srcDir), relPath)
+}
+
+// redactURL 去掉 URL 中的用户名和密码
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	u.User = nil
+	return u.String()
+}
+
+// statusRecorder 记录响应状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// handleAudit 查询审计日志（仅管理员）
+// 查询参数: actor、action（前缀，如 git）、target（包含）、since/until（RFC3339 或 2006-01-02）、success、limit
+func (h *APIHandler) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := service.AuditFilter{
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+		Target: query.Get("target"),
+	}
+	var err error
+	if filter.Since, err = parseAuditTime(query.Get("since")); err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "since 格式错误，应为 RFC3339 或 YYYY-MM-DD", ErrInvalidInput)
+		return
+	}
+	if filter.Until, err = parseAuditTime(query.Get("until")); err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "until 格式错误，应为 RFC3339 或 YYYY-MM-DD", ErrInvalidInput)
+		return
+	}
+	if s := query.Get("success"); s != "" {
+		success, err := strconv.ParseBool(s)
+		if err != nil {
+			h.errorResponse(w, http.StatusBadRequest, "success 应为 true 或 false", ErrInvalidInput)
+			return
+		}
+		filter.Success = &success
+	}
+	if s := query.Get("limit"); s != "" {
+		if filter.Limit, err = strconv.Atoi(s); err != nil || filter.Limit < 1 {
+			h.errorResponse(w, http.StatusBadRequest, "limit 应为正整数", ErrInvalidInput)
+			return
+		}
+	}
+
+	entries, err := h.auditSvc.Query(filter)
+	if err != nil {
+		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	h.successResponse(w, map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// parseAuditTime 解析查询时间，日期按服务器本地时区的零点处理
+func parseAuditTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
@@ -0,0 +1,548 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"doc-generator-web/service"
+)
+
+// accessScope 限定客户范围的用户能否使用某个接口
+type accessScope int
+
+const (
+	scopeAny         accessScope = iota // 可以使用，请求体中的客户由处理器检查
+	scopeClientPath                     // 路径中接口前缀后的第一段是客户目录名
+	scopeSharedWrite                    // 写操作会修改所有客户共用的内容，只能读取
+	scopeShared                         // 会涉及其他客户的内容，不能使用
+)
+
+// routeRule 接口需要的角色和 API 令牌权限范围
+// read 和 readScope 用于 GET/HEAD 请求，write 和 writeScope 用于其他请求
+type routeRule struct {
+	path       string // 以 / 结尾时按前缀匹配，否则完全匹配
+	read       service.Role
+	write      service.Role
+	scope      accessScope
+	readScope  service.TokenScope // 为空时任何令牌都可以访问
+	writeScope service.TokenScope
+}
+
+// 常用角色和权限范围的简写
+const (
+	viewer  = service.RoleViewer
+	author  = service.RoleAuthor
+	builder = service.RoleBuilder
+	admin   = service.RoleAdmin
+
+	configRead  = service.ScopeConfigRead
+	configWrite = service.ScopeConfigWrite
+	buildRead   = service.ScopeBuildRead
+	buildWrite  = service.ScopeBuildWrite
+	editorWrite = service.ScopeEditorWrite
+	gitRead     = service.ScopeGitRead
+	gitWrite    = service.ScopeGitWrite
+	gitPush     = service.ScopeGitPush
+	adminScope  = service.ScopeAdmin
+)
+
+// routeRules 按顺序匹配，没有匹配的 /api/ 接口只允许管理员访问
+var routeRules = []routeRule{
+	{"/api/auth/", viewer, viewer, scopeAny, "", adminScope},
+	{"/api/users", admin, admin, scopeShared, adminScope, adminScope},
+	{"/api/users/", admin, admin, scopeShared, adminScope, adminScope},
+	{"/api/tokens", viewer, viewer, scopeAny, adminScope, adminScope},
+	{"/api/tokens/", viewer, viewer, scopeAny, adminScope, adminScope},
+	{"/api/audit", admin, admin, scopeShared, adminScope, adminScope},
+	// 回收站（恢复时按条目类型检查权限，列表按客户范围过滤）；清理需要管理员
+	{"/api/trash", author, admin, scopeAny, configRead, adminScope},
+	{"/api/trash/", author, author, scopeAny, configRead, ""},
+	// 文件变化推送（按客户范围过滤）
+	{"/api/watch/stream", viewer, viewer, scopeAny, configRead, configRead},
+	// 客户和文档生成
+	{"/api/clients", viewer, viewer, scopeAny, configRead, configRead},
+	{"/api/clients/", viewer, viewer, scopeClientPath, configRead, configRead},
+	{"/api/generate", builder, builder, scopeAny, buildWrite, buildWrite},
+	{"/api/generate/batch", builder, builder, scopeAny, buildWrite, buildWrite},
+	{"/api/download/", viewer, viewer, scopeAny, buildRead, buildRead},
+	{"/api/download-zip", viewer, viewer, scopeAny, buildRead, buildRead},
+	// 配置
+	{"/api/modules", viewer, viewer, scopeAny, configRead, configRead},
+	{"/api/templates", viewer, viewer, scopeAny, configRead, configRead},
+	{"/api/template-variables", viewer, viewer, scopeAny, configRead, configRead},
+	{"/api/template-variables/", viewer, viewer, scopeAny, configRead, configRead},
+	{"/api/schema/config", viewer, viewer, scopeAny, configRead, configRead},
+	{"/api/configs", author, author, scopeAny, configWrite, configWrite},
+	{"/api/configs/", viewer, author, scopeClientPath, configRead, configWrite},
+	{"/api/overrides/", viewer, viewer, scopeClientPath, configRead, configRead},
+	{"/api/upstream", viewer, viewer, scopeAny, configRead, configRead},
+	{"/api/upstream/", viewer, author, scopeClientPath, configRead, configWrite},
+	{"/api/lock/", viewer, author, scopeClientPath, configRead, configWrite},
+	// 变量（POST /api/variables 只提取变量，不修改文件）
+	{"/api/variables", viewer, viewer, scopeAny, configRead, configRead},
+	{"/api/variables/lint", viewer, viewer, scopeAny, configRead, configRead},
+	{"/api/variables/rename", author, author, scopeShared, editorWrite, editorWrite},
+	// 模块编辑（src 目录所有客户共用）；在线状态只是心跳，查看者也可以上报
+	{"/api/editor/presence", viewer, viewer, scopeAny, configRead, configRead},
+	{"/api/editor/presence/stream", viewer, viewer, scopeAny, configRead, configRead},
+	{"/api/editor/", viewer, author, scopeSharedWrite, configRead, editorWrite},
+	{"/api/src/", viewer, viewer, scopeAny, configRead, configRead},
+	// Git（状态和历史包含所有客户的文件）
+	{"/api/git/check", viewer, viewer, scopeShared, gitRead, gitRead},
+	{"/api/git/status", viewer, viewer, scopeShared, gitRead, gitRead},
+	{"/api/git/changes", viewer, viewer, scopeShared, gitRead, gitRead},
+	{"/api/git/log", viewer, viewer, scopeShared, gitRead, gitRead},
+	{"/api/git/file-history", viewer, viewer, scopeShared, gitRead, gitRead},
+	{"/api/git/file-show", viewer, viewer, scopeShared, gitRead, gitRead},
+	{"/api/git/commit", author, author, scopeShared, gitWrite, gitWrite},
+	{"/api/git/stage", author, author, scopeShared, gitWrite, gitWrite},
+	{"/api/git/unstage", author, author, scopeShared, gitWrite, gitWrite},
+	{"/api/git/stage-all", author, author, scopeShared, gitWrite, gitWrite},
+	{"/api/git/unstage-all", author, author, scopeShared, gitWrite, gitWrite},
+	{"/api/git/push", builder, builder, scopeShared, gitPush, gitPush},
+	{"/api/git/pull", builder, builder, scopeShared, gitPush, gitPush},
+	{"/api/git/remote", viewer, admin, scopeShared, gitRead, adminScope},
+	{"/api/git/credentials", admin, admin, scopeShared, adminScope, adminScope},
+	{"/api/git/init", admin, admin, scopeShared, adminScope, adminScope},
+	{"/api/git/discard", admin, admin, scopeShared, adminScope, adminScope},
+	// 字体和模板资源
+	{"/api/resources/", viewer, admin, scopeSharedWrite, configRead, adminScope},
+	// AI 聊天（上下文可以读取任意文件）
+	{"/api/chat/rag/index", admin, admin, scopeShared, adminScope, adminScope},
+	{"/api/chat/", author, author, scopeShared, adminScope, adminScope},
+}
+
+// findRouteRule 查找路径对应的规则
+func findRouteRule(urlPath string) (routeRule, bool) {
+	for _, rule := range routeRules {
+		if urlPath == rule.path || (strings.HasSuffix(rule.path, "/") && strings.HasPrefix(urlPath, rule.path)) {
+			return rule, true
+		}
+	}
+	return routeRule{}, false
+}
+
+// userContextKey 请求上下文中当前用户的键
+type userContextKey struct{}
+
+// tokenContextKey 请求上下文中 API 令牌的键
+type tokenContextKey struct{}
+
+// currentToken 返回请求使用的 API 令牌（通过会话登录时返回 nil）
+func currentToken(r *http.Request) *service.APIToken {
+	token, _ := r.Context().Value(tokenContextKey{}).(*service.APIToken)
+	return token
+}
+
+// currentUser 返回当前登录的用户（未经过 RequireAuth 的请求返回 nil）
+func currentUser(r *http.Request) *service.User {
+	user, _ := r.Context().Value(userContextKey{}).(*service.User)
+	return user
+}
+
+// RequireAuth 登录和权限检查中间件
+// 除登录接口外的 /api/ 请求都需要登录（会话 Cookie 或 API 令牌），并按 routeRules 检查角色、令牌权限范围和客户范围
+func (h *APIHandler) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/auth/login" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var user *service.User
+		var token *service.APIToken
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			// API 令牌：Authorization: Bearer dgt_...
+			bearer, ok := strings.CutPrefix(auth, "Bearer ")
+			if ok {
+				token, user, ok = h.tokenSvc.Authenticate(strings.TrimSpace(bearer))
+			}
+			if !ok {
+				h.errorResponse(w, http.StatusUnauthorized, "API 令牌无效或已过期", ErrUnauthorized)
+				return
+			}
+		} else if cookie, err := r.Cookie(service.SessionCookieName); err == nil {
+			user, _ = h.userSvc.SessionUser(cookie.Value)
+		}
+		if user == nil {
+			h.errorResponse(w, http.StatusUnauthorized, "请先登录", ErrUnauthorized)
+			return
+		}
+
+		// 写操作在权限检查之前开始审计，被拒绝的请求也会留下记录
+		audit, recorder := startAudit(w, r, user, token)
+		if audit != nil {
+			w = recorder
+			defer h.finishAudit(audit, recorder)
+		}
+
+		rule, ok := findRouteRule(r.URL.Path)
+		if !ok {
+			rule = routeRule{path: r.URL.Path, read: service.RoleAdmin, write: service.RoleAdmin, scope: scopeShared}
+		}
+		required, requiredScope := rule.write, rule.writeScope
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			required, requiredScope = rule.read, rule.readScope
+		}
+		if !user.Role.Allows(required) {
+			h.errorResponse(w, http.StatusForbidden, fmt.Sprintf("权限不足：需要 %s 角色", required), ErrForbidden)
+			return
+		}
+		if token != nil && requiredScope != "" && !token.HasScope(requiredScope) {
+			h.errorResponse(w, http.StatusForbidden, fmt.Sprintf("API 令牌权限不足：需要 %s", requiredScope), ErrForbidden)
+			return
+		}
+
+		if user.Scoped() {
+			switch rule.scope {
+			case scopeShared:
+				h.errorResponse(w, http.StatusForbidden, "权限不足：该操作涉及所有客户的内容", ErrForbidden)
+				return
+			case scopeSharedWrite:
+				if r.Method != http.MethodGet && r.Method != http.MethodHead {
+					h.errorResponse(w, http.StatusForbidden, "权限不足：不能修改所有客户共用的内容", ErrForbidden)
+					return
+				}
+			case scopeClientPath:
+				segment := strings.SplitN(strings.TrimPrefix(r.URL.Path, rule.path), "/", 2)[0]
+				clientName, err := url.PathUnescape(segment)
+				if err != nil || !user.CanAccessClient(clientName) {
+					h.errorResponse(w, http.StatusForbidden, "无权访问该客户", ErrForbidden)
+					return
+				}
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey{}, user)
+		if token != nil {
+			ctx = context.WithValue(ctx, tokenContextKey{}, token)
+		}
+		ctx = withAudit(ctx, audit)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientForbidden 当前用户不能访问客户时发送 403 并返回 true
+func (h *APIHandler) clientForbidden(w http.ResponseWriter, r *http.Request, clientName string) bool {
+	if user := currentUser(r); user != nil && !user.CanAccessClient(clientName) {
+		h.errorResponse(w, http.StatusForbidden, "无权访问客户: "+clientName, ErrForbidden)
+		return true
+	}
+	return false
+}
+
+// canAccessClient 当前用户能否访问客户（用于过滤列表）
+func canAccessClient(r *http.Request, clientName string) bool {
+	user := currentUser(r)
+	return user == nil || user.CanAccessClient(clientName)
+}
+
+// referencedClient 配置引用（extends 或 upstream）所在的客户目录
+// extends 相对于当前客户目录（如 ../标准文档/运维手册），upstream 为 客户/文档类型
+func referencedClient(clientName, ref string, relative bool) string {
+	ref = strings.ReplaceAll(ref, "\\", "/")
+	if relative {
+		ref = path.Join(clientName, ref)
+	}
+	return strings.SplitN(path.Clean(ref), "/", 2)[0]
+}
+
+// recordOutput 记录生成文件所属的客户，限定客户范围的用户只能下载自己客户的文件
+func (h *APIHandler) recordOutput(fileName, clientName string) {
+	h.outputsMu.Lock()
+	defer h.outputsMu.Unlock()
+	h.outputs[fileName] = clientName
+}
+
+// canDownload 当前用户能否下载生成的文件
+// 服务重启前生成的文件没有记录所属客户，只有不限客户范围的用户可以下载
+func (h *APIHandler) canDownload(r *http.Request, fileName string) bool {
+	user := currentUser(r)
+	if user == nil || !user.Scoped() {
+		return true
+	}
+	h.outputsMu.Lock()
+	clientName, ok := h.outputs[fileName]
+	h.outputsMu.Unlock()
+	return ok && user.CanAccessClient(clientName)
+}
+
+// LoginRequest 登录请求
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// handleAuthLogin 登录，成功后设置会话 Cookie
+func (h *APIHandler) handleAuthLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "无效的请求格式", ErrInvalidInput)
+		return
+	}
+	token, user, err := h.userSvc.Login(strings.TrimSpace(req.Username), req.Password)
+	if err != nil {
+		// 降低暴力破解速度
+		time.Sleep(500 * time.Millisecond)
+		h.errorResponse(w, http.StatusUnauthorized, err.Error(), ErrUnauthorized)
+		return
+	}
+	h.setSessionCookie(w, r, token, int(service.SessionTTL.Seconds()))
+
+	h.successResponse(w, map[string]interface{}{
+		"user": user,
+	})
+}
+
+// handleAuthLogout 退出登录
+func (h *APIHandler) handleAuthLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.methodNotAllowed(w)
+		return
+	}
+	if cookie, err := r.Cookie(service.SessionCookieName); err == nil {
+		h.userSvc.Logout(cookie.Value)
+	}
+	h.setSessionCookie(w, r, "", -1)
+	h.successResponse(w, map[string]interface{}{
+		"message": "已退出登录",
+	})
+}
+
+// handleAuthMe 返回当前用户
+func (h *APIHandler) handleAuthMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+	h.successResponse(w, map[string]interface{}{
+		"user":  currentUser(r),
+		"token": currentToken(r),
+		"roles": service.Roles,
+	})
+}
+
+// handleAuthPassword 修改自己的密码，其他会话随之失效
+func (h *APIHandler) handleAuthPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	var req struct {
+		OldPassword string `json:"oldPassword"`
+		NewPassword string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "无效的请求格式", ErrInvalidInput)
+		return
+	}
+	user := currentUser(r)
+	auditTarget(r, user.Username, nil)
+	if err := h.userSvc.ChangePassword(user.Username, req.OldPassword, req.NewPassword); err != nil {
+		h.errorResponse(w, http.StatusBadRequest, err.Error(), ErrInvalidInput)
+		return
+	}
+	// 修改密码后所有会话失效，为当前浏览器重新登录
+	if token, _, err := h.userSvc.Login(user.Username, req.NewPassword); err == nil {
+		h.setSessionCookie(w, r, token, int(service.SessionTTL.Seconds()))
+	}
+
+	h.successResponse(w, map[string]interface{}{
+		"message": "密码已修改",
+	})
+}
+
+// setSessionCookie 设置或清除（maxAge < 0）会话 Cookie
+func (h *APIHandler) setSessionCookie(w http.ResponseWriter, r *http.Request, token string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     service.SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// handleUsers 用户列表和创建用户（管理员）
+// GET  /api/users
+// POST /api/users {"username", "password", "role", "clients", "displayName"}
+func (h *APIHandler) handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.successResponse(w, map[string]interface{}{
+			"users": h.userSvc.ListUsers(),
+			"roles": service.Roles,
+		})
+	case http.MethodPost:
+		var req service.UserInput
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.errorResponse(w, http.StatusBadRequest, "无效的请求格式", ErrInvalidInput)
+			return
+		}
+		auditTarget(r, req.Username, nil)
+		user, err := h.userSvc.CreateUser(req)
+		if err != nil {
+			h.userErrorResponse(w, err)
+			return
+		}
+		log.Printf("[API] %s 创建了用户 %s", currentUser(r).Username, user.Username)
+		auditDetail(r, "角色: %s", user.Role)
+		h.successResponse(w, map[string]interface{}{
+			"user": user,
+		})
+	default:
+		h.methodNotAllowed(w)
+	}
+}
+
+// handleUserDetail 修改或删除用户（管理员）
+// PUT    /api/users/{username} 只修改请求中提供的字段，clients 为 [] 时取消客户限制
+// DELETE /api/users/{username}
+func (h *APIHandler) handleUserDetail(w http.ResponseWriter, r *http.Request) {
+	username, err := url.PathUnescape(strings.TrimPrefix(r.URL.Path, "/api/users/"))
+	if err != nil || username == "" {
+		h.errorResponse(w, http.StatusBadRequest, "无效的用户名", ErrInvalidInput)
+		return
+	}
+
+	auditTarget(r, username, nil)
+	switch r.Method {
+	case http.MethodPut:
+		var req service.UserInput
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.errorResponse(w, http.StatusBadRequest, "无效的请求格式", ErrInvalidInput)
+			return
+		}
+		user, err := h.userSvc.UpdateUser(username, req)
+		if err != nil {
+			h.userErrorResponse(w, err)
+			return
+		}
+		log.Printf("[API] %s 修改了用户 %s", currentUser(r).Username, username)
+		auditDetail(r, "角色: %s", user.Role)
+		h.successResponse(w, map[string]interface{}{
+			"user": user,
+		})
+	case http.MethodDelete:
+		if username == currentUser(r).Username {
+			h.errorResponse(w, http.StatusBadRequest, "不能删除当前登录的用户", ErrInvalidInput)
+			return
+		}
+		if err := h.userSvc.DeleteUser(username); err != nil {
+			h.userErrorResponse(w, err)
+			return
+		}
+		log.Printf("[API] %s 删除了用户 %s", currentUser(r).Username, username)
+		h.successResponse(w, map[string]interface{}{
+			"message": "用户已删除",
+		})
+	default:
+		h.methodNotAllowed(w)
+	}
+}
+
+// userErrorResponse 按错误类型返回用户管理错误
+func (h *APIHandler) userErrorResponse(w http.ResponseWriter, err error) {
+	errMsg := err.Error()
+	switch {
+	case strings.Contains(errMsg, "用户不存在"):
+		h.errorResponse(w, http.StatusNotFound, errMsg, ErrUserNotFound)
+	case strings.Contains(errMsg, "已存在"):
+		h.errorResponse(w, http.StatusConflict, errMsg, ErrUserExists)
+	case strings.Contains(errMsg, "无效") || strings.Contains(errMsg, "未知") || strings.Contains(errMsg, "至少") ||
+		strings.Contains(errMsg, "不存在") || strings.Contains(errMsg, "最后一个"):
+		h.errorResponse(w, http.StatusBadRequest, errMsg, ErrInvalidInput)
+	default:
+		h.errorResponse(w, http.StatusInternalServerError, errMsg, "")
+	}
+}
+
+// handleTokens API 令牌列表和创建令牌
+// GET  /api/tokens 自己创建的令牌（管理员加 ?all=true 查看全部）
+// POST /api/tokens {"name", "kind": "personal|service", "scopes": ["build:write"], "clients", "expiresInDays"}
+// 令牌只在创建时返回一次
+func (h *APIHandler) handleTokens(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	switch r.Method {
+	case http.MethodGet:
+		owner := user.Username
+		if r.URL.Query().Get("all") == "true" && user.Role.Allows(service.RoleAdmin) {
+			owner = ""
+		}
+		h.successResponse(w, map[string]interface{}{
+			"tokens": h.tokenSvc.ListTokens(owner),
+			"scopes": service.TokenScopes,
+		})
+	case http.MethodPost:
+		if currentToken(r) != nil {
+			h.errorResponse(w, http.StatusForbidden, "不能使用 API 令牌创建令牌，请登录后创建", ErrForbidden)
+			return
+		}
+		var req service.TokenInput
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.errorResponse(w, http.StatusBadRequest, "无效的请求格式", ErrInvalidInput)
+			return
+		}
+		auditTarget(r, req.Name, nil)
+		secret, token, err := h.tokenSvc.CreateToken(user, req)
+		if err != nil {
+			errMsg := err.Error()
+			if strings.Contains(errMsg, "需要") || strings.Contains(errMsg, "只有管理员") || strings.Contains(errMsg, "无权") {
+				h.errorResponse(w, http.StatusForbidden, errMsg, ErrForbidden)
+			} else {
+				h.errorResponse(w, http.StatusBadRequest, errMsg, ErrInvalidInput)
+			}
+			return
+		}
+		auditDetail(r, "令牌 %s（%s）", token.ID, token.Kind)
+		h.successResponse(w, map[string]interface{}{
+			"token":   secret,
+			"info":    token,
+			"message": "请立即保存令牌，之后无法再次查看",
+		})
+	default:
+		h.methodNotAllowed(w)
+	}
+}
+
+// handleTokenDetail 吊销令牌
+// DELETE /api/tokens/{id} 只能吊销自己创建的令牌，管理员可以吊销任何令牌
+func (h *APIHandler) handleTokenDetail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		h.methodNotAllowed(w)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/tokens/")
+	auditTarget(r, id, nil)
+	user := currentUser(r)
+	owner := user.Username
+	if user.Role.Allows(service.RoleAdmin) && !user.Scoped() {
+		owner = ""
+	}
+	if err := h.tokenSvc.RevokeToken(id, owner); err != nil {
+		if strings.Contains(err.Error(), "不存在") {
+			h.errorResponse(w, http.StatusNotFound, err.Error(), ErrTokenNotFound)
+		} else {
+			h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+		}
+		return
+	}
+	h.successResponse(w, map[string]interface{}{
+		"message": "令牌已吊销",
+	})
+}
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"doc-generator-web/service"
+)
+
+// presenceHeader 编辑器在修改模块的请求中带上自己的推送连接 ID，推送事件时据此标记来源
+const presenceHeader = "X-Editor-Connection"
+
+// presenceKeepAlive 推送连接的保活间隔（避免代理关闭空闲连接）
+const presenceKeepAlive = 25 * time.Second
+
+// ErrEditLocked 模块正在被其他人编辑
+const ErrEditLocked = "EDIT_LOCKED"
+
+// PresenceRequest 上报在线状态（心跳）请求
+type PresenceRequest struct {
+	ConnectionID string `json:"connectionId"`
+	Path         string `json:"path"`
+	Mode         string `json:"mode"` // viewing 或 editing
+}
+
+// EditLockRequest 获取编辑锁请求
+type EditLockRequest struct {
+	ConnectionID string `json:"connectionId"`
+	Path         string `json:"path"`
+	Force        bool   `json:"force"` // 接管其他人的编辑锁
+}
+
+// presencePath 统一模块路径为相对于 src/ 的格式
+func presencePath(p string) string {
+	if p == "" {
+		return ""
+	}
+	return strings.TrimPrefix(path.Clean(strings.ReplaceAll(p, "\\", "/")), "src/")
+}
+
+// notifyPresence 广播模块变更事件，来源为请求头中的连接 ID
+func (h *APIHandler) notifyPresence(r *http.Request, event service.PresenceEvent) {
+	if user := currentUser(r); user != nil {
+		event.Actor = user.Username
+		event.DisplayName = user.DisplayName
+	}
+	event.Path = presencePath(event.Path)
+	event.OldPath = presencePath(event.OldPath)
+	event.Source = r.Header.Get(presenceHeader)
+	h.presenceSvc.Notify(event)
+}
+
+// handlePresence 查询（GET）或上报（POST）编辑器在线状态
+// POST 同时作为心跳，需要每隔 20 秒左右发送一次，并为当前模块的编辑锁续期
+func (h *APIHandler) handlePresence(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		presence, locks := h.presenceSvc.Snapshot()
+		h.successResponse(w, map[string]interface{}{
+			"presence": presence,
+			"locks":    locks,
+		})
+	case http.MethodPost:
+		var req PresenceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.errorResponse(w, http.StatusBadRequest, "无效的请求格式", ErrInvalidInput)
+			return
+		}
+		if req.Path != "" {
+			if _, err := h.editorSvc.ValidatePath(req.Path); err != nil {
+				h.errorResponse(w, http.StatusBadRequest, err.Error(), ErrInvalidInput)
+				return
+			}
+		}
+		if err := h.presenceSvc.Update(req.ConnectionID, currentUser(r).Username, presencePath(req.Path), req.Mode); err != nil {
+			h.errorResponse(w, http.StatusNotFound, err.Error(), ErrInvalidInput)
+			return
+		}
+		h.successResponse(w, map[string]interface{}{"message": "ok"})
+	default:
+		h.methodNotAllowed(w)
+	}
+}
+
+// handlePresenceStream 编辑器推送通道（SSE）
+// 连接后首先收到 hello 事件（本连接的 ID 和当前在线状态），之后推送在线状态变化和其他人对模块的修改
+func (h *APIHandler) handlePresenceStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.errorResponse(w, http.StatusInternalServerError, "不支持流式响应", "")
+		return
+	}
+
+	user := currentUser(r)
+	id, events, err := h.presenceSvc.Subscribe(user.Username, user.DisplayName)
+	if err != nil {
+		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	defer h.presenceSvc.Unsubscribe(id)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(presenceKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				// 心跳超时被清理
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("[API] 推送事件编码失败: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// handleEditLock 获取（POST）或释放（DELETE）模块的编辑锁
+// 编辑锁只是提示其他人有人正在编辑，不阻止保存；需要通过在线状态心跳续期，超过 60 秒未续期自动释放
+func (h *APIHandler) handleEditLock(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	switch r.Method {
+	case http.MethodPost:
+		var req EditLockRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.errorResponse(w, http.StatusBadRequest, "无效的请求格式", ErrInvalidInput)
+			return
+		}
+		if _, err := h.editorSvc.ValidatePath(req.Path); err != nil {
+			h.errorResponse(w, http.StatusBadRequest, err.Error(), ErrInvalidInput)
+			return
+		}
+		lock, err := h.presenceSvc.AcquireEditLock(req.ConnectionID, user.Username, presencePath(req.Path), req.Force)
+		if err != nil {
+			var heldErr *service.EditLockHeldError
+			if errors.As(err, &heldErr) {
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.WriteHeader(http.StatusConflict)
+				if err := json.NewEncoder(w).Encode(Response{
+					Success: false,
+					Data:    map[string]interface{}{"lock": heldErr.Lock},
+					Error:   heldErr.Error(),
+					Code:    ErrEditLocked,
+				}); err != nil {
+					log.Printf("[API] JSON 编码失败: %v", err)
+				}
+				return
+			}
+			h.errorResponse(w, http.StatusNotFound, err.Error(), ErrInvalidInput)
+			return
+		}
+		h.successResponse(w, map[string]interface{}{"lock": lock})
+	case http.MethodDelete:
+		query := r.URL.Query()
+		if err := h.presenceSvc.ReleaseEditLock(query.Get("connectionId"), user.Username, presencePath(query.Get("path"))); err != nil {
+			h.errorResponse(w, http.StatusNotFound, err.Error(), ErrInvalidInput)
+			return
+		}
+		h.successResponse(w, map[string]interface{}{"message": "编辑锁已释放"})
+	default:
+		h.methodNotAllowed(w)
+	}
+}
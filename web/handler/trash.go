@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"doc-generator-web/service"
+)
+
+// ErrTrashConflict 恢复位置已存在文件
+const ErrTrashConflict = "TRASH_CONFLICT"
+
+// TrashRestoreRequest 恢复回收站条目请求
+type TrashRestoreRequest struct {
+	OnConflict string `json:"onConflict"` // fail（默认）、overwrite 或 rename
+}
+
+// trashedResponse 删除成功的响应，移入回收站时带上条目 ID 以便撤销
+func trashedResponse(r *http.Request, message string, item *service.TrashItem) map[string]interface{} {
+	response := map[string]interface{}{
+		"message": message,
+	}
+	if item != nil {
+		auditDetail(r, "已移入回收站: %s", item.ID)
+		response["trashId"] = item.ID
+	}
+	return response
+}
+
+// trashItemVisible 当前用户能否看到回收站条目（限定客户范围的用户只能看到自己客户的配置）
+func trashItemVisible(r *http.Request, item service.TrashItem) bool {
+	user := currentUser(r)
+	if user == nil || !user.Scoped() {
+		return true
+	}
+	return item.Kind == service.TrashConfig && user.CanAccessClient(item.Client())
+}
+
+// trashRestoreForbidden 当前用户不能恢复条目时发送 403 并返回 true
+// 恢复需要与删除相同的权限：字体和模板需要管理员，模块和图片需要能修改共用内容，配置需要能访问该客户
+func (h *APIHandler) trashRestoreForbidden(w http.ResponseWriter, r *http.Request, item *service.TrashItem) bool {
+	user, token := currentUser(r), currentToken(r)
+	var role service.Role
+	var scope service.TokenScope
+	switch item.Kind {
+	case service.TrashFont, service.TrashTemplate:
+		role, scope = service.RoleAdmin, service.ScopeAdmin
+	case service.TrashModule, service.TrashImage:
+		if user.Scoped() {
+			h.errorResponse(w, http.StatusForbidden, "权限不足：不能修改所有客户共用的内容", ErrForbidden)
+			return true
+		}
+		role, scope = service.RoleAuthor, service.ScopeEditorWrite
+	default:
+		if h.clientForbidden(w, r, item.Client()) {
+			return true
+		}
+		role, scope = service.RoleAuthor, service.ScopeConfigWrite
+	}
+	if !user.Role.Allows(role) {
+		h.errorResponse(w, http.StatusForbidden, "权限不足：需要 "+string(role)+" 角色", ErrForbidden)
+		return true
+	}
+	if token != nil && !token.HasScope(scope) {
+		h.errorResponse(w, http.StatusForbidden, "API 令牌权限不足：需要 "+string(scope), ErrForbidden)
+		return true
+	}
+	return false
+}
+
+// trashLocked 恢复位置被配置锁定时发送 403 并返回 true
+func (h *APIHandler) trashLocked(w http.ResponseWriter, r *http.Request, item *service.TrashItem) bool {
+	switch item.Kind {
+	case service.TrashConfig:
+		return h.configLocked(w, r, item.Client(), "")
+	case service.TrashModule, service.TrashImage:
+		for _, file := range item.Files {
+			if h.fileLocked(w, r, file) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// trashErrorResponse 回收站错误转换为响应
+func (h *APIHandler) trashErrorResponse(w http.ResponseWriter, err error) {
+	var conflictErr *service.TrashConflictError
+	switch {
+	case errors.As(err, &conflictErr):
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusConflict)
+		if err := json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Data: map[string]interface{}{
+				"item":      conflictErr.Item,
+				"conflicts": conflictErr.Conflicts,
+			},
+			Error: conflictErr.Error() + "，可以选择覆盖（现有文件会移入回收站）或恢复为新文件名",
+			Code:  ErrTrashConflict,
+		}); err != nil {
+			log.Printf("[API] JSON 编码失败: %v", err)
+		}
+	case errors.Is(err, service.ErrTrashNotFound):
+		h.errorResponse(w, http.StatusNotFound, err.Error(), ErrFileNotFound)
+	case errors.Is(err, service.ErrTrashInvalidMode), errors.Is(err, service.ErrTrashRenameMulti):
+		h.errorResponse(w, http.StatusBadRequest, err.Error(), ErrInvalidInput)
+	default:
+		h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+	}
+}
+
+// handleTrash 列出回收站条目（GET，可用 ?kind= 过滤），或按时间清理（DELETE ?days=30，days=0 清空回收站）
+func (h *APIHandler) handleTrash(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		items, err := h.trashSvc.List()
+		if err != nil {
+			h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+			return
+		}
+		kind := r.URL.Query().Get("kind")
+		visible := make([]service.TrashItem, 0, len(items))
+		for _, item := range items {
+			if (kind == "" || item.Kind == kind) && trashItemVisible(r, item) {
+				visible = append(visible, item)
+			}
+		}
+		h.successResponse(w, map[string]interface{}{"items": visible})
+	case http.MethodDelete:
+		days, err := strconv.Atoi(r.URL.Query().Get("days"))
+		if err != nil || days < 0 {
+			h.errorResponse(w, http.StatusBadRequest, "days 必须是非负整数（清理多少天之前删除的条目，0 表示全部）", ErrInvalidInput)
+			return
+		}
+		purged, err := h.trashSvc.PurgeOlderThan(time.Duration(days)*24*time.Hour, nil)
+		if err != nil {
+			h.errorResponse(w, http.StatusInternalServerError, err.Error(), "")
+			return
+		}
+		auditTarget(r, ".trash", nil)
+		auditDetail(r, "清理 %d 天前删除的 %d 个条目", days, len(purged))
+		h.successResponse(w, map[string]interface{}{
+			"message": "回收站已清理",
+			"purged":  purged,
+		})
+	default:
+		h.methodNotAllowed(w)
+	}
+}
+
+// handleTrashItem 回收站条目：GET 查看，POST /api/trash/{id}/restore 恢复，DELETE 永久删除（管理员）
+func (h *APIHandler) handleTrashItem(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/trash/")
+	id, action, _ := strings.Cut(rest, "/")
+	id, err := url.PathUnescape(id)
+	if err != nil || id == "" {
+		h.errorResponse(w, http.StatusBadRequest, "无效的条目 ID", ErrInvalidInput)
+		return
+	}
+	item, err := h.trashSvc.Get(id)
+	if err == nil && !trashItemVisible(r, *item) {
+		err = service.ErrTrashNotFound
+	}
+	if err != nil {
+		h.trashErrorResponse(w, err)
+		return
+	}
+	auditTarget(r, item.OriginalPath, nil)
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.successResponse(w, map[string]interface{}{"item": item})
+	case action == "" && r.Method == http.MethodDelete:
+		if !currentUser(r).Role.Allows(service.RoleAdmin) {
+			h.errorResponse(w, http.StatusForbidden, "权限不足：需要 admin 角色", ErrForbidden)
+			return
+		}
+		if token := currentToken(r); token != nil && !token.HasScope(service.ScopeAdmin) {
+			h.errorResponse(w, http.StatusForbidden, "API 令牌权限不足：需要 admin", ErrForbidden)
+			return
+		}
+		if err := h.trashSvc.Purge(id); err != nil {
+			h.trashErrorResponse(w, err)
+			return
+		}
+		auditDetail(r, "永久删除回收站条目: %s", id)
+		h.successResponse(w, map[string]interface{}{"message": "已永久删除"})
+	case action == "restore" && r.Method == http.MethodPost:
+		h.restoreTrashItem(w, r, item)
+	default:
+		h.methodNotAllowed(w)
+	}
+}
+
+// restoreTrashItem 恢复回收站条目
+func (h *APIHandler) restoreTrashItem(w http.ResponseWriter, r *http.Request, item *service.TrashItem) {
+	var req TrashRestoreRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.errorResponse(w, http.StatusBadRequest, "无效的请求格式", ErrInvalidInput)
+			return
+		}
+	}
+	if h.trashRestoreForbidden(w, r, item) || h.trashLocked(w, r, item) {
+		return
+	}
+
+	result, err := h.trashSvc.Restore(item.ID, req.OnConflict, currentUser(r).Username)
+	if err != nil {
+		h.trashErrorResponse(w, err)
+		return
+	}
+	auditState(r, fileState(h.workFile(result.Files[0])))
+	auditDetail(r, "从回收站恢复 %s 到 %s", item.ID, strings.Join(result.Files, ", "))
+
+	if item.Kind == service.TrashModule {
+		h.notifyPresence(r, service.PresenceEvent{Type: service.PresenceEventCreated, Path: result.Files[0]})
+	}
+	h.successResponse(w, map[string]interface{}{
+		"message": "已恢复",
+		"result":  result,
+	})
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"doc-generator-web/service"
+)
+
+// watchEventBuffer 每个推送连接缓存的变更批次，客户端读取过慢时丢弃
+const watchEventBuffer = 16
+
+// WatchChangedEvent 推送给界面的文件变更（一轮轮询发现的所有变更）
+type WatchChangedEvent struct {
+	Changes []service.WatchEvent `json:"changes"`
+	Time    time.Time            `json:"time"`
+}
+
+// visibleChanges 过滤掉当前用户无权访问的客户目录中的变更
+func visibleChanges(r *http.Request, changes []service.WatchEvent) []service.WatchEvent {
+	var visible []service.WatchEvent
+	for _, change := range changes {
+		if change.Root == "clients" {
+			clientName := strings.SplitN(change.Path, "/", 2)[0]
+			if !canAccessClient(r, clientName) {
+				continue
+			}
+		}
+		visible = append(visible, change)
+	}
+	return visible
+}
+
+// releaseDeletedLocks 在 Web 界面之外删除的模块不会再保存，释放其编辑锁
+func (h *APIHandler) releaseDeletedLocks(changes []service.WatchEvent) {
+	var deleted []string
+	for _, change := range changes {
+		if change.Root == "src" && change.Type == service.FileDeleted {
+			deleted = append(deleted, change.Path)
+		}
+	}
+	if len(deleted) > 0 {
+		h.presenceSvc.FilesDeleted(deleted)
+	}
+}
+
+// handleWatchStream 文件变化推送通道（SSE）
+// 连接后首先收到 hello 事件（是否启用了文件监视），之后每轮轮询发现变更时收到一个 changed 事件
+// 变更包括 Web 界面中的修改和界面之外的修改（如在服务器上执行 git pull），客户目录的变更按用户的客户范围过滤
+func (h *APIHandler) handleWatchStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.errorResponse(w, http.StatusInternalServerError, "不支持流式响应", "")
+		return
+	}
+
+	events := make(chan []service.WatchEvent, watchEventBuffer)
+	user := currentUser(r)
+	unsubscribe := h.watcher.Subscribe("stream:"+user.Username, func(changes []service.WatchEvent) {
+		select {
+		case events <- changes:
+		default:
+			log.Printf("[API] 用户 %s 的文件变化推送队列已满，丢弃 %d 个变更", user.Username, len(changes))
+		}
+	})
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "event: hello\ndata: {\"enabled\":%t}\n\n", h.watcher.Enabled())
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(presenceKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case changes := <-events:
+			changes = visibleChanges(r, changes)
+			if len(changes) == 0 {
+				continue
+			}
+			data, err := json.Marshal(WatchChangedEvent{Changes: changes, Time: time.Now()})
+			if err != nil {
+				log.Printf("[API] 推送事件编码失败: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: changed\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
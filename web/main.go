@@ -67,6 +67,15 @@ func main() {
 	cfg.TemplatesDir = filepath.Join(cfg.WorkDir, "templates")
 	cfg.SrcDir = filepath.Join(cfg.WorkDir, "src")
 	cfg.FontsDir = filepath.Join(cfg.WorkDir, "fonts")
+	if os.Getenv("USERS_FILE") == "" {
+		cfg.UsersFile = filepath.Join(cfg.WorkDir, ".users.json")
+	}
+	if os.Getenv("TOKENS_FILE") == "" {
+		cfg.TokensFile = filepath.Join(cfg.WorkDir, ".tokens.json")
+	}
+	if os.Getenv("AUDIT_FILE") == "" {
+		cfg.AuditFile = filepath.Join(cfg.WorkDir, ".audit.log")
+	}
 
 	// 确定端口优先级: 命令行参数 > 环境变量 > 默认值
 	if *port != "" {
@@ -103,9 +112,33 @@ func main() {
 	templateSvc := service.NewTemplateService(cfg.TemplatesDir)
 	configMgr := service.NewConfigManager(cfg.ClientsDir)
 	editorSvc := service.NewEditorService(cfg.SrcDir)
+	userSvc, err := service.NewUserService(cfg.UsersFile, cfg.ClientsDir, cfg.AdminPassword)
+	if err != nil {
+		log.Fatal("无法加载用户账号:", err)
+	}
+	tokenSvc, err := service.NewTokenService(cfg.TokensFile, userSvc)
+	if err != nil {
+		log.Fatal("无法加载 API 令牌:", err)
+	}
+	auditSvc, err := service.NewAuditService(cfg.AuditFile)
+	if err != nil {
+		log.Fatal("无法打开审计日志:", err)
+	}
+
+	// 回收站（工作目录的 .trash/）
+	trashSvc := service.NewTrashService(cfg.WorkDir)
+
+	// 监视 Web 界面之外的文件修改（如在服务器上执行 git pull）
+	watcher := service.NewFileWatcher(map[string]string{
+		"src":       cfg.SrcDir,
+		"clients":   cfg.ClientsDir,
+		"templates": cfg.TemplatesDir,
+		"fonts":     cfg.FontsDir,
+	}, cfg.WatchInterval)
 
 	// 创建 API 处理器
-	apiHandler := handler.NewAPIHandler(clientSvc, docSvc, buildSvc, moduleSvc, templateSvc, configMgr, editorSvc, cfg.SrcDir, cfg.AdminPassword, cfg.FontsDir, cfg.TemplatesDir, cfg.ClientsDir, cfg)
+	apiHandler := handler.NewAPIHandler(clientSvc, docSvc, buildSvc, moduleSvc, templateSvc, configMgr, editorSvc, cfg.SrcDir, cfg.FontsDir, cfg.TemplatesDir, cfg.ClientsDir, cfg, userSvc, tokenSvc, auditSvc, watcher, trashSvc)
+	watcher.Start()
 
 	// 创建路由
 	mux := http.NewServeMux()
@@ -122,6 +155,11 @@ func main() {
 		w.WriteHeader(http.StatusNoContent)
 	})
 
+	// 登录页面
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(staticDir, "login.html"))
+	})
+
 	// 编辑器页面
 	mux.HandleFunc("/editor", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, filepath.Join(staticDir, "editor.html"))
@@ -136,8 +174,8 @@ func main() {
 		http.ServeFile(w, r, filepath.Join(staticDir, "index.html"))
 	})
 
-	// 应用 Gzip 压缩中间件
-	handler := gzipMiddleware(mux)
+	// 应用登录检查和 Gzip 压缩中间件
+	handler := gzipMiddleware(apiHandler.RequireAuth(mux))
 
 	// 启动服务器
 	addr := ":" + cfg.Port
@@ -0,0 +1,181 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditEntry 审计日志条目
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`   // 用户名，服务令牌为 service:<名称>
+	Via        string    `json:"via"`     // session 或 token:<令牌 ID>
+	Action     string    `json:"action"`  // 操作，如 module.save、git.commit
+	Target     string    `json:"target"`  // 操作对象（文件路径、客户/文档类型、提交等）
+	Method     string    `json:"method"`  // HTTP 方法
+	Path       string    `json:"path"`    // 请求路径
+	Status     int       `json:"status"`  // 响应状态码
+	Success    bool      `json:"success"` // 状态码是否为 2xx
+	Before     string    `json:"before"`  // 操作前的内容哈希（不存在时为空）
+	After      string    `json:"after"`   // 操作后的内容哈希（不存在时为空）
+	Detail     string    `json:"detail,omitempty"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+}
+
+// AuditFilter 审计日志查询条件
+type AuditFilter struct {
+	Actor   string    // 用户名（精确匹配）
+	Action  string    // 操作前缀，如 git 匹配所有 git.* 操作
+	Target  string    // 操作对象包含的文本
+	Since   time.Time // 起始时间（含）
+	Until   time.Time // 截止时间（不含）
+	Success *bool     // 是否只看成功或失败的操作
+	Limit   int       // 最多返回条数，默认 100，最大 1000
+}
+
+// AuditService 审计日志服务（只追加写入，每行一个 JSON）
+type AuditService struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewAuditService 创建审计日志服务
+func NewAuditService(path string) (*AuditService, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建审计日志目录失败: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("打开审计日志失败: %w", err)
+	}
+	log.Printf("[AuditService] 审计日志: %s", path)
+	return &AuditService{path: path, file: file}, nil
+}
+
+// Record 追加一条审计记录
+func (s *AuditService) Record(entry AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(data); err != nil {
+		return fmt.Errorf("写入审计日志失败: %w", err)
+	}
+	return nil
+}
+
+// Query 按条件查询审计记录，最新的在前
+func (s *AuditService) Query(filter AuditFilter) ([]AuditEntry, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+
+	s.mu.Lock()
+	file, err := os.Open(s.path)
+	s.mu.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []AuditEntry{}, nil
+		}
+		return nil, fmt.Errorf("读取审计日志失败: %w", err)
+	}
+	defer file.Close()
+
+	// 日志按时间顺序追加，保留最后 limit 条匹配的记录
+	matched := make([]AuditEntry, 0, limit)
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var entry AuditEntry
+			if jsonErr := json.Unmarshal(line, &entry); jsonErr != nil {
+				log.Printf("[AuditService] 跳过无法解析的记录: %v", jsonErr)
+			} else if filter.matches(&entry) {
+				if len(matched) == limit {
+					matched = matched[1:]
+				}
+				matched = append(matched, entry)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取审计日志失败: %w", err)
+		}
+	}
+
+	entries := make([]AuditEntry, len(matched))
+	for i, entry := range matched {
+		entries[len(matched)-1-i] = entry
+	}
+	return entries, nil
+}
+
+// matches 记录是否符合查询条件
+func (f *AuditFilter) matches(entry *AuditEntry) bool {
+	if f.Actor != "" && entry.Actor != f.Actor {
+		return false
+	}
+	if f.Action != "" && entry.Action != f.Action && !strings.HasPrefix(entry.Action, f.Action+".") {
+		return false
+	}
+	if f.Target != "" && !strings.Contains(entry.Target, f.Target) {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !entry.Time.Before(f.Until) {
+		return false
+	}
+	if f.Success != nil && entry.Success != *f.Success {
+		return false
+	}
+	return true
+}
+
+// HashFile 计算文件内容的 SHA-256（文件不存在或是目录时返回空字符串）
+func HashFile(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err != nil || info.IsDir() {
+		return ""
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
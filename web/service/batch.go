@@ -0,0 +1,259 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BatchBuildRequest 批量生成请求（每行数据生成一份文档）
+type BatchBuildRequest struct {
+	ClientName   string `json:"clientName"`
+	DocumentType string `json:"documentType"`
+	Format       string `json:"format"`     // word 或 pdf（默认: word）
+	NameColumn   string `json:"nameColumn"` // 用作文件名和自定义客户名称的列（可选）
+}
+
+// BatchRowResult 单行的生成结果
+type BatchRowResult struct {
+	Row              int               `json:"row"` // 数据行号（表头为第 1 行，不计空行）
+	Name             string            `json:"name,omitempty"`
+	Success          bool              `json:"success"`
+	FileName         string            `json:"fileName,omitempty"` // zip 中的文件名
+	Error            string            `json:"error,omitempty"`
+	ValidationErrors []ValidationError `json:"validationErrors,omitempty"`
+}
+
+// BatchBuildResult 批量生成结果
+type BatchBuildResult struct {
+	ZipFileName     string           `json:"zipFileName,omitempty"`
+	Total           int              `json:"total"`
+	Succeeded       int              `json:"succeeded"`
+	Failed          int              `json:"failed"`
+	UnmappedColumns []string         `json:"unmappedColumns,omitempty"` // 未对应任何变量声明的列
+	Rows            []BatchRowResult `json:"rows"`
+}
+
+// batchReportFile zip 中的逐行报告文件名
+const batchReportFile = "生成报告.csv"
+
+// maxBatchDuration 批量生成在请求中执行的最长时间，超过后剩余的行不再构建（在报告中标为失败）
+const maxBatchDuration = 30 * time.Minute
+
+// BatchBuild 按数据表逐行生成文档，打包为 zip 并返回逐行报告
+// 列名对应模块中声明的变量名，空单元格不覆盖其他层级的变量值
+// 每行先用 ValidateValues 校验，校验失败的行不会构建
+func (s *BuildService) BatchBuild(req BatchBuildRequest, table *BatchTable) (*BatchBuildResult, error) {
+	if req.DocumentType == "" {
+		return nil, fmt.Errorf("文档类型不能为空")
+	}
+	cfg, err := s.configMgr.GetConfig(req.ClientName, req.DocumentType)
+	if err != nil {
+		return nil, err
+	}
+
+	declarations, conflicts := s.variableSvc.ExtractVariables(ModulePaths(cfg.Modules))
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("模块中的变量声明存在冲突: %s", conflicts[0].Error())
+	}
+	declByName := make(map[string]VariableDeclaration)
+	for _, decl := range declarations {
+		declByName[decl.Name] = decl
+	}
+
+	nameCol := -1
+	result := &BatchBuildResult{Total: len(table.Rows), Rows: []BatchRowResult{}}
+	for i, header := range table.Headers {
+		if req.NameColumn != "" && header == req.NameColumn {
+			nameCol = i
+			continue
+		}
+		if _, ok := declByName[header]; !ok && header != "" {
+			result.UnmappedColumns = append(result.UnmappedColumns, header)
+		}
+	}
+	if req.NameColumn != "" && nameCol == -1 {
+		return nil, fmt.Errorf("找不到文件名列: %s", req.NameColumn)
+	}
+
+	log.Printf("[BuildService] 开始批量生成: 客户=%s, 文档类型=%s, 行数=%d", req.ClientName, req.DocumentType, len(table.Rows))
+	if len(result.UnmappedColumns) > 0 {
+		log.Printf("[BuildService] 警告: 以下列没有对应的变量声明，将被忽略: %s", strings.Join(result.UnmappedColumns, ", "))
+	}
+
+	if err := os.MkdirAll(s.buildDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建构建目录失败: %w", err)
+	}
+	zipName := fmt.Sprintf("批量_%s_%s_%s.zip", req.ClientName, req.DocumentType, time.Now().Format("20060102-150405"))
+	zipPath := filepath.Join(s.buildDir, zipName)
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		return nil, fmt.Errorf("创建 zip 文件失败: %w", err)
+	}
+	zipWriter := zip.NewWriter(zipFile)
+	usedNames := make(map[string]bool)
+
+	// 各行的输出写入本批独立的目录，不经过共享的 build 目录（避免覆盖或删除同名的单独构建输出）
+	outputDir, err := os.MkdirTemp("", "doc-batch-*")
+	if err != nil {
+		zipWriter.Close()
+		zipFile.Close()
+		os.Remove(zipPath)
+		return nil, fmt.Errorf("创建批量输出目录失败: %w", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	// 构建输出文件名由 output_pattern 决定，各行可能相同，因此逐行构建并立即打包
+	started := time.Now()
+	for i := range table.Rows {
+		row := BatchRowResult{Row: i + 2}
+		if nameCol >= 0 {
+			row.Name = table.Cell(i, nameCol)
+		}
+		if time.Since(started) > maxBatchDuration {
+			row.Error = fmt.Sprintf("批量生成已超过 %d 分钟，未生成", int(maxBatchDuration.Minutes()))
+			result.Rows = append(result.Rows, row)
+			result.Failed++
+			continue
+		}
+
+		values := make(map[string]interface{})
+		for col, header := range table.Headers {
+			decl, ok := declByName[header]
+			if !ok || col == nameCol {
+				continue
+			}
+			value := table.Cell(i, col)
+			if decl.Type == VarTypeDate {
+				value = table.DateCell(i, col)
+			}
+			if value != "" {
+				values[header] = value
+			}
+		}
+
+		// 校验合并后的值，这样在客户或文档类型中已赋值的必填变量不要求每行都填写
+		merged, err := s.variableSvc.ResolveValues(nil, req.ClientName, cfg.Variables, values)
+		if err != nil {
+			row.Error = fmt.Sprintf("读取变量配置档失败: %v", err)
+			result.Rows = append(result.Rows, row)
+			result.Failed++
+			continue
+		}
+		if errs := s.variableSvc.ValidateValues(declarations, merged); len(errs) > 0 {
+			row.ValidationErrors = errs
+			row.Error = fmt.Sprintf("变量校验失败: %s", errs[0].Error())
+			result.Rows = append(result.Rows, row)
+			result.Failed++
+			continue
+		}
+
+		buildResult, err := s.Build(BuildRequest{
+			ClientName:   req.ClientName,
+			DocumentType: req.DocumentType,
+			CustomName:   row.Name,
+			Format:       req.Format,
+			Variables:    values,
+			outputDir:    outputDir,
+		})
+		if err == nil && !buildResult.Success {
+			err = fmt.Errorf("%s", buildResult.Error)
+		}
+		if err == nil {
+			row.FileName, err = s.addBatchOutput(zipWriter, buildResult.FilePath, row, usedNames)
+		}
+		if err != nil {
+			row.Error = err.Error()
+			result.Failed++
+		} else {
+			row.Success = true
+			result.Succeeded++
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	if err := writeBatchReport(zipWriter, result); err != nil {
+		log.Printf("[BuildService] 警告: 写入生成报告失败: %v", err)
+	}
+	if err := zipWriter.Close(); err != nil {
+		zipFile.Close()
+		os.Remove(zipPath)
+		return nil, fmt.Errorf("写入 zip 文件失败: %w", err)
+	}
+	zipFile.Close()
+
+	if result.Succeeded == 0 {
+		os.Remove(zipPath)
+	} else {
+		result.ZipFileName = zipName
+	}
+
+	log.Printf("[BuildService] 批量生成完成: 成功 %d, 失败 %d", result.Succeeded, result.Failed)
+	return result, nil
+}
+
+// addBatchOutput 将单行的构建输出写入 zip，并从批量输出目录中移除（避免被下一行覆盖）
+func (s *BuildService) addBatchOutput(zw *zip.Writer, filePath string, row BatchRowResult, usedNames map[string]bool) (string, error) {
+	fileName := filepath.Base(filePath)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("读取输出文件失败: %w", err)
+	}
+
+	entryName := fileName
+	if row.Name != "" {
+		entryName = sanitizeFilename(row.Name) + filepath.Ext(fileName)
+	}
+	if usedNames[entryName] {
+		entryName = fmt.Sprintf("%03d_%s", row.Row, entryName)
+	}
+	usedNames[entryName] = true
+
+	w, err := zw.Create(entryName)
+	if err != nil {
+		return "", fmt.Errorf("写入 zip 失败: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return "", fmt.Errorf("写入 zip 失败: %w", err)
+	}
+
+	if err := os.Remove(filePath); err != nil {
+		log.Printf("[BuildService] 警告: 删除临时输出文件失败 %s: %v", filePath, err)
+	}
+	return entryName, nil
+}
+
+// writeBatchReport 在 zip 中写入逐行报告（带 BOM，便于 Excel 直接打开）
+func writeBatchReport(zw *zip.Writer, result *BatchBuildResult) error {
+	var buf bytes.Buffer
+	buf.WriteString("\xef\xbb\xbf")
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"行号", "名称", "结果", "文件", "错误"})
+	for _, row := range result.Rows {
+		status := "成功"
+		if !row.Success {
+			status = "失败"
+		}
+		writer.Write([]string{strconv.Itoa(row.Row), row.Name, status, row.FileName, row.Error})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	w, err := zw.Create(batchReportFile)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, &buf)
+	return err
+}
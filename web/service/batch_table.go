@@ -0,0 +1,347 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// MaxBatchRows 单次批量生成的最大行数（每行都在请求中完整构建一次）
+	MaxBatchRows = 200
+	// MaxBatchFileSize 批量生成数据文件的最大大小 (5MB)
+	MaxBatchFileSize = 5 * 1024 * 1024
+)
+
+// BatchTable 批量生成的数据表（第一行为表头）
+type BatchTable struct {
+	Headers []string
+	Rows    [][]string
+	// numericCells 记录 XLSX 中的数值单元格（行、列），用于把日期序列号转换为 YYYY-MM-DD
+	numericCells map[[2]int]bool
+}
+
+// ParseBatchTable 解析上传的 CSV 或 XLSX 文件
+func ParseBatchTable(fileName string, data []byte) (*BatchTable, error) {
+	var table *BatchTable
+	var err error
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv", ".txt":
+		table, err = parseCSVTable(data)
+	case ".xlsx":
+		table, err = parseXLSXTable(data)
+	default:
+		return nil, fmt.Errorf("不支持的文件类型，仅支持 .csv 和 .xlsx")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(table.Headers) == 0 {
+		return nil, fmt.Errorf("文件为空或缺少表头")
+	}
+	for i, header := range table.Headers {
+		table.Headers[i] = strings.TrimSpace(header)
+	}
+	if len(table.Rows) == 0 {
+		return nil, fmt.Errorf("文件中没有数据行")
+	}
+	if len(table.Rows) > MaxBatchRows {
+		return nil, fmt.Errorf("数据行过多: %d 行（最多 %d 行）", len(table.Rows), MaxBatchRows)
+	}
+	return table, nil
+}
+
+// Cell 获取单元格内容（越界时返回空字符串）
+func (t *BatchTable) Cell(row, col int) string {
+	if row < 0 || row >= len(t.Rows) || col < 0 || col >= len(t.Rows[row]) {
+		return ""
+	}
+	return strings.TrimSpace(t.Rows[row][col])
+}
+
+// DateCell 获取日期单元格内容，XLSX 中的日期序列号会转换为 YYYY-MM-DD
+func (t *BatchTable) DateCell(row, col int) string {
+	value := t.Cell(row, col)
+	if !t.numericCells[[2]int{row, col}] {
+		return value
+	}
+	serial, err := strconv.ParseFloat(value, 64)
+	if err != nil || serial <= 0 {
+		return value
+	}
+	// Excel 日期序列号以 1899-12-30 为基准
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	return base.AddDate(0, 0, int(serial)).Format("2006-01-02")
+}
+
+// parseCSVTable 解析 CSV，支持 UTF-8 BOM 以及逗号、分号、制表符分隔
+func parseCSVTable(data []byte) (*BatchTable, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("CSV 文件必须使用 UTF-8 编码（Excel 中请选择“CSV UTF-8”格式保存）")
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = detectCSVDelimiter(data)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("解析 CSV 失败: %w", err)
+	}
+	records = trimEmptyRecords(records)
+	if len(records) == 0 {
+		return &BatchTable{}, nil
+	}
+	return &BatchTable{Headers: records[0], Rows: records[1:]}, nil
+}
+
+// detectCSVDelimiter 根据表头行判断分隔符
+func detectCSVDelimiter(data []byte) rune {
+	firstLine := string(data)
+	if idx := strings.IndexByte(firstLine, '\n'); idx >= 0 {
+		firstLine = firstLine[:idx]
+	}
+	best, bestCount := ',', strings.Count(firstLine, ",")
+	for _, sep := range []rune{';', '\t'} {
+		if n := strings.Count(firstLine, string(sep)); n > bestCount {
+			best, bestCount = sep, n
+		}
+	}
+	return best
+}
+
+// trimEmptyRecords 去掉全部为空的行
+func trimEmptyRecords(records [][]string) [][]string {
+	var result [][]string
+	for _, record := range records {
+		for _, field := range record {
+			if strings.TrimSpace(field) != "" {
+				result = append(result, record)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// XLSX 内部 XML 结构（只解析需要的部分）
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (r xlsxRichText) String() string {
+	if len(r.Runs) == 0 {
+		return r.Text
+	}
+	var b strings.Builder
+	for _, run := range r.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref       string       `xml:"r,attr"`
+			Type      string       `xml:"t,attr"`
+			Value     string       `xml:"v"`
+			InlineStr xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// parseXLSXTable 解析 XLSX 的第一个工作表
+func parseXLSXTable(data []byte) (*BatchTable, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("无效的 XLSX 文件: %w", err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared xlsxSharedStrings
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeZipXML(f, &shared); err != nil {
+			return nil, fmt.Errorf("解析 XLSX 共享字符串失败: %w", err)
+		}
+	}
+
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("XLSX 中找不到工作表: %s", sheetPath)
+	}
+	var sheet xlsxSheet
+	if err := decodeZipXML(f, &sheet); err != nil {
+		return nil, fmt.Errorf("解析 XLSX 工作表失败: %w", err)
+	}
+
+	var records [][]string
+	numeric := make(map[[2]int]bool)
+	for _, row := range sheet.Rows {
+		var record []string
+		col := -1
+		for _, cell := range row.Cells {
+			// 没有 r 属性的单元格紧跟在上一个单元格之后
+			col++
+			if cell.Ref != "" {
+				var err error
+				if col, err = xlsxColumnIndex(cell.Ref); err != nil {
+					return nil, err
+				}
+			}
+			for len(record) <= col {
+				record = append(record, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				idx, err := strconv.Atoi(cell.Value)
+				if err == nil && idx >= 0 && idx < len(shared.Items) {
+					record[col] = shared.Items[idx].String()
+				}
+			case "inlineStr":
+				record[col] = cell.InlineStr.String()
+			case "b":
+				record[col] = map[string]string{"1": "true", "0": "false"}[cell.Value]
+			case "", "n":
+				record[col] = cell.Value
+				if cell.Value != "" {
+					// 记录在去掉表头和空行之前的位置，下面再换算
+					numeric[[2]int{len(records), col}] = true
+				}
+			default:
+				record[col] = cell.Value
+			}
+		}
+		records = append(records, record)
+	}
+
+	// 去掉空行时同步调整数值单元格的行号
+	table := &BatchTable{numericCells: make(map[[2]int]bool)}
+	dataRow := -1
+	for i, record := range records {
+		if len(trimEmptyRecords([][]string{record})) == 0 {
+			continue
+		}
+		if table.Headers == nil {
+			table.Headers = record
+			continue
+		}
+		table.Rows = append(table.Rows, record)
+		dataRow++
+		for col := range record {
+			if numeric[[2]int{i, col}] {
+				table.numericCells[[2]int{dataRow, col}] = true
+			}
+		}
+	}
+	return table, nil
+}
+
+// firstSheetPath 从 workbook.xml 中找到第一个工作表的路径
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	wbFile, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", fmt.Errorf("无效的 XLSX 文件: 缺少 xl/workbook.xml")
+	}
+	var wb xlsxWorkbook
+	if err := decodeZipXML(wbFile, &wb); err != nil || len(wb.Sheets) == 0 {
+		return fallback, nil
+	}
+
+	relsFile, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok {
+		return fallback, nil
+	}
+	var rels xlsxRelationships
+	if err := decodeZipXML(relsFile, &rels); err != nil {
+		return fallback, nil
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != wb.Sheets[0].RID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return fallback, nil
+}
+
+// decodeZipXML 解码 zip 中的 XML 文件
+func decodeZipXML(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(io.LimitReader(rc, 50<<20)).Decode(v)
+}
+
+// xlsxMaxColumns XLSX 工作表的最大列数（A..XFD）
+const xlsxMaxColumns = 16384
+
+// xlsxColumnIndex 把单元格引用（如 "AB12"）转换为从 0 开始的列号
+// 引用中没有列字母或超出 XFD 列时返回错误
+func xlsxColumnIndex(ref string) (int, error) {
+	col := 0
+	for _, r := range strings.ToUpper(ref) {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		if col > xlsxMaxColumns {
+			return 0, fmt.Errorf("XLSX 单元格引用超出最大列数: %s", ref)
+		}
+	}
+	if col == 0 {
+		return 0, fmt.Errorf("XLSX 单元格引用无效: %s", ref)
+	}
+	return col - 1, nil
+}
@@ -12,6 +12,8 @@ import (
 	"runtime"
 	"strings"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // BuildRequest 构建请求
@@ -21,6 +23,11 @@ type BuildRequest struct {
 	CustomName   string                 `json:"customName"`          // 自定义客户名称（可选）
 	Format       string                 `json:"format"`              // 输出格式：word 或 pdf（默认: word）
 	Variables    map[string]interface{} `json:"variables,omitempty"` // 变量值（可选）
+	// WordOptions 覆盖配置中的 Word 输出选项（可选，只覆盖设置了的字段）
+	WordOptions *WordOptions `json:"wordOptions,omitempty"`
+
+	// outputDir 输出文件的目录（批量生成时每批独立），为空时使用共享的 build 目录
+	outputDir string
 }
 
 // BuildResult 构建结果
@@ -30,6 +37,8 @@ type BuildResult struct {
 	FileName string `json:"fileName"` // 文件名
 	Error    string `json:"error,omitempty"`
 	Output   string `json:"output,omitempty"` // 构建输出日志
+	// LintIssues 构建前变量检查发现的问题（不阻断构建）
+	LintIssues []LintIssue `json:"lintIssues,omitempty"`
 }
 
 // BuildService 构建服务
@@ -43,6 +52,8 @@ type BuildService struct {
 	cleanupTicker *time.Ticker
 	pathFix       *PathFixService  // 路径修复服务
 	variableSvc   *VariableService // 变量服务
+	configMgr     *ConfigManager   // 配置管理器（读取文档类型变量）
+	overrideSvc   *OverrideService // 客户模块覆盖服务
 }
 
 // NewBuildService 创建构建服务实例
@@ -68,6 +79,8 @@ func NewBuildService(workDir, buildDir, srcDir string) *BuildService {
 		cleanupAge:  24 * time.Hour,             // 默认 24 小时后清理
 		pathFix:     NewPathFixService(workDir), // 初始化路径修复服务
 		variableSvc: NewVariableService(srcDir), // 初始化变量服务
+		configMgr:   NewConfigManager(filepath.Join(workDir, "clients")),
+		overrideSvc: NewOverrideService(workDir, filepath.Join(workDir, "clients")),
 	}
 
 	// 启动定期清理
@@ -104,7 +117,7 @@ func (s *BuildService) CleanOldFiles() error {
 			continue
 		}
 		name := entry.Name()
-		if !strings.HasSuffix(name, ".docx") && !strings.HasSuffix(name, ".pdf") {
+		if !strings.HasSuffix(name, ".docx") && !strings.HasSuffix(name, ".pdf") && !strings.HasSuffix(name, ".zip") {
 			continue
 		}
 
@@ -153,27 +166,93 @@ func (s *BuildService) Build(req BuildRequest) (*BuildResult, error) {
 		// 不中断构建流程，继续执行
 	}
 
-	// 如果有变量值，先进行变量替换
+	// 校验配置文件（手工编辑的 YAML 类型错误会被构建脚本静默忽略）
+	if req.DocumentType != "" {
+		if schemaErrs, err := s.configMgr.ValidateConfigFile(req.ClientName, req.DocumentType); err == nil && len(schemaErrs) > 0 {
+			validationErr := &ConfigValidationError{Errors: schemaErrs}
+			log.Printf("[BuildService] 错误: %v", validationErr)
+			return &BuildResult{
+				Success: false,
+				Error:   validationErr.Error(),
+			}, nil
+		}
+	}
+
+	// 检查 pandoc_args（构建脚本直接读取配置文件，手工编辑的参数不经过保存时的检查）
+	if err := s.configMgr.CheckBuildPandocArgs(req.ClientName, req.DocumentType); err != nil {
+		log.Printf("[BuildService] 错误: %v", err)
+		return &BuildResult{
+			Success: false,
+			Error:   err.Error(),
+		}, nil
+	}
+
+	// 请求中的 Word 选项会写入临时配置，需要和保存的配置一样通过校验
+	if format == "word" {
+		if err := s.ValidateWordOptions(req); err != nil {
+			log.Printf("[BuildService] 错误: %v", err)
+			return &BuildResult{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+	}
+
+	// 合并各层级变量值（全局 → 客户 → 文档类型 → 请求）
+	variables, err := s.resolveBuildVariables(req)
+	if err != nil {
+		log.Printf("[BuildService] 错误: %v", err)
+		return &BuildResult{
+			Success: false,
+			Error:   err.Error(),
+		}, nil
+	}
+
+	// 评估带条件的模块（按输出格式和变量值），nil 表示配置中没有条件模块
+	selectedModules, err := s.selectBuildModules(req, format, variables)
+	if err != nil {
+		log.Printf("[BuildService] 错误: %v", err)
+		return &BuildResult{
+			Success: false,
+			Error:   err.Error(),
+		}, nil
+	}
+
+	// 构建前检查变量使用情况（未声明的占位符会原样输出到文档中）
+	lintIssues := s.lintBuildModules(req, selectedModules)
+
+	// 配置使用 extends 继承时，构建脚本需要读取解析后的完整配置
+	extendsConfig := req.DocumentType != "" && s.configMgr.ConfigExtends(req.ClientName, req.DocumentType) != ""
+
+	// 请求覆盖 Word 选项时，构建脚本需要读取临时目录中改写后的配置
+	wordOverride := format == "word" && req.DocumentType != "" && !req.WordOptions.IsZero()
+
+	// 配置中有其他输出格式的模板变量时，构建脚本需要读取临时目录中筛选后的 template_variables
+	templateVars := s.resolveTemplateVars(req, format)
+
+	// 如果有变量值、模块引用、客户覆盖模块、条件模块、配置继承、Word 选项覆盖或模板变量筛选，先在临时目录中处理源文件
+	// 指定了输出目录时也在临时目录中构建，输出不经过共享的 build 目录
 	tempSrcDir := ""
 	workDir := s.workDir
-	if len(req.Variables) > 0 {
+	if len(variables) > 0 || s.buildUsesIncludes(req, selectedModules) || s.overrideSvc.HasOverrides(req.ClientName) || selectedModules != nil || extendsConfig || wordOverride || templateVars != nil || req.outputDir != "" {
 		var err error
-		tempSrcDir, err = s.prepareVariableRenderedSrc(req.Variables)
+		tempSrcDir, err = s.prepareVariableRenderedSrc(req, variables, selectedModules, templateVars)
 		if err != nil {
-			log.Printf("[BuildService] 警告: 变量替换失败: %v", err)
-			// 继续使用原始源文件
-		} else {
-			// 使用临时目录作为工作目录
-			workDir = filepath.Dir(tempSrcDir)
-			log.Printf("[BuildService] 使用变量替换后的临时目录: %s", workDir)
-			defer func() {
-				// 构建完成后清理临时目录
-				if tempSrcDir != "" {
-					os.RemoveAll(filepath.Dir(tempSrcDir))
-					log.Printf("[BuildService] 已清理临时目录")
-				}
-			}()
+			// 原始源文件缺少继承、覆盖、include、条件模块等处理，用它构建会得到错误的文档
+			log.Printf("[BuildService] 错误: 准备临时目录失败: %v", err)
+			return &BuildResult{
+				Success: false,
+				Error:   "准备构建目录失败: " + err.Error(),
+			}, nil
 		}
+		// 使用临时目录作为工作目录
+		workDir = filepath.Dir(tempSrcDir)
+		log.Printf("[BuildService] 使用变量替换后的临时目录: %s", workDir)
+		defer func() {
+			// 构建完成后清理临时目录
+			os.RemoveAll(filepath.Dir(tempSrcDir))
+			log.Printf("[BuildService] 已清理临时目录")
+		}()
 	}
 
 	// 创建带超时的上下文
@@ -249,19 +328,29 @@ func (s *BuildService) Build(req BuildRequest) (*BuildResult, error) {
 		}, nil
 	}
 
-	// 如果使用了临时目录，需要将输出文件复制到原始 build 目录
+	// 如果使用了临时目录，需要将输出文件复制到原始 build 目录（或请求指定的输出目录）
+	outputDir := s.buildDir
+	if req.outputDir != "" {
+		outputDir = req.outputDir
+	}
 	if tempSrcDir != "" {
 		tempBuildDir := filepath.Join(workDir, "build")
 		log.Printf("[BuildService] 临时构建目录: %s", tempBuildDir)
-		log.Printf("[BuildService] 目标构建目录: %s", s.buildDir)
-		if err := s.copyBuildOutput(tempBuildDir, s.buildDir); err != nil {
+		log.Printf("[BuildService] 目标构建目录: %s", outputDir)
+		if err := s.copyBuildOutput(tempBuildDir, outputDir); err != nil {
 			log.Printf("[BuildService] 警告: 复制输出文件失败: %v", err)
 		}
 	}
 
 	// 从输出中解析生成的文件路径
 	filePath, fileName := s.parseOutputFile(outputStr, req.ClientName, format)
-	if filePath == "" {
+	if req.outputDir != "" {
+		// 指定的输出目录中只有本次构建的文件
+		filePath = ""
+		if fileName != "" {
+			filePath = filepath.Join(req.outputDir, fileName)
+		}
+	} else if filePath == "" {
 		// 尝试从 build 目录查找最新文件
 		log.Printf("[BuildService] 从输出解析文件路径失败，尝试查找最新文件")
 		filePath, fileName = s.findLatestFile(req.ClientName, format)
@@ -276,6 +365,18 @@ func (s *BuildService) Build(req BuildRequest) (*BuildResult, error) {
 		}, nil
 	}
 
+	// 表格样式无法通过 Pandoc 参数设置，在生成的文档中替换
+	if format == "word" {
+		if opts := s.resolveWordOptions(req); opts != nil && opts.TableStyle != "" {
+			if err := applyDocxTableStyle(filePath, opts.TableStyle); err != nil {
+				log.Printf("[BuildService] 警告: 设置表格样式失败: %v", err)
+				outputStr += fmt.Sprintf("[警告] 设置表格样式失败: %v\n", err)
+			} else {
+				log.Printf("[BuildService] 已设置表格样式: %s", opts.TableStyle)
+			}
+		}
+	}
+
 	log.Printf("[BuildService] ==========================================")
 	log.Printf("[BuildService] 构建成功!")
 	log.Printf("[BuildService] 输出文件: %s", filePath)
@@ -283,13 +384,83 @@ func (s *BuildService) Build(req BuildRequest) (*BuildResult, error) {
 	log.Printf("[BuildService] ==========================================")
 
 	return &BuildResult{
-		Success:  true,
-		FilePath: filePath,
-		FileName: fileName,
-		Output:   outputStr,
+		Success:    true,
+		FilePath:   filePath,
+		FileName:   fileName,
+		Output:     outputStr,
+		LintIssues: lintIssues,
 	}, nil
 }
 
+// selectBuildModules 评估配置中的模块条件，返回本次构建包含的模块
+// 配置中没有条件模块时返回 nil（由构建脚本直接读取配置）
+func (s *BuildService) selectBuildModules(req BuildRequest, format string, variables map[string]interface{}) ([]string, error) {
+	if req.DocumentType == "" {
+		return nil, nil
+	}
+	cfg, err := s.configMgr.GetConfig(req.ClientName, req.DocumentType)
+	if err != nil || !HasConditionalModules(cfg.Modules) {
+		return nil, nil
+	}
+
+	ctx := s.variableSvc.NewModuleContext(req.ClientName, req.DocumentType, format, cfg.Modules, variables)
+	modules, err := SelectModules(cfg.Modules, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(modules) == 0 {
+		return nil, fmt.Errorf("按条件筛选后没有需要构建的模块（格式: %s）", format)
+	}
+	log.Printf("[BuildService] 条件模块筛选: %d/%d 个模块", len(modules), len(cfg.Modules))
+	return modules, nil
+}
+
+// buildModules 本次构建的模块（已应用客户覆盖）
+// selectedModules 为条件筛选后的模块，nil 时使用配置中的全部模块；未指定文档类型或无法读取配置时返回 nil
+func (s *BuildService) buildModules(req BuildRequest, selectedModules []string) []string {
+	if req.DocumentType == "" {
+		return nil
+	}
+	modules := selectedModules
+	if modules == nil {
+		cfg, err := s.configMgr.GetConfig(req.ClientName, req.DocumentType)
+		if err != nil {
+			return nil
+		}
+		modules = ModulePaths(cfg.Modules)
+	}
+	return s.overrideSvc.ResolveModules(req.ClientName, modules)
+}
+
+// buildUsesIncludes 本次构建的模块中是否有 {{include}}（不知道构建哪些模块时检查整个 src 目录）
+func (s *BuildService) buildUsesIncludes(req BuildRequest, selectedModules []string) bool {
+	modules := s.buildModules(req, selectedModules)
+	if modules == nil {
+		return s.variableSvc.SrcUsesIncludes()
+	}
+	return s.variableSvc.ModulesUseIncludes(modules)
+}
+
+// lintBuildModules 检查本次构建模块的变量使用情况
+// selectedModules 为条件筛选后的模块，nil 时使用配置中的全部模块
+func (s *BuildService) lintBuildModules(req BuildRequest, selectedModules []string) []LintIssue {
+	modules := s.buildModules(req, selectedModules)
+	if modules == nil {
+		return nil
+	}
+
+	result, err := s.variableSvc.LintModules(modules)
+	if err != nil {
+		log.Printf("[BuildService] 警告: 变量检查失败: %v", err)
+		return nil
+	}
+
+	for _, issue := range result.Issues {
+		log.Printf("[BuildService] 变量检查: %s", issue.String())
+	}
+	return result.Issues
+}
+
 // findScript 查找构建脚本，优先可执行文件目录的 bin，其次 workDir
 func (s *BuildService) findScript(name string) string {
 	log.Printf("[BuildService] 查找脚本: %s", name)
@@ -550,6 +721,21 @@ func (s *BuildService) StreamBuild(req BuildRequest, outputChan chan<- string) (
 		format = "word"
 	}
 
+	if err := s.configMgr.CheckBuildPandocArgs(req.ClientName, req.DocumentType); err != nil {
+		log.Printf("[BuildService] 错误: %v", err)
+		return &BuildResult{
+			Success: false,
+			Error:   err.Error(),
+		}, nil
+	}
+	// 流式构建直接使用工作目录，无法筛选其他输出格式的模板变量
+	if s.resolveTemplateVars(req, format) != nil {
+		return &BuildResult{
+			Success: false,
+			Error:   fmt.Sprintf("配置中有 %s 输出不支持的模板变量，请使用普通构建", format),
+		}, nil
+	}
+
 	args := s.buildCommandArgs(req.ClientName, req.DocumentType, req.CustomName, format)
 
 	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
@@ -657,9 +843,61 @@ func (s *BuildService) buildCommandArgsWithWorkDir(clientName, docType, customNa
 	return s.buildCommandArgs(clientName, docType, customName, format, workDir)
 }
 
+// resolveWordOptions 本次构建的 Word 选项：配置（含继承）中的选项被请求中设置的字段覆盖
+func (s *BuildService) resolveWordOptions(req BuildRequest) *WordOptions {
+	var configured *WordOptions
+	if req.DocumentType != "" {
+		if cfg, err := s.configMgr.GetConfig(req.ClientName, req.DocumentType); err == nil {
+			configured = cfg.WordOptions
+		}
+	}
+	return mergeWordOptions(configured, req.WordOptions)
+}
+
+// resolveBuildVariables 合并构建所用的变量值
+// 优先级（低 → 高）：src/_variables.yaml → 客户 variables.yaml → 文档类型 variables → 请求值
+// 模块声明的默认值在渲染时由 RenderContent 兜底
+// 配置或变量文件无法读取时返回错误（缺少变量值构建出的文档是错误的）
+func (s *BuildService) resolveBuildVariables(req BuildRequest) (map[string]interface{}, error) {
+	var docTypeValues map[string]interface{}
+	if req.DocumentType != "" {
+		cfg, err := s.configMgr.GetConfig(req.ClientName, req.DocumentType)
+		if err != nil {
+			return nil, err
+		}
+		docTypeValues = cfg.Variables
+	}
+
+	values, err := s.variableSvc.ResolveValues(nil, req.ClientName, docTypeValues, req.Variables)
+	if err != nil {
+		return nil, fmt.Errorf("读取变量配置档失败: %w", err)
+	}
+	return values, nil
+}
+
+// resolveTemplateVars 本次输出格式可用的模板变量
+// 配置（含继承）中有其他模板的变量时返回筛选后的变量（可能为空映射），否则返回 nil 表示不需要改写配置
+func (s *BuildService) resolveTemplateVars(req BuildRequest, format string) map[string]interface{} {
+	if req.DocumentType == "" {
+		return nil
+	}
+	cfg, err := s.configMgr.GetConfig(req.ClientName, req.DocumentType)
+	if err != nil {
+		return nil
+	}
+	kept, skipped := FilterTemplateVars(format, cfg.TemplateVars)
+	if len(skipped) == 0 {
+		return nil
+	}
+	log.Printf("[BuildService] 忽略 %s 输出不支持的模板变量: %s", format, strings.Join(skipped, ", "))
+	return kept
+}
+
 // prepareVariableRenderedSrc 准备变量替换后的源文件目录
-// 返回临时 src 目录路径
-func (s *BuildService) prepareVariableRenderedSrc(variables map[string]interface{}) (string, error) {
+// 依次应用条件模块筛选结果、客户覆盖模块、展开 {{include}}、替换变量，返回临时 src 目录路径
+// templateVars 不为 nil 时替换临时配置中的 template_variables
+func (s *BuildService) prepareVariableRenderedSrc(req BuildRequest, variables map[string]interface{}, selectedModules []string, templateVars map[string]interface{}) (string, error) {
+	clientName := req.ClientName
 	log.Printf("[BuildService] 开始变量替换处理...")
 
 	// 创建临时目录
@@ -681,63 +919,200 @@ func (s *BuildService) prepareVariableRenderedSrc(variables map[string]interface
 		return "", fmt.Errorf("复制工作目录失败: %w", err)
 	}
 
-	// 遍历临时 src 目录中的所有 .md 文件，进行变量替换
+	// 配置继承：把解析后的完整配置写入临时目录，构建脚本无需理解 extends
+	if req.DocumentType != "" && s.configMgr.ConfigExtends(req.ClientName, req.DocumentType) != "" {
+		data, err := s.configMgr.ResolvedConfigData(req.ClientName, req.DocumentType)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(tempDir, "clients", req.ClientName, req.DocumentType+".yaml"), data, 0644)
+		}
+		if err != nil {
+			os.RemoveAll(tempDir)
+			return "", fmt.Errorf("写入解析继承后的配置失败: %w", err)
+		}
+	}
+
+	// 条件模块：把筛选后的模块列表写入临时目录中的配置，构建脚本只需读取普通列表
+	if selectedModules != nil {
+		if err := writeResolvedModules(tempDir, req.ClientName, req.DocumentType, selectedModules); err != nil {
+			os.RemoveAll(tempDir)
+			return "", fmt.Errorf("写入筛选后的模块列表失败: %w", err)
+		}
+	}
+
+	// 请求覆盖的 Word 选项：把合并后的选项写入临时目录中的配置
+	if req.DocumentType != "" && !req.WordOptions.IsZero() {
+		if err := setTempConfigField(tempDir, req.ClientName, req.DocumentType, "word_options", s.resolveWordOptions(req)); err != nil {
+			os.RemoveAll(tempDir)
+			return "", fmt.Errorf("写入 Word 选项失败: %w", err)
+		}
+	}
+
+	// 按输出格式筛选后的模板变量
+	if templateVars != nil {
+		if err := setTempConfigField(tempDir, req.ClientName, req.DocumentType, "template_variables", templateVars); err != nil {
+			os.RemoveAll(tempDir)
+			return "", fmt.Errorf("写入模板变量失败: %w", err)
+		}
+	}
+
+	// 客户覆盖的模块替换同路径的基础模块
+	overridden, err := s.overrideSvc.ApplyOverrides(clientName, tempSrcDir)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return "", fmt.Errorf("应用客户覆盖模块失败: %w", err)
+	}
+	for _, rel := range overridden {
+		log.Printf("[BuildService] 使用客户覆盖模块: src/%s", rel)
+	}
+
+	// 收集临时 src 目录中的所有 .md 文件
+	var mdFiles []string
 	err = filepath.Walk(tempSrcDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
-			return nil
-		}
-		if !strings.HasSuffix(info.Name(), ".md") {
-			return nil
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".md") {
+			mdFiles = append(mdFiles, path)
 		}
+		return nil
+	})
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return "", fmt.Errorf("变量替换处理失败: %w", err)
+	}
 
+	// 先展开所有文件的 {{include}}，再统一替换变量，避免读到已替换的被引用文件
+	tempVariableSvc := NewVariableService(tempSrcDir)
+	contents := make(map[string]string)
+	declarationsByFile := make(map[string][]VariableDeclaration)
+	expandedFiles := make(map[string]bool)
+	for _, path := range mdFiles {
 		// 读取文件内容
-		content, err := os.ReadFile(path)
+		data, err := os.ReadFile(path)
 		if err != nil {
 			log.Printf("[BuildService] 警告: 读取文件失败 %s: %v", path, err)
-			return nil // 继续处理其他文件
+			continue // 继续处理其他文件
 		}
+		content := string(data)
 
 		// 提取变量声明
-		declarations, err := s.variableSvc.ExtractVariablesFromContent(string(content), path)
+		declarations, err := s.variableSvc.ExtractVariablesFromContent(content, path)
 		if err != nil {
 			log.Printf("[BuildService] 警告: 提取变量声明失败 %s: %v", path, err)
-			return nil
+			continue
+		}
+
+		// 展开 {{include}}（在变量替换之前）
+		if HasIncludes(content) {
+			expanded, included, err := tempVariableSvc.ExpandIncludes(content, path)
+			if err != nil {
+				log.Printf("[BuildService] 警告: 展开引用失败 %s: %v", path, err)
+				continue
+			}
+			content = expanded
+			expandedFiles[path] = true
+
+			// 被引用文件的变量与顶层模块一样合并（同名变量类型冲突时记录警告）
+			varsByFile := map[string][]VariableDeclaration{path: declarations}
+			for file, decls := range included {
+				varsByFile[file] = decls
+			}
+			var conflicts []ValidationError
+			declarations, conflicts = s.variableSvc.MergeVariables(varsByFile)
+			for _, conflict := range conflicts {
+				log.Printf("[BuildService] 警告: %s", conflict.Error())
+			}
+			log.Printf("[BuildService] 已展开引用: %s", filepath.Base(path))
+		}
+
+		contents[path] = content
+		declarationsByFile[path] = declarations
+	}
+
+	for _, path := range mdFiles {
+		content, ok := contents[path]
+		if !ok {
+			continue
 		}
+		declarations := declarationsByFile[path]
 
-		// 如果文件没有变量声明，跳过
+		// 如果文件没有变量声明，只写回展开引用后的内容
 		if len(declarations) == 0 {
-			return nil
+			if expandedFiles[path] {
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					log.Printf("[BuildService] 警告: 写入文件失败 %s: %v", path, err)
+				}
+			}
+			continue
 		}
 
 		// 渲染内容
-		rendered, err := s.variableSvc.RenderContent(string(content), declarations, variables)
+		rendered, err := s.variableSvc.RenderContent(content, declarations, variables)
 		if err != nil {
 			log.Printf("[BuildService] 警告: 变量替换失败 %s: %v", path, err)
-			return nil
+			continue
 		}
 
 		// 写回文件
-		if err := os.WriteFile(path, []byte(rendered), info.Mode()); err != nil {
+		if err := os.WriteFile(path, []byte(rendered), 0644); err != nil {
 			log.Printf("[BuildService] 警告: 写入文件失败 %s: %v", path, err)
-			return nil
+			continue
 		}
 
 		log.Printf("[BuildService] 已替换变量: %s", filepath.Base(path))
-		return nil
-	})
-
-	if err != nil {
-		os.RemoveAll(tempDir)
-		return "", fmt.Errorf("变量替换处理失败: %w", err)
 	}
 
 	log.Printf("[BuildService] 变量替换完成，临时目录: %s", tempDir)
 	return tempSrcDir, nil
 }
 
+// writeResolvedModules 把临时目录中配置文件的 modules 替换为筛选后的路径列表（保留其他内容）
+func writeResolvedModules(tempDir, clientName, docType string, modules []string) error {
+	return setTempConfigField(tempDir, clientName, docType, "modules", modules)
+}
+
+// setTempConfigField 替换临时目录中配置文件的一个顶级字段（字段不存在时追加，保留其他内容）
+func setTempConfigField(tempDir, clientName, docType, key string, value interface{}) error {
+	configPath := filepath.Join(tempDir, "clients", clientName, docType+".yaml")
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		configPath = filepath.Join(tempDir, "clients", clientName, docType+".yml")
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("配置文件格式无效: %s", configPath)
+	}
+
+	valueNode := &yaml.Node{}
+	if err := valueNode.Encode(value); err != nil {
+		return err
+	}
+	root := doc.Content[0]
+	found := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == key {
+			root.Content[i+1] = valueNode
+			found = true
+		}
+	}
+	if !found {
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, valueNode)
+	}
+
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(configPath, out, 0644)
+}
+
 // copyWorkDir 复制工作目录（排除 build 目录和 .git 目录）
 func (s *BuildService) copyWorkDir(src, dst string) error {
 	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
@@ -751,11 +1126,16 @@ func (s *BuildService) copyWorkDir(src, dst string) error {
 			return err
 		}
 
-		// 跳过 build 目录和 .git 目录
-		if info.IsDir() {
-			if relPath == "build" || relPath == ".git" || strings.HasPrefix(relPath, "build"+string(filepath.Separator)) || strings.HasPrefix(relPath, ".git"+string(filepath.Separator)) {
+		// 跳过 build 目录和工作目录顶层的隐藏文件和目录
+		// （.git、回收站 .trash，以及 .users.json、.tokens.json、.audit.log 等账号和审计数据，构建不需要，也不应出现在临时目录中）
+		if relPath != "." && !strings.Contains(relPath, string(filepath.Separator)) && strings.HasPrefix(relPath, ".") {
+			if info.IsDir() {
 				return filepath.SkipDir
 			}
+			return nil
+		}
+		if info.IsDir() && relPath == "build" {
+			return filepath.SkipDir
 		}
 
 		// 目标路径
@@ -824,7 +1204,7 @@ func (s *BuildService) copyBuildOutput(tempBuildDir, targetBuildDir string) erro
 			continue
 		}
 		name := entry.Name()
-		if !strings.HasSuffix(name, ".docx") && !strings.HasSuffix(name, ".pdf") {
+		if !strings.HasSuffix(name, ".docx") && !strings.HasSuffix(name, ".pdf") && !strings.HasSuffix(name, ".zip") {
 			continue
 		}
 
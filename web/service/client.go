@@ -4,8 +4,10 @@ package service
 import (
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -18,6 +20,7 @@ type Client struct {
 	ModifiedAt  time.Time `json:"modifiedAt"`  // 最后修改时间
 	IsCustom    bool      `json:"isCustom"`    // 是否为自定义配置
 	Locked      bool      `json:"locked"`      // 是否已锁定
+	Locks       []ConfigLock `json:"locks,omitempty"` // 当前有效的锁定（整个客户和文档类型）
 }
 
 // ClientMetadata 客户元数据（从 metadata.yaml 读取）
@@ -135,7 +138,7 @@ func (s *ClientService) CreateClient(name, displayName string) error {
 
 // hasValidConfig 检查目录是否包含有效配置文件
 func (s *ClientService) hasValidConfig(clientDir string) bool {
-	// 检查是否有任何 .yaml 配置文件（除了 metadata.yaml）
+	// 检查是否有任何 .yaml 配置文件（除了 metadata.yaml 和 variables.yaml）
 	entries, err := os.ReadDir(clientDir)
 	if err != nil {
 		return false
@@ -146,7 +149,7 @@ func (s *ClientService) hasValidConfig(clientDir string) bool {
 			continue
 		}
 		name := entry.Name()
-		if filepath.Ext(name) == ".yaml" && name != "metadata.yaml" {
+		if filepath.Ext(name) == ".yaml" && !isReservedConfigName(strings.TrimSuffix(name, ".yaml")) {
 			return true
 		}
 	}
@@ -160,8 +163,9 @@ func (s *ClientService) getClientInfo(name, clientDir string) (*Client, error) {
 		Name:        name,
 		DisplayName: name, // 默认使用目录名
 		IsCustom:    s.isCustomClient(clientDir),
-		Locked:      s.isClientLocked(clientDir),
 	}
+	client.Locks = NewConfigManager(s.clientsDir).ListLocks(name)
+	client.Locked = len(client.Locks) > 0 && client.Locks[0].DocType == ""
 
 	// 获取目录修改时间
 	info, err := os.Stat(clientDir)
@@ -197,12 +201,6 @@ func (s *ClientService) isCustomClient(clientDir string) bool {
 	return err == nil
 }
 
-// isClientLocked 检查客户是否已锁定
-func (s *ClientService) isClientLocked(clientDir string) bool {
-	lockedPath := filepath.Join(clientDir, ".locked")
-	_, err := os.Stat(lockedPath)
-	return err == nil
-}
 
 // IsCustomClient 检查客户是否为自定义配置（公开方法）
 func (s *ClientService) IsCustomClient(name string) bool {
@@ -259,6 +257,20 @@ func (s *ClientService) copyDefaultTemplate(srcDir, dstDir, clientName, displayN
 		// 非致命错误，继续
 	}
 
+	// 记录每个文档类型配置的来源，之后可以对比模板配置的更新
+	configMgr := NewConfigManager(s.clientsDir)
+	sourceClient := filepath.Base(srcDir)
+	for _, entry := range entries {
+		name := entry.Name()
+		baseName := strings.TrimSuffix(name, ".yaml")
+		if entry.IsDir() || filepath.Ext(name) != ".yaml" || isReservedConfigName(baseName) {
+			continue
+		}
+		if err := configMgr.RecordUpstream(clientName, baseName, sourceClient+"/"+baseName); err != nil {
+			log.Printf("[ClientService] 警告: 记录配置来源失败: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -3,6 +3,7 @@ package service
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -55,18 +56,51 @@ type PdfOptions struct {
 	FooterCenter string `json:"footer-center,omitempty" yaml:"footer-center,omitempty"`
 }
 
+// WordOptions Word 输出选项
+// 开关类选项使用指针：未设置时沿用 pandoc_args 中的参数
+type WordOptions struct {
+	// 目录和编号
+	Toc            *bool `json:"toc,omitempty" yaml:"toc,omitempty"`
+	TocDepth       int   `json:"toc-depth,omitempty" yaml:"toc-depth,omitempty"`
+	NumberSections *bool `json:"number-sections,omitempty" yaml:"number-sections,omitempty"`
+
+	// 代码高亮
+	HighlightStyle string `json:"highlight-style,omitempty" yaml:"highlight-style,omitempty"`
+
+	// 版式
+	PageBreakBeforeChapter *bool  `json:"page-break-before-chapter,omitempty" yaml:"page-break-before-chapter,omitempty"`
+	TableStyle             string `json:"table-style,omitempty" yaml:"table-style,omitempty"`
+
+	// 图表标题前缀（如 图、表，生成“图 1 标题”）
+	FigurePrefix string `json:"figure-prefix,omitempty" yaml:"figure-prefix,omitempty"`
+	TablePrefix  string `json:"table-prefix,omitempty" yaml:"table-prefix,omitempty"`
+
+	// 参考文档（templates 目录下的 .docx，优先于 template）
+	ReferenceDoc string `json:"reference-doc,omitempty" yaml:"reference-doc,omitempty"`
+}
+
+// IsZero 没有设置任何选项（yaml 输出时省略 word_options）
+func (o *WordOptions) IsZero() bool {
+	return o == nil || *o == WordOptions{}
+}
+
 // CustomConfig 自定义配置
 type CustomConfig struct {
-	ClientName    string                 `json:"clientName"`              // 客户名称（目录名）
-	DocTypeName   string                 `json:"docTypeName"`             // 文档类型名称（配置文件名）
-	DisplayName   string                 `json:"displayName"`             // 显示名称
-	Template      string                 `json:"template"`                // 模板文件名
-	Modules       []string               `json:"modules"`                 // 模块列表（有序）
-	PandocArgs    []string               `json:"pandocArgs"`              // Pandoc 参数
-	OutputPattern string                 `json:"outputPattern"`           // 输出文件名模式
-	PdfOptions    *PdfOptions            `json:"pdfOptions,omitempty"`    // PDF 输出选项
-	Variables     map[string]interface{} `json:"variables,omitempty"`     // 变量值
-	Metadata      *MetadataConfig        `json:"metadata,omitempty"`      // 元数据配置
+	ClientName    string                 `json:"clientName"`                  // 客户名称（目录名）
+	DocTypeName   string                 `json:"docTypeName"`                 // 文档类型名称（配置文件名）
+	DisplayName   string                 `json:"displayName"`                 // 显示名称
+	Template      string                 `json:"template"`                    // 模板文件名
+	Modules       []ModuleEntry          `json:"modules"`                     // 模块列表（有序，条目可带 when 条件）
+	PandocArgs    []string               `json:"pandocArgs"`                  // Pandoc 参数
+	OutputPattern string                 `json:"outputPattern"`               // 输出文件名模式
+	PdfOptions    *PdfOptions            `json:"pdfOptions,omitempty"`        // PDF 输出选项
+	WordOptions   *WordOptions           `json:"wordOptions,omitempty"`       // Word 输出选项
+	Variables     map[string]interface{} `json:"variables,omitempty"`         // 变量值
+	TemplateVars  map[string]interface{} `json:"templateVariables,omitempty"` // 传给输出模板的变量（-V，如 logo、footer-left）
+	Metadata      *MetadataConfig        `json:"metadata,omitempty"`          // 元数据配置
+	Extends       string                 `json:"extends,omitempty"`           // 继承的配置（如 ../标准文档/运维手册）
+	Upstream      string                 `json:"upstream,omitempty"`          // 复制来源的标准配置（如 标准文档/运维手册）
+	ApprovedBy    string                 `json:"-"`                           // 确认不在允许列表中的 pandoc_args 的管理员（由处理器在校验角色后设置）
 }
 
 // MetadataConfig 元数据配置
@@ -101,23 +135,29 @@ type ConfigYAML struct {
 	// 配置字段
 	ClientName    string                 `yaml:"client_name"`
 	Template      string                 `yaml:"template"`
-	Modules       []string               `yaml:"modules"`
+	Modules       []ModuleEntry          `yaml:"modules"`
 	PandocArgs    []string               `yaml:"pandoc_args"`
 	OutputPattern string                 `yaml:"output_pattern"`
 	PdfOptions    *PdfOptions            `yaml:"pdf_options,omitempty"`
+	WordOptions   *WordOptions           `yaml:"word_options,omitempty"`
 	Variables     map[string]interface{} `yaml:"variables,omitempty"`
+	TemplateVars  map[string]interface{} `yaml:"template_variables,omitempty"`
 }
 
 // ConfigManager 配置管理器
 type ConfigManager struct {
 	clientsDir string
+	trash      *TrashService
 }
 
 // 自定义配置标记文件名
 const customMarkerFile = ".custom"
 
-// 锁定标记文件名
-const lockedMarkerFile = ".locked"
+// isReservedConfigName 检查客户目录下的 YAML 文件是否为保留文件（不是文档类型配置）
+// metadata.yaml 为客户元数据，variables.yaml 为客户变量配置档
+func isReservedConfigName(baseName string) bool {
+	return baseName == "metadata" || baseName == strings.TrimSuffix(clientVariablesFile, ".yaml")
+}
 
 // 非法字符正则表达式
 var invalidNameChars = regexp.MustCompile(`[/\\:*?"<>|]`)
@@ -129,6 +169,11 @@ func NewConfigManager(clientsDir string) *ConfigManager {
 	}
 }
 
+// SetTrash 设置回收站，删除的配置移入回收站（未设置时直接删除）
+func (m *ConfigManager) SetTrash(trash *TrashService) {
+	m.trash = trash
+}
+
 // IsCustomConfig 检查是否为自定义配置
 func (m *ConfigManager) IsCustomConfig(clientName string) bool {
 	markerPath := filepath.Join(m.clientsDir, clientName, customMarkerFile)
@@ -136,33 +181,6 @@ func (m *ConfigManager) IsCustomConfig(clientName string) bool {
 	return err == nil
 }
 
-// IsClientLocked 检查客户配置是否已锁定
-func (m *ConfigManager) IsClientLocked(clientName string) bool {
-	lockedPath := filepath.Join(m.clientsDir, clientName, lockedMarkerFile)
-	_, err := os.Stat(lockedPath)
-	return err == nil
-}
-
-// LockClient 锁定客户配置
-func (m *ConfigManager) LockClient(clientName string) error {
-	clientDir := filepath.Join(m.clientsDir, clientName)
-	if _, err := os.Stat(clientDir); os.IsNotExist(err) {
-		return fmt.Errorf("客户不存在: %s", clientName)
-	}
-	
-	lockedPath := filepath.Join(clientDir, lockedMarkerFile)
-	return os.WriteFile(lockedPath, []byte(""), 0644)
-}
-
-// UnlockClient 解锁客户配置
-func (m *ConfigManager) UnlockClient(clientName string) error {
-	lockedPath := filepath.Join(m.clientsDir, clientName, lockedMarkerFile)
-	if _, err := os.Stat(lockedPath); os.IsNotExist(err) {
-		return nil // 本来就没锁定
-	}
-	return os.Remove(lockedPath)
-}
-
 // validateClientName 验证客户名称
 func (m *ConfigManager) validateClientName(name string) error {
 	if strings.TrimSpace(name) == "" {
@@ -186,10 +204,20 @@ func (m *ConfigManager) validateDocTypeName(name string) error {
 }
 
 // validateModules 验证模块列表
-func (m *ConfigManager) validateModules(modules []string) error {
+func (m *ConfigManager) validateModules(modules []ModuleEntry) error {
 	if len(modules) == 0 {
 		return fmt.Errorf("请至少选择一个文档模块")
 	}
+	for _, module := range modules {
+		if strings.TrimSpace(module.Path) == "" {
+			return fmt.Errorf("模块路径不能为空")
+		}
+		if module.When != nil {
+			if err := module.When.Validate(); err != nil {
+				return fmt.Errorf("模块 %s 的条件无效: %w", module.Path, err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -202,13 +230,37 @@ func (m *ConfigManager) CreateConfig(config CustomConfig) error {
 	if err := m.validateDocTypeName(config.DocTypeName); err != nil {
 		return err
 	}
-	if err := m.validateModules(config.Modules); err != nil {
-		return err
-	}
 
 	clientDir := filepath.Join(m.clientsDir, config.ClientName)
 	configPath := filepath.Join(clientDir, config.DocTypeName+".yaml")
 
+	// 继承其他配置时，未设置的字段沿用父配置
+	if config.Extends != "" {
+		parent, err := m.extendsParentConfig(configPath, config.Extends)
+		if err != nil {
+			return err
+		}
+		config = inheritEmptyFields(parent, config)
+	}
+	// 从标准配置复制时，未设置的字段使用标准配置的值
+	if config.Upstream != "" {
+		sourceClient, sourceDoc, err := splitConfigName(config.Upstream)
+		if err != nil {
+			return err
+		}
+		upstream, err := m.GetConfig(sourceClient, sourceDoc)
+		if err != nil {
+			return fmt.Errorf("读取标准配置失败: %w", err)
+		}
+		config = inheritEmptyFields(upstream, config)
+	}
+	if err := m.validateModules(config.Modules); err != nil {
+		return err
+	}
+	if err := m.checkPandocArgs(config.ClientName+"/"+config.DocTypeName, config.PandocArgs, config.ApprovedBy); err != nil {
+		return err
+	}
+
 	// 检查客户目录是否存在
 	clientExists := false
 	if info, err := os.Stat(clientDir); err == nil && info.IsDir() {
@@ -247,7 +299,7 @@ func (m *ConfigManager) CreateConfig(config CustomConfig) error {
 	}
 
 	// 生成配置文件
-	if err := m.writeConfigFile(configPath, config); err != nil {
+	if _, err := m.saveConfigFile(configPath, config); err != nil {
 		// 如果是新创建的客户目录，清理
 		if !clientExists {
 			os.RemoveAll(clientDir)
@@ -255,11 +307,65 @@ func (m *ConfigManager) CreateConfig(config CustomConfig) error {
 		return fmt.Errorf("写入配置文件失败: %w", err)
 	}
 
+	// 记录复制来源，之后可以对比标准配置的更新
+	if config.Upstream != "" {
+		if err := m.RecordUpstream(config.ClientName, config.DocTypeName, config.Upstream); err != nil {
+			return fmt.Errorf("记录配置来源失败: %w", err)
+		}
+	}
+
 	return nil
 }
 
-// writeConfigFile 写入配置文件
-func (m *ConfigManager) writeConfigFile(path string, config CustomConfig) error {
+// saveConfigFile 写入配置文件，继承其他配置时只写入差异
+// 文件已存在时只修改变化的字段（保留注释、字段顺序和界面不处理的字段），返回文件的变更（统一 diff 格式）
+func (m *ConfigManager) saveConfigFile(path string, config CustomConfig) (string, error) {
+	var content []byte
+	var err error
+	if config.Extends != "" {
+		content, err = m.renderConfigDelta(path, config.Extends, config)
+	} else {
+		content, err = renderConfigFile(config)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	existing, err := os.ReadFile(path)
+	if err == nil {
+		if content, err = patchConfigFile(existing, content); err != nil {
+			return "", err
+		}
+		if string(content) == string(existing) {
+			return "", nil
+		}
+	}
+	// 原文件中已有的问题（如手工添加的字段）不阻止保存
+	if errs := newConfigSchemaErrors(existing, content); len(errs) > 0 {
+		return "", &ConfigValidationError{Errors: errs}
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return "", err
+	}
+
+	name := relSlash(filepath.Dir(m.clientsDir), path)
+	return UnifiedDiff(string(existing), string(content), "a/"+name, "b/"+name), nil
+}
+
+// renderConfigFile 生成完整的配置文件内容
+func renderConfigFile(config CustomConfig) ([]byte, error) {
+	data, err := yaml.Marshal(buildConfigYAML(config))
+	if err != nil {
+		return nil, err
+	}
+
+	// 添加注释头
+	content := fmt.Sprintf("# %s 配置\n# 自定义生成\n\n%s", config.DocTypeName, string(data))
+	return []byte(content), nil
+}
+
+// buildConfigYAML 把配置转换为配置文件结构
+func buildConfigYAML(config CustomConfig) ConfigYAML {
 	yamlConfig := ConfigYAML{
 		ClientName:    config.DisplayName,
 		Template:      config.Template,
@@ -267,7 +373,9 @@ func (m *ConfigManager) writeConfigFile(path string, config CustomConfig) error
 		PandocArgs:    config.PandocArgs,
 		OutputPattern: config.OutputPattern,
 		PdfOptions:    config.PdfOptions,
+		WordOptions:   config.WordOptions,
 		Variables:     config.Variables,
+		TemplateVars:  config.TemplateVars,
 	}
 
 	// 将元数据字段写入顶层（与构建脚本兼容）
@@ -292,18 +400,7 @@ func (m *ConfigManager) writeConfigFile(path string, config CustomConfig) error
 		}
 	}
 
-	data, err := yaml.Marshal(yamlConfig)
-	if err != nil {
-		return err
-	}
-
-	// 添加注释头
-	content := fmt.Sprintf("# %s 配置\n# 自定义生成\n\n%s", config.DocTypeName, string(data))
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
-		return err
-	}
-
-	return nil
+	return yamlConfig
 }
 
 // IsEmpty 检查元数据是否为空
@@ -315,21 +412,11 @@ func (m *MetadataConfig) IsEmpty() bool {
 		m.Version == "" && m.Date == "" && m.TocTitle == "" && m.Client == nil
 }
 
-// GetConfig 获取配置详情
+// GetConfig 获取配置详情（已解析 extends 继承链）
 func (m *ConfigManager) GetConfig(clientName, docTypeName string) (*CustomConfig, error) {
-	configPath := filepath.Join(m.clientsDir, clientName, docTypeName+".yaml")
-
-	data, err := os.ReadFile(configPath)
+	yamlConfig, err := m.loadConfigYAML(clientName, docTypeName)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("配置不存在: %s/%s", clientName, docTypeName)
-		}
-		return nil, fmt.Errorf("读取配置文件失败: %w", err)
-	}
-
-	var yamlConfig ConfigYAML
-	if err := yaml.Unmarshal(data, &yamlConfig); err != nil {
-		return nil, fmt.Errorf("解析配置文件失败: %w", err)
+		return nil, err
 	}
 
 	// 从顶层字段构建元数据（文档级别元数据）
@@ -357,34 +444,42 @@ func (m *ConfigManager) GetConfig(clientName, docTypeName string) (*CustomConfig
 		PandocArgs:    yamlConfig.PandocArgs,
 		OutputPattern: yamlConfig.OutputPattern,
 		PdfOptions:    yamlConfig.PdfOptions,
+		WordOptions:   yamlConfig.WordOptions,
 		Variables:     yamlConfig.Variables,
+		TemplateVars:  yamlConfig.TemplateVars,
 		Metadata:      metadata,
+		Extends:       m.ConfigExtends(clientName, docTypeName),
+		Upstream:      m.upstreamSource(clientName, docTypeName),
 	}, nil
 }
 
-// UpdateConfig 更新配置
-func (m *ConfigManager) UpdateConfig(clientName, docTypeName string, config CustomConfig) error {
-	// 检查客户是否已锁定
-	if m.IsClientLocked(clientName) {
-		return fmt.Errorf("客户配置已锁定，请先解锁后再修改")
+// upstreamSource 返回配置的复制来源（未记录时为空）
+func (m *ConfigManager) upstreamSource(clientName, docTypeName string) string {
+	record, err := m.GetUpstream(clientName, docTypeName)
+	if err != nil || record == nil {
+		return ""
 	}
+	return record.Source
+}
 
+// UpdateConfig 更新配置，返回配置文件的变更（统一 diff 格式）
+func (m *ConfigManager) UpdateConfig(clientName, docTypeName string, config CustomConfig) (string, error) {
 	configPath := filepath.Join(m.clientsDir, clientName, docTypeName+".yaml")
 
 	// 检查配置是否存在
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return fmt.Errorf("配置不存在: %s/%s", clientName, docTypeName)
+		return "", fmt.Errorf("配置不存在: %s/%s", clientName, docTypeName)
 	}
 
 	// 读取现有配置，以便保留前端未发送的字段
 	existingConfig, err := m.GetConfig(clientName, docTypeName)
 	if err != nil {
-		return fmt.Errorf("读取现有配置失败: %w", err)
+		return "", fmt.Errorf("读取现有配置失败: %w", err)
 	}
 
 	// 验证输入
 	if err := m.validateModules(config.Modules); err != nil {
-		return err
+		return "", err
 	}
 
 	// 合并配置：前端发送的值优先，但保留前端未处理的字段
@@ -392,7 +487,64 @@ func (m *ConfigManager) UpdateConfig(clientName, docTypeName string, config Cust
 	mergedConfig.ClientName = clientName
 	mergedConfig.DocTypeName = docTypeName
 
-	return m.writeConfigFile(configPath, *mergedConfig)
+	// 不在允许列表中的 Pandoc 参数需要有管理员确认记录（文件中已有的参数也不例外）
+	if err := m.checkPandocArgs(clientName+"/"+docTypeName, mergedConfig.PandocArgs, config.ApprovedBy); err != nil {
+		return "", err
+	}
+
+	// 继承关系：未指定时保持原有的 extends
+	mergedConfig.Extends = existingConfig.Extends
+	if config.Extends != "" {
+		mergedConfig.Extends = config.Extends
+	}
+
+	return m.saveConfigFile(configPath, *mergedConfig)
+}
+
+// extendsParentConfig 读取 extends 指向的父配置（已解析继承链）
+func (m *ConfigManager) extendsParentConfig(configPath, extends string) (*CustomConfig, error) {
+	parentPath, err := m.resolveExtendsPath(configPath, extends)
+	if err != nil {
+		return nil, err
+	}
+	name := m.configName(parentPath)
+	idx := strings.Index(name, "/")
+	return m.GetConfig(name[:idx], name[idx+1:])
+}
+
+// inheritEmptyFields 未设置的字段使用父配置的值
+func inheritEmptyFields(parent *CustomConfig, config CustomConfig) CustomConfig {
+	if config.DisplayName == "" {
+		config.DisplayName = parent.DisplayName
+	}
+	if config.Template == "" {
+		config.Template = parent.Template
+	}
+	if len(config.Modules) == 0 {
+		config.Modules = parent.Modules
+	}
+	if len(config.PandocArgs) == 0 {
+		config.PandocArgs = parent.PandocArgs
+	}
+	if config.OutputPattern == "" {
+		config.OutputPattern = parent.OutputPattern
+	}
+	if config.PdfOptions == nil {
+		config.PdfOptions = parent.PdfOptions
+	}
+	if config.WordOptions == nil {
+		config.WordOptions = parent.WordOptions
+	}
+	if config.Variables == nil {
+		config.Variables = parent.Variables
+	}
+	if config.TemplateVars == nil {
+		config.TemplateVars = parent.TemplateVars
+	}
+	if config.Metadata == nil {
+		config.Metadata = parent.Metadata
+	}
+	return config
 }
 
 // mergeConfigs 合并配置，newConfig 的非空值优先
@@ -427,6 +579,18 @@ func (m *ConfigManager) mergeConfigs(existing, newConfig *CustomConfig) *CustomC
 	// 合并 PDF 选项
 	result.PdfOptions = m.mergePdfOptions(existing.PdfOptions, newConfig.PdfOptions)
 
+	// Word 选项由前端整体提交，未发送时保留现有的
+	result.WordOptions = newConfig.WordOptions
+	if result.WordOptions == nil && existing != nil {
+		result.WordOptions = existing.WordOptions
+	}
+
+	// 模板变量未发送时保留现有的（发送空对象表示清空）
+	result.TemplateVars = newConfig.TemplateVars
+	if result.TemplateVars == nil && existing != nil {
+		result.TemplateVars = existing.TemplateVars
+	}
+
 	return result
 }
 
@@ -527,28 +691,24 @@ func (m *ConfigManager) mergePdfOptions(existing, newOpts *PdfOptions) *PdfOptio
 	return result
 }
 
-// DeleteConfig 删除配置
-func (m *ConfigManager) DeleteConfig(clientName, docTypeName string) error {
+// DeleteConfig 删除自定义配置（移入回收站），没有其他配置时连同客户目录一起删除
+// 返回回收站条目（没有设置回收站时为 nil）
+func (m *ConfigManager) DeleteConfig(clientName, docTypeName, deletedBy string) (*TrashItem, error) {
 	// 检查是否为自定义配置（只有自定义配置可以删除）
 	if !m.IsCustomConfig(clientName) {
-		return fmt.Errorf("不能删除预置配置")
-	}
-
-	// 检查客户是否已锁定
-	if m.IsClientLocked(clientName) {
-		return fmt.Errorf("客户配置已锁定，请先解锁后再删除")
+		return nil, fmt.Errorf("不能删除预置配置")
 	}
 
 	configPath := filepath.Join(m.clientsDir, clientName, docTypeName+".yaml")
 
 	// 检查配置是否存在
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return fmt.Errorf("配置不存在: %s/%s", clientName, docTypeName)
+		return nil, fmt.Errorf("配置不存在: %s/%s", clientName, docTypeName)
 	}
 
-	// 删除配置文件
-	if err := os.Remove(configPath); err != nil {
-		return fmt.Errorf("删除配置文件失败: %w", err)
+	// 被其他配置继承时不能删除
+	if dependents := m.ConfigDependents(clientName, docTypeName); len(dependents) > 0 {
+		return nil, fmt.Errorf("配置被以下配置继承，不能删除: %s", strings.Join(dependents, ", "))
 	}
 
 	// 检查是否还有其他配置文件
@@ -564,22 +724,38 @@ func (m *ConfigManager) DeleteConfig(clientName, docTypeName string) error {
 			name := entry.Name()
 			ext := filepath.Ext(name)
 			baseName := strings.TrimSuffix(name, ext)
-			// 检查是否有其他 yaml 配置文件（排除 metadata.yaml 和 .custom）
-			if (ext == ".yaml" || ext == ".yml") && baseName != "metadata" {
+			// 检查是否有其他 yaml 配置文件（排除 metadata.yaml、variables.yaml 和 .custom）
+			if (ext == ".yaml" || ext == ".yml") && !isReservedConfigName(baseName) && baseName != docTypeName {
 				hasOtherConfigs = true
 				break
 			}
 		}
 	}
 
-	// 如果没有其他配置，删除整个客户目录
+	if err := os.Remove(m.LockPath(clientName, docTypeName)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[ConfigManager] 警告: 删除锁定标记失败: %v", err)
+	}
+
+	// 移入回收站；如果没有其他配置，整个客户目录一起移入
+	removed := configPath
 	if !hasOtherConfigs {
-		if err := os.RemoveAll(clientDir); err != nil {
-			return fmt.Errorf("删除客户目录失败: %w", err)
+		removed = clientDir
+	}
+	item, err := m.trash.discard(TrashConfig, clientName+"/"+docTypeName, []string{removed}, deletedBy)
+	if err != nil {
+		if removed == clientDir {
+			return nil, fmt.Errorf("删除客户目录失败: %w", err)
+		}
+		return nil, fmt.Errorf("删除配置文件失败: %w", err)
+	}
+	// 客户目录整体移入回收站时来源记录随目录保存，恢复后仍然有效
+	if removed == configPath {
+		if err := m.removeUpstream(clientName, docTypeName); err != nil {
+			log.Printf("[ConfigManager] 警告: 删除配置来源记录失败: %v", err)
 		}
 	}
 
-	return nil
+	return item, nil
 }
 
 // ListCustomConfigs 列出客户的所有自定义配置
@@ -602,7 +778,7 @@ func (m *ConfigManager) ListCustomConfigs(clientName string) ([]string, error) {
 		name := entry.Name()
 		ext := filepath.Ext(name)
 		baseName := strings.TrimSuffix(name, ext)
-		if (ext == ".yaml" || ext == ".yml") && baseName != "metadata" {
+		if (ext == ".yaml" || ext == ".yml") && !isReservedConfigName(baseName) {
 			configs = append(configs, baseName)
 		}
 	}
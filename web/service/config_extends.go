@@ -0,0 +1,456 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 配置继承相关的键（解析后不会出现在合并结果中）
+const (
+	extendsKey       = "extends"
+	modulesAddKey    = "modules_add"
+	modulesRemoveKey = "modules_remove"
+)
+
+// maxExtendsDepth 继承链的最大层数
+const maxExtendsDepth = 10
+
+// configFilePath 返回文档类型配置文件路径
+func (m *ConfigManager) configFilePath(clientName, docTypeName string) string {
+	return filepath.Join(m.clientsDir, clientName, docTypeName+".yaml")
+}
+
+// ConfigPath 返回文档类型配置文件路径（用于计算审计哈希）
+func (m *ConfigManager) ConfigPath(clientName, docTypeName string) string {
+	return m.configFilePath(clientName, docTypeName)
+}
+
+// ConfigExtends 返回配置文件中声明的 extends（未继承时为空）
+func (m *ConfigManager) ConfigExtends(clientName, docTypeName string) string {
+	raw, err := readConfigMap(m.configFilePath(clientName, docTypeName))
+	if err != nil {
+		return ""
+	}
+	extends, _ := raw[extendsKey].(string)
+	return extends
+}
+
+// ResolvedConfigData 返回解析继承后的完整配置（YAML），供构建脚本读取
+func (m *ConfigManager) ResolvedConfigData(clientName, docTypeName string) ([]byte, error) {
+	merged, err := m.resolveConfigMap(m.configFilePath(clientName, docTypeName), nil)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(merged)
+}
+
+// loadConfigYAML 读取配置并解析继承链
+func (m *ConfigManager) loadConfigYAML(clientName, docTypeName string) (*ConfigYAML, error) {
+	configPath := m.configFilePath(clientName, docTypeName)
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("配置不存在: %s/%s", clientName, docTypeName)
+	}
+
+	merged, err := m.resolveConfigMap(configPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	var yamlConfig ConfigYAML
+	if err := remarshalYAML(merged, &yamlConfig); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	return &yamlConfig, nil
+}
+
+// resolveConfigMap 递归解析继承链，返回合并后的配置
+// 子配置的值覆盖父配置（对象逐键合并，值为 null 表示删除），随后应用 modules_remove 和 modules_add
+func (m *ConfigManager) resolveConfigMap(configPath string, stack []string) (map[string]interface{}, error) {
+	raw, err := readConfigMap(configPath)
+	if err != nil {
+		return nil, err
+	}
+	stack = append(stack, configPath)
+
+	extends, _ := raw[extendsKey].(string)
+	added := raw[modulesAddKey]
+	removed := raw[modulesRemoveKey]
+	delete(raw, extendsKey)
+	delete(raw, modulesAddKey)
+	delete(raw, modulesRemoveKey)
+
+	merged := raw
+	if extends != "" {
+		if len(stack) > maxExtendsDepth {
+			return nil, fmt.Errorf("配置继承超过 %d 层: %s", maxExtendsDepth, m.chainNames(stack))
+		}
+		parentPath, err := m.resolveExtendsPath(configPath, extends)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m.configName(configPath), err)
+		}
+		for _, p := range stack {
+			if p == parentPath {
+				return nil, fmt.Errorf("配置循环继承: %s", m.chainNames(append(stack, parentPath)))
+			}
+		}
+		parent, err := m.resolveConfigMap(parentPath, stack)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeConfigMaps(parent, raw)
+	}
+
+	if added != nil || removed != nil {
+		modules, err := applyModuleChanges(merged["modules"], added, removed)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m.configName(configPath), err)
+		}
+		merged["modules"] = modules
+	}
+	return merged, nil
+}
+
+// resolveExtendsPath 解析 extends 指向的配置文件
+// 支持同一客户下的文档类型（如 运维手册）和其他客户的文档类型（如 ../标准文档/运维手册）
+func (m *ConfigManager) resolveExtendsPath(fromPath, extends string) (string, error) {
+	target := strings.TrimSpace(filepath.FromSlash(extends))
+	if target == "" || filepath.IsAbs(target) {
+		return "", fmt.Errorf("无效的 extends: %s", extends)
+	}
+	if ext := filepath.Ext(target); ext != ".yaml" && ext != ".yml" {
+		target += ".yaml"
+	}
+	targetPath := filepath.Join(filepath.Dir(fromPath), target)
+
+	// 只能继承 clients/<客户>/<文档类型>.yaml
+	rel, err := filepath.Rel(m.clientsDir, targetPath)
+	if err != nil || strings.HasPrefix(rel, "..") || len(strings.Split(rel, string(filepath.Separator))) != 2 {
+		return "", fmt.Errorf("extends 只能指向客户目录下的文档类型配置: %s", extends)
+	}
+	baseName := strings.TrimSuffix(filepath.Base(targetPath), filepath.Ext(targetPath))
+	if isReservedConfigName(baseName) {
+		return "", fmt.Errorf("extends 不能指向 %s", filepath.Base(targetPath))
+	}
+	if _, err := os.Stat(targetPath); err != nil {
+		return "", fmt.Errorf("继承的配置不存在: %s", extends)
+	}
+	return targetPath, nil
+}
+
+// configName 返回配置文件的显示名称（客户/文档类型）
+func (m *ConfigManager) configName(configPath string) string {
+	rel, err := filepath.Rel(m.clientsDir, configPath)
+	if err != nil {
+		return configPath
+	}
+	return strings.TrimSuffix(filepath.ToSlash(rel), filepath.Ext(rel))
+}
+
+// chainNames 格式化继承链
+func (m *ConfigManager) chainNames(paths []string) string {
+	names := make([]string, len(paths))
+	for i, p := range paths {
+		names[i] = m.configName(p)
+	}
+	return strings.Join(names, " → ")
+}
+
+// ConfigDependents 列出继承该配置的其他配置（客户/文档类型）
+func (m *ConfigManager) ConfigDependents(clientName, docTypeName string) []string {
+	target := m.configFilePath(clientName, docTypeName)
+	var dependents []string
+
+	clients, err := os.ReadDir(m.clientsDir)
+	if err != nil {
+		return nil
+	}
+	for _, client := range clients {
+		if !client.IsDir() {
+			continue
+		}
+		docTypes, err := m.ListCustomConfigs(client.Name())
+		if err != nil {
+			continue
+		}
+		for _, docType := range docTypes {
+			configPath := m.configFilePath(client.Name(), docType)
+			extends := m.ConfigExtends(client.Name(), docType)
+			if extends == "" {
+				continue
+			}
+			if parent, err := m.resolveExtendsPath(configPath, extends); err == nil && parent == target {
+				dependents = append(dependents, client.Name()+"/"+docType)
+			}
+		}
+	}
+	return dependents
+}
+
+// renderConfigDelta 生成继承配置的内容：只记录与父配置不同的字段
+func (m *ConfigManager) renderConfigDelta(configPath, extends string, config CustomConfig) ([]byte, error) {
+	parentPath, err := m.resolveExtendsPath(configPath, extends)
+	if err != nil {
+		return nil, err
+	}
+	parentMap, err := m.resolveConfigMap(parentPath, []string{configPath})
+	if err != nil {
+		return nil, err
+	}
+
+	// 父配置和新配置都按 ConfigYAML 规范化后再比较，忽略父配置中界面不处理的字段
+	var parentYAML ConfigYAML
+	if err := remarshalYAML(parentMap, &parentYAML); err != nil {
+		return nil, fmt.Errorf("解析继承的配置失败: %w", err)
+	}
+	fullYAML := buildConfigYAML(config)
+
+	var parent, full map[string]interface{}
+	if err := remarshalYAML(parentYAML, &parent); err != nil {
+		return nil, err
+	}
+	if err := remarshalYAML(fullYAML, &full); err != nil {
+		return nil, err
+	}
+	delete(parent, "modules")
+	delete(full, "modules")
+	delta := configDelta(parent, full)
+
+	// 按 ConfigYAML 的字段顺序输出，extends 放在最前面
+	var order yaml.Node
+	if err := order.Encode(fullYAML); err != nil {
+		return nil, err
+	}
+	out := &yaml.Node{Kind: yaml.MappingNode}
+	if err := appendYAMLPair(out, extendsKey, extends); err != nil {
+		return nil, err
+	}
+	written := make(map[string]bool)
+	for i := 0; i+1 < len(order.Content); i += 2 {
+		key := order.Content[i].Value
+		if key == "modules" {
+			if err := appendModulesDelta(out, parentYAML.Modules, fullYAML.Modules); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if val, ok := delta[key]; ok {
+			if err := appendYAMLPair(out, key, val); err != nil {
+				return nil, err
+			}
+			written[key] = true
+		}
+	}
+	// 父配置中有、新配置中已清空的字段
+	for key, val := range delta {
+		if !written[key] {
+			if err := appendYAMLPair(out, key, val); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	data, err := yaml.Marshal(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{out}})
+	if err != nil {
+		return nil, err
+	}
+	content := fmt.Sprintf("# %s 配置\n# 继承自 %s，只记录不同的字段\n\n%s", config.DocTypeName, extends, string(data))
+	return []byte(content), nil
+}
+
+// appendModulesDelta 写入模块列表的差异：能用 modules_add / modules_remove 表达时优先使用，否则写完整列表
+func appendModulesDelta(out *yaml.Node, parent, modules []ModuleEntry) error {
+	added, removed, ok := moduleDelta(parent, modules)
+	if !ok {
+		return appendYAMLPair(out, "modules", modules)
+	}
+	if len(removed) > 0 {
+		if err := appendYAMLPair(out, modulesRemoveKey, removed); err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 {
+		if err := appendYAMLPair(out, modulesAddKey, added); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moduleDelta 计算相对父配置的模块增删
+// 只有保留的模块顺序不变、新增的模块都在末尾时才能表达为增删，否则 ok 为 false
+func moduleDelta(parent, modules []ModuleEntry) (added []ModuleEntry, removed []string, ok bool) {
+	current := make(map[string]bool, len(modules))
+	for _, entry := range modules {
+		current[normalizeModulePath(entry.Path)] = true
+	}
+	var kept []ModuleEntry
+	for _, entry := range parent {
+		if current[normalizeModulePath(entry.Path)] {
+			kept = append(kept, entry)
+		} else {
+			removed = append(removed, entry.Path)
+		}
+	}
+
+	if len(modules) < len(kept) {
+		return nil, nil, false
+	}
+	for i, entry := range kept {
+		if !reflect.DeepEqual(entry, modules[i]) {
+			return nil, nil, false
+		}
+	}
+	inParent := make(map[string]bool, len(parent))
+	for _, entry := range parent {
+		inParent[normalizeModulePath(entry.Path)] = true
+	}
+	for _, entry := range modules[len(kept):] {
+		if inParent[normalizeModulePath(entry.Path)] {
+			return nil, nil, false
+		}
+		added = append(added, entry)
+	}
+	return added, removed, true
+}
+
+// applyModuleChanges 对模块列表应用 modules_remove 和 modules_add
+func applyModuleChanges(modules, added, removed interface{}) ([]interface{}, error) {
+	list, _ := modules.([]interface{})
+
+	if removed != nil {
+		items, ok := removed.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("modules_remove 必须是列表")
+		}
+		drop := make(map[string]bool, len(items))
+		for _, item := range items {
+			drop[normalizeModulePath(fmt.Sprintf("%v", item))] = true
+		}
+		var kept []interface{}
+		for _, entry := range list {
+			if !drop[normalizeModulePath(moduleEntryPath(entry))] {
+				kept = append(kept, entry)
+			}
+		}
+		list = kept
+	}
+
+	if added != nil {
+		items, ok := added.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("modules_add 必须是列表")
+		}
+		list = append(list, items...)
+	}
+	return list, nil
+}
+
+// moduleEntryPath 返回原始 YAML 模块条目（字符串或 {path, when}）的路径
+func moduleEntryPath(entry interface{}) string {
+	if m, ok := entry.(map[string]interface{}); ok {
+		return fmt.Sprintf("%v", m["path"])
+	}
+	return fmt.Sprintf("%v", entry)
+}
+
+// normalizeModulePath 统一模块路径写法（去掉 ./ 前缀、使用正斜杠）
+func normalizeModulePath(path string) string {
+	return strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(path)), "./")
+}
+
+// mergeConfigMaps 合并配置：child 覆盖 parent，对象逐键合并，值为 null 时删除该键
+func mergeConfigMaps(parent, child map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(parent)+len(child))
+	for key, val := range parent {
+		result[key] = val
+	}
+	for key, val := range child {
+		if val == nil {
+			delete(result, key)
+			continue
+		}
+		childMap, childIsMap := val.(map[string]interface{})
+		parentMap, parentIsMap := result[key].(map[string]interface{})
+		if childIsMap && parentIsMap {
+			result[key] = mergeConfigMaps(parentMap, childMap)
+		} else {
+			result[key] = val
+		}
+	}
+	return result
+}
+
+// configDelta 计算 full 相对 parent 的差异（mergeConfigMaps 的逆运算）
+func configDelta(parent, full map[string]interface{}) map[string]interface{} {
+	delta := make(map[string]interface{})
+	for key, val := range full {
+		parentVal, ok := parent[key]
+		if !ok {
+			delta[key] = val
+			continue
+		}
+		fullMap, fullIsMap := val.(map[string]interface{})
+		parentMap, parentIsMap := parentVal.(map[string]interface{})
+		if fullIsMap && parentIsMap {
+			if sub := configDelta(parentMap, fullMap); len(sub) > 0 {
+				delta[key] = sub
+			}
+			continue
+		}
+		if !reflect.DeepEqual(val, parentVal) {
+			delta[key] = val
+		}
+	}
+	for key := range parent {
+		if _, ok := full[key]; !ok {
+			delta[key] = nil
+		}
+	}
+	return delta
+}
+
+// readConfigMap 读取配置文件为通用结构
+func readConfigMap(configPath string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("配置不存在: %s", filepath.Base(configPath))
+		}
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	raw := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	if raw == nil {
+		raw = make(map[string]interface{})
+	}
+	return raw, nil
+}
+
+// remarshalYAML 通过 YAML 序列化在结构之间转换
+func remarshalYAML(in, out interface{}) error {
+	data, err := yaml.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, out)
+}
+
+// appendYAMLPair 向映射节点追加键值对
+func appendYAMLPair(mapping *yaml.Node, key string, val interface{}) error {
+	valNode := &yaml.Node{}
+	if val == nil {
+		valNode = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	} else if err := valNode.Encode(val); err != nil {
+		return err
+	}
+	mapping.Content = append(mapping.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, valNode)
+	return nil
+}
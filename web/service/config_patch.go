@@ -0,0 +1,287 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// commentSpacingRegex 注释前的空白（yaml 输出时统一为一个空格）
+var commentSpacingRegex = regexp.MustCompile(`[ \t]+#`)
+
+// patchConfigFile 把新生成的配置合并到已有的配置文件中
+// 只修改变化的字段，保留注释、字段顺序、空行以及界面不处理的字段
+func patchConfigFile(existing, generated []byte) ([]byte, error) {
+	var oldDoc, newDoc yaml.Node
+	if err := yaml.Unmarshal(existing, &oldDoc); err != nil || len(oldDoc.Content) == 0 || oldDoc.Content[0].Kind != yaml.MappingNode {
+		// 原文件无法解析时直接使用新内容
+		return generated, nil
+	}
+	if err := yaml.Unmarshal(generated, &newDoc); err != nil {
+		return nil, fmt.Errorf("解析生成的配置失败: %w", err)
+	}
+	if len(newDoc.Content) == 0 {
+		return generated, nil
+	}
+
+	patchYAMLNode(oldDoc.Content[0], newDoc.Content[0], ConfigSchema())
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(detectYAMLIndent(existing))
+	if err := encoder.Encode(&oldDoc); err != nil {
+		return nil, fmt.Errorf("生成配置文件失败: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return []byte(restoreYAMLLayout(string(existing), buf.String())), nil
+}
+
+// patchYAMLNode 用 updated 的值更新 node，尽量复用原节点以保留注释和引号风格
+func patchYAMLNode(node, updated *yaml.Node, schema map[string]interface{}) {
+	if node.Kind != updated.Kind {
+		replaceYAMLNode(node, updated)
+		return
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		patchYAMLMapping(node, updated, schema)
+	case yaml.SequenceNode:
+		patchYAMLSequence(node, updated, schema)
+	case yaml.ScalarNode:
+		if node.Value == updated.Value && node.ShortTag() == updated.ShortTag() {
+			return
+		}
+		// 原来加了引号的字符串保持原有的引号风格
+		style := updated.Style
+		if node.ShortTag() == "!!str" && updated.ShortTag() == "!!str" && node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+			style = node.Style
+		}
+		node.Value = updated.Value
+		node.Tag = updated.Tag
+		node.Style = style
+	default:
+		replaceYAMLNode(node, updated)
+	}
+}
+
+// patchYAMLMapping 逐个字段更新对象
+// 新内容中没有的字段：Schema 中已知的字段删除，未知字段（手工添加的）保留
+func patchYAMLMapping(node, updated *yaml.Node, schema map[string]interface{}) {
+	props, _ := schema["properties"].(map[string]interface{})
+	additional, _ := schema["additionalProperties"].(bool)
+	managed := func(key string) bool {
+		_, known := props[key]
+		return known || props == nil || additional
+	}
+
+	updatedValues := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(updated.Content); i += 2 {
+		updatedValues[updated.Content[i].Value] = updated.Content[i+1]
+	}
+
+	// 更新或删除已有字段
+	var content []*yaml.Node
+	existing := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valNode := node.Content[i], node.Content[i+1]
+		newVal, ok := updatedValues[keyNode.Value]
+		if !ok {
+			// 手工写明的零值（如 book: false）在结构中无法表示，保留原样
+			if managed(keyNode.Value) && !isZeroYAMLScalar(valNode) {
+				continue
+			}
+		} else {
+			propSchema, _ := props[keyNode.Value].(map[string]interface{})
+			patchYAMLNode(valNode, newVal, propSchema)
+		}
+		existing[keyNode.Value] = true
+		content = append(content, keyNode, valNode)
+	}
+
+	// 新增字段插入到新内容中前一个字段之后
+	previous := ""
+	for i := 0; i+1 < len(updated.Content); i += 2 {
+		key := updated.Content[i].Value
+		if existing[key] {
+			previous = key
+			continue
+		}
+		pair := []*yaml.Node{clearYAMLComments(updated.Content[i]), clearYAMLComments(updated.Content[i+1])}
+		pos := 0
+		if previous != "" {
+			for j := 0; j+1 < len(content); j += 2 {
+				if content[j].Value == previous {
+					pos = j + 2
+					break
+				}
+			}
+		}
+		content = append(content[:pos], append(pair, content[pos:]...)...)
+		existing[key] = true
+		previous = key
+	}
+	node.Content = content
+}
+
+// patchYAMLSequence 更新列表：值相同的条目（模块按 path 匹配）复用原节点
+func patchYAMLSequence(node, updated *yaml.Node, schema map[string]interface{}) {
+	var itemSchema map[string]interface{}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		itemSchema = items
+		if variants, ok := items["oneOf"].([]interface{}); ok {
+			for _, variant := range variants {
+				if v, ok := variant.(map[string]interface{}); ok && v["type"] == "object" {
+					itemSchema = v
+				}
+			}
+		}
+	}
+
+	used := make([]bool, len(node.Content))
+	content := make([]*yaml.Node, 0, len(updated.Content))
+	for _, item := range updated.Content {
+		key := yamlItemKey(item)
+		match := -1
+		for i, old := range node.Content {
+			if !used[i] && key != "" && yamlItemKey(old) == key {
+				match = i
+				break
+			}
+		}
+		if match < 0 {
+			content = append(content, clearYAMLComments(item))
+			continue
+		}
+		used[match] = true
+		patchYAMLNode(node.Content[match], item, itemSchema)
+		content = append(content, node.Content[match])
+	}
+	node.Content = content
+}
+
+// yamlItemKey 列表条目的匹配键：标量为值，对象为 path 字段
+func yamlItemKey(item *yaml.Node) string {
+	switch item.Kind {
+	case yaml.ScalarNode:
+		return "=" + item.Value
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(item.Content); i += 2 {
+			if item.Content[i].Value == "path" {
+				return "=" + item.Content[i+1].Value
+			}
+		}
+	}
+	return ""
+}
+
+// isZeroYAMLScalar 判断节点是否为零值（空字符串、false、0 或 null）
+func isZeroYAMLScalar(node *yaml.Node) bool {
+	if node.Kind != yaml.ScalarNode {
+		return false
+	}
+	switch node.ShortTag() {
+	case "!!null":
+		return true
+	case "!!str":
+		return node.Value == ""
+	case "!!bool":
+		return node.Value == "false"
+	case "!!int", "!!float":
+		return strings.Trim(node.Value, "0.+-") == ""
+	}
+	return false
+}
+
+// replaceYAMLNode 整体替换节点内容，保留原节点上的注释
+func replaceYAMLNode(node, updated *yaml.Node) {
+	head, line, foot := node.HeadComment, node.LineComment, node.FootComment
+	*node = *clearYAMLComments(updated)
+	node.HeadComment, node.LineComment, node.FootComment = head, line, foot
+}
+
+// clearYAMLComments 去掉新生成节点上的注释（如生成内容的文件头注释）
+func clearYAMLComments(node *yaml.Node) *yaml.Node {
+	node.HeadComment, node.LineComment, node.FootComment = "", "", ""
+	for _, child := range node.Content {
+		clearYAMLComments(child)
+	}
+	return node
+}
+
+// detectYAMLIndent 检测文件使用的缩进宽度（默认 2）
+func detectYAMLIndent(data []byte) int {
+	indent := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if n := len(line) - len(trimmed); n > 0 && (indent == 0 || n < indent) {
+			indent = n
+		}
+	}
+	if indent < 2 || indent > 8 {
+		return 2
+	}
+	return indent
+}
+
+// restoreYAMLLayout 还原 yaml 重新输出时丢失的格式
+// 与原文件相同的行使用原文（保留注释前的对齐空格），原文件中的空行保留在原来的位置
+func restoreYAMLLayout(original, encoded string) string {
+	oldLines := splitLines(original)
+	newLines := splitLines(encoded)
+	normalize := func(lines []string) []string {
+		result := make([]string, len(lines))
+		for i, line := range lines {
+			result[i] = commentSpacingRegex.ReplaceAllString(strings.TrimRight(line, " \t"), " #")
+		}
+		return result
+	}
+
+	var out, blanks []string
+	dropped := false // 上次输出后是否删除过内容行
+	// 原文件的空行放在插入的新行之后、下一个原有行之前；删除字段后不留下连续的空行
+	flush := func() {
+		if dropped && len(blanks) > 0 {
+			blanks = blanks[:1]
+			if len(out) > 0 && strings.TrimSpace(out[len(out)-1]) == "" {
+				blanks = nil
+			}
+		}
+		out = append(out, blanks...)
+		blanks = nil
+		dropped = false
+	}
+
+	oi, ni := 0, 0
+	for _, d := range DiffLines(normalize(oldLines), normalize(newLines)) {
+		switch d.Op {
+		case DiffEqual:
+			flush()
+			out = append(out, oldLines[oi])
+			oi++
+			ni++
+		case DiffDelete:
+			if strings.TrimSpace(oldLines[oi]) == "" {
+				blanks = append(blanks, oldLines[oi])
+			} else {
+				dropped = true
+			}
+			oi++
+		case DiffInsert:
+			out = append(out, newLines[ni])
+			ni++
+		}
+	}
+	for len(out) > 0 && strings.TrimSpace(out[len(out)-1]) == "" {
+		out = out[:len(out)-1]
+	}
+	return strings.Join(out, "\n") + "\n"
+}
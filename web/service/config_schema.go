@@ -0,0 +1,571 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigSchemaError 配置文件校验错误
+type ConfigSchemaError struct {
+	Path    string `json:"path"`    // YAML 路径（如 pdf_options.toc-depth、modules[2].path）
+	Line    int    `json:"line"`    // 行号（从 1 开始，未知时为 0）
+	Column  int    `json:"column"`  // 列号
+	Message string `json:"message"` // 错误说明
+}
+
+// String 返回带路径和行号的错误说明
+func (e ConfigSchemaError) String() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s（第 %d 行）: %s", e.Path, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ConfigValidationError 配置文件没有通过校验
+type ConfigValidationError struct {
+	Errors []ConfigSchemaError
+}
+
+// Error 实现 error 接口
+func (e *ConfigValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, schemaErr := range e.Errors {
+		messages[i] = schemaErr.String()
+	}
+	return "配置校验失败: " + strings.Join(messages, "; ")
+}
+
+// configSchemaRule 字段的额外约束（结构体无法表达的部分）
+type configSchemaRule struct {
+	description string
+	minimum     *float64
+	maximum     *float64
+	pattern     string
+	enum        []string
+	hint        string // 格式不符时的说明
+}
+
+func schemaBound(v float64) *float64 { return &v }
+
+// hexColorRule 颜色字段：6 位十六进制（不带 #）
+var hexColorRule = configSchemaRule{pattern: `^[0-9A-Fa-f]{6}$`, hint: "应为 6 位十六进制颜色，如 2980B9（纯数字颜色需要加引号）"}
+
+// docxTemplateRule Word 模板文件名：templates 目录下的 .docx 文件，不能包含路径分隔符、盘符，不能以 . 开头（排除 ..）
+var docxTemplateRule = configSchemaRule{pattern: `^[^/\\:.][^/\\:]*\.docx$`, hint: "应为 templates 目录下的 .docx 文件名（不能包含路径分隔符或 ..）"}
+
+// configSchemaRules 按 YAML 路径定义的约束
+var configSchemaRules = map[string]configSchemaRule{
+	"extends":                                {description: "继承的配置（如 ../标准文档/运维手册）"},
+	"client_name":                            {description: "客户显示名称"},
+	"template":                               {description: "Word 模板文件名", pattern: docxTemplateRule.pattern, hint: docxTemplateRule.hint},
+	"output_pattern":                         {description: "输出文件名模式，支持 {client} {title} {version} {date}"},
+	"modules":                                {description: "模块列表（有序）"},
+	"modules_add":                            {description: "在继承的模块列表末尾追加的模块"},
+	"modules_remove":                         {description: "从继承的模块列表中删除的模块"},
+	"pandoc_args":                            {description: "传给 Pandoc 的额外参数"},
+	"variables":                              {description: "文档类型级别的变量值"},
+	"pdf_options":                            {description: "PDF 输出选项"},
+	"pdf_options.fontsize":                   {pattern: `^\d+(\.\d+)?pt$`, hint: "应为磅值，如 11pt"},
+	"pdf_options.linestretch":                {minimum: schemaBound(0.5), maximum: schemaBound(3)},
+	"pdf_options.toc-depth":                  {minimum: schemaBound(1), maximum: schemaBound(6)},
+	"pdf_options.titlepage-rule-height":      {minimum: schemaBound(0), maximum: schemaBound(50)},
+	"pdf_options.titlepage-color":            hexColorRule,
+	"pdf_options.titlepage-text-color":       hexColorRule,
+	"pdf_options.titlepage-rule-color":       hexColorRule,
+	"pdf_options.linkcolor":                  hexColorRule,
+	"pdf_options.urlcolor":                   hexColorRule,
+	"pdf_options.geometry":                   {pattern: `^[a-z]+=`, hint: "应为 LaTeX geometry 参数，如 margin=2.5cm"},
+	"pdf_options.code-block-font-size":       {pattern: `^\\[a-zA-Z]+$`, hint: `应为 LaTeX 字号命令，如 \small`},
+	"word_options":                           {description: "Word 输出选项"},
+	"word_options.toc":                       {description: "生成目录（覆盖 pandoc_args 中的 --toc）"},
+	"word_options.toc-depth":                 {minimum: schemaBound(1), maximum: schemaBound(6)},
+	"word_options.number-sections":           {description: "章节编号（覆盖 pandoc_args 中的 --number-sections）"},
+	"word_options.highlight-style":           {enum: highlightStyles},
+	"word_options.page-break-before-chapter": {description: "一级标题前分页"},
+	"word_options.table-style":               {description: "表格样式名称（参考文档中定义的表格样式，如 网格型）"},
+	"word_options.figure-prefix":             {description: "图片标题前缀（如 图）"},
+	"word_options.table-prefix":              {description: "表格标题前缀（如 表）"},
+	"word_options.reference-doc":             {description: "参考文档（templates 目录下的 .docx，优先于 template）", pattern: docxTemplateRule.pattern, hint: docxTemplateRule.hint},
+}
+
+// highlightStyles Pandoc 内置的代码高亮样式
+var highlightStyles = []string{"pygments", "tango", "espresso", "zenburn", "kate", "monochrome", "breezedark", "haddock"}
+
+// ConfigSchema 返回客户文档配置的 JSON Schema（由 ConfigYAML 结构生成）
+func ConfigSchema() map[string]interface{} {
+	schema := structSchema(reflect.TypeOf(ConfigYAML{}), "")
+	props := schema["properties"].(map[string]interface{})
+
+	// 继承相关字段不在 ConfigYAML 中（解析继承后不再出现）
+	props[extendsKey] = withRule(map[string]interface{}{"type": "string"}, extendsKey)
+	props[modulesAddKey] = withRule(moduleListSchema(), modulesAddKey)
+	props["template_variables"] = templateVariablesSchema()
+	props[modulesRemoveKey] = withRule(map[string]interface{}{
+		"type":  "array",
+		"items": map[string]interface{}{"type": "string", "minLength": 1},
+	}, modulesRemoveKey)
+
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["$id"] = "/api/schema/config"
+	schema["title"] = "客户文档配置"
+	schema["description"] = "clients/<客户>/<文档类型>.yaml"
+	return schema
+}
+
+// structSchema 根据 yaml 标签生成对象的 Schema
+func structSchema(t reflect.Type, prefix string) map[string]interface{} {
+	props := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		props[name] = withRule(typeSchema(field.Type, path), path)
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+// typeSchema 根据 Go 类型生成 Schema
+func typeSchema(t reflect.Type, path string) map[string]interface{} {
+	if t == reflect.TypeOf([]ModuleEntry{}) {
+		return moduleListSchema()
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), path)
+	case reflect.Struct:
+		return structSchema(t, path)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), path+"[]")}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": true}
+	}
+	return map[string]interface{}{}
+}
+
+// moduleListSchema 模块列表：每项是路径字符串或 {path, when}
+func moduleListSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "array",
+		"items": map[string]interface{}{
+			"oneOf": []interface{}{
+				map[string]interface{}{"type": "string", "minLength": 1},
+				map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"path": map[string]interface{}{"type": "string", "minLength": 1},
+						"when": map[string]interface{}{
+							"description": "包含条件：表达式字符串或键值对象",
+							"type":        []interface{}{"string", "object"},
+						},
+					},
+					"required":             []interface{}{"path"},
+					"additionalProperties": false,
+				},
+			},
+		},
+	}
+}
+
+// withRule 附加 configSchemaRules 中的约束
+func withRule(schema map[string]interface{}, path string) map[string]interface{} {
+	rule, ok := configSchemaRules[path]
+	if !ok {
+		return schema
+	}
+	if rule.description != "" {
+		schema["description"] = rule.description
+	}
+	if rule.minimum != nil {
+		schema["minimum"] = *rule.minimum
+	}
+	if rule.maximum != nil {
+		schema["maximum"] = *rule.maximum
+	}
+	if rule.pattern != "" {
+		schema["pattern"] = rule.pattern
+	}
+	if len(rule.enum) > 0 {
+		values := make([]interface{}, len(rule.enum))
+		for i, value := range rule.enum {
+			values[i] = value
+		}
+		schema["enum"] = values
+	}
+	if rule.hint != "" {
+		schema["x-hint"] = rule.hint
+	}
+	return schema
+}
+
+// ValidateConfigData 按 Schema 校验配置文件内容
+func ValidateConfigData(data []byte) []ConfigSchemaError {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return []ConfigSchemaError{{Path: "(文件)", Message: "YAML 语法错误: " + err.Error()}}
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	var errs []ConfigSchemaError
+	validateSchemaNode(doc.Content[0], ConfigSchema(), "", &errs)
+	return errs
+}
+
+// newConfigSchemaErrors 返回 updated 中新出现的校验错误（existing 中已有的忽略）
+func newConfigSchemaErrors(existing, updated []byte) []ConfigSchemaError {
+	known := make(map[string]bool)
+	if len(existing) > 0 {
+		for _, schemaErr := range ValidateConfigData(existing) {
+			known[schemaErr.Path+"\x00"+schemaErr.Message] = true
+		}
+	}
+	var errs []ConfigSchemaError
+	for _, schemaErr := range ValidateConfigData(updated) {
+		if !known[schemaErr.Path+"\x00"+schemaErr.Message] {
+			errs = append(errs, schemaErr)
+		}
+	}
+	return errs
+}
+
+// ValidateConfigFile 校验客户的文档类型配置文件（包括继承链上的配置）
+func (m *ConfigManager) ValidateConfigFile(clientName, docTypeName string) ([]ConfigSchemaError, error) {
+	configPath := m.configFilePath(clientName, docTypeName)
+	var errs []ConfigSchemaError
+	for depth := 0; depth <= maxExtendsDepth; depth++ {
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			if os.IsNotExist(err) && depth == 0 {
+				return nil, fmt.Errorf("配置不存在: %s/%s", clientName, docTypeName)
+			}
+			return nil, fmt.Errorf("读取配置文件失败: %w", err)
+		}
+		for _, schemaErr := range ValidateConfigData(data) {
+			if depth > 0 {
+				schemaErr.Path = m.configName(configPath) + ": " + schemaErr.Path
+			}
+			errs = append(errs, schemaErr)
+		}
+
+		raw, err := readConfigMap(configPath)
+		if err != nil {
+			break
+		}
+		extends, _ := raw[extendsKey].(string)
+		if extends == "" {
+			break
+		}
+		if configPath, err = m.resolveExtendsPath(configPath, extends); err != nil {
+			errs = append(errs, ConfigSchemaError{Path: extendsKey, Message: err.Error()})
+			break
+		}
+	}
+	return errs, nil
+}
+
+// validateSchemaNode 递归校验节点（null 值表示未设置或删除继承的值，总是允许）
+func validateSchemaNode(node *yaml.Node, schema map[string]interface{}, path string, errs *[]ConfigSchemaError) {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+	fail := func(n *yaml.Node, format string, args ...interface{}) {
+		*errs = append(*errs, ConfigSchemaError{Path: displaySchemaPath(path), Line: n.Line, Column: n.Column, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if variants, ok := schema["oneOf"].([]interface{}); ok {
+		var firstErrs []ConfigSchemaError
+		for i, variant := range variants {
+			var variantErrs []ConfigSchemaError
+			validateSchemaNode(node, variant.(map[string]interface{}), path, &variantErrs)
+			if len(variantErrs) == 0 {
+				return
+			}
+			if i == 0 || (node.Kind == yaml.MappingNode && variant.(map[string]interface{})["type"] == "object") {
+				firstErrs = variantErrs
+			}
+		}
+		*errs = append(*errs, firstErrs...)
+		return
+	}
+
+	if want, ok := schema["type"]; ok {
+		if !schemaTypeMatches(node, want) {
+			fail(node, "应为%s，实际为%s%s", schemaTypeName(want), nodeTypeName(node), typeMismatchHint(node, want))
+			return
+		}
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		props, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(bool)
+		seen := make(map[string]bool)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valNode := node.Content[i], node.Content[i+1]
+			key := keyNode.Value
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if seen[key] {
+				*errs = append(*errs, ConfigSchemaError{Path: childPath, Line: keyNode.Line, Column: keyNode.Column, Message: "字段重复"})
+				continue
+			}
+			seen[key] = true
+
+			propSchema, known := props[key].(map[string]interface{})
+			if !known {
+				if props != nil && !additional {
+					message := "未知字段"
+					if suggestion := closestKey(key, props); suggestion != "" {
+						message += fmt.Sprintf("（是否应为 %s？）", suggestion)
+					}
+					*errs = append(*errs, ConfigSchemaError{Path: childPath, Line: keyNode.Line, Column: keyNode.Column, Message: message})
+				}
+				continue
+			}
+			validateSchemaNode(valNode, propSchema, childPath, errs)
+		}
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if !seen[name.(string)] {
+					fail(node, "缺少 %s", name)
+				}
+			}
+		}
+
+	case yaml.SequenceNode:
+		items, _ := schema["items"].(map[string]interface{})
+		if items == nil {
+			return
+		}
+		for i, item := range node.Content {
+			validateSchemaNode(item, items, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+
+	case yaml.ScalarNode:
+		if minLength, ok := schema["minLength"].(int); ok && len(strings.TrimSpace(node.Value)) < minLength {
+			fail(node, "不能为空")
+		}
+		if node.Tag == "!!int" || node.Tag == "!!float" {
+			value, _ := strconv.ParseFloat(node.Value, 64)
+			minimum, hasMin := schema["minimum"].(float64)
+			maximum, hasMax := schema["maximum"].(float64)
+			if (hasMin && value < minimum) || (hasMax && value > maximum) {
+				fail(node, "必须在 %s..%s 之间", formatBound(minimum, hasMin), formatBound(maximum, hasMax))
+			}
+		}
+		// 空字符串表示使用默认值，不检查格式
+		if enum, ok := schema["enum"].([]interface{}); ok && !schemaEnumContains(enum, node.Value) {
+			values := make([]string, len(enum))
+			for i, value := range enum {
+				values[i] = fmt.Sprintf("%v", value)
+			}
+			fail(node, "必须是 %s 之一", strings.Join(values, "、"))
+		}
+		if pattern, ok := schema["pattern"].(string); ok && node.Value != "" {
+			if !regexp.MustCompile(pattern).MatchString(node.Value) {
+				hint, _ := schema["x-hint"].(string)
+				if hint == "" {
+					hint = "格式无效（应匹配 " + pattern + "）"
+				}
+				fail(node, "%s", hint)
+			}
+		}
+	}
+}
+
+// schemaTypeMatches 判断节点类型是否符合 Schema 的 type（字符串或列表）
+func schemaTypeMatches(node *yaml.Node, want interface{}) bool {
+	if list, ok := want.([]interface{}); ok {
+		for _, item := range list {
+			if schemaTypeMatches(node, item) {
+				return true
+			}
+		}
+		return false
+	}
+	switch want {
+	case "object":
+		return node.Kind == yaml.MappingNode
+	case "array":
+		return node.Kind == yaml.SequenceNode
+	case "string":
+		// 字符串字段允许未加引号的数字（如 version: 2），YAML 解析为 string 时会保留原文
+		return node.Kind == yaml.ScalarNode && node.Tag != "!!bool"
+	case "boolean":
+		return node.Kind == yaml.ScalarNode && node.Tag == "!!bool"
+	case "integer":
+		return node.Kind == yaml.ScalarNode && node.Tag == "!!int"
+	case "number":
+		return node.Kind == yaml.ScalarNode && (node.Tag == "!!int" || node.Tag == "!!float")
+	}
+	return true
+}
+
+// schemaEnumContains 判断值是否在枚举列表中
+func schemaEnumContains(enum []interface{}, value string) bool {
+	for _, item := range enum {
+		if fmt.Sprintf("%v", item) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// typeMismatchHint 针对常见的手工编辑错误给出提示
+func typeMismatchHint(node *yaml.Node, want interface{}) string {
+	if node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	if (want == "number" || want == "integer") && node.Tag == "!!str" {
+		if _, err := strconv.ParseFloat(node.Value, 64); err == nil {
+			return "（数字不要加引号）"
+		}
+	}
+	if want == "boolean" && node.Tag == "!!str" {
+		if lower := strings.ToLower(node.Value); lower == "true" || lower == "false" {
+			return "（布尔值不要加引号）"
+		}
+	}
+	if want == "string" && node.Tag == "!!bool" {
+		return "（true/false/yes/no 作为文本时需要加引号）"
+	}
+	return ""
+}
+
+// schemaTypeName Schema 类型的中文名称
+func schemaTypeName(want interface{}) string {
+	names := map[string]string{
+		"object":  "对象",
+		"array":   "列表",
+		"string":  "字符串",
+		"boolean": "布尔值",
+		"integer": "整数",
+		"number":  "数字",
+	}
+	if list, ok := want.([]interface{}); ok {
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = schemaTypeName(item)
+		}
+		return strings.Join(parts, "或")
+	}
+	if name, ok := names[fmt.Sprintf("%v", want)]; ok {
+		return name
+	}
+	return fmt.Sprintf("%v", want)
+}
+
+// nodeTypeName 节点类型的中文名称
+func nodeTypeName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "对象"
+	case yaml.SequenceNode:
+		return "列表"
+	}
+	switch node.Tag {
+	case "!!bool":
+		return "布尔值"
+	case "!!int":
+		return "整数"
+	case "!!float":
+		return "数字"
+	}
+	return fmt.Sprintf("字符串 %q", node.Value)
+}
+
+// formatBound 格式化范围边界
+func formatBound(v float64, ok bool) string {
+	if !ok {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// displaySchemaPath 根节点显示为 (根)
+func displaySchemaPath(path string) string {
+	if path == "" {
+		return "(根)"
+	}
+	return path
+}
+
+// closestKey 找出与未知字段最接近的已知字段（编辑距离不超过 2）
+func closestKey(key string, props map[string]interface{}) string {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	best, bestDist := "", 3
+	for _, name := range names {
+		if d := editDistance(strings.ToLower(key), strings.ToLower(name)); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+// editDistance 计算编辑距离
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,198 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 差异行类型
+const (
+	DiffEqual  = ' '
+	DiffDelete = '-'
+	DiffInsert = '+'
+)
+
+// diffContextLines 统一格式 diff 中每个差异块前后保留的上下文行数
+const diffContextLines = 3
+
+// maxDiffCells 逐行比较的最大规模（行数乘积），超过后整体视为替换，避免占用过多内存
+const maxDiffCells = 4000000
+
+// DiffLine 差异中的一行
+type DiffLine struct {
+	Op   byte
+	Text string
+}
+
+// DiffLines 逐行比较两段文本（基于最长公共子序列）
+func DiffLines(a, b []string) []DiffLine {
+	// 去掉相同的首尾，缩小比较范围
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var result []DiffLine
+	for _, line := range a[:prefix] {
+		result = append(result, DiffLine{DiffEqual, line})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)*len(midB) > maxDiffCells {
+		for _, line := range midA {
+			result = append(result, DiffLine{DiffDelete, line})
+		}
+		for _, line := range midB {
+			result = append(result, DiffLine{DiffInsert, line})
+		}
+	} else {
+		result = append(result, lcsDiff(midA, midB)...)
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		result = append(result, DiffLine{DiffEqual, line})
+	}
+	return result
+}
+
+// lcsDiff 用动态规划计算最长公共子序列并生成差异
+func lcsDiff(a, b []string) []DiffLine {
+	n, m := len(a), len(b)
+	// lcs[i][j] 表示 a[i:] 与 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var result []DiffLine
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			result = append(result, DiffLine{DiffEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			result = append(result, DiffLine{DiffDelete, a[i]})
+			i++
+		default:
+			result = append(result, DiffLine{DiffInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		result = append(result, DiffLine{DiffDelete, a[i]})
+	}
+	for ; j < m; j++ {
+		result = append(result, DiffLine{DiffInsert, b[j]})
+	}
+	return result
+}
+
+// UnifiedDiff 生成统一格式的 diff（与 git diff 的格式一致），内容相同时返回空字符串
+func UnifiedDiff(oldText, newText, oldName, newName string) string {
+	if oldText == newText {
+		return ""
+	}
+	lines := DiffLines(splitLines(oldText), splitLines(newText))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+
+	// 按上下文行数把差异分组为块
+	for start := 0; start < len(lines); {
+		// 找到下一处改动
+		first := start
+		for first < len(lines) && lines[first].Op == DiffEqual {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+
+		hunkStart := first - diffContextLines
+		if hunkStart < start {
+			hunkStart = start
+		}
+		// 向后延伸，直到连续的相同行超过两倍上下文
+		hunkEnd := first
+		for k := first; k < len(lines); k++ {
+			if lines[k].Op != DiffEqual {
+				hunkEnd = k + 1
+				continue
+			}
+			if k-hunkEnd >= 2*diffContextLines {
+				break
+			}
+		}
+		hunkEnd += diffContextLines
+		if hunkEnd > len(lines) {
+			hunkEnd = len(lines)
+		}
+
+		oldStart, newStart := 1, 1
+		for _, line := range lines[:hunkStart] {
+			if line.Op != DiffInsert {
+				oldStart++
+			}
+			if line.Op != DiffDelete {
+				newStart++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, line := range lines[hunkStart:hunkEnd] {
+			if line.Op != DiffInsert {
+				oldCount++
+			}
+			if line.Op != DiffDelete {
+				newCount++
+			}
+		}
+
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, line := range lines[hunkStart:hunkEnd] {
+			b.WriteByte(line.Op)
+			b.WriteString(line.Text)
+			b.WriteByte('\n')
+		}
+		start = hunkEnd
+	}
+	return b.String()
+}
+
+// hunkRange 格式化差异块的行范围
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines 按行拆分文本（统一换行符，忽略末尾换行）
+func splitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
@@ -16,6 +16,7 @@ type DocumentType struct {
 	DisplayName string    `json:"displayName"` // 显示名称
 	IsDefault   bool      `json:"isDefault"`   // 是否为默认配置
 	ModifiedAt  time.Time `json:"modifiedAt"`  // 最后修改时间
+	Lock        *ConfigLock `json:"lock,omitempty"` // 文档类型本身的锁定（整个客户的锁定见 Client.Locks）
 }
 
 // DocumentPreview 文档预览信息
@@ -28,6 +29,10 @@ type DocumentPreview struct {
 	Version     string   `json:"version,omitempty"`  // 版本（可选）
 	Date        string   `json:"date,omitempty"`     // 日期（可选）
 	Template    string   `json:"template,omitempty"` // 使用的模板（可选）
+	// OverriddenModules 被客户覆盖目录（overrides/src）替换的模块
+	OverriddenModules []string `json:"overriddenModules,omitempty"`
+	// ConditionalModules 带包含条件的模块（模块路径 -> 条件）
+	ConditionalModules map[string]string `json:"conditionalModules,omitempty"`
 }
 
 // DocumentTypeWithPreview 带预览的文档类型
@@ -77,9 +82,9 @@ func (s *DocumentService) ListDocumentTypes(clientName string) ([]DocumentType,
 			continue
 		}
 
-		// 跳过 metadata.yaml
+		// 跳过 metadata.yaml 和 variables.yaml
 		baseName := strings.TrimSuffix(name, ext)
-		if baseName == "metadata" {
+		if isReservedConfigName(baseName) {
 			continue
 		}
 
@@ -95,6 +100,7 @@ func (s *DocumentService) ListDocumentTypes(clientName string) ([]DocumentType,
 			DisplayName: baseName,
 			IsDefault:   false,
 			ModifiedAt:  info.ModTime(),
+			Lock:        activeLockAt(filepath.Join(clientDir, docLockFile(baseName)), clientName, baseName),
 		}
 
 		docTypes = append(docTypes, docType)
@@ -187,6 +193,15 @@ func (s *DocumentService) GetDocumentPreview(clientName, docTypeName string) (*D
 		}
 	}
 
+	// 继承其他配置时使用解析后的完整配置
+	configMgr := NewConfigManager(s.clientsDir)
+	if filepath.Ext(configPath) == ".yaml" && configMgr.ConfigExtends(clientName, docTypeName) != "" {
+		data, err = configMgr.ResolvedConfigData(clientName, docTypeName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// 解析 YAML
 	var config struct {
 		Title      string   `yaml:"title"`
@@ -195,7 +210,7 @@ func (s *DocumentService) GetDocumentPreview(clientName, docTypeName string) (*D
 		Date       string   `yaml:"date"`
 		ClientName string   `yaml:"client_name"`
 		Template   string   `yaml:"template"`
-		Modules    []string `yaml:"modules"`
+		Modules    []ModuleEntry `yaml:"modules"`
 	}
 	
 	if err := parseYAML(data, &config); err != nil {
@@ -217,18 +232,31 @@ func (s *DocumentService) GetDocumentPreview(clientName, docTypeName string) (*D
 		preview.Title = docTypeName
 	}
 
+	// 与构建一致，客户覆盖目录中的同路径模块替换基础模块
+	for _, mod := range config.Modules {
+		if _, overridden := resolveClientModule(s.clientsDir, filepath.Dir(s.clientsDir), clientName, mod.Path); overridden {
+			preview.OverriddenModules = append(preview.OverriddenModules, mod.Path)
+		}
+		if mod.When != nil {
+			if preview.ConditionalModules == nil {
+				preview.ConditionalModules = make(map[string]string)
+			}
+			preview.ConditionalModules[mod.Path] = mod.When.String()
+		}
+	}
+
 	// 提取模块显示名称（最多5个）
 	maxModules := 5
 	if len(config.Modules) <= maxModules {
 		preview.Modules = make([]string, len(config.Modules))
 		for i, mod := range config.Modules {
-			preview.Modules[i] = extractModuleDisplayName(mod)
+			preview.Modules[i] = moduleDisplayNameWithCondition(mod)
 		}
 		preview.HasMore = false
 	} else {
 		preview.Modules = make([]string, maxModules)
 		for i := 0; i < maxModules; i++ {
-			preview.Modules[i] = extractModuleDisplayName(config.Modules[i])
+			preview.Modules[i] = moduleDisplayNameWithCondition(config.Modules[i])
 		}
 		preview.HasMore = true
 	}
@@ -236,6 +264,15 @@ func (s *DocumentService) GetDocumentPreview(clientName, docTypeName string) (*D
 	return preview, nil
 }
 
+// moduleDisplayNameWithCondition 模块显示名称，带条件的模块附加条件说明
+func moduleDisplayNameWithCondition(mod ModuleEntry) string {
+	name := extractModuleDisplayName(mod.Path)
+	if mod.When != nil {
+		name += " [条件: " + mod.When.String() + "]"
+	}
+	return name
+}
+
 // ListDocumentTypesWithPreview 获取带预览的文档类型列表
 func (s *DocumentService) ListDocumentTypesWithPreview(clientName string) ([]DocumentTypeWithPreview, error) {
 	// 先获取基本文档类型列表
@@ -2,6 +2,8 @@
 package service
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +14,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -31,6 +34,7 @@ var (
 	ErrInvalidFilename = errors.New("文件名包含非法字符")
 	ErrReadError       = errors.New("文件读取失败")
 	ErrWriteError      = errors.New("文件写入失败")
+	ErrETagRequired    = errors.New("保存模块需要提供 If-Match（读取模块时返回的 ETag）")
 )
 
 // ModuleContent 模块内容
@@ -38,11 +42,34 @@ type ModuleContent struct {
 	Path         string    `json:"path"`
 	Content      string    `json:"content"`
 	LastModified time.Time `json:"lastModified"`
+	ETag         string    `json:"etag"` // 内容哈希，保存时通过 If-Match 传回
+}
+
+// SaveResult 保存模块的结果
+type SaveResult struct {
+	ETag    string `json:"etag"`
+	Merged  bool   `json:"merged"`            // 是否与其他人的修改自动合并
+	Content string `json:"content,omitempty"` // 自动合并后的内容
+}
+
+// ModuleConflictError 模块已被其他人修改，且无法自动合并
+type ModuleConflictError struct {
+	Current *ModuleContent // 服务器上的当前内容
+	Merge   *MergeResult   // 提供了原始版本时的三方合并结果（冲突处带有标记）
+}
+
+func (e *ModuleConflictError) Error() string {
+	if e.Merge != nil {
+		return fmt.Sprintf("模块已被其他人修改，有 %d 处冲突需要手动处理", e.Merge.Conflicts)
+	}
+	return "模块已被其他人修改，请重新加载后再保存"
 }
 
 // EditorService 编辑器服务
 type EditorService struct {
 	srcDir string
+	mu     sync.Mutex // 保证保存时比较 ETag 和写入文件之间不被其他保存或批量改写引用打断
+	trash  *TrashService
 }
 
 // NewEditorService 创建编辑器服务
@@ -52,6 +79,16 @@ func NewEditorService(srcDir string) *EditorService {
 	}
 }
 
+// SaveLock 返回保存锁，其他服务批量改写模块时使用
+func (s *EditorService) SaveLock() sync.Locker {
+	return &s.mu
+}
+
+// SetTrash 设置回收站，删除的模块和图片移入回收站（未设置时直接删除）
+func (s *EditorService) SetTrash(trash *TrashService) {
+	s.trash = trash
+}
+
 // ValidatePath 验证路径安全性
 // 参数: modulePath - 文件路径（可以是 "src/xxx.md" 或 "xxx.md" 格式）
 // 返回: 清理后的安全绝对路径和错误
@@ -229,31 +266,76 @@ func (s *EditorService) ReadModule(modulePath string) (*ModuleContent, error) {
 		Path:         modulePath,
 		Content:      string(content),
 		LastModified: info.ModTime(),
+		ETag:         ContentETag(content),
 	}, nil
 }
 
+// ContentETag 计算内容的 ETag（带引号的 SHA-256，与 HTTP ETag 头的格式一致）
+func ContentETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// etagMatches 判断 If-Match 是否与当前 ETag 一致（支持 * 和逗号分隔的多个值）
+func etagMatches(ifMatch, etag string) bool {
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
 // SaveModule 保存模块内容
-// 参数: modulePath - 相对于 src/ 的文件路径, content - 文件内容
-// 返回: 错误
-func (s *EditorService) SaveModule(modulePath string, content string) error {
-	// 验证路径
+// 参数: modulePath - 相对于 src/ 的文件路径, content - 文件内容,
+// ifMatch - 读取时的 ETag（"*" 表示强制覆盖）, base - 读取时的原始内容（可以为 nil，用于自动合并）
+// 返回: 保存结果和错误；文件已被修改且无法自动合并时返回 *ModuleConflictError
+func (s *EditorService) SaveModule(modulePath, content, ifMatch string, base *string) (*SaveResult, error) {
+	if strings.TrimSpace(ifMatch) == "" {
+		return nil, ErrETagRequired
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 读取当前内容（只允许编辑已存在的文件）
+	current, err := s.ReadModule(modulePath)
+	if err != nil {
+		return nil, err
+	}
 	absPath, err := s.ValidatePath(modulePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// 检查文件是否存在（只允许编辑已存在的文件）
-	if _, err := os.Stat(absPath); os.IsNotExist(err) {
-		return ErrFileNotFound
+	result := &SaveResult{}
+	if !etagMatches(ifMatch, current.ETag) {
+		// 提供了读取时的原始内容时尝试三方合并
+		if base == nil || !etagMatches(ifMatch, ContentETag([]byte(*base))) {
+			return nil, &ModuleConflictError{Current: current}
+		}
+		merge := Merge3(*base, content, current.Content)
+		if merge.Conflicts > 0 {
+			return nil, &ModuleConflictError{Current: current, Merge: &merge}
+		}
+		content = merge.Content
+		result.Merged = true
+		result.Content = content
 	}
 
 	// 写入文件
 	if err := os.WriteFile(absPath, []byte(content), 0644); err != nil {
-		return fmt.Errorf("%w: %v", ErrWriteError, err)
+		return nil, fmt.Errorf("%w: %v", ErrWriteError, err)
 	}
+	result.ETag = ContentETag([]byte(content))
 
-	log.Printf("[Editor] 文件已保存: %s", modulePath)
-	return nil
+	if result.Merged {
+		log.Printf("[Editor] 文件已保存（已自动合并其他修改）: %s", modulePath)
+	} else {
+		log.Printf("[Editor] 文件已保存: %s", modulePath)
+	}
+	return result, nil
 }
 
 // CreateModule 创建新模块
@@ -485,6 +567,11 @@ func (s *EditorService) SaveTreeOrder(parentPath string, order []string) error {
 	return s.saveTreeOrder(orderMap)
 }
 
+// TreeOrderPath 返回保存文件树排序的文件路径
+func (s *EditorService) TreeOrderPath() string {
+	return filepath.Join(s.srcDir, editorOrderFileName)
+}
+
 func (s *EditorService) loadTreeOrder() (map[string][]string, error) {
 	orderPath := filepath.Join(s.srcDir, editorOrderFileName)
 	data, err := os.ReadFile(orderPath)
@@ -519,43 +606,57 @@ func (s *EditorService) saveTreeOrder(orderMap map[string][]string) error {
 	return nil
 }
 
-// DeleteModule 删除模块
-// 参数: modulePath - 相对于 src/ 的文件路径
-// 返回: 错误
-func (s *EditorService) DeleteModule(modulePath string) error {
+// DeleteModule 删除模块（移入回收站）
+// 参数: modulePath - 相对于 src/ 的文件路径, deletedBy - 操作人
+// 返回: 回收站条目（没有设置回收站时为 nil）, 错误
+func (s *EditorService) DeleteModule(modulePath, deletedBy string) (*TrashItem, error) {
 	// 验证路径
 	absPath, err := s.ValidatePath(modulePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 检查文件是否存在
 	if _, err := os.Stat(absPath); os.IsNotExist(err) {
-		return ErrFileNotFound
+		return nil, ErrFileNotFound
 	}
 
-	// 删除文件
-	if err := os.Remove(absPath); err != nil {
-		return fmt.Errorf("%w: %v", ErrWriteError, err)
+	// 移入回收站
+	item, err := s.trash.discard(TrashModule, s.srcRelPath(absPath), []string{absPath}, deletedBy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWriteError, err)
 	}
 
 	log.Printf("[Editor] 文件已删除: %s", modulePath)
-	return nil
+	return item, nil
 }
 
-// DeleteImage 删除图片文件
-// 参数: imagePath - 相对于 src/ 的图片路径
-// 返回: 错误
-func (s *EditorService) DeleteImage(imagePath string) error {
+// srcRelPath 绝对路径转为相对于 src/ 的路径（使用 /）
+func (s *EditorService) srcRelPath(absPath string) string {
+	absSrcDir, err := filepath.Abs(s.srcDir)
+	if err != nil {
+		return filepath.Base(absPath)
+	}
+	rel, err := filepath.Rel(absSrcDir, absPath)
+	if err != nil {
+		return filepath.Base(absPath)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// DeleteImage 删除图片文件（移入回收站）
+// 参数: imagePath - 相对于 src/ 的图片路径, deletedBy - 操作人, force - 仍被模块引用时也删除
+// 返回: 回收站条目（没有设置回收站时为 nil）, 错误（仍被引用时为 *ImageInUseError）
+func (s *EditorService) DeleteImage(imagePath, deletedBy string, force bool) (*TrashItem, error) {
 	// 检查路径是否包含 ..
 	if strings.Contains(imagePath, "..") {
 		log.Printf("[Editor] 检测到路径遍历尝试: %s", imagePath)
-		return ErrPathForbidden
+		return nil, ErrPathForbidden
 	}
 
 	// 检查是否是图片文件
 	if !isImageFile(imagePath) {
-		return ErrInvalidFileType
+		return nil, ErrInvalidFileType
 	}
 
 	// 清理路径
@@ -567,72 +668,43 @@ func (s *EditorService) DeleteImage(imagePath string) error {
 	absPath := filepath.Join(s.srcDir, cleanPath)
 	absPath, err := filepath.Abs(absPath)
 	if err != nil {
-		return ErrPathForbidden
+		return nil, ErrPathForbidden
 	}
 
 	// 确保路径在 srcDir 内
 	absSrcDir, err := filepath.Abs(s.srcDir)
 	if err != nil {
-		return ErrPathForbidden
+		return nil, ErrPathForbidden
 	}
 	if !strings.HasPrefix(absPath, absSrcDir) {
 		log.Printf("[Editor] 路径超出 src 目录: %s", imagePath)
-		return ErrPathForbidden
+		return nil, ErrPathForbidden
 	}
 
 	// 检查文件是否存在
 	if _, err := os.Stat(absPath); os.IsNotExist(err) {
-		return ErrFileNotFound
-	}
-
-	// 删除文件
-	if err := os.Remove(absPath); err != nil {
-		return fmt.Errorf("%w: %v", ErrWriteError, err)
+		return nil, ErrFileNotFound
 	}
 
-	log.Printf("[Editor] 图片已删除: %s", imagePath)
-	return nil
-}
-
-// RenameModule 重命名模块
-// 参数: oldPath - 原路径, newPath - 新路径
-// 返回: 错误
-func (s *EditorService) RenameModule(oldPath, newPath string) error {
-	// 验证原路径
-	absOldPath, err := s.ValidatePath(oldPath)
-	if err != nil {
-		return err
+	// 仍被模块引用时拒绝删除，避免构建时才发现图片丢失
+	if !force {
+		refs, err := s.ImageReferences(absPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(refs) > 0 {
+			return nil, &ImageInUseError{Path: s.srcRelPath(absPath), References: refs}
+		}
 	}
 
-	// 验证新路径
-	absNewPath, err := s.ValidatePath(newPath)
+	// 移入回收站
+	item, err := s.trash.discard(TrashImage, s.srcRelPath(absPath), []string{absPath}, deletedBy)
 	if err != nil {
-		return err
-	}
-
-	// 检查原文件是否存在
-	if _, err := os.Stat(absOldPath); os.IsNotExist(err) {
-		return ErrFileNotFound
-	}
-
-	// 检查新文件是否已存在
-	if _, err := os.Stat(absNewPath); err == nil {
-		return ErrFileExists
-	}
-
-	// 确保目标目录存在
-	dir := filepath.Dir(absNewPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("%w: %v", ErrWriteError, err)
-	}
-
-	// 重命名文件
-	if err := os.Rename(absOldPath, absNewPath); err != nil {
-		return fmt.Errorf("%w: %v", ErrWriteError, err)
+		return nil, fmt.Errorf("%w: %v", ErrWriteError, err)
 	}
 
-	log.Printf("[Editor] 文件已重命名: %s -> %s", oldPath, newPath)
-	return nil
+	log.Printf("[Editor] 图片已删除: %s", imagePath)
+	return item, nil
 }
 
 // SaveImage 保存图片
@@ -811,19 +883,19 @@ func (s *EditorService) GetAttachments(modulePath string) ([]AttachmentInfo, err
 	return attachments, nil
 }
 
-// RenameAttachment 重命名附件文件
+// RenameAttachment 重命名附件文件，并修改 src/ 中所有引用该附件的 ![](...) 和 <img src>
 // 参数: modulePath - 文档的相对路径, oldName - 原文件名, newName - 新文件名
-// 返回: 新的相对路径和错误
-func (s *EditorService) RenameAttachment(modulePath, oldName, newName string) (string, error) {
+// 返回: 新的相对路径、修改的引用和错误
+func (s *EditorService) RenameAttachment(modulePath, oldName, newName string) (string, []ImageReference, error) {
 	// 验证路径安全性
 	if strings.Contains(modulePath, "..") || strings.Contains(oldName, "..") || strings.Contains(newName, "..") {
 		log.Printf("[Editor] 检测到路径遍历尝试")
-		return "", ErrPathForbidden
+		return "", nil, ErrPathForbidden
 	}
 
 	// 验证新文件名
 	if strings.ContainsAny(newName, "/\\:*?\"<>|") || strings.HasPrefix(newName, ".") {
-		return "", ErrInvalidFilename
+		return "", nil, ErrInvalidFilename
 	}
 
 	// 确保保留原扩展名
@@ -858,15 +930,15 @@ func (s *EditorService) RenameAttachment(modulePath, oldName, newName string) (s
 	// 确保路径在 srcDir 内
 	absImagesDir, err := filepath.Abs(imagesDir)
 	if err != nil {
-		return "", ErrPathForbidden
+		return "", nil, ErrPathForbidden
 	}
 	absSrcDir, err := filepath.Abs(s.srcDir)
 	if err != nil {
-		return "", ErrPathForbidden
+		return "", nil, ErrPathForbidden
 	}
 	if !strings.HasPrefix(absImagesDir, absSrcDir) {
 		log.Printf("[Editor] 路径超出 src 目录")
-		return "", ErrPathForbidden
+		return "", nil, ErrPathForbidden
 	}
 
 	// 构建原文件和新文件的完整路径
@@ -875,25 +947,41 @@ func (s *EditorService) RenameAttachment(modulePath, oldName, newName string) (s
 
 	// 检查原文件是否存在
 	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
-		return "", ErrFileNotFound
+		return "", nil, ErrFileNotFound
 	}
 
 	// 如果新旧文件名相同，直接返回成功
 	if oldName == newName {
-		return "images/" + newName, nil
+		return "images/" + newName, []ImageReference{}, nil
 	}
 
 	// 检查新文件是否已存在
 	if _, err := os.Stat(newPath); err == nil {
-		return "", ErrFileExists
+		return "", nil, ErrFileExists
+	}
+
+	// 找出需要修改的引用（持有保存锁直到写回，避免覆盖期间保存的模块）
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writes, refs, err := s.retargetReferences(oldPath, newPath)
+	if err != nil {
+		return "", nil, err
 	}
 
 	// 执行重命名
 	if err := os.Rename(oldPath, newPath); err != nil {
 		log.Printf("[Editor] 重命名附件失败: %v", err)
-		return "", fmt.Errorf("%w: %v", ErrWriteError, err)
+		return "", nil, fmt.Errorf("%w: %v", ErrWriteError, err)
+	}
+
+	// 修改引用，失败时恢复文件名
+	if err := writeFilesAtomically(writes); err != nil {
+		if restoreErr := os.Rename(newPath, oldPath); restoreErr != nil {
+			log.Printf("[Editor] 警告: 恢复附件文件名失败: %v", restoreErr)
+		}
+		return "", nil, fmt.Errorf("%w: %v", ErrWriteError, err)
 	}
 
-	log.Printf("[Editor] 附件重命名成功: %s -> %s", oldName, newName)
-	return "images/" + newName, nil
+	log.Printf("[Editor] 附件重命名成功: %s -> %s (修改 %d 处引用)", oldName, newName, len(refs))
+	return "images/" + newName, refs, nil
 }
@@ -165,6 +165,30 @@ func (s *GitService) IsRepository() bool {
 	return info.IsDir()
 }
 
+// HeadCommit 返回 HEAD 指向的提交哈希（不是仓库或还没有提交时为空）
+func (s *GitService) HeadCommit() string {
+	if !s.IsRepository() {
+		return ""
+	}
+	hash, err := s.runGit("rev-parse", "--verify", "-q", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return hash
+}
+
+// IndexTree 返回暂存区对应的树对象哈希（用于记录暂存操作前后的状态）
+func (s *GitService) IndexTree() string {
+	if !s.IsRepository() {
+		return ""
+	}
+	hash, err := s.runGit("write-tree")
+	if err != nil {
+		return ""
+	}
+	return hash
+}
+
 // GetStatus 获取仓库状态
 func (s *GitService) GetStatus() (*GitStatus, error) {
 	status := &GitStatus{
@@ -499,6 +523,15 @@ Thumbs.db
 *.swp
 *.swo
 
+# User accounts, audit log and approvals
+.users.json
+.tokens.json
+.audit.log
+.pandoc-approvals.json
+
+# Recycle bin
+.trash/
+
 # Temporary files
 *.tmp
 *.temp
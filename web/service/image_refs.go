@@ -0,0 +1,143 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ImageReference 模块中对图片的一处引用
+type ImageReference struct {
+	Module    string `json:"module"` // 相对于 src/
+	Line      int    `json:"line"`
+	Target    string `json:"target"`              // 原文中的路径
+	NewTarget string `json:"newTarget,omitempty"` // 重命名后的路径
+}
+
+// ImageInUseError 删除的图片仍被模块引用
+type ImageInUseError struct {
+	Path       string           // 相对于 src/
+	References []ImageReference // 引用位置
+}
+
+func (e *ImageInUseError) Error() string {
+	modules := make([]string, 0, len(e.References))
+	seen := make(map[string]bool)
+	for _, ref := range e.References {
+		if !seen[ref.Module] {
+			seen[ref.Module] = true
+			modules = append(modules, ref.Module)
+		}
+	}
+	return fmt.Sprintf("图片 %s 仍被 %d 个模块引用: %s", e.Path, len(modules), strings.Join(modules, ", "))
+}
+
+// srcFileRefs 一个模块中指向某个文件的引用
+type srcFileRefs struct {
+	abs     string
+	content string
+	refs    []markdownRef
+}
+
+// findFileReferences 查找 src/ 中指向 targetAbs 的相对引用（![](...)、<img src>、链接和 {{include}}）
+func (s *EditorService) findFileReferences(targetAbs string) ([]srcFileRefs, error) {
+	absSrcDir, err := filepath.Abs(s.srcDir)
+	if err != nil {
+		return nil, ErrPathForbidden
+	}
+	if targetAbs, err = filepath.Abs(targetAbs); err != nil {
+		return nil, ErrPathForbidden
+	}
+
+	var result []srcFileRefs
+	err = filepath.WalkDir(absSrcDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if file != absSrcDir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isMarkdownFile(d.Name()) {
+			return nil
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		content := string(data)
+		var matched []markdownRef
+		for _, ref := range findMarkdownRefs(content) {
+			if target, _ := resolveRef(ref, file, absSrcDir); target == targetAbs {
+				matched = append(matched, ref)
+			}
+		}
+		if len(matched) > 0 {
+			result = append(result, srcFileRefs{abs: file, content: content, refs: matched})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrReadError, err)
+	}
+	return result, nil
+}
+
+// ImageReferences 列出引用图片的模块位置
+// 参数: imageAbs - 图片的绝对路径
+func (s *EditorService) ImageReferences(imageAbs string) ([]ImageReference, error) {
+	files, err := s.findFileReferences(imageAbs)
+	if err != nil {
+		return nil, err
+	}
+	refs := []ImageReference{}
+	for _, file := range files {
+		for _, ref := range file.refs {
+			refs = append(refs, ImageReference{
+				Module: s.srcRelPath(file.abs),
+				Line:   lineAt(file.content, ref.Start),
+				Target: file.content[ref.Start:ref.End],
+			})
+		}
+	}
+	return refs, nil
+}
+
+// retargetReferences 把 src/ 中指向 oldAbs 的引用改为指向 newAbs（newAbs 尚未存在也可以）
+// 返回修改后的文件内容和修改清单
+func (s *EditorService) retargetReferences(oldAbs, newAbs string) (map[string]string, []ImageReference, error) {
+	files, err := s.findFileReferences(oldAbs)
+	if err != nil {
+		return nil, nil, err
+	}
+	writes := make(map[string]string)
+	refs := []ImageReference{}
+	for _, file := range files {
+		var b strings.Builder
+		last := 0
+		for _, ref := range file.refs {
+			newRel, err := filepath.Rel(filepath.Dir(file.abs), newAbs)
+			if err != nil {
+				continue
+			}
+			replacement := formatRef(ref, newRel)
+			refs = append(refs, ImageReference{
+				Module:    s.srcRelPath(file.abs),
+				Line:      lineAt(file.content, ref.Start),
+				Target:    file.content[ref.Start:ref.End],
+				NewTarget: replacement,
+			})
+			b.WriteString(file.content[last:ref.Start])
+			b.WriteString(replacement)
+			last = ref.End
+		}
+		b.WriteString(file.content[last:])
+		writes[file.abs] = b.String()
+	}
+	return writes, refs, nil
+}
@@ -0,0 +1,235 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// includeRegex 匹配 {{include "path"}} 和 {{include "path" level=+1}}
+var includeRegex = regexp.MustCompile(`\{\{include\s+"([^"]+)"(?:\s+level=([+-]?\d+))?\s*\}\}`)
+
+// headingRegex 匹配 ATX 标题行
+var headingRegex = regexp.MustCompile(`(?m)^(#{1,6})(\s)`)
+
+// maxIncludeDepth 最大嵌套层数
+const maxIncludeDepth = 10
+
+// ExpandIncludes 展开内容中的 {{include}} 引用（递归，检测循环引用）
+// 参数: content - 文件内容, filePath - 文件的绝对路径（用于解析相对路径）
+// 返回展开后的内容，以及被引用文件中声明的变量（按文件分组，键为相对于项目根目录的路径）
+// 被引用文件的 front-matter 不会出现在展开结果中；转义的 \{{include ...}} 和代码中的引用保持原样
+func (s *VariableService) ExpandIncludes(content, filePath string) (string, map[string][]VariableDeclaration, error) {
+	included := make(map[string][]VariableDeclaration)
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", nil, err
+	}
+	expanded, err := s.expandIncludes(content, absPath, []string{absPath}, included)
+	if err != nil {
+		return "", nil, err
+	}
+	return expanded, included, nil
+}
+
+// HasIncludes 判断内容中是否有需要展开的引用
+func HasIncludes(content string) bool {
+	return len(findIncludes(content)) > 0
+}
+
+// ModulesUseIncludes 判断模块列表（相对于工作目录，支持通配符）中是否有模块使用了 {{include}}
+// 只需检查构建的模块：被引用的文件由展开时读取
+func (s *VariableService) ModulesUseIncludes(modulePaths []string) bool {
+	workDir := filepath.Dir(s.srcDir)
+	for _, path := range expandModulePatterns(workDir, modulePaths) {
+		if !strings.HasSuffix(strings.ToLower(path), ".md") {
+			continue
+		}
+		fullPath := path
+		if !filepath.IsAbs(path) {
+			fullPath = filepath.Join(workDir, path)
+		}
+		if data, err := os.ReadFile(filepath.Clean(fullPath)); err == nil && HasIncludes(string(data)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SrcUsesIncludes 判断 src 目录中是否有模块使用了 {{include}}（不知道构建哪些模块时使用）
+func (s *VariableService) SrcUsesIncludes() bool {
+	err := filepath.Walk(s.srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if path != s.srcDir && (strings.HasPrefix(info.Name(), ".") || ignoredDirs[info.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(strings.ToLower(info.Name()), ".md") {
+			if data, err := os.ReadFile(path); err == nil && HasIncludes(string(data)) {
+				return errIncludeFound
+			}
+		}
+		return nil
+	})
+	return err == errIncludeFound
+}
+
+// errIncludeFound 用于提前结束目录遍历
+var errIncludeFound = errors.New("include found")
+
+// expandIncludes 递归展开引用，stack 为当前引用链（用于检测循环引用）
+func (s *VariableService) expandIncludes(content, absPath string, stack []string, included map[string][]VariableDeclaration) (string, error) {
+	matches := findIncludes(content)
+	if len(matches) == 0 {
+		return content, nil
+	}
+	if len(stack) > maxIncludeDepth {
+		return "", fmt.Errorf("引用嵌套超过 %d 层: %s", maxIncludeDepth, strings.Join(s.relPaths(stack), " → "))
+	}
+
+	workDir, _ := filepath.Abs(filepath.Dir(s.srcDir))
+	var b strings.Builder
+	last := 0
+	for _, loc := range matches {
+		target := content[loc[2]:loc[3]]
+		line := lineAt(content, loc[0])
+		rel := relSlash(workDir, absPath)
+
+		targetPath, err := s.resolveIncludePath(absPath, target)
+		if err != nil {
+			return "", fmt.Errorf("%s:%d: %w", rel, line, err)
+		}
+		for _, p := range stack {
+			if p == targetPath {
+				chain := append(s.relPaths(stack), relSlash(workDir, targetPath))
+				return "", fmt.Errorf("%s:%d: 循环引用: %s", rel, line, strings.Join(chain, " → "))
+			}
+		}
+
+		level := 0
+		if loc[4] >= 0 {
+			level, _ = strconv.Atoi(strings.TrimPrefix(content[loc[4]:loc[5]], "+"))
+		}
+
+		data, err := os.ReadFile(targetPath)
+		if err != nil {
+			return "", fmt.Errorf("%s:%d: 读取引用文件失败: %w", rel, line, err)
+		}
+		targetRel := relSlash(workDir, targetPath)
+		decls, err := s.ExtractVariablesFromContent(string(data), targetRel)
+		if err != nil {
+			return "", fmt.Errorf("解析 %s 的 front-matter 失败: %w", targetRel, err)
+		}
+		if len(decls) > 0 {
+			included[targetRel] = decls
+		}
+
+		body := strings.TrimLeft(string(data)[frontMatterEnd(string(data)):], "\r\n")
+		body, err = s.expandIncludes(body, targetPath, append(stack, targetPath), included)
+		if err != nil {
+			return "", err
+		}
+		body = shiftHeadings(strings.TrimRight(body, "\r\n"), level)
+
+		b.WriteString(content[last:loc[0]])
+		b.WriteString(body)
+		last = loc[1]
+	}
+	b.WriteString(content[last:])
+	return b.String(), nil
+}
+
+// findIncludes 查找需要展开的引用（跳过 front-matter、代码和转义的引用）
+func findIncludes(content string) [][]int {
+	bodyStart := frontMatterEnd(content)
+	codeRanges := codeRegex.FindAllStringIndex(content, -1)
+
+	var result [][]int
+	for _, loc := range includeRegex.FindAllStringSubmatchIndex(content, -1) {
+		if loc[0] < bodyStart || inRanges(codeRanges, loc[0]) {
+			continue
+		}
+		if loc[0] > 0 && content[loc[0]-1] == '\\' {
+			continue
+		}
+		result = append(result, loc)
+	}
+	return result
+}
+
+// resolveIncludePath 解析引用路径：先相对于当前文件所在目录，再相对于 src 目录
+// 引用文件必须是 src 目录中的 Markdown 文件
+func (s *VariableService) resolveIncludePath(fromPath, target string) (string, error) {
+	if !strings.HasSuffix(strings.ToLower(target), ".md") {
+		return "", fmt.Errorf("只能引用 Markdown 文件: %s", target)
+	}
+	if filepath.IsAbs(target) {
+		return "", fmt.Errorf("引用路径必须是相对路径: %s", target)
+	}
+
+	srcDir, err := filepath.Abs(s.srcDir)
+	if err != nil {
+		return "", err
+	}
+	candidates := []string{
+		filepath.Join(filepath.Dir(fromPath), filepath.FromSlash(target)),
+		filepath.Join(srcDir, filepath.FromSlash(target)),
+	}
+	for _, candidate := range candidates {
+		rel, err := filepath.Rel(srcDir, candidate)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("引用文件不存在: %s", target)
+}
+
+// relPaths 把绝对路径转换为相对于项目根目录的路径
+func (s *VariableService) relPaths(paths []string) []string {
+	workDir, _ := filepath.Abs(filepath.Dir(s.srcDir))
+	result := make([]string, len(paths))
+	for i, p := range paths {
+		result[i] = relSlash(workDir, p)
+	}
+	return result
+}
+
+// shiftHeadings 调整标题级别（代码块中的 # 不处理），结果限制在 1～6 级
+func shiftHeadings(content string, level int) string {
+	if level == 0 {
+		return content
+	}
+	codeRanges := codeRegex.FindAllStringIndex(content, -1)
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range headingRegex.FindAllStringSubmatchIndex(content, -1) {
+		if inRanges(codeRanges, loc[0]) {
+			continue
+		}
+		depth := loc[3] - loc[2] + level
+		if depth < 1 {
+			depth = 1
+		}
+		if depth > 6 {
+			depth = 6
+		}
+		b.WriteString(content[last:loc[0]])
+		b.WriteString(strings.Repeat("#", depth))
+		last = loc[3]
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
@@ -0,0 +1,361 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// 锁定标记文件名：.locked 锁定整个客户，.locked.<文档类型> 只锁定一个文档类型
+	lockedMarkerFile = ".locked"
+	docLockPrefix    = ".locked."
+	// 锁定和解锁记录（每行一个 JSON，只追加）
+	lockHistoryFile = ".lock-history.jsonl"
+
+	maxLockHours = 24 * 365
+)
+
+// ConfigLock 配置锁定，保存在锁定标记文件中
+// 锁定期间只有锁定人可以修改配置、修改只被该客户使用的模块和生成正式版文档
+type ConfigLock struct {
+	Client    string     `json:"client"`
+	DocType   string     `json:"docType,omitempty"` // 为空时锁定整个客户
+	Owner     string     `json:"owner"`             // 锁定人，旧版空标记文件为空（任何人都不能绕过）
+	Reason    string     `json:"reason,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // 为空时不会自动过期
+}
+
+// LockInput 锁定参数
+type LockInput struct {
+	Reason         string `json:"reason"`
+	ExpiresInHours int    `json:"expiresInHours"` // 0 表示不过期
+}
+
+// LockEvent 锁定历史记录
+type LockEvent struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"` // lock 或 unlock
+	Actor  string    `json:"actor"`
+	ConfigLock
+}
+
+// Expired 锁定是否已过期
+func (l *ConfigLock) Expired() bool {
+	return l.ExpiresAt != nil && time.Now().After(*l.ExpiresAt)
+}
+
+// Target 锁定对象（客户 或 客户/文档类型）
+func (l *ConfigLock) Target() string {
+	if l.DocType == "" {
+		return l.Client
+	}
+	return l.Client + "/" + l.DocType
+}
+
+// Blocks 锁定是否阻止该用户修改
+func (l *ConfigLock) Blocks(username string) bool {
+	return l.Owner == "" || l.Owner != username
+}
+
+// Describe 锁定说明，用于错误信息
+func (l *ConfigLock) Describe() string {
+	var parts []string
+	if l.Owner != "" {
+		parts = append(parts, "锁定人: "+l.Owner)
+	}
+	if l.Reason != "" {
+		parts = append(parts, "原因: "+l.Reason)
+	}
+	if l.ExpiresAt != nil {
+		parts = append(parts, "到期: "+l.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	}
+	if len(parts) == 0 {
+		return l.Target() + " 已锁定"
+	}
+	return fmt.Sprintf("%s 已锁定（%s）", l.Target(), strings.Join(parts, "，"))
+}
+
+// docLockFile 返回锁定标记文件名
+func docLockFile(docTypeName string) string {
+	if docTypeName == "" {
+		return lockedMarkerFile
+	}
+	return docLockPrefix + docTypeName
+}
+
+// LockPath 返回锁定标记文件路径（docTypeName 为空时为客户锁定）
+func (m *ConfigManager) LockPath(clientName, docTypeName string) string {
+	return filepath.Join(m.clientsDir, clientName, docLockFile(docTypeName))
+}
+
+// readLockMarker 读取锁定标记文件，不存在时返回 nil
+// 旧版本的 .locked 是空文件，视为没有锁定人的永久锁定
+func readLockMarker(path, clientName, docTypeName string) (*ConfigLock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	lock := &ConfigLock{}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err := json.Unmarshal(data, lock); err != nil {
+			log.Printf("[ConfigManager] 锁定标记格式错误，按永久锁定处理: %s: %v", path, err)
+			lock = &ConfigLock{}
+		}
+	}
+	if lock.CreatedAt.IsZero() {
+		if info, err := os.Stat(path); err == nil {
+			lock.CreatedAt = info.ModTime()
+		}
+	}
+	lock.Client = clientName
+	lock.DocType = docTypeName
+	return lock, nil
+}
+
+// activeLockAt 读取未过期的锁定
+func activeLockAt(path, clientName, docTypeName string) *ConfigLock {
+	lock, err := readLockMarker(path, clientName, docTypeName)
+	if err != nil || lock == nil || lock.Expired() {
+		return nil
+	}
+	return lock
+}
+
+// GetLock 返回客户或文档类型本身的锁定（不含上级锁定，过期的锁定返回 nil）
+func (m *ConfigManager) GetLock(clientName, docTypeName string) *ConfigLock {
+	return activeLockAt(m.LockPath(clientName, docTypeName), clientName, docTypeName)
+}
+
+// LockFor 返回限制该配置的锁定：先检查整个客户的锁定，再检查文档类型的锁定
+func (m *ConfigManager) LockFor(clientName, docTypeName string) *ConfigLock {
+	if lock := m.GetLock(clientName, ""); lock != nil {
+		return lock
+	}
+	if docTypeName == "" {
+		return nil
+	}
+	return m.GetLock(clientName, docTypeName)
+}
+
+// BlockingLock 返回阻止该用户修改配置的锁定：整个客户和文档类型的锁定都检查，返回第一个被其他人持有的锁定
+// 用户持有客户锁定时，其他人对文档类型的锁定仍然有效
+func (m *ConfigManager) BlockingLock(clientName, docTypeName, username string) *ConfigLock {
+	if lock := m.GetLock(clientName, ""); lock != nil && lock.Blocks(username) {
+		return lock
+	}
+	if docTypeName == "" {
+		return nil
+	}
+	if lock := m.GetLock(clientName, docTypeName); lock != nil && lock.Blocks(username) {
+		return lock
+	}
+	return nil
+}
+
+// IsClientLocked 检查整个客户是否已锁定
+func (m *ConfigManager) IsClientLocked(clientName string) bool {
+	return m.GetLock(clientName, "") != nil
+}
+
+// ListLocks 列出客户当前有效的锁定（整个客户的锁定在前）
+func (m *ConfigManager) ListLocks(clientName string) []ConfigLock {
+	locks := []ConfigLock{}
+	if lock := m.GetLock(clientName, ""); lock != nil {
+		locks = append(locks, *lock)
+	}
+	entries, err := os.ReadDir(filepath.Join(m.clientsDir, clientName))
+	if err != nil {
+		return locks
+	}
+	for _, entry := range entries {
+		docType, ok := strings.CutPrefix(entry.Name(), docLockPrefix)
+		if !ok || entry.IsDir() || docType == "" {
+			continue
+		}
+		if lock := m.GetLock(clientName, docType); lock != nil {
+			locks = append(locks, *lock)
+		}
+	}
+	return locks
+}
+
+// Lock 锁定整个客户或一个文档类型
+// 已被其他人锁定时返回错误；锁定人再次锁定时更新原因和到期时间
+func (m *ConfigManager) Lock(clientName, docTypeName, owner string, input LockInput) (*ConfigLock, error) {
+	clientDir := filepath.Join(m.clientsDir, clientName)
+	if _, err := os.Stat(clientDir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("客户不存在: %s", clientName)
+	}
+	if docTypeName != "" {
+		if _, err := os.Stat(m.configFilePath(clientName, docTypeName)); os.IsNotExist(err) {
+			return nil, fmt.Errorf("配置不存在: %s/%s", clientName, docTypeName)
+		}
+	}
+	if input.ExpiresInHours < 0 || input.ExpiresInHours > maxLockHours {
+		return nil, fmt.Errorf("锁定时长无效，应为 0（不过期）到 %d 小时", maxLockHours)
+	}
+	// 整个客户被其他人锁定时不能锁定文档类型；客户中有其他人锁定的文档类型时不能锁定整个客户
+	blocking := m.BlockingLock(clientName, docTypeName, owner)
+	if docTypeName == "" {
+		for _, existing := range m.ListLocks(clientName) {
+			if existing.Blocks(owner) {
+				blocking = &existing
+				break
+			}
+		}
+	}
+	if blocking != nil {
+		return nil, fmt.Errorf("配置已锁定: %s", blocking.Describe())
+	}
+
+	lock := &ConfigLock{
+		Client:    clientName,
+		DocType:   docTypeName,
+		Owner:     owner,
+		Reason:    strings.TrimSpace(input.Reason),
+		CreatedAt: time.Now(),
+	}
+	if input.ExpiresInHours > 0 {
+		expiresAt := lock.CreatedAt.Add(time.Duration(input.ExpiresInHours) * time.Hour)
+		lock.ExpiresAt = &expiresAt
+	}
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(m.LockPath(clientName, docTypeName), data, 0644); err != nil {
+		return nil, fmt.Errorf("写入锁定标记失败: %w", err)
+	}
+	m.appendLockEvent("lock", owner, lock)
+	log.Printf("[ConfigManager] %s 锁定了 %s", owner, lock.Target())
+	return lock, nil
+}
+
+// Unlock 解除锁定；force 为 false 时只有锁定人可以解锁（已过期的锁定任何人都可以清除）
+// 本来就没有锁定时返回 nil
+func (m *ConfigManager) Unlock(clientName, docTypeName, actor string, force bool) (*ConfigLock, error) {
+	lockPath := m.LockPath(clientName, docTypeName)
+	lock, err := readLockMarker(lockPath, clientName, docTypeName)
+	if err != nil {
+		return nil, fmt.Errorf("读取锁定标记失败: %w", err)
+	}
+	if lock == nil {
+		return nil, nil
+	}
+	if !force && !lock.Expired() && lock.Blocks(actor) {
+		return nil, fmt.Errorf("只有锁定人或管理员可以解锁: %s", lock.Describe())
+	}
+	if err := os.Remove(lockPath); err != nil {
+		return nil, fmt.Errorf("删除锁定标记失败: %w", err)
+	}
+	m.appendLockEvent("unlock", actor, lock)
+	log.Printf("[ConfigManager] %s 解锁了 %s", actor, lock.Target())
+	return lock, nil
+}
+
+// appendLockEvent 追加锁定历史（写入失败只记录日志，不影响锁定操作）
+func (m *ConfigManager) appendLockEvent(action, actor string, lock *ConfigLock) {
+	data, err := json.Marshal(LockEvent{Time: time.Now(), Action: action, Actor: actor, ConfigLock: *lock})
+	if err != nil {
+		return
+	}
+	historyPath := filepath.Join(m.clientsDir, lock.Client, lockHistoryFile)
+	file, err := os.OpenFile(historyPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		log.Printf("[ConfigManager] 写入锁定历史失败: %v", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		log.Printf("[ConfigManager] 写入锁定历史失败: %v", err)
+	}
+}
+
+// LockHistory 返回客户的锁定历史，最新的在前
+func (m *ConfigManager) LockHistory(clientName string) ([]LockEvent, error) {
+	events := []LockEvent{}
+	file, err := os.Open(filepath.Join(m.clientsDir, clientName, lockHistoryFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return events, nil
+		}
+		return nil, fmt.Errorf("读取锁定历史失败: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event LockEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err == nil {
+			events = append(events, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取锁定历史失败: %w", err)
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, nil
+}
+
+// ModuleLocks 返回限制修改该模块的锁定
+// 只有当模块只被一个客户的配置使用时，该客户（或使用它的文档类型）的锁定才会限制修改
+// modulePath 为相对于项目根目录的路径（如 src/01-概述.md）
+func (m *ConfigManager) ModuleLocks(workDir, modulePath string) []ConfigLock {
+	modulePath = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(modulePath)), "./")
+	usedBy := make(map[string][]string) // 客户 -> 使用该模块的文档类型
+
+	clients, err := os.ReadDir(m.clientsDir)
+	if err != nil {
+		return nil
+	}
+	for _, client := range clients {
+		if !client.IsDir() {
+			continue
+		}
+		docTypes, err := m.ListCustomConfigs(client.Name())
+		if err != nil {
+			continue
+		}
+		for _, docType := range docTypes {
+			cfg, err := m.GetConfig(client.Name(), docType)
+			if err != nil {
+				continue
+			}
+			for _, module := range expandModulePatterns(workDir, ModulePaths(cfg.Modules)) {
+				if strings.TrimPrefix(filepath.ToSlash(module), "./") == modulePath {
+					usedBy[client.Name()] = append(usedBy[client.Name()], docType)
+					break
+				}
+			}
+		}
+	}
+	if len(usedBy) != 1 {
+		return nil
+	}
+
+	var locks []ConfigLock
+	for clientName, docTypes := range usedBy {
+		if lock := m.GetLock(clientName, ""); lock != nil {
+			return []ConfigLock{*lock}
+		}
+		for _, docType := range docTypes {
+			if lock := m.GetLock(clientName, docType); lock != nil {
+				locks = append(locks, *lock)
+			}
+		}
+	}
+	return locks
+}
@@ -0,0 +1,131 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Markdown 中引用的类型
+const (
+	MarkdownRefLink    = "link"    // [text](path)、![alt](path) 和 [id]: path
+	MarkdownRefHTML    = "html"    // <img src="path"> 和 <a href="path">
+	MarkdownRefInclude = "include" // {{include "path"}}
+)
+
+var (
+	// mdLinkTargetRegex 匹配行内链接和图片的目标：](path) 或 ](<path with space>)
+	mdLinkTargetRegex = regexp.MustCompile(`\]\(\s*(<[^>\n]+>|[^)\s]+)`)
+	// mdRefDefinitionRegex 匹配引用式链接的定义：[id]: path
+	mdRefDefinitionRegex = regexp.MustCompile(`(?m)^ {0,3}\[[^\]\n]+\]:[ \t]*(<[^>\n]+>|\S+)`)
+	// htmlSrcRegex 匹配 HTML 标签中的 src 和 href
+	htmlSrcRegex = regexp.MustCompile(`(?i)<(?:img|a|source|video)\s[^>]*?(?:src|href)\s*=\s*["']([^"'\n]+)["']`)
+)
+
+// markdownRef Markdown 中的一处相对路径引用
+type markdownRef struct {
+	Kind       string
+	Start, End int    // 路径在内容中的起止位置（不含尖括号、锚点和查询参数）
+	Path       string // 解码后的路径（使用 /）
+	Escape     bool   // 原文使用了百分号编码
+}
+
+// findMarkdownRefs 查找内容中的相对路径引用（跳过 front-matter、代码、网址、锚点和绝对路径）
+func findMarkdownRefs(content string) []markdownRef {
+	bodyStart := frontMatterEnd(content)
+	codeRanges := codeRegex.FindAllStringIndex(content, -1)
+
+	var refs []markdownRef
+	add := func(kind string, start, end int) {
+		if start < bodyStart || inRanges(codeRanges, start) {
+			return
+		}
+		raw := content[start:end]
+		if strings.HasPrefix(raw, "<") && strings.HasSuffix(raw, ">") {
+			start, end = start+1, end-1
+			raw = raw[1 : len(raw)-1]
+		}
+		if i := strings.IndexAny(raw, "#?"); i >= 0 {
+			end = start + i
+			raw = raw[:i]
+		}
+		if !isRelativeRef(raw) {
+			return
+		}
+		ref := markdownRef{Kind: kind, Start: start, End: end, Path: raw}
+		if strings.Contains(raw, "%") {
+			if decoded, err := url.PathUnescape(raw); err == nil {
+				ref.Path, ref.Escape = decoded, true
+			}
+		}
+		ref.Path = strings.ReplaceAll(ref.Path, "\\", "/")
+		refs = append(refs, ref)
+	}
+
+	for _, loc := range mdLinkTargetRegex.FindAllStringSubmatchIndex(content, -1) {
+		add(MarkdownRefLink, loc[2], loc[3])
+	}
+	for _, loc := range mdRefDefinitionRegex.FindAllStringSubmatchIndex(content, -1) {
+		add(MarkdownRefLink, loc[2], loc[3])
+	}
+	for _, loc := range htmlSrcRegex.FindAllStringSubmatchIndex(content, -1) {
+		add(MarkdownRefHTML, loc[2], loc[3])
+	}
+	for _, loc := range findIncludes(content) {
+		add(MarkdownRefInclude, loc[2], loc[3])
+	}
+
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Start < refs[j].Start })
+	return refs
+}
+
+// isRelativeRef 是否为指向本地文件的相对路径
+func isRelativeRef(target string) bool {
+	if target == "" || strings.HasPrefix(target, "/") || strings.HasPrefix(target, "{{") {
+		return false
+	}
+	// 带协议的网址（http:、mailto:、data: 等）和 Windows 盘符
+	if i := strings.Index(target, ":"); i >= 0 && !strings.ContainsAny(target[:i], "/\\") {
+		return false
+	}
+	return true
+}
+
+// resolveRef 解析引用指向的文件：相对于所在文件的目录；{{include}} 找不到时再相对于 src 目录
+// 返回绝对路径和是否相对于 src 目录，文件不存在时返回空字符串
+func resolveRef(ref markdownRef, fileAbs, srcDir string) (string, bool) {
+	target := filepath.Join(filepath.Dir(fileAbs), filepath.FromSlash(ref.Path))
+	if _, err := os.Stat(target); err == nil {
+		return target, false
+	}
+	if ref.Kind == MarkdownRefInclude {
+		target = filepath.Join(srcDir, filepath.FromSlash(ref.Path))
+		if _, err := os.Stat(target); err == nil {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// formatRef 把新路径写成与原引用相同的风格（保留 ./ 前缀、结尾的 / 和百分号编码）
+func formatRef(ref markdownRef, newPath string) string {
+	newPath = filepath.ToSlash(newPath)
+	if strings.HasPrefix(ref.Path, "./") && !strings.HasPrefix(newPath, "../") {
+		newPath = "./" + newPath
+	}
+	if strings.HasSuffix(ref.Path, "/") && !strings.HasSuffix(newPath, "/") {
+		newPath += "/"
+	}
+	if ref.Escape {
+		segments := strings.Split(newPath, "/")
+		for i, segment := range segments {
+			segments[i] = url.PathEscape(segment)
+		}
+		newPath = strings.Join(segments, "/")
+	}
+	return newPath
+}
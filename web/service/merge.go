@@ -0,0 +1,151 @@
+// Package service 提供业务逻辑服务
+package service
+
+import "strings"
+
+// 合并冲突标记（与 git 的格式一致）
+const (
+	conflictMarkerOurs   = "<<<<<<< 我的修改"
+	conflictMarkerSep    = "======="
+	conflictMarkerTheirs = ">>>>>>> 服务器版本"
+)
+
+// MergeResult 三方合并结果
+type MergeResult struct {
+	Content   string `json:"content"`   // 合并后的内容，有冲突时冲突处带有标记
+	Conflicts int    `json:"conflicts"` // 冲突块数量，为 0 时可以直接保存
+}
+
+// mergeHunk 相对于共同版本的一处修改：把 base[start:end] 替换为 lines
+type mergeHunk struct {
+	start, end int
+	lines      []string
+}
+
+// Merge3 逐行三方合并：base 为共同的原始版本，ours 和 theirs 为两边各自修改后的版本
+// 两边修改不重叠时自动合并；修改了相同（或相邻）的行且结果不同时记为冲突
+func Merge3(base, ours, theirs string) MergeResult {
+	if ours == theirs || theirs == base {
+		return MergeResult{Content: ours}
+	}
+	if ours == base {
+		return MergeResult{Content: theirs}
+	}
+
+	baseLines := splitLines(base)
+	oursHunks := diffHunks(DiffLines(baseLines, splitLines(ours)))
+	theirsHunks := diffHunks(DiffLines(baseLines, splitLines(theirs)))
+
+	var out []string
+	conflicts := 0
+	pos := 0
+	i, j := 0, 0
+	for i < len(oursHunks) || j < len(theirsHunks) {
+		// 从起点最靠前的修改开始，收集与之重叠的所有修改
+		start := -1
+		if i < len(oursHunks) {
+			start = oursHunks[i].start
+		}
+		if j < len(theirsHunks) && (start < 0 || theirsHunks[j].start < start) {
+			start = theirsHunks[j].start
+		}
+		end := start
+		oi, tj := i, j
+		for {
+			if oi < len(oursHunks) && oursHunks[oi].start <= end {
+				if oursHunks[oi].end > end {
+					end = oursHunks[oi].end
+				}
+				oi++
+				continue
+			}
+			if tj < len(theirsHunks) && theirsHunks[tj].start <= end {
+				if theirsHunks[tj].end > end {
+					end = theirsHunks[tj].end
+				}
+				tj++
+				continue
+			}
+			break
+		}
+		out = append(out, baseLines[pos:start]...)
+		oursRegion := applyHunks(baseLines, start, end, oursHunks[i:oi])
+		theirsRegion := applyHunks(baseLines, start, end, theirsHunks[j:tj])
+		switch {
+		case oi == i:
+			out = append(out, theirsRegion...)
+		case tj == j, equalLines(oursRegion, theirsRegion):
+			out = append(out, oursRegion...)
+		default:
+			conflicts++
+			out = append(out, conflictMarkerOurs)
+			out = append(out, oursRegion...)
+			out = append(out, conflictMarkerSep)
+			out = append(out, theirsRegion...)
+			out = append(out, conflictMarkerTheirs)
+		}
+		pos, i, j = end, oi, tj
+	}
+	out = append(out, baseLines[pos:]...)
+
+	content := strings.Join(out, "\n")
+	if len(out) > 0 && (strings.HasSuffix(ours, "\n") || strings.HasSuffix(theirs, "\n")) {
+		content += "\n"
+	}
+	return MergeResult{Content: content, Conflicts: conflicts}
+}
+
+// diffHunks 把逐行差异整理为相对于原始版本的修改块
+func diffHunks(lines []DiffLine) []mergeHunk {
+	var hunks []mergeHunk
+	basePos := 0
+	var current *mergeHunk
+	for _, line := range lines {
+		if line.Op == DiffEqual {
+			if current != nil {
+				hunks = append(hunks, *current)
+				current = nil
+			}
+			basePos++
+			continue
+		}
+		if current == nil {
+			current = &mergeHunk{start: basePos, end: basePos}
+		}
+		if line.Op == DiffDelete {
+			basePos++
+			current.end = basePos
+		} else {
+			current.lines = append(current.lines, line.Text)
+		}
+	}
+	if current != nil {
+		hunks = append(hunks, *current)
+	}
+	return hunks
+}
+
+// applyHunks 对原始版本的 [start, end) 区间应用一组修改，返回修改后的行
+func applyHunks(base []string, start, end int, hunks []mergeHunk) []string {
+	var result []string
+	pos := start
+	for _, h := range hunks {
+		result = append(result, base[pos:h.start]...)
+		result = append(result, h.lines...)
+		pos = h.end
+	}
+	return append(result, base[pos:end]...)
+}
+
+// equalLines 判断两组行是否完全相同
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,578 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ModuleEntry 配置中的模块条目
+// YAML/JSON 中可以是字符串路径，也可以是带条件的对象：
+//
+//	modules:
+//	  - src/01-概述.md
+//	  - path: src/12-PDF功能示例.md
+//	    when: {format: pdf}
+//	  - path: src/05-生产环境.md
+//	    when: 'environment == "生产环境"'
+type ModuleEntry struct {
+	Path string           `json:"path" yaml:"path"`
+	When *ModuleCondition `json:"when,omitempty" yaml:"when,omitempty"`
+}
+
+// ModuleCondition 模块包含条件
+// 对象形式的所有键都必须满足：format 匹配输出格式，其他键匹配变量值（值为列表时匹配其中任一个）
+// 字符串形式为表达式，支持 == != < > <= >= && || ! 和括号
+type ModuleCondition struct {
+	Match map[string][]string
+	Expr  string
+}
+
+// ModuleContext 评估模块条件时可用的值
+type ModuleContext struct {
+	Format    string                 // 输出格式：word 或 pdf
+	Client    string                 // 客户名称
+	DocType   string                 // 文档类型
+	Variables map[string]interface{} // 解析后的变量值
+}
+
+// NewModuleEntries 把路径列表转换为无条件的模块条目
+func NewModuleEntries(paths []string) []ModuleEntry {
+	entries := make([]ModuleEntry, len(paths))
+	for i, path := range paths {
+		entries[i] = ModuleEntry{Path: path}
+	}
+	return entries
+}
+
+// NewModuleContext 创建评估模块条件用的上下文
+// values 为已合并的变量值，未设置的变量使用模块中声明的默认值
+func (s *VariableService) NewModuleContext(clientName, docType, format string, entries []ModuleEntry, values map[string]interface{}) ModuleContext {
+	variables := make(map[string]interface{}, len(values))
+	for name, val := range values {
+		variables[name] = val
+	}
+	declarations, _ := s.ExtractVariables(ModulePaths(entries))
+	for _, decl := range declarations {
+		if _, ok := variables[decl.Name]; !ok && decl.Default != nil {
+			variables[decl.Name] = decl.Default
+		}
+	}
+	return ModuleContext{
+		Format:    format,
+		Client:    clientName,
+		DocType:   docType,
+		Variables: variables,
+	}
+}
+
+// ModulePaths 返回所有模块路径（不评估条件）
+func ModulePaths(entries []ModuleEntry) []string {
+	paths := make([]string, len(entries))
+	for i, entry := range entries {
+		paths[i] = entry.Path
+	}
+	return paths
+}
+
+// HasConditionalModules 判断模块列表中是否有带条件的条目
+func HasConditionalModules(entries []ModuleEntry) bool {
+	for _, entry := range entries {
+		if entry.When != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectModules 评估条件，返回本次构建应包含的模块路径
+func SelectModules(entries []ModuleEntry, ctx ModuleContext) ([]string, error) {
+	var result []string
+	for _, entry := range entries {
+		if entry.When != nil {
+			ok, err := entry.When.Evaluate(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("模块 %s 的条件无效: %w", entry.Path, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		result = append(result, entry.Path)
+	}
+	return result, nil
+}
+
+// String 返回条件的可读形式
+func (c *ModuleCondition) String() string {
+	if c == nil {
+		return ""
+	}
+	if c.Expr != "" {
+		return c.Expr
+	}
+	keys := make([]string, 0, len(c.Match))
+	for key := range c.Match {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=" + strings.Join(c.Match[key], "|")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Validate 检查条件语法
+func (c *ModuleCondition) Validate() error {
+	if c.Expr != "" {
+		_, err := parseConditionExpr(c.Expr)
+		return err
+	}
+	if len(c.Match) == 0 {
+		return fmt.Errorf("when 条件不能为空")
+	}
+	return nil
+}
+
+// Evaluate 评估条件
+func (c *ModuleCondition) Evaluate(ctx ModuleContext) (bool, error) {
+	if c.Expr != "" {
+		expr, err := parseConditionExpr(c.Expr)
+		if err != nil {
+			return false, err
+		}
+		return truthy(expr.eval(ctx)), nil
+	}
+	for key, allowed := range c.Match {
+		actual := fmt.Sprintf("%v", ctx.lookup(key))
+		matched := false
+		for _, want := range allowed {
+			if strings.EqualFold(actual, want) || valuesEqual(actual, want) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// lookup 查找条件中引用的名称
+func (ctx ModuleContext) lookup(name string) interface{} {
+	switch name {
+	case "format":
+		if ctx.Format == "" {
+			return "word"
+		}
+		return ctx.Format
+	case "client":
+		return ctx.Client
+	case "docType":
+		return ctx.DocType
+	}
+	if val, ok := ctx.Variables[name]; ok && val != nil {
+		return val
+	}
+	return ""
+}
+
+// UnmarshalYAML 支持字符串和对象两种写法
+func (e *ModuleEntry) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		e.Path = node.Value
+		return nil
+	}
+	var raw struct {
+		Path string           `yaml:"path"`
+		When *ModuleCondition `yaml:"when"`
+	}
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	if raw.Path == "" {
+		return fmt.Errorf("第 %d 行: 模块条目缺少 path", node.Line)
+	}
+	e.Path, e.When = raw.Path, raw.When
+	return nil
+}
+
+// MarshalYAML 无条件的条目保存为字符串，保持配置文件简洁
+func (e ModuleEntry) MarshalYAML() (interface{}, error) {
+	if e.When == nil {
+		return e.Path, nil
+	}
+	return struct {
+		Path string           `yaml:"path"`
+		When *ModuleCondition `yaml:"when"`
+	}{e.Path, e.When}, nil
+}
+
+// UnmarshalJSON 支持字符串和对象两种写法
+func (e *ModuleEntry) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		e.Path, e.When = path, nil
+		return nil
+	}
+	var raw struct {
+		Path string           `json:"path"`
+		When *ModuleCondition `json:"when"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	e.Path, e.When = raw.Path, raw.When
+	return nil
+}
+
+// MarshalJSON 无条件的条目输出为字符串，兼容只处理路径列表的客户端
+func (e ModuleEntry) MarshalJSON() ([]byte, error) {
+	if e.When == nil {
+		return json.Marshal(e.Path)
+	}
+	return json.Marshal(struct {
+		Path string           `json:"path"`
+		When *ModuleCondition `json:"when"`
+	}{e.Path, e.When})
+}
+
+// UnmarshalYAML 条件可以是表达式字符串或键值对象
+func (c *ModuleCondition) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		c.Expr = node.Value
+		return nil
+	}
+	var raw map[string]interface{}
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	c.Match = conditionMatch(raw)
+	return nil
+}
+
+// MarshalYAML 按原来的写法保存
+func (c ModuleCondition) MarshalYAML() (interface{}, error) {
+	if c.Expr != "" {
+		return c.Expr, nil
+	}
+	return conditionMatchValue(c.Match), nil
+}
+
+// UnmarshalJSON 条件可以是表达式字符串或键值对象
+func (c *ModuleCondition) UnmarshalJSON(data []byte) error {
+	var expr string
+	if err := json.Unmarshal(data, &expr); err == nil {
+		c.Expr = expr
+		return nil
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	c.Match = conditionMatch(raw)
+	return nil
+}
+
+// MarshalJSON 按原来的写法输出
+func (c ModuleCondition) MarshalJSON() ([]byte, error) {
+	if c.Expr != "" {
+		return json.Marshal(c.Expr)
+	}
+	return json.Marshal(conditionMatchValue(c.Match))
+}
+
+// conditionMatch 把对象形式的条件统一为 键 -> 候选值列表
+func conditionMatch(raw map[string]interface{}) map[string][]string {
+	match := make(map[string][]string)
+	for key, val := range raw {
+		switch v := val.(type) {
+		case []interface{}:
+			for _, item := range v {
+				match[key] = append(match[key], fmt.Sprintf("%v", item))
+			}
+		default:
+			match[key] = []string{fmt.Sprintf("%v", v)}
+		}
+	}
+	return match
+}
+
+// conditionMatchValue 序列化对象形式的条件（单个候选值写成标量）
+func conditionMatchValue(match map[string][]string) map[string]interface{} {
+	result := make(map[string]interface{})
+	for key, vals := range match {
+		if len(vals) == 1 {
+			result[key] = vals[0]
+		} else {
+			result[key] = vals
+		}
+	}
+	return result
+}
+
+// ---- 条件表达式 ----
+
+// condNode 表达式节点
+type condNode interface {
+	eval(ctx ModuleContext) interface{}
+}
+
+type condLiteral struct{ value interface{} }
+type condIdent struct{ name string }
+type condNot struct{ operand condNode }
+type condBinary struct {
+	op          string
+	left, right condNode
+}
+
+func (n condLiteral) eval(ModuleContext) interface{}   { return n.value }
+func (n condIdent) eval(ctx ModuleContext) interface{} { return ctx.lookup(n.name) }
+func (n condNot) eval(ctx ModuleContext) interface{}   { return !truthy(n.operand.eval(ctx)) }
+
+func (n condBinary) eval(ctx ModuleContext) interface{} {
+	switch n.op {
+	case "&&":
+		return truthy(n.left.eval(ctx)) && truthy(n.right.eval(ctx))
+	case "||":
+		return truthy(n.left.eval(ctx)) || truthy(n.right.eval(ctx))
+	}
+
+	left := fmt.Sprintf("%v", n.left.eval(ctx))
+	right := fmt.Sprintf("%v", n.right.eval(ctx))
+	switch n.op {
+	case "==":
+		return valuesEqual(left, right)
+	case "!=":
+		return !valuesEqual(left, right)
+	}
+
+	// 大小比较：都是数字时按数值比较，否则按字符串比较
+	cmp := strings.Compare(left, right)
+	if l, err1 := strconv.ParseFloat(left, 64); err1 == nil {
+		if r, err2 := strconv.ParseFloat(right, 64); err2 == nil {
+			switch {
+			case l < r:
+				cmp = -1
+			case l > r:
+				cmp = 1
+			default:
+				cmp = 0
+			}
+		}
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	default: // ">="
+		return cmp >= 0
+	}
+}
+
+// valuesEqual 比较两个值（数字按数值比较，如 3 与 3.0 相等）
+func valuesEqual(a, b string) bool {
+	if a == b {
+		return true
+	}
+	l, err1 := strconv.ParseFloat(a, 64)
+	r, err2 := strconv.ParseFloat(b, 64)
+	return err1 == nil && err2 == nil && l == r
+}
+
+// truthy 判断值是否为真（空字符串、false、0 为假）
+func truthy(v interface{}) bool {
+	switch val := v.(type) {
+	case bool:
+		return val
+	case nil:
+		return false
+	}
+	s := strings.TrimSpace(fmt.Sprintf("%v", v))
+	return s != "" && s != "false" && s != "0"
+}
+
+// condParser 递归下降解析器
+type condParser struct {
+	tokens []string
+	pos    int
+}
+
+// parseConditionExpr 解析条件表达式
+func parseConditionExpr(expr string) (condNode, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("条件表达式为空")
+	}
+	p := &condParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("条件表达式中有多余的内容: %s", p.tokens[p.pos])
+	}
+	return node, nil
+}
+
+func (p *condParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *condParser) parseOr() (condNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = condBinary{"||", left, right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseAnd() (condNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.pos++
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = condBinary{"&&", left, right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseComparison() (condNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "==", "!=", "<", ">", "<=", ">=":
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return condBinary{op, left, right}, nil
+	}
+	return left, nil
+}
+
+func (p *condParser) parseUnary() (condNode, error) {
+	tok := p.peek()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("条件表达式不完整")
+	case tok == "!":
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return condNot{operand}, nil
+	case tok == "(":
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("条件表达式缺少右括号")
+		}
+		p.pos++
+		return node, nil
+	case strings.HasPrefix(tok, `"`) || strings.HasPrefix(tok, `'`):
+		p.pos++
+		return condLiteral{tok[1 : len(tok)-1]}, nil
+	case tok == "true" || tok == "false":
+		p.pos++
+		return condLiteral{tok == "true"}, nil
+	case unicode.IsDigit(rune(tok[0])) || tok[0] == '-':
+		p.pos++
+		return condLiteral{tok}, nil
+	case ValidateVariableName(tok):
+		p.pos++
+		return condIdent{tok}, nil
+	}
+	return nil, fmt.Errorf("条件表达式中有无法识别的内容: %s", tok)
+}
+
+// tokenizeCondition 把表达式拆分为记号
+func tokenizeCondition(expr string) ([]string, error) {
+	var tokens []string
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("条件表达式中的字符串缺少结束引号")
+			}
+			tokens = append(tokens, string(runes[i:end+1]))
+			i = end + 1
+		case strings.ContainsRune("=!<>&|", r):
+			if i+1 < len(runes) {
+				two := string(runes[i : i+2])
+				switch two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					tokens = append(tokens, two)
+					i += 2
+					continue
+				}
+			}
+			if r == '!' || r == '<' || r == '>' {
+				tokens = append(tokens, string(r))
+				i++
+				continue
+			}
+			return nil, fmt.Errorf("条件表达式中有无效的运算符: %c", r)
+		case r == '(' || r == ')':
+			tokens = append(tokens, string(r))
+			i++
+		default:
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || strings.ContainsRune("_.-", runes[end])) {
+				end++
+			}
+			if end == i {
+				return nil, fmt.Errorf("条件表达式中有无法识别的字符: %c", r)
+			}
+			tokens = append(tokens, string(runes[i:end]))
+			i = end
+		}
+	}
+	return tokens, nil
+}
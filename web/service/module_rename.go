@@ -0,0 +1,561 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 模块重命名的修改类型
+const (
+	ModuleRenameMove     = "move"     // 移动模块文件或目录
+	ModuleRenameOverride = "override" // 移动客户的模块覆盖文件
+	ModuleRenameConfig   = "config"   // 客户配置 modules 中的条目
+	ModuleRenameOrder    = "order"    // .editor-order.json 中的排序
+	ModuleRenameLink     = "link"     // Markdown 中的相对链接和图片
+	ModuleRenameInclude  = "include"  // {{include}} 引用
+)
+
+// ModuleRenameChange 重命名涉及的一处修改
+type ModuleRenameChange struct {
+	File   string `json:"file"` // 当前位置，相对于项目根目录
+	Line   int    `json:"line,omitempty"`
+	Kind   string `json:"kind"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// ModuleRenameResult 重命名结果
+type ModuleRenameResult struct {
+	OldPath string               `json:"oldPath"` // 相对于 src/
+	NewPath string               `json:"newPath"`
+	IsDir   bool                 `json:"isDir"`
+	DryRun  bool                 `json:"dryRun"`
+	Moved   []string             `json:"moved"` // 移动的文件和目录（原位置，相对于项目根目录）
+	Files   []string             `json:"files"` // 需要修改内容的文件（原位置，相对于项目根目录）
+	Changes []ModuleRenameChange `json:"changes"`
+}
+
+// NewLocation 文件（相对于项目根目录）重命名后的位置，包括随模块移动的客户覆盖文件
+func (r *ModuleRenameResult) NewLocation(file string) string {
+	prefix := "src/"
+	if strings.HasPrefix(file, "clients/") {
+		parts := strings.SplitN(file, "/", 5)
+		if len(parts) < 5 || parts[2] != overridesDirName || parts[3] != "src" {
+			return file
+		}
+		prefix = strings.Join(parts[:4], "/") + "/"
+	}
+	rest, ok := strings.CutPrefix(file, prefix)
+	switch {
+	case !ok:
+		return file
+	case rest == r.OldPath:
+		return prefix + r.NewPath
+	case r.IsDir && strings.HasPrefix(rest, r.OldPath+"/"):
+		return prefix + r.NewPath + rest[len(r.OldPath):]
+	}
+	return file
+}
+
+// fileMove 一次移动
+type fileMove struct {
+	from string
+	to   string
+}
+
+// renamePlan 重命名要执行的移动和写入
+type renamePlan struct {
+	srcDir  string // 绝对路径
+	workDir string
+	oldAbs  string
+	newAbs  string
+	isDir   bool
+	moves   []fileMove
+	writes  map[string]string // 移动后的绝对路径 -> 新内容
+	result  *ModuleRenameResult
+}
+
+// RenameModule 重命名或移动模块文件或目录，并修改所有引用
+// 修改范围：clients/*/*.yaml 的 modules 条目、客户的模块覆盖文件、.editor-order.json 中的排序，
+// 以及 src/ 和覆盖文件中指向被移动文件的相对链接、图片和 {{include}}（被移动的文件中指向外部的引用也会调整）
+// dryRun 为 true 时只返回修改清单；执行时任一步失败都会恢复已移动和已写入的文件
+func (s *EditorService) RenameModule(oldPath, newPath string, dryRun bool) (*ModuleRenameResult, error) {
+	// 从读取引用到写回期间持有保存锁，否则期间保存的模块会被按旧内容改写的版本覆盖
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	plan, err := s.newRenamePlan(oldPath, newPath)
+	if err != nil {
+		return nil, err
+	}
+	plan.result.DryRun = dryRun
+
+	if err := plan.addOverrideMoves(s.clientsDir()); err != nil {
+		return nil, err
+	}
+	if err := plan.rewriteMarkdown(s.clientsDir()); err != nil {
+		return nil, err
+	}
+	if err := plan.rewriteConfigs(s.clientsDir()); err != nil {
+		return nil, err
+	}
+	orderMap, err := s.loadTreeOrder()
+	if err != nil {
+		return nil, err
+	}
+	if err := plan.rewriteOrder(orderMap, s.TreeOrderPath()); err != nil {
+		return nil, err
+	}
+	plan.finish()
+
+	if dryRun {
+		return plan.result, nil
+	}
+	if err := plan.apply(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Editor] 已重命名: %s -> %s (移动 %d 项, 修改 %d 个文件)", plan.result.OldPath, plan.result.NewPath, len(plan.moves), len(plan.writes))
+	return plan.result, nil
+}
+
+// clientsDir 客户配置目录（与 src 同级）
+func (s *EditorService) clientsDir() string {
+	return filepath.Join(filepath.Dir(s.srcDir), "clients")
+}
+
+// newRenamePlan 验证新旧路径：原路径可以是 Markdown 文件或目录，文件的新路径也必须是 Markdown 文件
+func (s *EditorService) newRenamePlan(oldPath, newPath string) (*renamePlan, error) {
+	absSrcDir, err := filepath.Abs(s.srcDir)
+	if err != nil {
+		return nil, ErrPathForbidden
+	}
+	oldRel, err := cleanSrcRel(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newRel, err := cleanSrcRel(newPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ValidateFilename(path.Base(newRel)); err != nil || strings.HasPrefix(path.Base(newRel), ".") {
+		return nil, ErrInvalidFilename
+	}
+
+	oldAbs := filepath.Join(absSrcDir, filepath.FromSlash(oldRel))
+	newAbs := filepath.Join(absSrcDir, filepath.FromSlash(newRel))
+	info, err := os.Stat(oldAbs)
+	if err != nil {
+		return nil, ErrFileNotFound
+	}
+	if !info.IsDir() && (!isMarkdownFile(oldRel) || !isMarkdownFile(newRel)) {
+		return nil, ErrInvalidFileType
+	}
+	if info.IsDir() && strings.HasPrefix(newAbs, oldAbs+string(filepath.Separator)) {
+		log.Printf("[Editor] 不能把目录移动到自身之内: %s -> %s", oldRel, newRel)
+		return nil, ErrPathForbidden
+	}
+	if _, err := os.Stat(newAbs); err == nil {
+		return nil, ErrFileExists
+	}
+
+	workDir := filepath.Dir(absSrcDir)
+	return &renamePlan{
+		srcDir:  absSrcDir,
+		workDir: workDir,
+		oldAbs:  oldAbs,
+		newAbs:  newAbs,
+		isDir:   info.IsDir(),
+		moves:   []fileMove{{from: oldAbs, to: newAbs}},
+		writes:  make(map[string]string),
+		result: &ModuleRenameResult{
+			OldPath: oldRel,
+			NewPath: newRel,
+			IsDir:   info.IsDir(),
+			Moved:   []string{relSlash(workDir, oldAbs)},
+			Files:   []string{},
+			Changes: []ModuleRenameChange{{
+				File:   relSlash(workDir, oldAbs),
+				Kind:   ModuleRenameMove,
+				Before: "src/" + oldRel,
+				After:  "src/" + newRel,
+			}},
+		},
+	}, nil
+}
+
+// cleanSrcRel 规范化相对于 src/ 的路径，拒绝路径遍历和 src 目录本身
+func cleanSrcRel(p string) (string, error) {
+	if strings.Contains(p, "..") {
+		log.Printf("[Editor] 检测到路径遍历尝试: %s", p)
+		return "", ErrPathForbidden
+	}
+	cleaned := path.Clean(strings.ReplaceAll(p, "\\", "/"))
+	cleaned = strings.TrimPrefix(strings.TrimPrefix(cleaned, "/"), "src/")
+	if cleaned == "" || cleaned == "." || cleaned == "src" {
+		return "", ErrPathForbidden
+	}
+	return cleaned, nil
+}
+
+// isMarkdownFile 是否为 Markdown 文件
+func isMarkdownFile(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".md")
+}
+
+// mapPath 被移动的文件返回新位置，其他文件原样返回
+func (p *renamePlan) mapPath(abs string) string {
+	if abs == p.oldAbs {
+		return p.newAbs
+	}
+	if p.isDir && strings.HasPrefix(abs, p.oldAbs+string(filepath.Separator)) {
+		return p.newAbs + abs[len(p.oldAbs):]
+	}
+	return abs
+}
+
+// addOverrideMoves 客户覆盖了被移动的模块时，覆盖文件一起移动
+func (p *renamePlan) addOverrideMoves(clientsDir string) error {
+	oldRel, _ := filepath.Rel(p.srcDir, p.oldAbs)
+	newRel, _ := filepath.Rel(p.srcDir, p.newAbs)
+	clients, err := os.ReadDir(clientsDir)
+	if err != nil {
+		return nil
+	}
+	for _, client := range clients {
+		if !client.IsDir() {
+			continue
+		}
+		overrideDir := clientOverrideSrcDir(clientsDir, client.Name())
+		from := filepath.Join(overrideDir, oldRel)
+		if _, err := os.Stat(from); err != nil {
+			continue
+		}
+		to := filepath.Join(overrideDir, newRel)
+		if _, err := os.Stat(to); err == nil {
+			return fmt.Errorf("%w: 客户 %s 的覆盖文件 %s", ErrFileExists, client.Name(), relSlash(p.workDir, to))
+		}
+		p.moves = append(p.moves, fileMove{from: from, to: to})
+		p.result.Moved = append(p.result.Moved, relSlash(p.workDir, from))
+		p.result.Changes = append(p.result.Changes, ModuleRenameChange{
+			File:   relSlash(p.workDir, from),
+			Kind:   ModuleRenameOverride,
+			Before: relSlash(p.workDir, from),
+			After:  relSlash(p.workDir, to),
+		})
+	}
+	return nil
+}
+
+// movedTo 文件移动后的位置（包括随模块一起移动的覆盖文件）
+func (p *renamePlan) movedTo(abs string) string {
+	for _, move := range p.moves {
+		if abs == move.from {
+			return move.to
+		}
+		if strings.HasPrefix(abs, move.from+string(filepath.Separator)) {
+			return move.to + abs[len(move.from):]
+		}
+	}
+	return abs
+}
+
+// rewriteMarkdown 调整 src/ 和客户覆盖文件中受影响的相对引用
+// 覆盖文件在构建时会替换 src 中的同名模块，因此按其在 src 中对应的位置解析引用
+func (p *renamePlan) rewriteMarkdown(clientsDir string) error {
+	type markdownFile struct {
+		real    string // 实际位置
+		virtual string // 在 src 中对应的位置
+	}
+	var files []markdownFile
+	collect := func(root string) error {
+		return filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if file == root {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() {
+				if file != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if isMarkdownFile(d.Name()) {
+				rel, _ := filepath.Rel(root, file)
+				files = append(files, markdownFile{real: file, virtual: filepath.Join(p.srcDir, rel)})
+			}
+			return nil
+		})
+	}
+	if err := collect(p.srcDir); err != nil {
+		return fmt.Errorf("%w: %v", ErrReadError, err)
+	}
+	if clients, err := os.ReadDir(clientsDir); err == nil {
+		for _, client := range clients {
+			if client.IsDir() {
+				if err := collect(clientOverrideSrcDir(clientsDir, client.Name())); err != nil {
+					return fmt.Errorf("%w: %v", ErrReadError, err)
+				}
+			}
+		}
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file.real)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrReadError, err)
+		}
+		content := string(data)
+		fromVirtual, toVirtual := file.virtual, p.mapPath(file.virtual)
+
+		var b strings.Builder
+		var changes []ModuleRenameChange
+		last := 0
+		for _, ref := range findMarkdownRefs(content) {
+			target, srcRelative := resolveRef(ref, fromVirtual, p.srcDir)
+			if target == "" {
+				continue
+			}
+			newTarget := p.mapPath(target)
+			if fromVirtual == toVirtual && newTarget == target {
+				continue
+			}
+			base := filepath.Dir(toVirtual)
+			if srcRelative {
+				base = p.srcDir
+			}
+			newRel, err := filepath.Rel(base, newTarget)
+			if err != nil {
+				continue
+			}
+			replacement := formatRef(ref, newRel)
+			if path.Clean(filepath.ToSlash(newRel)) == path.Clean(ref.Path) {
+				continue
+			}
+			kind := ModuleRenameLink
+			if ref.Kind == MarkdownRefInclude {
+				kind = ModuleRenameInclude
+			}
+			changes = append(changes, ModuleRenameChange{
+				File:   relSlash(p.workDir, file.real),
+				Line:   lineAt(content, ref.Start),
+				Kind:   kind,
+				Before: content[ref.Start:ref.End],
+				After:  replacement,
+			})
+			b.WriteString(content[last:ref.Start])
+			b.WriteString(replacement)
+			last = ref.End
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		b.WriteString(content[last:])
+		p.writes[p.movedTo(file.real)] = b.String()
+		p.result.Files = append(p.result.Files, relSlash(p.workDir, file.real))
+		p.result.Changes = append(p.result.Changes, changes...)
+	}
+	return nil
+}
+
+// rewriteConfigs 修改客户配置 modules 中指向被移动模块的条目（只改所在行，保留注释和格式）
+func (p *renamePlan) rewriteConfigs(clientsDir string) error {
+	clients, err := os.ReadDir(clientsDir)
+	if err != nil {
+		return nil
+	}
+	for _, client := range clients {
+		if !client.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(clientsDir, client.Name()))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+				continue
+			}
+			file := filepath.Join(clientsDir, client.Name(), entry.Name())
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrReadError, err)
+			}
+			updated, changes, err := p.rewriteModuleEntries(string(data), relSlash(p.workDir, file))
+			if err != nil {
+				return err
+			}
+			if len(changes) > 0 {
+				p.writes[file] = updated
+				p.result.Files = append(p.result.Files, relSlash(p.workDir, file))
+				p.result.Changes = append(p.result.Changes, changes...)
+			}
+		}
+	}
+	return nil
+}
+
+// rewriteModuleEntries 修改一个配置文件 modules 中的条目（字符串或 {path, when} 形式）
+func (p *renamePlan) rewriteModuleEntries(content, file string) (string, []ModuleRenameChange, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return "", nil, fmt.Errorf("解析 %s 失败: %w", file, err)
+	}
+	if len(doc.Content) == 0 {
+		return content, nil, nil
+	}
+	modules := mappingValue(doc.Content[0], "modules")
+	if modules == nil || modules.Kind != yaml.SequenceNode {
+		return content, nil, nil
+	}
+
+	lines := strings.Split(content, "\n")
+	var changes []ModuleRenameChange
+	for _, item := range modules.Content {
+		node := item
+		if item.Kind == yaml.MappingNode {
+			node = mappingValue(item, "path")
+		}
+		if node == nil || node.Kind != yaml.ScalarNode || !strings.HasPrefix(node.Value, "src/") {
+			continue
+		}
+		abs := filepath.Join(p.srcDir, filepath.FromSlash(strings.TrimPrefix(node.Value, "src/")))
+		moved := p.mapPath(abs)
+		if moved == abs {
+			continue
+		}
+		idx := node.Line - 1
+		if idx < 0 || idx >= len(lines) || !strings.Contains(lines[idx], node.Value) {
+			continue
+		}
+		newValue := "src/" + relSlash(p.srcDir, moved)
+		before := lines[idx]
+		lines[idx] = strings.Replace(before, node.Value, newValue, 1)
+		changes = append(changes, ModuleRenameChange{
+			File:   file,
+			Line:   node.Line,
+			Kind:   ModuleRenameConfig,
+			Before: strings.TrimSpace(before),
+			After:  strings.TrimSpace(lines[idx]),
+		})
+	}
+	return strings.Join(lines, "\n"), changes, nil
+}
+
+// rewriteOrder 修改文件树排序：条目换成新名称（移动到其他目录时从原目录移除并追加到新目录末尾），
+// 移动目录时目录本身和子目录的排序键一起修改
+func (p *renamePlan) rewriteOrder(orderMap map[string][]string, orderPath string) error {
+	if len(orderMap) == 0 {
+		return nil
+	}
+	oldRel, newRel := p.result.OldPath, p.result.NewPath
+	oldParent, oldName := splitOrderPath(oldRel)
+	newParent, newName := splitOrderPath(newRel)
+	file := relSlash(p.workDir, orderPath)
+	var changes []ModuleRenameChange
+
+	updated := make(map[string][]string, len(orderMap))
+	keys := make([]string, 0, len(orderMap))
+	for key := range orderMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		newKey := key
+		if p.isDir && (key == oldRel || strings.HasPrefix(key, oldRel+"/")) {
+			newKey = newRel + key[len(oldRel):]
+			changes = append(changes, ModuleRenameChange{File: file, Kind: ModuleRenameOrder, Before: key + "/", After: newKey + "/"})
+		}
+		updated[newKey] = append([]string(nil), orderMap[key]...)
+	}
+
+	entries := updated[oldParent]
+	for i, name := range entries {
+		if name != oldName {
+			continue
+		}
+		if oldParent == newParent {
+			entries[i] = newName
+		} else {
+			updated[oldParent] = append(entries[:i:i], entries[i+1:]...)
+			if target, ok := updated[newParent]; ok {
+				updated[newParent] = append(target, newName)
+			}
+		}
+		changes = append(changes, ModuleRenameChange{File: file, Kind: ModuleRenameOrder, Before: oldRel, After: newRel})
+		break
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(updated, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWriteError, err)
+	}
+	p.writes[orderPath] = string(data)
+	p.result.Files = append(p.result.Files, file)
+	p.result.Changes = append(p.result.Changes, changes...)
+	return nil
+}
+
+// splitOrderPath 拆分为排序键（父目录，根目录为空）和名称
+func splitOrderPath(rel string) (string, string) {
+	parent, name := path.Split(rel)
+	return strings.TrimSuffix(parent, "/"), name
+}
+
+// finish 整理结果中的文件列表
+func (p *renamePlan) finish() {
+	sort.Strings(p.result.Files)
+}
+
+// apply 先移动文件再写入修改，任一步失败时按相反顺序恢复
+func (p *renamePlan) apply() error {
+	var done []fileMove
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			if err := movePath(done[i].to, done[i].from); err != nil {
+				log.Printf("[Editor] 警告: 回滚移动 %s 失败: %v", done[i].to, err)
+			}
+		}
+	}
+	for _, move := range p.moves {
+		if err := os.MkdirAll(filepath.Dir(move.to), 0755); err != nil {
+			rollback()
+			return fmt.Errorf("%w: %v", ErrWriteError, err)
+		}
+		if err := movePath(move.from, move.to); err != nil {
+			rollback()
+			return fmt.Errorf("%w: 移动 %s 失败（已回滚）: %v", ErrWriteError, relSlash(p.workDir, move.from), err)
+		}
+		done = append(done, move)
+	}
+	if err := writeFilesAtomically(p.writes); err != nil {
+		rollback()
+		return fmt.Errorf("%w: %v", ErrWriteError, err)
+	}
+
+	// 移走后变空的目录一起删除（到 src 或覆盖目录的 src 为止）
+	for _, move := range p.moves {
+		for dir := filepath.Dir(move.from); dir != p.srcDir && filepath.Base(dir) != "src"; dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
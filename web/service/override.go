@@ -0,0 +1,206 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// overridesDirName 客户模块覆盖目录（clients/<client>/overrides/src/...）
+const overridesDirName = "overrides"
+
+// ModuleOverride 客户覆盖的模块
+type ModuleOverride struct {
+	Module       string    `json:"module"`       // 被覆盖的模块路径（如 src/05-备份.md）
+	OverridePath string    `json:"overridePath"` // 覆盖文件路径（如 clients/客户A/overrides/src/05-备份.md）
+	BaseExists   bool      `json:"baseExists"`   // src 中是否存在同路径的模块（不存在时为客户新增的模块）
+	UsedBy       []string  `json:"usedBy"`       // 引用该模块的文档类型
+	ModifiedAt   time.Time `json:"modifiedAt"`
+	Diff         string    `json:"diff,omitempty"` // 与基础模块的差异（统一格式）
+}
+
+// OverrideService 客户模块覆盖服务
+type OverrideService struct {
+	workDir    string
+	clientsDir string
+}
+
+// NewOverrideService 创建覆盖服务实例
+func NewOverrideService(workDir, clientsDir string) *OverrideService {
+	return &OverrideService{
+		workDir:    workDir,
+		clientsDir: clientsDir,
+	}
+}
+
+// OverrideSrcDir 返回客户覆盖目录中的 src 目录
+func (s *OverrideService) OverrideSrcDir(clientName string) string {
+	return clientOverrideSrcDir(s.clientsDir, clientName)
+}
+
+// HasOverrides 判断客户是否有覆盖的模块
+func (s *OverrideService) HasOverrides(clientName string) bool {
+	overrides, err := s.listOverrideFiles(clientName)
+	return err == nil && len(overrides) > 0
+}
+
+// ResolveModule 返回客户构建时实际使用的模块路径（相对于项目根目录）
+func (s *OverrideService) ResolveModule(clientName, module string) string {
+	resolved, _ := resolveClientModule(s.clientsDir, s.workDir, clientName, module)
+	return resolved
+}
+
+// ResolveModules 对模块列表逐个应用客户覆盖
+func (s *OverrideService) ResolveModules(clientName string, modules []string) []string {
+	result := make([]string, len(modules))
+	for i, module := range modules {
+		result[i] = s.ResolveModule(clientName, module)
+	}
+	return result
+}
+
+// ListOverrides 列出客户覆盖的模块及其与基础模块的差异
+// withDiff 为 false 时不计算差异
+func (s *OverrideService) ListOverrides(clientName string, withDiff bool) ([]ModuleOverride, error) {
+	files, err := s.listOverrideFiles(clientName)
+	if err != nil {
+		return nil, err
+	}
+
+	usedBy := s.moduleUsage(clientName)
+	result := []ModuleOverride{}
+	for _, rel := range files {
+		module := "src/" + rel
+		overridePath := filepath.Join(s.OverrideSrcDir(clientName), filepath.FromSlash(rel))
+		info, err := os.Stat(overridePath)
+		if err != nil {
+			continue
+		}
+
+		item := ModuleOverride{
+			Module:       module,
+			OverridePath: relSlash(s.workDir, overridePath),
+			UsedBy:       usedBy[module],
+			ModifiedAt:   info.ModTime(),
+		}
+		if item.UsedBy == nil {
+			item.UsedBy = []string{}
+		}
+
+		basePath := filepath.Join(s.workDir, filepath.FromSlash(module))
+		baseData, baseErr := os.ReadFile(basePath)
+		item.BaseExists = baseErr == nil
+
+		if withDiff {
+			overrideData, err := os.ReadFile(overridePath)
+			if err != nil {
+				return nil, fmt.Errorf("读取覆盖文件失败: %w", err)
+			}
+			oldName := "a/" + module
+			if !item.BaseExists {
+				oldName = "/dev/null"
+			}
+			item.Diff = UnifiedDiff(string(baseData), string(overrideData), oldName, "b/"+item.OverridePath)
+		}
+
+		result = append(result, item)
+	}
+
+	return result, nil
+}
+
+// ApplyOverrides 把客户覆盖的模块复制到目标 src 目录（构建用的临时目录）
+func (s *OverrideService) ApplyOverrides(clientName, targetSrcDir string) ([]string, error) {
+	files, err := s.listOverrideFiles(clientName)
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range files {
+		src := filepath.Join(s.OverrideSrcDir(clientName), filepath.FromSlash(rel))
+		dst := filepath.Join(targetSrcDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return nil, err
+		}
+		if err := copyFile(src, dst); err != nil {
+			return nil, fmt.Errorf("复制覆盖文件 %s 失败: %w", rel, err)
+		}
+	}
+	return files, nil
+}
+
+// listOverrideFiles 列出覆盖目录中的文件（相对于覆盖 src 目录，使用正斜杠）
+func (s *OverrideService) listOverrideFiles(clientName string) ([]string, error) {
+	if clientName == "" || strings.ContainsAny(clientName, `/\`) || strings.Contains(clientName, "..") {
+		return nil, fmt.Errorf("无效的客户名称: %s", clientName)
+	}
+	root := s.OverrideSrcDir(clientName)
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		files = append(files, relSlash(root, path))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("扫描覆盖目录失败: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// moduleUsage 统计客户各文档类型引用的模块
+func (s *OverrideService) moduleUsage(clientName string) map[string][]string {
+	usage := make(map[string][]string)
+	configMgr := NewConfigManager(s.clientsDir)
+	docTypes, err := configMgr.ListCustomConfigs(clientName)
+	if err != nil {
+		return usage
+	}
+	for _, docType := range docTypes {
+		cfg, err := configMgr.GetConfig(clientName, docType)
+		if err != nil {
+			continue
+		}
+		for _, module := range expandModulePatterns(s.workDir, ModulePaths(cfg.Modules)) {
+			usage[module] = append(usage[module], docType)
+		}
+	}
+	return usage
+}
+
+// clientOverrideSrcDir 返回客户覆盖目录中的 src 目录
+func clientOverrideSrcDir(clientsDir, clientName string) string {
+	return filepath.Join(clientsDir, clientName, overridesDirName, "src")
+}
+
+// resolveClientModule 解析模块路径：客户覆盖目录中存在同路径文件时返回覆盖文件
+// 返回相对于项目根目录的路径，以及是否被覆盖
+func resolveClientModule(clientsDir, workDir, clientName, module string) (string, bool) {
+	rel := strings.TrimPrefix(filepath.ToSlash(module), "./")
+	if clientName == "" || !strings.HasPrefix(rel, "src/") || strings.Contains(rel, "*") {
+		return module, false
+	}
+	overridePath := filepath.Join(clientOverrideSrcDir(clientsDir, clientName), filepath.FromSlash(strings.TrimPrefix(rel, "src/")))
+	if info, err := os.Stat(overridePath); err != nil || info.IsDir() {
+		return module, false
+	}
+	return relSlash(workDir, overridePath), true
+}
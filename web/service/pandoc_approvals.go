@@ -0,0 +1,169 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// pandocApprovalsFile 管理员确认的 Pandoc 参数记录（工作目录的 .pandoc-approvals.json）
+// 记录在配置文件之外，手工编辑或 git pull 得到的配置不能自行声明已确认
+const pandocApprovalsFile = ".pandoc-approvals.json"
+
+// pandocApprovalsMu 保护确认记录文件（Web 服务和构建服务各有一个 ConfigManager）
+var pandocApprovalsMu sync.Mutex
+
+// PandocArgApproval 一条管理员确认记录
+// Arg 是 ValidatePandocArgs 报告的完整参数文本（如 "--lua-filter filters/x.lua"），值不同需要重新确认
+type PandocArgApproval struct {
+	Arg        string    `json:"arg"`
+	Config     string    `json:"config"` // 确认时所在的配置（客户/文档类型）
+	ApprovedBy string    `json:"approvedBy"`
+	ApprovedAt time.Time `json:"approvedAt"`
+}
+
+// pandocApprovalsPath 返回确认记录文件路径
+func (m *ConfigManager) pandocApprovalsPath() string {
+	return filepath.Join(filepath.Dir(m.clientsDir), pandocApprovalsFile)
+}
+
+// readPandocApprovals 读取确认记录，调用方需持有 pandocApprovalsMu
+func (m *ConfigManager) readPandocApprovals() ([]PandocArgApproval, error) {
+	approvals := []PandocArgApproval{}
+	data, err := os.ReadFile(m.pandocApprovalsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return approvals, nil
+		}
+		return nil, fmt.Errorf("读取 Pandoc 参数确认记录失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &approvals); err != nil {
+		return nil, fmt.Errorf("解析 Pandoc 参数确认记录失败: %w", err)
+	}
+	return approvals, nil
+}
+
+// ListPandocApprovals 列出管理员确认过的 Pandoc 参数
+func (m *ConfigManager) ListPandocApprovals() ([]PandocArgApproval, error) {
+	pandocApprovalsMu.Lock()
+	defer pandocApprovalsMu.Unlock()
+	return m.readPandocApprovals()
+}
+
+// approvePandocArgs 记录管理员确认的参数
+func (m *ConfigManager) approvePandocArgs(config string, errs []PandocArgError, approvedBy string) error {
+	pandocApprovalsMu.Lock()
+	defer pandocApprovalsMu.Unlock()
+
+	approvals, err := m.readPandocApprovals()
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, item := range approvals {
+		seen[item.Arg] = true
+	}
+	now := time.Now()
+	for _, e := range errs {
+		if seen[e.Arg] {
+			continue
+		}
+		seen[e.Arg] = true
+		approvals = append(approvals, PandocArgApproval{Arg: e.Arg, Config: config, ApprovedBy: approvedBy, ApprovedAt: now})
+		log.Printf("[ConfigManager] %s 确认了 Pandoc 参数（%s）: %s", approvedBy, config, e.String())
+	}
+
+	data, err := json.MarshalIndent(approvals, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := m.pandocApprovalsPath()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("保存 Pandoc 参数确认记录失败: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("保存 Pandoc 参数确认记录失败: %w", err)
+	}
+	return nil
+}
+
+// unapprovedPandocArgs 返回不在允许列表中、也没有管理员确认记录的参数
+func (m *ConfigManager) unapprovedPandocArgs(args []string) ([]PandocArgError, error) {
+	errs := ValidatePandocArgs(args)
+	if len(errs) == 0 {
+		return nil, nil
+	}
+	pandocApprovalsMu.Lock()
+	approvals, err := m.readPandocApprovals()
+	pandocApprovalsMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	approved := make(map[string]bool)
+	for _, item := range approvals {
+		approved[item.Arg] = true
+	}
+	var rejected []PandocArgError
+	for _, e := range errs {
+		if !approved[e.Arg] {
+			rejected = append(rejected, e)
+		}
+	}
+	return rejected, nil
+}
+
+// checkPandocArgs 保存配置前检查 pandoc_args
+// 不在允许列表中且没有确认记录的参数需要管理员确认：approvedBy 不为空时记录为该管理员确认，否则拒绝
+func (m *ConfigManager) checkPandocArgs(config string, args []string, approvedBy string) error {
+	rejected, err := m.unapprovedPandocArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	if approvedBy != "" {
+		return m.approvePandocArgs(config, rejected, approvedBy)
+	}
+	return &PandocArgsError{Errors: rejected}
+}
+
+// CheckBuildPandocArgs 构建前检查配置（已解析 extends）中的 pandoc_args
+// 构建脚本直接读取 YAML，手工编辑或 git pull 得到的参数也要经过允许列表和确认记录
+// 未指定文档类型时构建脚本会选择客户目录中的某个配置，因此检查客户的所有配置
+func (m *ConfigManager) CheckBuildPandocArgs(clientName, docTypeName string) error {
+	docTypes := []string{docTypeName}
+	if docTypeName == "" || docTypeName == "config" {
+		var err error
+		if docTypes, err = m.ListCustomConfigs(clientName); err != nil {
+			return err
+		}
+	}
+
+	var rejected []PandocArgError
+	for _, docType := range docTypes {
+		if _, err := os.Stat(m.configFilePath(clientName, docType)); err != nil {
+			continue
+		}
+		config, err := m.GetConfig(clientName, docType)
+		if err != nil {
+			return err
+		}
+		errs, err := m.unapprovedPandocArgs(config.PandocArgs)
+		if err != nil {
+			return err
+		}
+		rejected = append(rejected, errs...)
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	return &PandocArgsError{Errors: rejected}
+}
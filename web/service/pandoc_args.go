@@ -0,0 +1,275 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PandocArgError 一个不允许的 Pandoc 参数
+type PandocArgError struct {
+	Index   int    `json:"index"` // 在 pandoc_args 中的位置（从 0 开始）
+	Arg     string `json:"arg"`
+	Message string `json:"message"`
+}
+
+// String 格式化为 "pandoc_args[2] --lua-filter=x.lua: 原因"
+func (e PandocArgError) String() string {
+	return fmt.Sprintf("pandoc_args[%d] %s: %s", e.Index, e.Arg, e.Message)
+}
+
+// PandocArgsError pandoc_args 中有不在允许列表中的参数（需要管理员确认后才能保存）
+type PandocArgsError struct {
+	Errors []PandocArgError `json:"errors"`
+}
+
+func (e *PandocArgsError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, item := range e.Errors {
+		msgs[i] = item.String()
+	}
+	return "Pandoc 参数不允许（需要管理员确认）: " + strings.Join(msgs, "; ")
+}
+
+// pandocArgKind 参数值的类型
+type pandocArgKind int
+
+const (
+	pandocArgFlag     pandocArgKind = iota // 开关，不带值
+	pandocArgInt                           // 整数，在 min..max 之间
+	pandocArgEnum                          // 可选值之一
+	pandocArgPattern                       // 符合正则的字符串
+	pandocArgKeyValue                      // 元数据或模板变量：key=value 或 key:value
+)
+
+// pandocArgRule 允许的参数及其取值约束
+type pandocArgRule struct {
+	kind     pandocArgKind
+	min, max int
+	values   []string
+	pattern  *regexp.Regexp
+	hint     string // 值不符合 pattern 时的说明
+}
+
+// pandocArgRules 允许通过配置传给 Pandoc 的参数（只影响排版，不读写服务器文件）
+var pandocArgRules = map[string]pandocArgRule{
+	// 开关
+	"--toc":              {kind: pandocArgFlag},
+	"--number-sections":  {kind: pandocArgFlag},
+	"--standalone":       {kind: pandocArgFlag},
+	"--file-scope":       {kind: pandocArgFlag},
+	"--preserve-tabs":    {kind: pandocArgFlag},
+	"--strip-comments":   {kind: pandocArgFlag},
+	"--no-highlight":     {kind: pandocArgFlag},
+	"--section-divs":     {kind: pandocArgFlag},
+	"--listings":         {kind: pandocArgFlag},
+	"--reference-links":  {kind: pandocArgFlag},
+	"--ascii":            {kind: pandocArgFlag},
+	"--verbose":          {kind: pandocArgFlag},
+	"--quiet":            {kind: pandocArgFlag},
+	"--fail-if-warnings": {kind: pandocArgFlag},
+	// 数值
+	"--toc-depth":              {kind: pandocArgInt, min: 1, max: 6},
+	"--shift-heading-level-by": {kind: pandocArgInt, min: -5, max: 5},
+	"--columns":                {kind: pandocArgInt, min: 10, max: 1000},
+	"--tab-stop":               {kind: pandocArgInt, min: 1, max: 16},
+	"--dpi":                    {kind: pandocArgInt, min: 36, max: 2400},
+	"--slide-level":            {kind: pandocArgInt, min: 0, max: 6},
+	// 可选值
+	"--top-level-division": {kind: pandocArgEnum, values: []string{"default", "section", "chapter", "part"}},
+	"--highlight-style":    {kind: pandocArgEnum, values: highlightStyles},
+	"--wrap":               {kind: pandocArgEnum, values: []string{"auto", "none", "preserve"}},
+	"--eol":                {kind: pandocArgEnum, values: []string{"crlf", "lf", "native"}},
+	"--track-changes":      {kind: pandocArgEnum, values: []string{"accept", "reject", "all"}},
+	"--markdown-headings":  {kind: pandocArgEnum, values: []string{"atx", "setext"}},
+	"--reference-location": {kind: pandocArgEnum, values: []string{"block", "section", "document"}},
+	// 字符串
+	"--from":          {kind: pandocArgPattern, pattern: regexp.MustCompile(`^(markdown|gfm|commonmark|commonmark_x)([+-][a-z0-9_]+)*$`), hint: "只能使用 Markdown 读取器及其扩展，如 markdown-implicit_figures"},
+	"--number-offset": {kind: pandocArgPattern, pattern: regexp.MustCompile(`^\d+(,\d+)*$`), hint: "应为逗号分隔的数字，如 1,2"},
+	"--id-prefix":     {kind: pandocArgPattern, pattern: regexp.MustCompile(`^[A-Za-z0-9_-]+$`), hint: "只能包含字母、数字、- 和 _"},
+	// 元数据和模板变量
+	"--metadata": {kind: pandocArgKeyValue},
+	"--variable": {kind: pandocArgKeyValue},
+}
+
+// pandocArgAliases 短选项和别名对应的完整参数名
+var pandocArgAliases = map[string]string{
+	"--table-of-contents": "--toc",
+	"-N":                  "--number-sections",
+	"-s":                  "--standalone",
+	"-p":                  "--preserve-tabs",
+	"-f":                  "--from",
+	"-r":                  "--from",
+	"--read":              "--from",
+	"-M":                  "--metadata",
+	"-V":                  "--variable",
+	"-o":                  "--output",
+	"-t":                  "--to",
+	"-w":                  "--to",
+	"--write":             "--to",
+	"-L":                  "--lua-filter",
+	"-F":                  "--filter",
+	"-H":                  "--include-in-header",
+	"-B":                  "--include-before-body",
+	"-A":                  "--include-after-body",
+	"-c":                  "--css",
+	"-d":                  "--defaults",
+}
+
+const (
+	pandocArgExecReason  = "可以在服务器上执行程序"
+	pandocArgReadReason  = "可以读取服务器上的任意文件"
+	pandocArgWriteReason = "可以向服务器写入文件"
+)
+
+// pandocArgDenied 明确禁止的参数及原因
+var pandocArgDenied = map[string]string{
+	"--output":                 "输出位置由构建脚本决定",
+	"--to":                     "输出格式由构建时选择的格式决定",
+	"--lua-filter":             pandocArgExecReason,
+	"--filter":                 pandocArgExecReason,
+	"--pdf-engine":             pandocArgExecReason,
+	"--pdf-engine-opt":         pandocArgExecReason,
+	"--extract-media":          pandocArgWriteReason,
+	"--log":                    pandocArgWriteReason,
+	"--template":               pandocArgReadReason,
+	"--reference-doc":          pandocArgReadReason + "，请使用 template 或 word_options.reference-doc",
+	"--include-in-header":      pandocArgReadReason,
+	"--include-before-body":    pandocArgReadReason,
+	"--include-after-body":     pandocArgReadReason,
+	"--css":                    pandocArgReadReason,
+	"--defaults":               pandocArgReadReason,
+	"--data-dir":               pandocArgReadReason,
+	"--resource-path":          pandocArgReadReason,
+	"--bibliography":           pandocArgReadReason,
+	"--csl":                    pandocArgReadReason,
+	"--citation-abbreviations": pandocArgReadReason,
+	"--abbreviations":          pandocArgReadReason,
+	"--syntax-definition":      pandocArgReadReason,
+	"--epub-cover-image":       pandocArgReadReason,
+	"--epub-metadata":          pandocArgReadReason,
+	"--epub-embed-font":        pandocArgReadReason,
+}
+
+// pandocMetaKeyRegex 元数据和模板变量名
+var pandocMetaKeyRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+
+// pandocDeniedMetaKeys 会被模板或 Pandoc 当作文件路径或原样插入的元数据
+var pandocDeniedMetaKeys = map[string]string{
+	"header-includes":        "会原样插入 LaTeX/HTML 代码",
+	"include-before":         "会原样插入 LaTeX/HTML 代码",
+	"include-after":          "会原样插入 LaTeX/HTML 代码",
+	"bibliography":           pandocArgReadReason,
+	"csl":                    pandocArgReadReason,
+	"citation-abbreviations": pandocArgReadReason,
+	"reference-doc":          pandocArgReadReason,
+}
+
+// ValidatePandocArgs 按允许列表检查 Pandoc 参数，返回所有不允许的参数
+// 带值的参数可以写成 --name=value、-Xvalue 或两个相邻的条目（--name、value）
+func ValidatePandocArgs(args []string) []PandocArgError {
+	var errs []PandocArgError
+	for i := 0; i < len(args); i++ {
+		index, arg := i, strings.TrimSpace(args[i])
+		if arg == "" {
+			continue
+		}
+		reject := func(msg string) {
+			errs = append(errs, PandocArgError{Index: index, Arg: arg, Message: msg})
+		}
+
+		name, value, hasValue := arg, "", false
+		switch {
+		case !strings.HasPrefix(arg, "-"):
+			reject("不是 Pandoc 选项（输入文件由模块列表决定）")
+			continue
+		case strings.HasPrefix(arg, "--"):
+			if eq := strings.Index(arg, "="); eq > 0 {
+				name, value, hasValue = arg[:eq], arg[eq+1:], true
+			}
+		case len(arg) > 2:
+			// 短选项直接跟值，如 -Mlang=zh-CN
+			name, value, hasValue = arg[:2], arg[2:], true
+		}
+		if full, ok := pandocArgAliases[name]; ok {
+			name = full
+		}
+
+		if reason, denied := pandocArgDenied[name]; denied {
+			// 相邻条目是它的值时一起跳过
+			if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				arg += " " + args[i]
+			}
+			reject(name + " " + reason)
+			continue
+		}
+		rule, ok := pandocArgRules[name]
+		if !ok {
+			reject(name + " 不在允许的参数列表中")
+			continue
+		}
+		if rule.kind == pandocArgFlag {
+			if hasValue {
+				reject(name + " 不接受参数值")
+			}
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				reject(name + " 缺少参数值")
+				continue
+			}
+			i++
+			value = args[i]
+			arg += " " + value
+		}
+		if msg := rule.check(value); msg != "" {
+			reject(name + " " + msg)
+		}
+	}
+	return errs
+}
+
+// check 检查参数值，不符合时返回原因
+func (r pandocArgRule) check(value string) string {
+	switch r.kind {
+	case pandocArgInt:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < r.min || n > r.max {
+			return fmt.Sprintf("应为 %d 到 %d 之间的整数", r.min, r.max)
+		}
+	case pandocArgEnum:
+		for _, v := range r.values {
+			if v == value {
+				return ""
+			}
+		}
+		return "应为 " + strings.Join(r.values, "、") + " 之一"
+	case pandocArgPattern:
+		if !r.pattern.MatchString(value) {
+			return r.hint
+		}
+	case pandocArgKeyValue:
+		key, val := value, ""
+		if i := strings.IndexAny(value, "=:"); i >= 0 {
+			key, val = value[:i], value[i+1:]
+		}
+		if !pandocMetaKeyRegex.MatchString(key) {
+			return "应为 key=value 格式"
+		}
+		if reason, denied := pandocDeniedMetaKeys[key]; denied {
+			return key + " " + reason
+		}
+		// 值与 template_variables 使用相同的约束（不含 LaTeX 特殊字符，路径变量只能是相对路径）
+		if val != "" {
+			rule := templateValueRule(key)
+			if !regexp.MustCompile(rule.pattern).MatchString(val) {
+				return key + " " + rule.hint
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,369 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// presenceTTL 连接超过此时间没有心跳时视为离开
+	presenceTTL = 60 * time.Second
+	// editLockTTL 编辑锁超过此时间没有心跳时自动释放
+	editLockTTL = 60 * time.Second
+	// presenceSweepInterval 清理过期连接和编辑锁的间隔
+	presenceSweepInterval = 15 * time.Second
+	// presenceEventBuffer 每个连接缓存的事件数，客户端读取过慢时丢弃新事件
+	presenceEventBuffer = 64
+)
+
+// 在线状态中的操作模式
+const (
+	PresenceViewing = "viewing"
+	PresenceEditing = "editing"
+)
+
+// 推送事件类型
+const (
+	PresenceEventHello    = "hello"    // 连接建立，包含连接 ID 和当前状态
+	PresenceEventPresence = "presence" // 在线状态或编辑锁变化，包含当前状态
+	PresenceEventSaved    = "saved"    // 模块已保存
+	PresenceEventCreated  = "created"  // 模块已创建
+	PresenceEventRenamed  = "renamed"  // 模块已重命名或移动
+	PresenceEventDeleted  = "deleted"  // 模块已删除
+)
+
+var (
+	ErrPresenceNotFound = errors.New("连接不存在或已过期，请刷新页面")
+	ErrEditLockNotHeld  = errors.New("没有持有该模块的编辑锁")
+)
+
+// PresenceEntry 一个连接正在查看或编辑的模块
+type PresenceEntry struct {
+	ConnectionID string    `json:"connectionId"`
+	User         string    `json:"user"`
+	DisplayName  string    `json:"displayName,omitempty"`
+	Path         string    `json:"path,omitempty"`
+	Mode         string    `json:"mode,omitempty"`
+	Since        time.Time `json:"since"`
+}
+
+// EditLock 模块的编辑锁（仅提示，不阻止保存）
+type EditLock struct {
+	Path         string    `json:"path"`
+	Owner        string    `json:"owner"`
+	DisplayName  string    `json:"displayName,omitempty"`
+	ConnectionID string    `json:"connectionId"`
+	AcquiredAt   time.Time `json:"acquiredAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// EditLockHeldError 模块正在被其他人编辑
+type EditLockHeldError struct {
+	Lock EditLock
+}
+
+func (e *EditLockHeldError) Error() string {
+	name := e.Lock.DisplayName
+	if name == "" {
+		name = e.Lock.Owner
+	}
+	return fmt.Sprintf("%s 正在编辑 %s", name, e.Lock.Path)
+}
+
+// PresenceEvent 推送给编辑器的事件
+type PresenceEvent struct {
+	Type         string          `json:"type"`
+	ConnectionID string          `json:"connectionId,omitempty"` // hello: 本连接的 ID
+	Path         string          `json:"path,omitempty"`
+	OldPath      string          `json:"oldPath,omitempty"` // renamed: 原路径
+	Actor        string          `json:"actor,omitempty"`
+	DisplayName  string          `json:"displayName,omitempty"`
+	Source       string          `json:"source,omitempty"` // 触发事件的连接，客户端据此忽略自己的操作
+	ETag         string          `json:"etag,omitempty"`   // saved: 保存后的内容 ETag
+	Presence     []PresenceEntry `json:"presence,omitempty"`
+	Locks        []EditLock      `json:"locks,omitempty"`
+	Time         time.Time       `json:"time"`
+}
+
+// presenceConn 一个编辑器的推送连接
+type presenceConn struct {
+	PresenceEntry
+	lastSeen time.Time
+	events   chan PresenceEvent
+}
+
+// PresenceService 编辑器在线状态、编辑锁和模块变更通知（只保存在内存中）
+type PresenceService struct {
+	mu    sync.Mutex
+	conns map[string]*presenceConn
+	locks map[string]*EditLock // 键为相对于 src/ 的模块路径
+}
+
+// NewPresenceService 创建在线状态服务，并在后台定期清理过期的连接和编辑锁
+func NewPresenceService() *PresenceService {
+	s := &PresenceService{
+		conns: make(map[string]*presenceConn),
+		locks: make(map[string]*EditLock),
+	}
+	go func() {
+		for range time.Tick(presenceSweepInterval) {
+			s.sweep()
+		}
+	}()
+	return s
+}
+
+// Subscribe 建立推送连接，返回连接 ID 和事件通道（第一个事件为 hello）
+func (s *PresenceService) Subscribe(user, displayName string) (string, <-chan PresenceEvent, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	conn := &presenceConn{
+		PresenceEntry: PresenceEntry{ConnectionID: id, User: user, DisplayName: displayName, Since: now},
+		lastSeen:      now,
+		events:        make(chan PresenceEvent, presenceEventBuffer),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[id] = conn
+	presence, locks := s.snapshotLocked()
+	conn.events <- PresenceEvent{Type: PresenceEventHello, ConnectionID: id, Presence: presence, Locks: locks, Time: now}
+	s.broadcastPresenceLocked()
+	return id, conn.events, nil
+}
+
+// Unsubscribe 断开推送连接，释放该连接持有的编辑锁
+func (s *PresenceService) Unsubscribe(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.conns[id]; !ok {
+		return
+	}
+	s.removeConnLocked(id)
+	s.broadcastPresenceLocked()
+}
+
+// Update 上报连接正在查看或编辑的模块（path 为空表示没有打开模块），同时作为心跳
+// 连接持有当前模块的编辑锁时一并续期
+func (s *PresenceService) Update(id, user, path, mode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conn, ok := s.conns[id]
+	if !ok || conn.User != user {
+		return ErrPresenceNotFound
+	}
+	now := time.Now()
+	conn.lastSeen = now
+	if lock, ok := s.locks[path]; ok && lock.ConnectionID == id {
+		lock.ExpiresAt = now.Add(editLockTTL)
+	}
+	if mode != PresenceEditing {
+		mode = PresenceViewing
+	}
+	if path == "" {
+		mode = ""
+	}
+	if conn.Path == path && conn.Mode == mode {
+		return nil
+	}
+	conn.Path, conn.Mode, conn.Since = path, mode, now
+	s.broadcastPresenceLocked()
+	return nil
+}
+
+// AcquireEditLock 获取模块的编辑锁，已持有时续期
+// 被其他连接持有时返回 *EditLockHeldError；force 为 true 时接管（编辑锁只是提示，不阻止保存）
+func (s *PresenceService) AcquireEditLock(id, user, path string, force bool) (*EditLock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conn, ok := s.conns[id]
+	if !ok || conn.User != user {
+		return nil, ErrPresenceNotFound
+	}
+	now := time.Now()
+	if lock, ok := s.locks[path]; ok && lock.ConnectionID != id && lock.ExpiresAt.After(now) && !force {
+		return nil, &EditLockHeldError{Lock: *lock}
+	}
+
+	lock, ok := s.locks[path]
+	if !ok || lock.ConnectionID != id {
+		if ok {
+			log.Printf("[Presence] %s 接管了 %s 的编辑锁: %s", user, lock.Owner, path)
+		}
+		lock = &EditLock{Path: path, Owner: user, DisplayName: conn.DisplayName, ConnectionID: id, AcquiredAt: now}
+		s.locks[path] = lock
+	}
+	lock.ExpiresAt = now.Add(editLockTTL)
+	conn.lastSeen = now
+	conn.Path, conn.Mode = path, PresenceEditing
+	s.broadcastPresenceLocked()
+	copied := *lock
+	return &copied, nil
+}
+
+// ReleaseEditLock 释放编辑锁（只能释放自己持有的）
+func (s *PresenceService) ReleaseEditLock(id, user, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock, ok := s.locks[path]
+	if !ok || lock.ConnectionID != id || lock.Owner != user {
+		return ErrEditLockNotHeld
+	}
+	delete(s.locks, path)
+	if conn, ok := s.conns[id]; ok && conn.Path == path {
+		conn.Mode = PresenceViewing
+	}
+	s.broadcastPresenceLocked()
+	return nil
+}
+
+// Snapshot 返回当前在线的连接和编辑锁
+func (s *PresenceService) Snapshot() ([]PresenceEntry, []EditLock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshotLocked()
+}
+
+// Notify 广播模块变更事件；重命名和删除时同步更新编辑锁和在线状态中的路径
+func (s *PresenceService) Notify(event PresenceEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event.Time = time.Now()
+	changed := false
+	switch event.Type {
+	case PresenceEventRenamed:
+		for path, lock := range s.locks {
+			if newPath, ok := movedPath(path, event.OldPath, event.Path); ok {
+				delete(s.locks, path)
+				lock.Path = newPath
+				s.locks[newPath] = lock
+				changed = true
+			}
+		}
+		for _, conn := range s.conns {
+			if newPath, ok := movedPath(conn.Path, event.OldPath, event.Path); ok {
+				conn.Path = newPath
+				changed = true
+			}
+		}
+	case PresenceEventDeleted:
+		if _, ok := s.locks[event.Path]; ok {
+			delete(s.locks, event.Path)
+			changed = true
+		}
+	}
+	s.broadcastLocked(event)
+	if changed {
+		s.broadcastPresenceLocked()
+	}
+}
+
+// FilesDeleted Web 界面之外删除了模块（文件监视器发现），释放这些模块的编辑锁
+func (s *PresenceService) FilesDeleted(paths []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := false
+	for _, path := range paths {
+		if _, ok := s.locks[path]; ok {
+			delete(s.locks, path)
+			changed = true
+		}
+	}
+	if changed {
+		s.broadcastPresenceLocked()
+	}
+}
+
+// movedPath 路径在重命名的文件或目录之下时返回新路径
+func movedPath(path, oldPath, newPath string) (string, bool) {
+	if path == "" || oldPath == "" {
+		return "", false
+	}
+	if path == oldPath {
+		return newPath, true
+	}
+	if len(path) > len(oldPath) && path[:len(oldPath)] == oldPath && path[len(oldPath)] == '/' {
+		return newPath + path[len(oldPath):], true
+	}
+	return "", false
+}
+
+// sweep 清理过期的连接和编辑锁
+func (s *PresenceService) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	changed := false
+	for id, conn := range s.conns {
+		if now.Sub(conn.lastSeen) > presenceTTL {
+			s.removeConnLocked(id)
+			changed = true
+		}
+	}
+	for path, lock := range s.locks {
+		if now.After(lock.ExpiresAt) {
+			delete(s.locks, path)
+			changed = true
+		}
+	}
+	if changed {
+		s.broadcastPresenceLocked()
+	}
+}
+
+// removeConnLocked 移除连接及其编辑锁并关闭事件通道（调用方需持有锁）
+func (s *PresenceService) removeConnLocked(id string) {
+	conn := s.conns[id]
+	delete(s.conns, id)
+	close(conn.events)
+	for path, lock := range s.locks {
+		if lock.ConnectionID == id {
+			delete(s.locks, path)
+		}
+	}
+}
+
+// snapshotLocked 当前状态，按用户和路径排序（调用方需持有锁）
+func (s *PresenceService) snapshotLocked() ([]PresenceEntry, []EditLock) {
+	presence := make([]PresenceEntry, 0, len(s.conns))
+	for _, conn := range s.conns {
+		presence = append(presence, conn.PresenceEntry)
+	}
+	sort.Slice(presence, func(i, j int) bool {
+		if presence[i].User != presence[j].User {
+			return presence[i].User < presence[j].User
+		}
+		return presence[i].Path < presence[j].Path
+	})
+	locks := make([]EditLock, 0, len(s.locks))
+	for _, lock := range s.locks {
+		locks = append(locks, *lock)
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Path < locks[j].Path })
+	return presence, locks
+}
+
+// broadcastPresenceLocked 广播当前在线状态（调用方需持有锁）
+func (s *PresenceService) broadcastPresenceLocked() {
+	presence, locks := s.snapshotLocked()
+	s.broadcastLocked(PresenceEvent{Type: PresenceEventPresence, Presence: presence, Locks: locks, Time: time.Now()})
+}
+
+// broadcastLocked 向所有连接发送事件，通道已满的连接丢弃该事件（调用方需持有锁）
+func (s *PresenceService) broadcastLocked(event PresenceEvent) {
+	for _, conn := range s.conns {
+		select {
+		case conn.events <- event:
+		default:
+			log.Printf("[Presence] 连接 %s 的事件队列已满，丢弃事件: %s", conn.ConnectionID, event.Type)
+		}
+	}
+}
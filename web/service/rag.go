@@ -3,9 +3,12 @@ package service
 import (
 	"context"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"doc-generator-web/config"
 )
@@ -15,6 +18,19 @@ type RAGService struct {
 	config      *config.Config
 	vectorStore *VectorStore
 	embSvc      *EmbeddingService
+
+	// indexMu 保证同一时间只有一个索引任务修改向量存储
+	indexMu sync.Mutex
+
+	// 索引之后发生变化、需要重新索引的文件（相对于工作目录），以及最近一次索引使用的 Embedding 配置（只保存在内存中）
+	mu      sync.Mutex
+	pending map[string]bool
+	creds   *embeddingCredentials
+}
+
+// embeddingCredentials Embedding API 配置
+type embeddingCredentials struct {
+	endpoint, key, model string
 }
 
 // NewRAGService 创建新的 RAG 服务实例
@@ -23,11 +39,15 @@ func NewRAGService(cfg *config.Config) *RAGService {
 		config:      cfg,
 		vectorStore: NewVectorStore(cfg.WorkDir),
 		embSvc:      NewEmbeddingService(),
+		pending:     make(map[string]bool),
 	}
 }
 
 // IndexDocuments 索引文档目录
 func (r *RAGService) IndexDocuments(ctx context.Context, apiEndpoint, apiKey, model string) error {
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+
 	srcDir := filepath.Join(r.config.WorkDir, "src")
 
 	// 加载现有索引
@@ -35,9 +55,6 @@ func (r *RAGService) IndexDocuments(ctx context.Context, apiEndpoint, apiKey, mo
 		return fmt.Errorf("failed to load vector store: %w", err)
 	}
 
-	// 清空现有索引
-	r.vectorStore.Clear()
-
 	// 读取所有 Markdown 文件
 	var allDocs []Document
 	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
@@ -50,36 +67,11 @@ func (r *RAGService) IndexDocuments(ctx context.Context, apiEndpoint, apiKey, mo
 			return nil
 		}
 
-		// 读取文件内容
-		content, err := os.ReadFile(path)
+		docs, err := r.fileDocuments(path)
 		if err != nil {
-			return fmt.Errorf("failed to read file %s: %w", path, err)
-		}
-
-		// 分块
-		text := string(content)
-		chunks := ChunkText(text, 1000, 200)
-
-		// 获取相对路径
-		relPath, _ := filepath.Rel(r.config.WorkDir, path)
-
-		// 提取标题
-		title := extractTitle(text)
-
-		// 为每个块创建文档
-		for i, chunk := range chunks {
-			doc := Document{
-				ID:      fmt.Sprintf("%s#%d", relPath, i),
-				Content: chunk,
-				Metadata: Metadata{
-					FilePath: relPath,
-					ChunkID:  i,
-					Title:    title,
-				},
-			}
-			allDocs = append(allDocs, doc)
+			return err
 		}
-
+		allDocs = append(allDocs, docs...)
 		return nil
 	})
 
@@ -91,39 +83,199 @@ func (r *RAGService) IndexDocuments(ctx context.Context, apiEndpoint, apiKey, mo
 		return fmt.Errorf("no documents found in %s", srcDir)
 	}
 
-	// 批量生成 embeddings（分批处理，避免超出 API 批量大小限制）
-	const batchSize = 20
-	texts := make([]string, len(allDocs))
-	for i, doc := range allDocs {
-		texts[i] = doc.Content
+	if err := r.embedDocuments(ctx, apiEndpoint, apiKey, model, allDocs); err != nil {
+		return err
 	}
 
-	allEmbeddings := make([][]float64, 0, len(texts))
-	for i := 0; i < len(texts); i += batchSize {
-		end := i + batchSize
-		if end > len(texts) {
-			end = len(texts)
+	// 替换现有索引
+	r.vectorStore.Clear()
+	r.vectorStore.AddDocuments(allDocs)
+
+	// 保存索引
+	if err := r.vectorStore.Save(); err != nil {
+		return fmt.Errorf("failed to save vector store: %w", err)
+	}
+
+	// 记住 Embedding 配置，之后文件变化时自动增量更新
+	r.mu.Lock()
+	r.pending = make(map[string]bool)
+	r.creds = &embeddingCredentials{endpoint: apiEndpoint, key: apiKey, model: model}
+	r.mu.Unlock()
+	return nil
+}
+
+// IndexPending 只重新索引上次索引之后发生变化的文件，返回处理的文件数
+func (r *RAGService) IndexPending(ctx context.Context, apiEndpoint, apiKey, model string) (int, error) {
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+
+	files := r.PendingFiles()
+	if len(files) == 0 {
+		return 0, nil
+	}
+	if err := r.vectorStore.Load(); err != nil {
+		return 0, fmt.Errorf("failed to load vector store: %w", err)
+	}
+
+	var docs []Document
+	for _, relPath := range files {
+		absPath := filepath.Join(r.config.WorkDir, filepath.FromSlash(relPath))
+		if _, err := os.Stat(absPath); os.IsNotExist(err) {
+			continue
 		}
-		batch, err := r.embSvc.GenerateEmbeddings(ctx, apiEndpoint, apiKey, model, texts[i:end])
+		fileDocs, err := r.fileDocuments(absPath)
 		if err != nil {
-			return fmt.Errorf("failed to generate embeddings (batch %d-%d): %w", i, end-1, err)
+			return 0, err
 		}
-		allEmbeddings = append(allEmbeddings, batch...)
+		docs = append(docs, fileDocs...)
+	}
+	if err := r.embedDocuments(ctx, apiEndpoint, apiKey, model, docs); err != nil {
+		return 0, err
 	}
 
-	// 将 embeddings 添加到文档
-	for i := range allDocs {
-		allDocs[i].Embedding = allEmbeddings[i]
+	for _, relPath := range files {
+		r.vectorStore.RemoveFile(relPath)
+	}
+	r.vectorStore.AddDocuments(docs)
+	if err := r.vectorStore.Save(); err != nil {
+		return 0, fmt.Errorf("failed to save vector store: %w", err)
 	}
 
-	// 添加到向量存储
-	r.vectorStore.AddDocuments(allDocs)
+	r.mu.Lock()
+	for _, relPath := range files {
+		delete(r.pending, relPath)
+	}
+	r.mu.Unlock()
+	return len(files), nil
+}
 
-	// 保存索引
-	if err := r.vectorStore.Save(); err != nil {
-		return fmt.Errorf("failed to save vector store: %w", err)
+// FilesChanged 记录 src 中发生变化的 Markdown 文件（文件监视器的订阅者）
+// 删除的文件立即从索引中移除；之前通过 Web 界面建立过索引时在后台自动增量更新
+func (r *RAGService) FilesChanged(changes []WatchEvent) {
+	var changed, deleted []string
+	for _, change := range changes {
+		if change.Root != "src" || !strings.HasSuffix(strings.ToLower(change.Path), ".md") {
+			continue
+		}
+		relPath := "src/" + change.Path
+		if change.Type == FileDeleted {
+			deleted = append(deleted, relPath)
+		} else {
+			changed = append(changed, relPath)
+		}
+	}
+	if len(changed) == 0 && len(deleted) == 0 {
+		return
 	}
 
+	r.indexMu.Lock()
+	if err := r.vectorStore.Load(); err != nil || r.vectorStore.GetDocumentCount() == 0 {
+		// 还没有建立索引
+		r.indexMu.Unlock()
+		return
+	}
+	removed := 0
+	for _, relPath := range deleted {
+		removed += r.vectorStore.RemoveFile(relPath)
+	}
+	if removed > 0 {
+		if err := r.vectorStore.Save(); err != nil {
+			log.Printf("[RAG] 保存索引失败: %v", err)
+		}
+	}
+	r.indexMu.Unlock()
+
+	r.mu.Lock()
+	for _, relPath := range deleted {
+		delete(r.pending, relPath)
+	}
+	for _, relPath := range changed {
+		r.pending[relPath] = true
+	}
+	creds := r.creds
+	r.mu.Unlock()
+
+	if creds != nil && len(changed) > 0 {
+		go func() {
+			n, err := r.IndexPending(context.Background(), creds.endpoint, creds.key, creds.model)
+			if err != nil {
+				log.Printf("[RAG] 增量更新索引失败: %v", err)
+				return
+			}
+			if n > 0 {
+				log.Printf("[RAG] 已增量更新 %d 个文件的索引", n)
+			}
+		}()
+	}
+}
+
+// PendingFiles 返回需要重新索引的文件
+func (r *RAGService) PendingFiles() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	files := make([]string, 0, len(r.pending))
+	for relPath := range r.pending {
+		files = append(files, relPath)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// fileDocuments 读取 Markdown 文件并分块
+func (r *RAGService) fileDocuments(path string) ([]Document, error) {
+	// 读取文件内容
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+
+	// 分块
+	text := string(content)
+	chunks := ChunkText(text, 1000, 200)
+
+	// 获取相对路径
+	relPath, _ := filepath.Rel(r.config.WorkDir, path)
+	relPath = filepath.ToSlash(relPath)
+
+	// 提取标题
+	title := extractTitle(text)
+
+	// 为每个块创建文档
+	docs := make([]Document, 0, len(chunks))
+	for i, chunk := range chunks {
+		docs = append(docs, Document{
+			ID:      fmt.Sprintf("%s#%d", relPath, i),
+			Content: chunk,
+			Metadata: Metadata{
+				FilePath: relPath,
+				ChunkID:  i,
+				Title:    title,
+			},
+		})
+	}
+	return docs, nil
+}
+
+// embedDocuments 批量生成 embeddings（分批处理，避免超出 API 批量大小限制）
+func (r *RAGService) embedDocuments(ctx context.Context, apiEndpoint, apiKey, model string, docs []Document) error {
+	const batchSize = 20
+	for i := 0; i < len(docs); i += batchSize {
+		end := i + batchSize
+		if end > len(docs) {
+			end = len(docs)
+		}
+		texts := make([]string, 0, end-i)
+		for _, doc := range docs[i:end] {
+			texts = append(texts, doc.Content)
+		}
+		batch, err := r.embSvc.GenerateEmbeddings(ctx, apiEndpoint, apiKey, model, texts)
+		if err != nil {
+			return fmt.Errorf("failed to generate embeddings (batch %d-%d): %w", i, end-1, err)
+		}
+		for j := range batch {
+			docs[i+j].Embedding = batch[j]
+		}
+	}
 	return nil
 }
 
@@ -158,11 +310,17 @@ func (r *RAGService) GetIndexStatus() (map[string]interface{}, error) {
 		return nil, fmt.Errorf("failed to load vector store: %w", err)
 	}
 
+	r.mu.Lock()
+	autoUpdate := r.creds != nil
+	r.mu.Unlock()
+
 	status := map[string]interface{}{
 		"document_count": r.vectorStore.GetDocumentCount(),
 		"indexed":        r.vectorStore.GetDocumentCount() > 0,
 		"model":          r.vectorStore.index.Model,
 		"version":        r.vectorStore.index.Version,
+		"pending_files":  r.PendingFiles(), // 索引之后发生变化的文件
+		"auto_update":    autoUpdate,       // 文件变化时是否自动增量更新
 	}
 
 	return status, nil
@@ -47,6 +47,7 @@ type ResourceService struct {
 	fontsDir     string
 	templatesDir string
 	clientsDir   string // 用于检查模板使用情况
+	trash        *TrashService
 }
 
 // NewResourceService 创建资源服务
@@ -59,6 +60,11 @@ func NewResourceService(fontsDir, templatesDir, clientsDir string) *ResourceServ
 }
 
 
+// SetTrash 设置回收站，删除的字体和模板移入回收站（未设置时直接删除）
+func (s *ResourceService) SetTrash(trash *TrashService) {
+	s.trash = trash
+}
+
 // ValidateFilename 验证文件名
 func (s *ResourceService) ValidateFilename(filename string) error {
 	filename = strings.TrimSpace(filename)
@@ -323,6 +329,22 @@ func (s *ResourceService) FontExists(filename string) bool {
 	return err == nil
 }
 
+// FontPath 返回字体文件路径（文件名无效时返回空字符串）
+func (s *ResourceService) FontPath(filename string) string {
+	if s.ValidateFilename(filename) != nil {
+		return ""
+	}
+	return filepath.Join(s.fontsDir, filename)
+}
+
+// TemplatePath 返回模板文件路径（文件名无效时返回空字符串）
+func (s *ResourceService) TemplatePath(filename string) string {
+	if s.ValidateFilename(filename) != nil {
+		return ""
+	}
+	return filepath.Join(s.templatesDir, filename)
+}
+
 // TemplateExists 检查模板文件是否存在
 func (s *ResourceService) TemplateExists(filename string) bool {
 	filePath := filepath.Join(s.templatesDir, filename)
@@ -330,48 +352,50 @@ func (s *ResourceService) TemplateExists(filename string) bool {
 	return err == nil
 }
 
-// DeleteFont 删除字体文件
-func (s *ResourceService) DeleteFont(filename string) error {
+// DeleteFont 删除字体文件（移入回收站）
+func (s *ResourceService) DeleteFont(filename, deletedBy string) (*TrashItem, error) {
 	// 验证文件名
 	if err := s.ValidateFilename(filename); err != nil {
-		return err
+		return nil, err
 	}
 
 	filePath := filepath.Join(s.fontsDir, filename)
 
 	// 检查文件是否存在
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("字体文件不存在: %s", filename)
+		return nil, fmt.Errorf("字体文件不存在: %s", filename)
 	}
 
-	// 删除文件
-	if err := os.Remove(filePath); err != nil {
-		return fmt.Errorf("删除字体文件失败: %w", err)
+	// 移入回收站
+	item, err := s.trash.discard(TrashFont, filename, []string{filePath}, deletedBy)
+	if err != nil {
+		return nil, fmt.Errorf("删除字体文件失败: %w", err)
 	}
 
-	return nil
+	return item, nil
 }
 
-// DeleteTemplate 删除模板文件
-func (s *ResourceService) DeleteTemplate(filename string) error {
+// DeleteTemplate 删除模板文件（移入回收站）
+func (s *ResourceService) DeleteTemplate(filename, deletedBy string) (*TrashItem, error) {
 	// 验证文件名
 	if err := s.ValidateFilename(filename); err != nil {
-		return err
+		return nil, err
 	}
 
 	filePath := filepath.Join(s.templatesDir, filename)
 
 	// 检查文件是否存在
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("模板文件不存在: %s", filename)
+		return nil, fmt.Errorf("模板文件不存在: %s", filename)
 	}
 
-	// 删除文件
-	if err := os.Remove(filePath); err != nil {
-		return fmt.Errorf("删除模板文件失败: %w", err)
+	// 移入回收站
+	item, err := s.trash.discard(TrashTemplate, filename, []string{filePath}, deletedBy)
+	if err != nil {
+		return nil, fmt.Errorf("删除模板文件失败: %w", err)
 	}
 
-	return nil
+	return item, nil
 }
 
 // DownloadTemplate 获取模板文件路径用于下载
@@ -429,8 +453,8 @@ func (s *ResourceService) GetTemplateUsage(filename string) ([]string, error) {
 				continue
 			}
 
-			// 跳过 metadata.yaml
-			if configName == "metadata.yaml" {
+			// 跳过 metadata.yaml 和 variables.yaml
+			if isReservedConfigName(strings.TrimSuffix(configName, ext)) {
 				continue
 			}
 
@@ -0,0 +1,239 @@
+// Package service 提供业务逻辑服务
+package service
+
+import "sort"
+
+// 模板变量类型
+const (
+	TemplateVarString  = "string"
+	TemplateVarBoolean = "boolean"
+	TemplateVarNumber  = "number"
+	TemplateVarColor   = "color" // 6 位十六进制，不带 #
+	TemplateVarEnum    = "enum"
+	TemplateVarPath    = "path" // 相对于项目根目录的文件路径
+)
+
+// 模板变量的值会原样写入 LaTeX（-V），不允许 LaTeX 特殊字符，避免插入 \input 等命令
+const latexUnsafeChars = `\\{}$%#&^~\n\r`
+
+// templateStringRule 字符串变量：不含 LaTeX 特殊字符
+var templateStringRule = configSchemaRule{
+	pattern: `^[^` + latexUnsafeChars + `]*$`,
+	hint:    `不能包含 LaTeX 特殊字符 \ { } $ % # & ^ ~ 或换行`,
+}
+
+// templatePathRule 路径变量：项目根目录下的相对路径（不能以 / 开头、不能包含 .. 和盘符），同样不含 LaTeX 特殊字符
+// 正则不支持否定前瞻，用"点后面不能紧跟点"表达不含 ..
+var templatePathRule = configSchemaRule{
+	pattern: `^[^/.:` + latexUnsafeChars + `](?:[^.:` + latexUnsafeChars + `]|\.[^.:` + latexUnsafeChars + `])*\.?$`,
+	hint:    `应为项目根目录下的相对路径（如 src/images/logo.png），不能以 / 开头，不能包含 ..、: 或 LaTeX 特殊字符`,
+}
+
+// templateValueRule 返回变量值的约束：模板目录中的路径变量用 templatePathRule，其他变量用 templateStringRule
+// pandoc_args 中的 -V/-M 也用它检查，避免绕过 template_variables 的限制
+func templateValueRule(name string) configSchemaRule {
+	for _, catalog := range templateCatalogs {
+		for _, v := range catalog.Variables {
+			if v.Name == name && v.Type == TemplateVarPath {
+				return templatePathRule
+			}
+		}
+	}
+	return templateStringRule
+}
+
+// TemplateVariable 输出模板支持的变量
+type TemplateVariable struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Default     string   `json:"default,omitempty"` // 模板的默认值（仅供参考）
+	Values      []string `json:"values,omitempty"`  // enum 类型的可选值
+	Min         *float64 `json:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty"`
+}
+
+// TemplateCatalog 一个输出模板的变量目录
+type TemplateCatalog struct {
+	Template    string             `json:"template"`    // 模板名称（eisvogel、docx）
+	Format      string             `json:"format"`      // 对应的输出格式（pdf、word）
+	Flag        string             `json:"flag"`        // 构建时传给 Pandoc 的方式（-V 模板变量、-M 元数据）
+	Description string             `json:"description"` // 说明
+	Variables   []TemplateVariable `json:"variables"`
+}
+
+// templateCatalogs 已知的输出模板变量（template_variables 只能使用这里列出的变量）
+var templateCatalogs = []TemplateCatalog{
+	{
+		Template:    "eisvogel",
+		Format:      "pdf",
+		Flag:        "-V",
+		Description: "PDF 输出使用的 Eisvogel LaTeX 模板",
+		Variables: []TemplateVariable{
+			// 封面
+			{Name: "titlepage", Type: TemplateVarBoolean, Description: "显示封面", Default: "false"},
+			{Name: "titlepage-color", Type: TemplateVarColor, Description: "封面背景色", Default: "D8DE2C"},
+			{Name: "titlepage-text-color", Type: TemplateVarColor, Description: "封面文字颜色", Default: "5F5F5F"},
+			{Name: "titlepage-rule-color", Type: TemplateVarColor, Description: "封面装饰线颜色", Default: "435488"},
+			{Name: "titlepage-rule-height", Type: TemplateVarNumber, Description: "封面装饰线高度（pt）", Default: "4", Min: schemaBound(0), Max: schemaBound(50)},
+			{Name: "titlepage-background", Type: TemplateVarPath, Description: "封面背景图（PDF 或图片）"},
+			{Name: "titlepage-logo", Type: TemplateVarPath, Description: "封面 Logo"},
+			{Name: "logo", Type: TemplateVarPath, Description: "封面 Logo（旧版本 Eisvogel）"},
+			{Name: "logo-width", Type: TemplateVarString, Description: "Logo 宽度（如 35mm）", Default: "35mm"},
+			// 页面
+			{Name: "page-background", Type: TemplateVarPath, Description: "正文页面背景图"},
+			{Name: "page-background-opacity", Type: TemplateVarNumber, Description: "页面背景图不透明度", Default: "0.2", Min: schemaBound(0), Max: schemaBound(1)},
+			{Name: "papersize", Type: TemplateVarEnum, Description: "纸张大小", Values: []string{"a4", "a5", "letter", "legal", "b5"}},
+			{Name: "geometry", Type: TemplateVarString, Description: "LaTeX geometry 参数（如 margin=2.5cm）"},
+			{Name: "classoption", Type: TemplateVarString, Description: "文档类选项（如 oneside）"},
+			{Name: "book", Type: TemplateVarBoolean, Description: "使用 book 文档类（章节从新页开始）", Default: "false"},
+			{Name: "first-chapter", Type: TemplateVarNumber, Description: "第一章的编号", Default: "1", Min: schemaBound(0)},
+			{Name: "caption-justification", Type: TemplateVarEnum, Description: "图表标题对齐方式", Default: "raggedright", Values: []string{"raggedright", "centering", "justified", "raggedleft"}},
+			{Name: "float-placement-figure", Type: TemplateVarString, Description: "图片浮动位置（如 H、htbp）", Default: "H"},
+			// 字体和排版
+			{Name: "mainfont", Type: TemplateVarString, Description: "正文字体"},
+			{Name: "sansfont", Type: TemplateVarString, Description: "无衬线字体"},
+			{Name: "monofont", Type: TemplateVarString, Description: "等宽字体"},
+			{Name: "CJKmainfont", Type: TemplateVarString, Description: "中文字体"},
+			{Name: "fontsize", Type: TemplateVarEnum, Description: "正文字号", Values: []string{"10pt", "11pt", "12pt"}},
+			{Name: "linestretch", Type: TemplateVarNumber, Description: "行间距倍数", Min: schemaBound(0.5), Max: schemaBound(3)},
+			{Name: "indent", Type: TemplateVarBoolean, Description: "段落首行缩进（关闭时用段间距分隔）", Default: "false"},
+			{Name: "lang", Type: TemplateVarString, Description: "文档语言（如 zh-CN）"},
+			// 目录和编号
+			{Name: "toc-own-page", Type: TemplateVarBoolean, Description: "目录单独一页", Default: "false"},
+			{Name: "secnumdepth", Type: TemplateVarNumber, Description: "章节编号深度", Min: schemaBound(0), Max: schemaBound(5)},
+			// 页眉页脚
+			{Name: "disable-header-and-footer", Type: TemplateVarBoolean, Description: "不显示页眉页脚", Default: "false"},
+			{Name: "header-left", Type: TemplateVarString, Description: "左页眉（默认为标题）"},
+			{Name: "header-center", Type: TemplateVarString, Description: "中页眉"},
+			{Name: "header-right", Type: TemplateVarString, Description: "右页眉（默认为日期）"},
+			{Name: "footer-left", Type: TemplateVarString, Description: "左页脚（默认为作者）"},
+			{Name: "footer-center", Type: TemplateVarString, Description: "中页脚"},
+			{Name: "footer-right", Type: TemplateVarString, Description: "右页脚（默认为页码）"},
+			// 表格和代码
+			{Name: "table-use-row-colors", Type: TemplateVarBoolean, Description: "表格隔行着色", Default: "true"},
+			{Name: "listings", Type: TemplateVarBoolean, Description: "使用 listings 排版代码块", Default: "false"},
+			{Name: "listings-disable-line-numbers", Type: TemplateVarBoolean, Description: "代码块不显示行号", Default: "false"},
+			{Name: "listings-no-page-break", Type: TemplateVarBoolean, Description: "代码块不跨页", Default: "false"},
+			{Name: "code-block-font-size", Type: TemplateVarEnum, Description: "代码块字号（LaTeX 字号命令）", Values: []string{`\tiny`, `\scriptsize`, `\footnotesize`, `\small`, `\normalsize`, `\large`}},
+			// 脚注和链接
+			{Name: "footnotes-pretty", Type: TemplateVarBoolean, Description: "美化脚注", Default: "false"},
+			{Name: "footnotes-disable-backlinks", Type: TemplateVarBoolean, Description: "脚注不显示返回链接", Default: "false"},
+			{Name: "colorlinks", Type: TemplateVarBoolean, Description: "彩色链接", Default: "false"},
+			{Name: "linkcolor", Type: TemplateVarColor, Description: "内部链接颜色"},
+			{Name: "urlcolor", Type: TemplateVarColor, Description: "URL 颜色"},
+			{Name: "toccolor", Type: TemplateVarColor, Description: "目录链接颜色"},
+		},
+	},
+	{
+		Template:    "docx",
+		Format:      "word",
+		Flag:        "-M",
+		Description: "Word 输出（Pandoc docx 写入器，样式来自参考模板）",
+		Variables: []TemplateVariable{
+			{Name: "lang", Type: TemplateVarString, Description: "文档语言（如 zh-CN，影响拼写检查）"},
+			{Name: "toc-title", Type: TemplateVarString, Description: "目录标题", Default: "Table of Contents"},
+			{Name: "abstract", Type: TemplateVarString, Description: "摘要"},
+			{Name: "abstract-title", Type: TemplateVarString, Description: "摘要标题", Default: "Abstract"},
+			{Name: "subject", Type: TemplateVarString, Description: "文档属性：主题"},
+			{Name: "keywords", Type: TemplateVarString, Description: "文档属性：关键词"},
+			{Name: "description", Type: TemplateVarString, Description: "文档属性：备注"},
+			{Name: "category", Type: TemplateVarString, Description: "文档属性：类别"},
+		},
+	},
+}
+
+// TemplateCatalogs 返回所有输出模板的变量目录
+func TemplateCatalogs() []TemplateCatalog {
+	return templateCatalogs
+}
+
+// FindTemplateCatalog 按模板名称或输出格式查找变量目录
+func FindTemplateCatalog(name string) (*TemplateCatalog, bool) {
+	for i := range templateCatalogs {
+		if templateCatalogs[i].Template == name || templateCatalogs[i].Format == name {
+			return &templateCatalogs[i], true
+		}
+	}
+	return nil, false
+}
+
+// FilterTemplateVars 只保留输出格式对应模板支持的变量，返回保留的变量和忽略的变量名
+// 同一个配置会分别构建 PDF 和 Word，其他模板的变量不传给 Pandoc（如 Eisvogel 的封面变量不作为 Word 元数据）
+func FilterTemplateVars(format string, vars map[string]interface{}) (map[string]interface{}, []string) {
+	catalog, ok := FindTemplateCatalog(format)
+	if !ok || len(vars) == 0 {
+		return vars, nil
+	}
+	known := make(map[string]bool, len(catalog.Variables))
+	for _, v := range catalog.Variables {
+		known[v.Name] = true
+	}
+	kept := make(map[string]interface{})
+	var skipped []string
+	for name, value := range vars {
+		if known[name] {
+			kept[name] = value
+		} else {
+			skipped = append(skipped, name)
+		}
+	}
+	sort.Strings(skipped)
+	return kept, skipped
+}
+
+// templateVariablesSchema 生成 template_variables 的 Schema（所有模板变量的并集，构建时再按输出格式筛选）
+func templateVariablesSchema() map[string]interface{} {
+	props := make(map[string]interface{})
+	for _, catalog := range templateCatalogs {
+		for _, v := range catalog.Variables {
+			if _, ok := props[v.Name]; ok {
+				continue
+			}
+			props[v.Name] = templateVariableSchema(v)
+		}
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"description":          "传给输出模板的变量：PDF 用 -V，Word 用 -M（可用变量见 /api/template-variables）",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+// templateVariableSchema 单个模板变量的 Schema
+func templateVariableSchema(v TemplateVariable) map[string]interface{} {
+	schema := map[string]interface{}{"description": v.Description}
+	switch v.Type {
+	case TemplateVarBoolean:
+		schema["type"] = "boolean"
+	case TemplateVarNumber:
+		schema["type"] = "number"
+		if v.Min != nil {
+			schema["minimum"] = *v.Min
+		}
+		if v.Max != nil {
+			schema["maximum"] = *v.Max
+		}
+	case TemplateVarColor:
+		schema["type"] = "string"
+		schema["pattern"] = hexColorRule.pattern
+		schema["x-hint"] = hexColorRule.hint
+	case TemplateVarEnum:
+		values := make([]interface{}, len(v.Values))
+		for i, value := range v.Values {
+			values[i] = value
+		}
+		schema["type"] = "string"
+		schema["enum"] = values
+	case TemplateVarPath:
+		schema["type"] = "string"
+		schema["pattern"] = templatePathRule.pattern
+		schema["x-hint"] = templatePathRule.hint
+	default:
+		schema["type"] = "string"
+		schema["pattern"] = templateStringRule.pattern
+		schema["x-hint"] = templateStringRule.hint
+	}
+	return schema
+}
@@ -0,0 +1,372 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenKind API 令牌类型
+type TokenKind string
+
+const (
+	TokenKindPersonal TokenKind = "personal" // 个人令牌：权限不超过创建者，创建者被删除后失效
+	TokenKindService  TokenKind = "service"  // 服务令牌：用于 CI 等机器客户端，只有管理员可以创建
+)
+
+// TokenScope 令牌权限范围
+type TokenScope string
+
+const (
+	ScopeConfigRead  TokenScope = "config:read"  // 查看客户、配置、模块和变量
+	ScopeConfigWrite TokenScope = "config:write" // 创建和修改客户配置
+	ScopeBuildRead   TokenScope = "build:read"   // 下载生成的文档
+	ScopeBuildWrite  TokenScope = "build:write"  // 生成文档
+	ScopeEditorWrite TokenScope = "editor:write" // 编辑 src 中的模块和图片
+	ScopeGitRead     TokenScope = "git:read"     // 查看 Git 状态和历史
+	ScopeGitWrite    TokenScope = "git:write"    // 暂存和提交
+	ScopeGitPush     TokenScope = "git:push"     // 推送和拉取
+	ScopeAdmin       TokenScope = "admin"        // 管理接口（用户、资源、锁定等）
+)
+
+// TokenScopes 所有权限范围及需要的最低角色
+var TokenScopes = map[TokenScope]Role{
+	ScopeConfigRead:  RoleViewer,
+	ScopeConfigWrite: RoleAuthor,
+	ScopeBuildRead:   RoleViewer,
+	ScopeBuildWrite:  RoleBuilder,
+	ScopeEditorWrite: RoleAuthor,
+	ScopeGitRead:     RoleViewer,
+	ScopeGitWrite:    RoleAuthor,
+	ScopeGitPush:     RoleBuilder,
+	ScopeAdmin:       RoleAdmin,
+}
+
+const (
+	tokenPrefix          = "dgt_"
+	defaultTokenLifetime = 90
+	maxTokenLifetime     = 365
+	tokenUsageInterval   = time.Minute
+)
+
+// APIToken API 令牌（不含令牌本身，只保存哈希）
+type APIToken struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	Kind       TokenKind    `json:"kind"`
+	Owner      string       `json:"owner"` // 创建者
+	Scopes     []TokenScope `json:"scopes"`
+	Clients    []string     `json:"clients,omitempty"` // 可访问的客户目录，为空时与创建者相同（服务令牌为全部）
+	Hint       string       `json:"hint"`              // 令牌开头几位，便于识别
+	CreatedAt  time.Time    `json:"createdAt"`
+	ExpiresAt  time.Time    `json:"expiresAt"`
+	LastUsedAt *time.Time   `json:"lastUsedAt,omitempty"`
+}
+
+// HasScope 是否具有权限范围（admin 包含全部）
+func (t *APIToken) HasScope(scope TokenScope) bool {
+	for _, s := range t.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired 是否已过期
+func (t *APIToken) Expired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+// tokenRecord 保存在令牌文件中的记录
+type tokenRecord struct {
+	APIToken
+	Hash string `json:"hash"` // SHA-256
+}
+
+// TokenInput 创建令牌的参数
+type TokenInput struct {
+	Name          string       `json:"name"`
+	Kind          TokenKind    `json:"kind"`
+	Scopes        []TokenScope `json:"scopes"`
+	Clients       []string     `json:"clients"`
+	ExpiresInDays int          `json:"expiresInDays"` // 有效天数，默认 90，最长 365
+}
+
+// TokenService API 令牌
+// 令牌只在创建时返回一次，文件中只保存 SHA-256 哈希
+type TokenService struct {
+	tokensPath string
+	users      *UserService
+	mu         sync.Mutex
+	tokens     map[string]*tokenRecord // 按哈希索引
+	lastSaved  time.Time
+}
+
+// NewTokenService 创建令牌服务
+func NewTokenService(tokensPath string, users *UserService) (*TokenService, error) {
+	s := &TokenService{
+		tokensPath: tokensPath,
+		users:      users,
+		tokens:     make(map[string]*tokenRecord),
+	}
+	data, err := os.ReadFile(tokensPath)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取令牌文件失败: %w", err)
+	}
+	var file struct {
+		Tokens []*tokenRecord `json:"tokens"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析令牌文件失败: %w", err)
+	}
+	for _, t := range file.Tokens {
+		s.tokens[t.Hash] = t
+	}
+	return s, nil
+}
+
+// save 写入令牌文件（调用方持有锁）
+func (s *TokenService) save() error {
+	var file struct {
+		Tokens []*tokenRecord `json:"tokens"`
+	}
+	file.Tokens = make([]*tokenRecord, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		file.Tokens = append(file.Tokens, t)
+	}
+	sort.Slice(file.Tokens, func(i, j int) bool {
+		return file.Tokens[i].CreatedAt.Before(file.Tokens[j].CreatedAt)
+	})
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := s.tokensPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("写入令牌文件失败: %w", err)
+	}
+	s.lastSaved = time.Now()
+	return os.Rename(tmpPath, s.tokensPath)
+}
+
+// CreateToken 为 creator 创建令牌，返回令牌明文（只返回这一次）
+func (s *TokenService) CreateToken(creator *User, input TokenInput) (string, *APIToken, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" || len([]rune(input.Name)) > 64 {
+		return "", nil, fmt.Errorf("令牌名称不能为空，最长 64 个字符")
+	}
+	if input.Kind == "" {
+		input.Kind = TokenKindPersonal
+	}
+	if input.Kind != TokenKindPersonal && input.Kind != TokenKindService {
+		return "", nil, fmt.Errorf("未知的令牌类型: %s", input.Kind)
+	}
+	if input.Kind == TokenKindService && !creator.Role.Allows(RoleAdmin) {
+		return "", nil, fmt.Errorf("只有管理员可以创建服务令牌")
+	}
+	if len(input.Scopes) == 0 {
+		return "", nil, fmt.Errorf("至少选择一个权限范围")
+	}
+	scopes := make([]TokenScope, 0, len(input.Scopes))
+	seen := make(map[TokenScope]bool)
+	for _, scope := range input.Scopes {
+		role, ok := TokenScopes[scope]
+		if !ok {
+			return "", nil, fmt.Errorf("未知的权限范围: %s", scope)
+		}
+		if !creator.Role.Allows(role) {
+			return "", nil, fmt.Errorf("权限范围 %s 需要 %s 角色", scope, role)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	clients, err := s.users.checkClients(input.Clients)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, c := range clients {
+		if !creator.CanAccessClient(c) {
+			return "", nil, fmt.Errorf("无权访问客户: %s", c)
+		}
+	}
+	if input.ExpiresInDays == 0 {
+		input.ExpiresInDays = defaultTokenLifetime
+	}
+	if input.ExpiresInDays < 1 || input.ExpiresInDays > maxTokenLifetime {
+		return "", nil, fmt.Errorf("有效天数必须在 1..%d 之间", maxTokenLifetime)
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+	id, err := randomHex(6)
+	if err != nil {
+		return "", nil, err
+	}
+	token := tokenPrefix + secret
+	now := time.Now()
+	record := &tokenRecord{
+		APIToken: APIToken{
+			ID:        id,
+			Name:      input.Name,
+			Kind:      input.Kind,
+			Owner:     creator.Username,
+			Scopes:    scopes,
+			Clients:   clients,
+			Hint:      token[:len(tokenPrefix)+6],
+			CreatedAt: now,
+			ExpiresAt: now.AddDate(0, 0, input.ExpiresInDays),
+		},
+		Hash: hashToken(token),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[record.Hash] = record
+	if err := s.save(); err != nil {
+		delete(s.tokens, record.Hash)
+		return "", nil, err
+	}
+	log.Printf("[TokenService] %s 创建了%s令牌 %s（%s，权限: %v）", creator.Username, tokenKindName(input.Kind), input.Name, id, scopes)
+	result := record.APIToken
+	return token, &result, nil
+}
+
+// ListTokens 列出令牌，owner 为空时列出全部
+func (s *TokenService) ListTokens(owner string) []APIToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := []APIToken{}
+	for _, t := range s.tokens {
+		if owner == "" || t.Owner == owner {
+			tokens = append(tokens, t.APIToken)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+	return tokens
+}
+
+// RevokeToken 吊销令牌；owner 不为空时只能吊销自己创建的令牌
+func (s *TokenService) RevokeToken(id, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, t := range s.tokens {
+		if t.ID != id {
+			continue
+		}
+		if owner != "" && t.Owner != owner {
+			break
+		}
+		delete(s.tokens, hash)
+		if err := s.save(); err != nil {
+			s.tokens[hash] = t
+			return err
+		}
+		log.Printf("[TokenService] 已吊销令牌 %s（%s）", t.Name, id)
+		return nil
+	}
+	return fmt.Errorf("令牌不存在: %s", id)
+}
+
+// Authenticate 校验令牌，返回令牌信息和以令牌身份访问时的用户
+// 个人令牌的用户为创建者（客户范围取令牌和创建者的交集），服务令牌的用户为 "service:令牌名称"
+func (s *TokenService) Authenticate(token string) (*APIToken, *User, bool) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return nil, nil, false
+	}
+	s.mu.Lock()
+	record, ok := s.tokens[hashToken(token)]
+	if ok && !record.Expired() {
+		now := time.Now()
+		record.LastUsedAt = &now
+		// 使用时间不需要实时保存，避免 CI 频繁调用时反复写文件
+		if now.Sub(s.lastSaved) > tokenUsageInterval {
+			if err := s.save(); err != nil {
+				log.Printf("[TokenService] 保存令牌使用时间失败: %v", err)
+			}
+		}
+	}
+	s.mu.Unlock()
+	if !ok || record.Expired() {
+		return nil, nil, false
+	}
+	info := record.APIToken
+
+	if info.Kind == TokenKindService {
+		user := &User{
+			Username:  "service:" + info.Name,
+			Role:      scopesRole(info.Scopes),
+			Clients:   info.Clients,
+			CreatedAt: info.CreatedAt,
+		}
+		return &info, user, true
+	}
+
+	user, ok := s.users.GetUser(info.Owner)
+	if !ok {
+		return nil, nil, false
+	}
+	if len(info.Clients) > 0 {
+		var clients []string
+		for _, c := range info.Clients {
+			if user.CanAccessClient(c) {
+				clients = append(clients, c)
+			}
+		}
+		if len(clients) == 0 {
+			// 创建者已失去这些客户的权限
+			return nil, nil, false
+		}
+		user.Clients = clients
+	}
+	return &info, user, true
+}
+
+// scopesRole 权限范围对应的最高角色（服务令牌的角色）
+func scopesRole(scopes []TokenScope) Role {
+	role := RoleViewer
+	for _, scope := range scopes {
+		if r := TokenScopes[scope]; r.Allows(role) {
+			role = r
+		}
+	}
+	return role
+}
+
+func tokenKindName(kind TokenKind) string {
+	if kind == TokenKindService {
+		return "服务"
+	}
+	return "个人"
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
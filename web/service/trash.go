@@ -0,0 +1,434 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trashDirName 回收站目录（位于工作目录）
+const trashDirName = ".trash"
+
+// trashItemFile 回收站条目的元数据文件名，被删除的文件保存在条目目录的 files/ 下（保持相对于工作目录的路径）
+const trashItemFile = "item.json"
+
+// 回收站条目类型
+const (
+	TrashModule   = "module"
+	TrashImage    = "image"
+	TrashConfig   = "config"
+	TrashFont     = "font"
+	TrashTemplate = "template"
+)
+
+// 恢复时目标已存在的处理方式
+const (
+	RestoreFail      = "fail"      // 返回冲突，不做修改
+	RestoreOverwrite = "overwrite" // 把现有文件移入回收站后恢复
+	RestoreRename    = "rename"    // 恢复为新的文件名（只支持单个文件的条目）
+)
+
+var (
+	ErrTrashNotFound    = errors.New("回收站中没有该条目")
+	ErrTrashRenameMulti = errors.New("包含多个文件的条目不能重命名恢复")
+	ErrTrashInvalidMode = errors.New("无效的冲突处理方式")
+	ErrTrashOutsideWork = errors.New("只能把工作目录中的文件移入回收站")
+)
+
+// TrashItem 回收站中的一次删除
+type TrashItem struct {
+	ID           string    `json:"id"`
+	Kind         string    `json:"kind"`         // module、image、config、font、template
+	Name         string    `json:"name"`         // 显示名称（模块和图片为相对于 src/ 的路径，配置为 客户/文档类型，资源为文件名）
+	OriginalPath string    `json:"originalPath"` // 主文件相对于工作目录的路径
+	Files        []string  `json:"files"`        // 删除的所有文件和目录（相对于工作目录）
+	Size         int64     `json:"size"`
+	DeletedBy    string    `json:"deletedBy,omitempty"`
+	DeletedAt    time.Time `json:"deletedAt"`
+}
+
+// Client 配置条目所属的客户
+func (item *TrashItem) Client() string {
+	if item.Kind != TrashConfig {
+		return ""
+	}
+	return strings.SplitN(strings.TrimPrefix(item.OriginalPath, "clients/"), "/", 2)[0]
+}
+
+// TrashConflictError 恢复时目标位置已有文件
+type TrashConflictError struct {
+	Item      TrashItem
+	Conflicts []string // 已存在的文件（相对于工作目录）
+}
+
+func (e *TrashConflictError) Error() string {
+	return fmt.Sprintf("恢复位置已存在文件: %s", strings.Join(e.Conflicts, ", "))
+}
+
+// RestoreResult 恢复结果
+type RestoreResult struct {
+	Item        TrashItem  `json:"item"`
+	Files       []string   `json:"files"`                 // 恢复到的位置（相对于工作目录）
+	Overwritten *TrashItem `json:"overwritten,omitempty"` // overwrite 时被移入回收站的现有文件
+}
+
+// TrashService 回收站：删除的模块、图片、配置、字体和模板先移到工作目录的 .trash/ 中，可以恢复或按时间清理
+type TrashService struct {
+	workDir  string
+	trashDir string
+	mu       sync.Mutex
+}
+
+// NewTrashService 创建回收站服务
+func NewTrashService(workDir string) *TrashService {
+	return &TrashService{
+		workDir:  workDir,
+		trashDir: filepath.Join(workDir, trashDirName),
+	}
+}
+
+// MoveToTrash 把文件或目录移入回收站，paths 为绝对路径，第一个为主文件
+func (s *TrashService) MoveToTrash(kind, name string, paths []string, deletedBy string) (*TrashItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.moveToTrashLocked(kind, name, paths, deletedBy)
+}
+
+func (s *TrashService) moveToTrashLocked(kind, name string, paths []string, deletedBy string) (*TrashItem, error) {
+	if len(paths) == 0 {
+		return nil, ErrTrashNotFound
+	}
+	relPaths := make([]string, 0, len(paths))
+	for _, p := range paths {
+		rel, err := s.relPath(p)
+		if err != nil {
+			return nil, err
+		}
+		relPaths = append(relPaths, rel)
+	}
+
+	id, err := randomHex(6)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	id = now.Format("20060102-150405") + "-" + id
+	itemDir := filepath.Join(s.trashDir, id)
+	item := &TrashItem{
+		ID:           id,
+		Kind:         kind,
+		Name:         name,
+		OriginalPath: relPaths[0],
+		DeletedBy:    deletedBy,
+		DeletedAt:    now,
+	}
+
+	for i, rel := range relPaths {
+		dest := filepath.Join(itemDir, "files", filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return nil, fmt.Errorf("创建回收站目录失败: %w", err)
+		}
+		item.Size += pathSize(paths[i])
+		if err := movePath(paths[i], dest); err != nil {
+			// 已经移动的文件放回原处，避免一半在回收站
+			for j := i - 1; j >= 0; j-- {
+				movePath(filepath.Join(itemDir, "files", filepath.FromSlash(relPaths[j])), paths[j])
+			}
+			os.RemoveAll(itemDir)
+			return nil, fmt.Errorf("移入回收站失败: %w", err)
+		}
+		item.Files = append(item.Files, rel)
+	}
+
+	if err := s.writeItem(item); err != nil {
+		return nil, err
+	}
+	log.Printf("[Trash] %s 删除了 %s: %s（%s）", deletedBy, kind, name, id)
+	return item, nil
+}
+
+// List 列出回收站中的条目，最近删除的在前
+func (s *TrashService) List() ([]TrashItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.trashDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []TrashItem{}, nil
+		}
+		return nil, fmt.Errorf("读取回收站失败: %w", err)
+	}
+	items := make([]TrashItem, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		item, err := s.readItem(entry.Name())
+		if err != nil {
+			log.Printf("[Trash] 跳过无法读取的条目 %s: %v", entry.Name(), err)
+			continue
+		}
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	return items, nil
+}
+
+// Get 返回回收站条目
+func (s *TrashService) Get(id string) (*TrashItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readItem(id)
+}
+
+// Restore 把条目恢复到原来的位置
+// 目标已存在时按 mode 处理：fail 返回 *TrashConflictError，overwrite 先把现有文件移入回收站，rename 恢复为新的文件名
+func (s *TrashService) Restore(id, mode, restoredBy string) (*RestoreResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, err := s.readItem(id)
+	if err != nil {
+		return nil, err
+	}
+	if mode == "" {
+		mode = RestoreFail
+	}
+	if mode != RestoreFail && mode != RestoreOverwrite && mode != RestoreRename {
+		return nil, ErrTrashInvalidMode
+	}
+
+	targets := make([]string, len(item.Files))
+	copy(targets, item.Files)
+	var conflicts []string
+	for _, rel := range targets {
+		if _, err := os.Stat(filepath.Join(s.workDir, filepath.FromSlash(rel))); err == nil {
+			conflicts = append(conflicts, rel)
+		}
+	}
+
+	result := &RestoreResult{Item: *item}
+	if len(conflicts) > 0 {
+		switch mode {
+		case RestoreFail:
+			return nil, &TrashConflictError{Item: *item, Conflicts: conflicts}
+		case RestoreRename:
+			if len(targets) != 1 {
+				return nil, ErrTrashRenameMulti
+			}
+			targets[0] = s.freePath(targets[0])
+		case RestoreOverwrite:
+			existing := make([]string, 0, len(conflicts))
+			for _, rel := range conflicts {
+				existing = append(existing, filepath.Join(s.workDir, filepath.FromSlash(rel)))
+			}
+			overwritten, err := s.moveToTrashLocked(item.Kind, item.Name, existing, restoredBy)
+			if err != nil {
+				return nil, err
+			}
+			result.Overwritten = overwritten
+		}
+	}
+
+	itemDir := filepath.Join(s.trashDir, id)
+	for i, rel := range item.Files {
+		src := filepath.Join(itemDir, "files", filepath.FromSlash(rel))
+		dest := filepath.Join(s.workDir, filepath.FromSlash(targets[i]))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return nil, fmt.Errorf("创建目录失败: %w", err)
+		}
+		if err := movePath(src, dest); err != nil {
+			return nil, fmt.Errorf("恢复 %s 失败: %w", rel, err)
+		}
+	}
+	if err := os.RemoveAll(itemDir); err != nil {
+		log.Printf("[Trash] 警告: 删除回收站条目目录失败: %v", err)
+	}
+	result.Files = targets
+	log.Printf("[Trash] %s 恢复了 %s: %s（%s）", restoredBy, item.Kind, item.Name, id)
+	return result, nil
+}
+
+// Purge 永久删除回收站条目
+func (s *TrashService) Purge(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.readItem(id); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(s.trashDir, id)); err != nil {
+		return fmt.Errorf("清理回收站失败: %w", err)
+	}
+	return nil
+}
+
+// PurgeOlderThan 永久删除早于 age 的条目（age 为 0 时清空回收站），keep 返回 false 的条目不删除，返回删除的条目
+func (s *TrashService) PurgeOlderThan(age time.Duration, keep func(TrashItem) bool) ([]TrashItem, error) {
+	items, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := time.Now().Add(-age)
+	purged := []TrashItem{}
+	for _, item := range items {
+		if item.DeletedAt.After(cutoff) || (keep != nil && !keep(item)) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.trashDir, item.ID)); err != nil {
+			return purged, fmt.Errorf("清理回收站失败: %w", err)
+		}
+		purged = append(purged, item)
+	}
+	return purged, nil
+}
+
+// relPath 绝对路径转为相对于工作目录的路径（使用 /）
+func (s *TrashService) relPath(path string) (string, error) {
+	absWork, err := filepath.Abs(s.workDir)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absWork, absPath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") || strings.HasPrefix(rel, trashDirName) {
+		return "", ErrTrashOutsideWork
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// freePath 在文件名后加上 -恢复、-恢复2 …… 直到不与现有文件冲突
+func (s *TrashService) freePath(rel string) string {
+	ext := filepath.Ext(rel)
+	base := strings.TrimSuffix(rel, ext)
+	for n := 1; ; n++ {
+		suffix := "-恢复"
+		if n > 1 {
+			suffix = fmt.Sprintf("-恢复%d", n)
+		}
+		candidate := base + suffix + ext
+		if _, err := os.Stat(filepath.Join(s.workDir, filepath.FromSlash(candidate))); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// readItem 读取条目的元数据（调用方需持有锁）
+func (s *TrashService) readItem(id string) (*TrashItem, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return nil, ErrTrashNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.trashDir, id, trashItemFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrTrashNotFound
+		}
+		return nil, err
+	}
+	var item TrashItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, fmt.Errorf("解析回收站条目失败: %w", err)
+	}
+	return &item, nil
+}
+
+// writeItem 保存条目的元数据（调用方需持有锁）
+func (s *TrashService) writeItem(item *TrashItem) error {
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.trashDir, item.ID, trashItemFile), data, 0644); err != nil {
+		return fmt.Errorf("保存回收站条目失败: %w", err)
+	}
+	return nil
+}
+
+// movePath 移动文件或目录，不能直接重命名（如跨文件系统）时复制后删除
+func movePath(src, dest string) error {
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+	if err := copyPath(src, dest); err != nil {
+		os.RemoveAll(dest)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// copyPath 递归复制文件或目录
+func copyPath(src, dest string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		in, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	}
+	if err := os.MkdirAll(dest, info.Mode().Perm()); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := copyPath(filepath.Join(src, entry.Name()), filepath.Join(dest, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pathSize 文件或目录的总大小
+func pathSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// discard 把文件移入回收站；没有设置回收站时（s 为 nil）直接删除
+func (s *TrashService) discard(kind, name string, paths []string, deletedBy string) (*TrashItem, error) {
+	if s == nil {
+		for _, p := range paths {
+			if err := os.RemoveAll(p); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+	return s.MoveToTrash(kind, name, paths, deletedBy)
+}
@@ -0,0 +1,472 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// upstreamFile 记录客户配置来源的文件（clients/<客户>/.upstream）
+// 不使用 .yaml 扩展名，避免被当作文档类型配置
+const upstreamFile = ".upstream"
+
+// 上游变更类型
+const (
+	UpstreamModuleAdded   = "moduleAdded"   // 标准配置新增了模块
+	UpstreamModuleRemoved = "moduleRemoved" // 标准配置删除了模块
+	UpstreamPdfOption     = "pdfOption"     // 标准配置修改了 PDF 选项
+)
+
+// UpstreamRecord 客户配置的来源记录
+// Modules 和 PdfOptions 是最近一次同步时标准配置的快照，用于区分标准配置的更新和客户自己的修改
+type UpstreamRecord struct {
+	Source     string                 `json:"source" yaml:"source"` // 标准配置（客户/文档类型，如 标准文档/运维手册）
+	ClonedAt   time.Time              `json:"clonedAt" yaml:"cloned_at"`
+	SyncedAt   time.Time              `json:"syncedAt" yaml:"synced_at"`
+	Modules    []ModuleEntry          `json:"modules" yaml:"modules"`
+	PdfOptions map[string]interface{} `json:"pdfOptions,omitempty" yaml:"pdf_options,omitempty"`
+}
+
+// UpstreamChange 标准配置自上次同步以来的一处变更
+type UpstreamChange struct {
+	ID          string      `json:"id"`                    // 变更标识，拉取时使用（如 module+:src/05-备份.md、pdf:mainfont）
+	Kind        string      `json:"kind"`                  // moduleAdded / moduleRemoved / pdfOption
+	Module      string      `json:"module,omitempty"`      // 模块路径
+	Option      string      `json:"option,omitempty"`      // PDF 选项名
+	Old         interface{} `json:"old,omitempty"`         // 上次同步时标准配置中的值
+	New         interface{} `json:"new,omitempty"`         // 当前标准配置中的值
+	ClientValue interface{} `json:"clientValue,omitempty"` // 客户配置中的当前值
+	Applied     bool        `json:"applied"`               // 客户配置已经与标准配置一致
+}
+
+// ConfigDrift 客户配置与标准配置的差异
+type ConfigDrift struct {
+	Client   string           `json:"client"`
+	DocType  string           `json:"docType"`
+	Source   string           `json:"source"`
+	ClonedAt time.Time        `json:"clonedAt"`
+	SyncedAt time.Time        `json:"syncedAt"`
+	Outdated bool             `json:"outdated"` // 有未拉取的标准配置变更
+	Pending  int              `json:"pending"`  // 未拉取的变更数量
+	Changes  []UpstreamChange `json:"changes"`
+	Error    string           `json:"error,omitempty"` // 标准配置无法读取时的错误
+	Diff     string           `json:"diff,omitempty"`  // 拉取变更后配置文件的变化（统一 diff 格式）
+}
+
+// RecordUpstream 记录客户配置的来源，并保存标准配置的当前快照
+func (m *ConfigManager) RecordUpstream(clientName, docTypeName, source string) error {
+	sourceClient, sourceDoc, err := splitConfigName(source)
+	if err != nil {
+		return err
+	}
+	if sourceClient == clientName && sourceDoc == docTypeName {
+		return fmt.Errorf("配置不能以自身为来源")
+	}
+	if _, err := os.Stat(m.configFilePath(clientName, docTypeName)); os.IsNotExist(err) {
+		return fmt.Errorf("配置不存在: %s/%s", clientName, docTypeName)
+	}
+	upstream, err := m.GetConfig(sourceClient, sourceDoc)
+	if err != nil {
+		return fmt.Errorf("读取标准配置失败: %w", err)
+	}
+
+	records, err := m.readUpstreamRecords(clientName)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	record := &UpstreamRecord{
+		Source:     sourceClient + "/" + sourceDoc,
+		ClonedAt:   now,
+		SyncedAt:   now,
+		Modules:    upstream.Modules,
+		PdfOptions: pdfOptionsMap(upstream.PdfOptions),
+	}
+	if existing, ok := records[docTypeName]; ok && existing.Source == record.Source {
+		record.ClonedAt = existing.ClonedAt
+	}
+	records[docTypeName] = record
+	return m.writeUpstreamRecords(clientName, records)
+}
+
+// GetUpstream 返回客户配置的来源记录（未记录时为 nil）
+func (m *ConfigManager) GetUpstream(clientName, docTypeName string) (*UpstreamRecord, error) {
+	records, err := m.readUpstreamRecords(clientName)
+	if err != nil {
+		return nil, err
+	}
+	return records[docTypeName], nil
+}
+
+// removeUpstream 删除配置的来源记录
+func (m *ConfigManager) removeUpstream(clientName, docTypeName string) error {
+	records, err := m.readUpstreamRecords(clientName)
+	if err != nil || records[docTypeName] == nil {
+		return err
+	}
+	delete(records, docTypeName)
+	return m.writeUpstreamRecords(clientName, records)
+}
+
+// ListUpstreamDrift 列出所有记录了来源的客户配置及其差异
+func (m *ConfigManager) ListUpstreamDrift() ([]ConfigDrift, error) {
+	entries, err := os.ReadDir(m.clientsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []ConfigDrift{}, nil
+		}
+		return nil, fmt.Errorf("读取客户目录失败: %w", err)
+	}
+
+	result := []ConfigDrift{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		records, err := m.readUpstreamRecords(entry.Name())
+		if err != nil || len(records) == 0 {
+			continue
+		}
+		docTypes := make([]string, 0, len(records))
+		for docType := range records {
+			docTypes = append(docTypes, docType)
+		}
+		sort.Strings(docTypes)
+		for _, docType := range docTypes {
+			drift, err := m.UpstreamDrift(entry.Name(), docType)
+			if err != nil {
+				result = append(result, ConfigDrift{
+					Client:  entry.Name(),
+					DocType: docType,
+					Source:  records[docType].Source,
+					Changes: []UpstreamChange{},
+					Error:   err.Error(),
+				})
+				continue
+			}
+			result = append(result, *drift)
+		}
+	}
+	return result, nil
+}
+
+// UpstreamDrift 比较标准配置自上次同步以来的变更，并标出客户配置是否已包含这些变更
+func (m *ConfigManager) UpstreamDrift(clientName, docTypeName string) (*ConfigDrift, error) {
+	record, err := m.GetUpstream(clientName, docTypeName)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("配置没有来源记录: %s/%s", clientName, docTypeName)
+	}
+	cfg, err := m.GetConfig(clientName, docTypeName)
+	if err != nil {
+		return nil, err
+	}
+	sourceClient, sourceDoc, err := splitConfigName(record.Source)
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := m.GetConfig(sourceClient, sourceDoc)
+	if err != nil {
+		return nil, fmt.Errorf("读取标准配置失败: %w", err)
+	}
+
+	drift := &ConfigDrift{
+		Client:   clientName,
+		DocType:  docTypeName,
+		Source:   record.Source,
+		ClonedAt: record.ClonedAt,
+		SyncedAt: record.SyncedAt,
+		Changes:  upstreamChanges(record, upstream, cfg),
+	}
+	for _, change := range drift.Changes {
+		if !change.Applied {
+			drift.Pending++
+		}
+	}
+	drift.Outdated = drift.Pending > 0
+	return drift, nil
+}
+
+// PullUpstream 把选中的标准配置变更应用到客户配置（ids 为空时拉取全部未应用的变更）
+func (m *ConfigManager) PullUpstream(clientName, docTypeName string, ids []string) (*ConfigDrift, error) {
+	drift, err := m.UpstreamDrift(clientName, docTypeName)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+	var changes []UpstreamChange
+	for _, change := range drift.Changes {
+		if len(ids) == 0 || selected[change.ID] {
+			changes = append(changes, change)
+			delete(selected, change.ID)
+		}
+	}
+	for id := range selected {
+		return nil, fmt.Errorf("未找到标准配置变更: %s", id)
+	}
+	if len(changes) == 0 {
+		return drift, nil
+	}
+
+	cfg, err := m.GetConfig(clientName, docTypeName)
+	if err != nil {
+		return nil, err
+	}
+	sourceClient, sourceDoc, _ := splitConfigName(drift.Source)
+	upstream, err := m.GetConfig(sourceClient, sourceDoc)
+	if err != nil {
+		return nil, fmt.Errorf("读取标准配置失败: %w", err)
+	}
+	record, err := m.GetUpstream(clientName, docTypeName)
+	if err != nil {
+		return nil, err
+	}
+
+	clientPdf := pdfOptionsMap(cfg.PdfOptions)
+	for _, change := range changes {
+		switch change.Kind {
+		case UpstreamModuleAdded:
+			if !change.Applied {
+				cfg.Modules = insertUpstreamModule(cfg.Modules, upstream.Modules, change.Module)
+			}
+			record.Modules = insertUpstreamModule(record.Modules, upstream.Modules, change.Module)
+		case UpstreamModuleRemoved:
+			cfg.Modules = removeModuleEntry(cfg.Modules, change.Module)
+			record.Modules = removeModuleEntry(record.Modules, change.Module)
+		case UpstreamPdfOption:
+			if record.PdfOptions == nil {
+				record.PdfOptions = make(map[string]interface{})
+			}
+			if change.New == nil {
+				delete(clientPdf, change.Option)
+				delete(record.PdfOptions, change.Option)
+			} else {
+				if clientPdf == nil {
+					clientPdf = make(map[string]interface{})
+				}
+				clientPdf[change.Option] = change.New
+				record.PdfOptions[change.Option] = change.New
+			}
+		}
+	}
+	if err := m.validateModules(cfg.Modules); err != nil {
+		return nil, err
+	}
+	if clientPdf != nil {
+		cfg.PdfOptions = &PdfOptions{}
+		if err := remarshalYAML(clientPdf, cfg.PdfOptions); err != nil {
+			return nil, err
+		}
+	}
+
+	diff, err := m.saveConfigFile(m.configFilePath(clientName, docTypeName), *cfg)
+	if err != nil {
+		return nil, fmt.Errorf("写入配置文件失败: %w", err)
+	}
+
+	records, err := m.readUpstreamRecords(clientName)
+	if err != nil {
+		return nil, err
+	}
+	record.SyncedAt = time.Now()
+	records[docTypeName] = record
+	if err := m.writeUpstreamRecords(clientName, records); err != nil {
+		return nil, err
+	}
+	result, err := m.UpstreamDrift(clientName, docTypeName)
+	if err != nil {
+		return nil, err
+	}
+	result.Diff = diff
+	return result, nil
+}
+
+// upstreamChanges 计算标准配置相对快照的变更
+func upstreamChanges(record *UpstreamRecord, upstream, cfg *CustomConfig) []UpstreamChange {
+	changes := []UpstreamChange{}
+	baseline := modulePathSet(record.Modules)
+	current := modulePathSet(upstream.Modules)
+	client := modulePathSet(cfg.Modules)
+
+	for _, entry := range upstream.Modules {
+		path := normalizeModulePath(entry.Path)
+		if !baseline[path] {
+			changes = append(changes, UpstreamChange{
+				ID:      "module+:" + path,
+				Kind:    UpstreamModuleAdded,
+				Module:  path,
+				Applied: client[path],
+			})
+		}
+	}
+	for _, entry := range record.Modules {
+		path := normalizeModulePath(entry.Path)
+		if !current[path] {
+			changes = append(changes, UpstreamChange{
+				ID:      "module-:" + path,
+				Kind:    UpstreamModuleRemoved,
+				Module:  path,
+				Applied: !client[path],
+			})
+		}
+	}
+
+	upstreamPdf := pdfOptionsMap(upstream.PdfOptions)
+	clientPdf := pdfOptionsMap(cfg.PdfOptions)
+	keys := make(map[string]bool)
+	for key := range record.PdfOptions {
+		keys[key] = true
+	}
+	for key := range upstreamPdf {
+		keys[key] = true
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+	for _, key := range sortedKeys {
+		oldVal, newVal := record.PdfOptions[key], upstreamPdf[key]
+		if reflect.DeepEqual(oldVal, newVal) {
+			continue
+		}
+		changes = append(changes, UpstreamChange{
+			ID:          "pdf:" + key,
+			Kind:        UpstreamPdfOption,
+			Option:      key,
+			Old:         oldVal,
+			New:         newVal,
+			ClientValue: clientPdf[key],
+			Applied:     reflect.DeepEqual(clientPdf[key], newVal),
+		})
+	}
+	return changes
+}
+
+// insertUpstreamModule 按标准配置中的顺序插入模块：放在标准配置中前一个已存在模块的后面
+func insertUpstreamModule(modules, upstream []ModuleEntry, path string) []ModuleEntry {
+	if modulePathSet(modules)[path] {
+		return modules
+	}
+	var entry ModuleEntry
+	insertAt := 0
+	existing := modulePathSet(modules)
+	for _, candidate := range upstream {
+		candidatePath := normalizeModulePath(candidate.Path)
+		if candidatePath == path {
+			entry = candidate
+			break
+		}
+		if existing[candidatePath] {
+			for i, module := range modules {
+				if normalizeModulePath(module.Path) == candidatePath {
+					insertAt = i + 1
+				}
+			}
+		}
+	}
+	if entry.Path == "" {
+		entry = ModuleEntry{Path: path}
+	}
+
+	result := make([]ModuleEntry, 0, len(modules)+1)
+	result = append(result, modules[:insertAt]...)
+	result = append(result, entry)
+	return append(result, modules[insertAt:]...)
+}
+
+// removeModuleEntry 按路径删除模块
+func removeModuleEntry(modules []ModuleEntry, path string) []ModuleEntry {
+	var result []ModuleEntry
+	for _, module := range modules {
+		if normalizeModulePath(module.Path) != path {
+			result = append(result, module)
+		}
+	}
+	return result
+}
+
+// modulePathSet 返回模块路径集合
+func modulePathSet(modules []ModuleEntry) map[string]bool {
+	set := make(map[string]bool, len(modules))
+	for _, module := range modules {
+		set[normalizeModulePath(module.Path)] = true
+	}
+	return set
+}
+
+// pdfOptionsMap 把 PDF 选项转换为键值（键为配置文件中的名称，省略未设置的选项）
+func pdfOptionsMap(opts *PdfOptions) map[string]interface{} {
+	if opts == nil {
+		return nil
+	}
+	var raw map[string]interface{}
+	if err := remarshalYAML(opts, &raw); err != nil {
+		return nil
+	}
+	result := make(map[string]interface{})
+	for key, val := range raw {
+		if val != nil && !reflect.ValueOf(val).IsZero() {
+			result[key] = val
+		}
+	}
+	return result
+}
+
+// splitConfigName 拆分 客户/文档类型
+func splitConfigName(name string) (string, string, error) {
+	parts := strings.Split(strings.Trim(filepath.ToSlash(name), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || parts[0] == ".." || parts[1] == ".." {
+		return "", "", fmt.Errorf("无效的标准配置: %s（格式为 客户/文档类型）", name)
+	}
+	return parts[0], parts[1], nil
+}
+
+// readUpstreamRecords 读取客户的来源记录（文档类型 -> 记录）
+func (m *ConfigManager) readUpstreamRecords(clientName string) (map[string]*UpstreamRecord, error) {
+	records := make(map[string]*UpstreamRecord)
+	data, err := os.ReadFile(filepath.Join(m.clientsDir, clientName, upstreamFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, nil
+		}
+		return nil, fmt.Errorf("读取来源记录失败: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("解析来源记录失败: %w", err)
+	}
+	if records == nil {
+		records = make(map[string]*UpstreamRecord)
+	}
+	return records, nil
+}
+
+// writeUpstreamRecords 保存客户的来源记录
+func (m *ConfigManager) writeUpstreamRecords(clientName string, records map[string]*UpstreamRecord) error {
+	path := filepath.Join(m.clientsDir, clientName, upstreamFile)
+	if len(records) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := yaml.Marshal(records)
+	if err != nil {
+		return err
+	}
+	content := "# 配置来源记录（自动生成，请勿手动修改）\n" + string(data)
+	return os.WriteFile(path, []byte(content), 0644)
+}
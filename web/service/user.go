@@ -0,0 +1,559 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Role 用户角色，后面的角色包含前面角色的全部权限
+type Role string
+
+const (
+	RoleViewer  Role = "viewer"  // 查看配置、模块和已生成的文档
+	RoleAuthor  Role = "author"  // 编辑模块、配置和变量，提交 Git 变更
+	RoleBuilder Role = "builder" // 生成文档，推送和拉取 Git
+	RoleAdmin   Role = "admin"   // 管理用户、资源、锁定和 Git 远程设置
+)
+
+// roleLevels 角色等级
+var roleLevels = map[Role]int{
+	RoleViewer:  1,
+	RoleAuthor:  2,
+	RoleBuilder: 3,
+	RoleAdmin:   4,
+}
+
+// Roles 所有角色（按权限从低到高）
+var Roles = []Role{RoleViewer, RoleAuthor, RoleBuilder, RoleAdmin}
+
+// Valid 是否为已知角色
+func (r Role) Valid() bool {
+	_, ok := roleLevels[r]
+	return ok
+}
+
+// Allows 该角色是否具有 required 角色的权限
+func (r Role) Allows(required Role) bool {
+	return roleLevels[r] >= roleLevels[required]
+}
+
+const (
+	// SessionCookieName 登录会话 Cookie 名称
+	SessionCookieName = "docgen_session"
+	// SessionTTL 会话有效期
+	SessionTTL = 12 * time.Hour
+
+	passwordMinLength    = 8
+	pbkdf2Iterations     = 120000
+	pbkdf2KeyLength      = 32
+	passwordHashScheme   = "pbkdf2-sha256"
+	bootstrapAdminName   = "admin"
+	defaultAdminPassword = "admin123"
+)
+
+var usernameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{1,31}$`)
+
+// User 用户信息（不含密码）
+type User struct {
+	Username    string    `json:"username"`
+	DisplayName string    `json:"displayName,omitempty"`
+	Role        Role      `json:"role"`
+	Clients     []string  `json:"clients,omitempty"` // 可访问的客户目录，为空时可访问全部客户
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Scoped 是否只能访问部分客户
+func (u *User) Scoped() bool {
+	return len(u.Clients) > 0
+}
+
+// CanAccessClient 是否可以访问客户目录
+func (u *User) CanAccessClient(client string) bool {
+	if !u.Scoped() {
+		return true
+	}
+	for _, c := range u.Clients {
+		if c == client {
+			return true
+		}
+	}
+	return false
+}
+
+// userRecord 保存在用户文件中的记录
+type userRecord struct {
+	User
+	PasswordHash string `json:"passwordHash"`
+}
+
+// UserInput 创建或修改用户的参数，修改时空字段保持不变
+type UserInput struct {
+	Username    string    `json:"username"`
+	DisplayName string    `json:"displayName"`
+	Password    string    `json:"password"`
+	Role        Role      `json:"role"`
+	Clients     *[]string `json:"clients"`
+}
+
+// session 登录会话
+type session struct {
+	username  string
+	expiresAt time.Time
+}
+
+// UserService 本地用户账号和登录会话
+// 用户保存在 JSON 文件中（默认为工作目录的 .users.json），会话只保存在内存里（重启后需要重新登录）
+type UserService struct {
+	usersPath  string
+	clientsDir string
+	mu         sync.RWMutex
+	users      map[string]*userRecord
+	sessions   map[string]*session
+}
+
+// NewUserService 创建用户服务
+// 用户文件不存在时创建 admin 管理员，密码为 adminPassword（不能为空、不能是默认密码 admin123，且要满足密码长度要求）
+func NewUserService(usersPath, clientsDir, adminPassword string) (*UserService, error) {
+	s := &UserService{
+		usersPath:  usersPath,
+		clientsDir: clientsDir,
+		users:      make(map[string]*userRecord),
+		sessions:   make(map[string]*session),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if len(s.users) == 0 {
+		// admin 账号可以管理用户、令牌、Pandoc 参数确认和 Git 推送，不能使用公开的默认密码
+		if adminPassword == "" || adminPassword == defaultAdminPassword {
+			return nil, fmt.Errorf("首次启动需要通过环境变量 ADMIN_PASSWORD 设置 %s 账号的密码（不能使用默认密码 %s）", bootstrapAdminName, defaultAdminPassword)
+		}
+		if err := checkPassword(adminPassword); err != nil {
+			return nil, fmt.Errorf("ADMIN_PASSWORD 不符合要求: %w", err)
+		}
+		hash, err := hashPassword(adminPassword)
+		if err != nil {
+			return nil, err
+		}
+		s.users[bootstrapAdminName] = &userRecord{
+			User:         User{Username: bootstrapAdminName, Role: RoleAdmin, CreatedAt: time.Now()},
+			PasswordHash: hash,
+		}
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+		log.Printf("[UserService] 已创建管理员账号 %s（密码为 ADMIN_PASSWORD）", bootstrapAdminName)
+	}
+	return s, nil
+}
+
+// load 读取用户文件
+func (s *UserService) load() error {
+	data, err := os.ReadFile(s.usersPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取用户文件失败: %w", err)
+	}
+	var file struct {
+		Users []*userRecord `json:"users"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("解析用户文件失败: %w", err)
+	}
+	for _, u := range file.Users {
+		s.users[u.Username] = u
+	}
+	return nil
+}
+
+// save 写入用户文件（调用方持有写锁）
+func (s *UserService) save() error {
+	var file struct {
+		Users []*userRecord `json:"users"`
+	}
+	for _, name := range s.sortedNames() {
+		file.Users = append(file.Users, s.users[name])
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := s.usersPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("写入用户文件失败: %w", err)
+	}
+	return os.Rename(tmpPath, s.usersPath)
+}
+
+func (s *UserService) sortedNames() []string {
+	names := make([]string, 0, len(s.users))
+	for name := range s.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ListUsers 列出所有用户
+func (s *UserService) ListUsers() []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make([]User, 0, len(s.users))
+	for _, name := range s.sortedNames() {
+		users = append(users, s.users[name].User)
+	}
+	return users
+}
+
+// GetUser 获取用户
+func (s *UserService) GetUser(username string) (*User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.users[username]
+	if !ok {
+		return nil, false
+	}
+	user := record.User
+	return &user, true
+}
+
+// CreateUser 创建用户
+func (s *UserService) CreateUser(input UserInput) (*User, error) {
+	if !usernameRegex.MatchString(input.Username) {
+		return nil, fmt.Errorf("用户名无效：2-32 位字母、数字、_、. 或 -，以字母或数字开头")
+	}
+	if input.Role == "" {
+		input.Role = RoleViewer
+	}
+	if !input.Role.Valid() {
+		return nil, fmt.Errorf("未知的角色: %s", input.Role)
+	}
+	if err := checkPassword(input.Password); err != nil {
+		return nil, err
+	}
+	var clients []string
+	if input.Clients != nil {
+		var err error
+		if clients, err = s.checkClients(*input.Clients); err != nil {
+			return nil, err
+		}
+	}
+	hash, err := hashPassword(input.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.users[input.Username]; exists {
+		return nil, fmt.Errorf("用户已存在: %s", input.Username)
+	}
+	record := &userRecord{
+		User: User{
+			Username:    input.Username,
+			DisplayName: strings.TrimSpace(input.DisplayName),
+			Role:        input.Role,
+			Clients:     clients,
+			CreatedAt:   time.Now(),
+		},
+		PasswordHash: hash,
+	}
+	s.users[input.Username] = record
+	if err := s.save(); err != nil {
+		delete(s.users, input.Username)
+		return nil, err
+	}
+	log.Printf("[UserService] 已创建用户 %s（角色: %s）", input.Username, input.Role)
+	user := record.User
+	return &user, nil
+}
+
+// UpdateUser 修改用户的显示名称、角色、可访问客户或密码
+// 修改密码后该用户的所有会话失效
+func (s *UserService) UpdateUser(username string, input UserInput) (*User, error) {
+	if input.Role != "" && !input.Role.Valid() {
+		return nil, fmt.Errorf("未知的角色: %s", input.Role)
+	}
+	var hash string
+	if input.Password != "" {
+		if err := checkPassword(input.Password); err != nil {
+			return nil, err
+		}
+		var err error
+		if hash, err = hashPassword(input.Password); err != nil {
+			return nil, err
+		}
+	}
+	var clients []string
+	if input.Clients != nil {
+		var err error
+		if clients, err = s.checkClients(*input.Clients); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.users[username]
+	if !ok {
+		return nil, fmt.Errorf("用户不存在: %s", username)
+	}
+	updated := *record
+	if input.DisplayName != "" {
+		updated.DisplayName = strings.TrimSpace(input.DisplayName)
+	}
+	if input.Role != "" {
+		updated.Role = input.Role
+	}
+	if input.Clients != nil {
+		updated.Clients = clients
+	}
+	if hash != "" {
+		updated.PasswordHash = hash
+	}
+	if record.Role == RoleAdmin && !record.Scoped() && !(updated.Role == RoleAdmin && !updated.Scoped()) && s.countAdmins() == 1 {
+		return nil, fmt.Errorf("不能修改最后一个管理员的角色或客户范围")
+	}
+	s.users[username] = &updated
+	if err := s.save(); err != nil {
+		s.users[username] = record
+		return nil, err
+	}
+	if hash != "" {
+		s.dropSessions(username)
+	}
+	log.Printf("[UserService] 已修改用户 %s（角色: %s）", username, updated.Role)
+	user := updated.User
+	return &user, nil
+}
+
+// DeleteUser 删除用户及其会话
+func (s *UserService) DeleteUser(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.users[username]
+	if !ok {
+		return fmt.Errorf("用户不存在: %s", username)
+	}
+	if record.Role == RoleAdmin && !record.Scoped() && s.countAdmins() == 1 {
+		return fmt.Errorf("不能删除最后一个管理员")
+	}
+	delete(s.users, username)
+	if err := s.save(); err != nil {
+		s.users[username] = record
+		return err
+	}
+	s.dropSessions(username)
+	log.Printf("[UserService] 已删除用户 %s", username)
+	return nil
+}
+
+// ChangePassword 用户修改自己的密码，需要提供原密码
+func (s *UserService) ChangePassword(username, oldPassword, newPassword string) error {
+	if _, ok := s.Authenticate(username, oldPassword); !ok {
+		return fmt.Errorf("原密码错误")
+	}
+	_, err := s.UpdateUser(username, UserInput{Password: newPassword})
+	return err
+}
+
+// countAdmins 不限客户范围的管理员数量（调用方持有锁）
+func (s *UserService) countAdmins() int {
+	n := 0
+	for _, u := range s.users {
+		if u.Role == RoleAdmin && !u.Scoped() {
+			n++
+		}
+	}
+	return n
+}
+
+// checkClients 检查客户目录是否存在，返回去重后的列表
+func (s *UserService) checkClients(clients []string) ([]string, error) {
+	var result []string
+	seen := make(map[string]bool)
+	for _, c := range clients {
+		c = strings.TrimSpace(c)
+		if c == "" || seen[c] {
+			continue
+		}
+		if strings.ContainsAny(c, `/\`) || c == "." || c == ".." {
+			return nil, fmt.Errorf("客户名称无效: %s", c)
+		}
+		if info, err := os.Stat(filepath.Join(s.clientsDir, c)); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("客户不存在: %s", c)
+		}
+		seen[c] = true
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// Authenticate 校验用户名和密码
+func (s *UserService) Authenticate(username, password string) (*User, bool) {
+	s.mu.RLock()
+	record, ok := s.users[username]
+	s.mu.RUnlock()
+	if !ok {
+		// 用户不存在时也计算一次哈希，避免通过响应时间判断用户名是否存在
+		verifyPassword(password, dummyPasswordHash)
+		return nil, false
+	}
+	if !verifyPassword(password, record.PasswordHash) {
+		return nil, false
+	}
+	user := record.User
+	return &user, true
+}
+
+// Login 校验密码并创建会话，返回会话令牌
+func (s *UserService) Login(username, password string) (string, *User, error) {
+	user, ok := s.Authenticate(username, password)
+	if !ok {
+		log.Printf("[UserService] 登录失败: %s", username)
+		return "", nil, fmt.Errorf("用户名或密码错误")
+	}
+	token, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.mu.Lock()
+	s.pruneSessions()
+	s.sessions[token] = &session{username: username, expiresAt: time.Now().Add(SessionTTL)}
+	s.mu.Unlock()
+	log.Printf("[UserService] 用户登录: %s", username)
+	return token, user, nil
+}
+
+// Logout 结束会话
+func (s *UserService) Logout(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, token)
+}
+
+// SessionUser 返回会话对应的用户，会话不存在或已过期时返回 false
+func (s *UserService) SessionUser(token string) (*User, bool) {
+	if token == "" {
+		return nil, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sess, ok := s.sessions[token]
+	if !ok || time.Now().After(sess.expiresAt) {
+		return nil, false
+	}
+	record, ok := s.users[sess.username]
+	if !ok {
+		return nil, false
+	}
+	user := record.User
+	return &user, true
+}
+
+// dropSessions 删除用户的所有会话（调用方持有写锁）
+func (s *UserService) dropSessions(username string) {
+	for token, sess := range s.sessions {
+		if sess.username == username {
+			delete(s.sessions, token)
+		}
+	}
+}
+
+// pruneSessions 清理过期会话（调用方持有写锁）
+func (s *UserService) pruneSessions() {
+	now := time.Now()
+	for token, sess := range s.sessions {
+		if now.After(sess.expiresAt) {
+			delete(s.sessions, token)
+		}
+	}
+}
+
+// checkPassword 检查密码强度
+func checkPassword(password string) error {
+	if len([]rune(password)) < passwordMinLength {
+		return fmt.Errorf("密码至少需要 %d 个字符", passwordMinLength)
+	}
+	return nil
+}
+
+// dummyPasswordHash 用于用户不存在时的比较
+var dummyPasswordHash = func() string {
+	hash, _ := hashPassword("dummy-password")
+	return hash
+}()
+
+// hashPassword 计算密码哈希，格式为 pbkdf2-sha256$迭代次数$盐$哈希
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := pbkdf2SHA256([]byte(password), salt, pbkdf2Iterations, pbkdf2KeyLength)
+	return fmt.Sprintf("%s$%d$%s$%s", passwordHashScheme, pbkdf2Iterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// verifyPassword 校验密码与哈希是否匹配
+func verifyPassword(password, encoded string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != passwordHashScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	salt, err1 := base64.RawStdEncoding.DecodeString(parts[2])
+	want, err2 := base64.RawStdEncoding.DecodeString(parts[3])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	got := pbkdf2SHA256([]byte(password), salt, iterations, len(want))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// pbkdf2SHA256 PBKDF2-HMAC-SHA256（RFC 8018）
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+	key := make([]byte, 0, blocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u = prf.Sum(u[:0])
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
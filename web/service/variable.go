@@ -2,6 +2,7 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"gopkg.in/yaml.v3"
 )
@@ -67,16 +69,40 @@ type VariablesResponse struct {
 
 // VariableService 变量服务
 type VariableService struct {
-	srcDir string
+	srcDir     string
+	clientsDir string
+	saveLock   sync.Locker // 编辑器的保存锁，重命名变量改写模块时持有（未设置时不加锁）
 }
 
 // NewVariableService 创建变量服务实例
 func NewVariableService(srcDir string) *VariableService {
 	return &VariableService{
 		srcDir: srcDir,
+		// clients 目录与 src 同级（项目根目录下）
+		clientsDir: filepath.Join(filepath.Dir(srcDir), "clients"),
 	}
 }
 
+// SetSaveLock 设置编辑器的保存锁，避免重命名变量时并发保存的模块覆盖改写结果
+func (s *VariableService) SetSaveLock(lock sync.Locker) {
+	s.saveLock = lock
+}
+
+// 全局变量文件名（位于 src 目录下，适用于所有客户）
+const globalVariablesFile = "_variables.yaml"
+
+// 客户变量配置档文件名（位于客户目录下，适用于该客户的所有文档类型）
+const clientVariablesFile = "variables.yaml"
+
+// VariableSources 各层级的变量值来源
+// 解析优先级（低 → 高）：系统默认值（模块声明）→ 全局常量 → 客户配置档 → 文档类型 variables → 请求值
+type VariableSources struct {
+	Global  map[string]interface{} `json:"global,omitempty"`  // src/_variables.yaml
+	Client  map[string]interface{} `json:"client,omitempty"`  // clients/<client>/variables.yaml
+	DocType map[string]interface{} `json:"docType,omitempty"` // 文档类型配置中的 variables 节
+	Request map[string]interface{} `json:"request,omitempty"` // 请求（或命令行）传入的值
+}
+
 // variableNameRegex 变量名正则：字母或下划线开头，后跟字母、数字、下划线或点
 var variableNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.]*$`)
 
@@ -277,6 +303,18 @@ func (s *VariableService) ExtractVariables(modulePaths []string) ([]VariableDecl
 		if len(decls) > 0 {
 			varsByFile[path] = decls
 		}
+
+		// 被引用文件中声明的变量与顶层模块一样参与合并
+		if content, err := os.ReadFile(fullPath); err == nil && HasIncludes(string(content)) {
+			_, included, err := s.ExpandIncludes(string(content), fullPath)
+			if err != nil {
+				log.Printf("[VariableService] 展开引用失败: %s, 错误: %v", path, err)
+				continue
+			}
+			for file, decls := range included {
+				varsByFile[file] = decls
+			}
+		}
 	}
 
 	return s.MergeVariables(varsByFile)
@@ -634,20 +672,107 @@ func (s *VariableService) RenderFile(filePath string, values map[string]interfac
 	return s.RenderContent(string(content), declarations, values)
 }
 
-// ResolveValues 解析变量值（合并默认值、配置值、命令行值）
-func (s *VariableService) ResolveValues(declarations []VariableDeclaration, configValues, cliValues map[string]interface{}) map[string]interface{} {
-	result := make(map[string]interface{})
+// ResolveValues 解析变量值（合并默认值、全局常量、客户配置档、文档类型配置值、请求值）
+// 优先级：请求 > 文档类型 > 客户 > 全局 > 默认值；declarations 为空时不填充默认值（渲染时再使用模块的默认值）
+// 全局或客户变量文件无法读取时返回错误
+func (s *VariableService) ResolveValues(declarations []VariableDeclaration, clientName string, docTypeValues, requestValues map[string]interface{}) (map[string]interface{}, error) {
+	sources, err := s.LoadSources(clientName, docTypeValues, requestValues)
+	if err != nil {
+		return nil, err
+	}
 
+	result := sources.Merge()
 	for _, decl := range declarations {
-		// 优先级：CLI > Config > Default
-		if val, ok := cliValues[decl.Name]; ok {
-			result[decl.Name] = val
-		} else if val, ok := configValues[decl.Name]; ok {
-			result[decl.Name] = val
-		} else if decl.Default != nil {
+		if _, ok := result[decl.Name]; !ok && decl.Default != nil {
 			result[decl.Name] = decl.Default
 		}
 	}
+	return result, nil
+}
 
+// Merge 按优先级合并各层级的变量值（不含模块默认值）
+func (v VariableSources) Merge() map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, layer := range []map[string]interface{}{v.Global, v.Client, v.DocType, v.Request} {
+		for name, val := range layer {
+			result[name] = val
+		}
+	}
 	return result
 }
+
+// LoadSources 加载客户的变量来源（全局常量和客户配置档），并附加文档类型值和请求值
+// 某一层的文件无法读取时仍加载其他层，返回的错误包含所有失败的层
+func (s *VariableService) LoadSources(clientName string, docTypeValues, requestValues map[string]interface{}) (VariableSources, error) {
+	sources := VariableSources{
+		DocType: docTypeValues,
+		Request: requestValues,
+	}
+
+	var errs []error
+	global, err := s.LoadGlobalValues()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	sources.Global = global
+
+	if clientName != "" {
+		client, err := s.LoadClientValues(clientName)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		sources.Client = client
+	}
+
+	return sources, errors.Join(errs...)
+}
+
+// LoadGlobalValues 读取全局变量文件 src/_variables.yaml
+func (s *VariableService) LoadGlobalValues() (map[string]interface{}, error) {
+	return readVariablesFile(filepath.Join(s.srcDir, globalVariablesFile))
+}
+
+// LoadClientValues 读取客户变量配置档 clients/<client>/variables.yaml
+func (s *VariableService) LoadClientValues(clientName string) (map[string]interface{}, error) {
+	return readVariablesFile(filepath.Join(s.clientsDir, clientName, clientVariablesFile))
+}
+
+// GlobalVariablesPath 返回全局变量文件路径
+func (s *VariableService) GlobalVariablesPath() string {
+	return filepath.Join(s.srcDir, globalVariablesFile)
+}
+
+// ClientVariablesPath 返回客户变量配置档路径
+func (s *VariableService) ClientVariablesPath(clientName string) string {
+	return filepath.Join(s.clientsDir, clientName, clientVariablesFile)
+}
+
+// readVariablesFile 读取变量值文件
+// 文件内容为 name: value 形式的映射，也可以放在 variables 节下（与文档类型配置一致）
+func readVariablesFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取变量文件失败: %w", err)
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("解析变量文件失败 %s: %w", filepath.Base(path), err)
+	}
+
+	if nested, ok := values["variables"].(map[string]interface{}); ok && len(values) == 1 {
+		values = nested
+	}
+
+	for name := range values {
+		if !ValidateVariableName(name) {
+			log.Printf("[VariableService] 跳过无效变量名 %s (in %s)", name, path)
+			delete(values, name)
+		}
+	}
+
+	return values, nil
+}
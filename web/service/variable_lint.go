@@ -0,0 +1,343 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// codeRegex 匹配围栏代码块和行内代码（其中的占位符通常是示例，不报未声明）
+var codeRegex = regexp.MustCompile("(?ms)^```.*?^```|`[^`\n]+`")
+
+// 检查问题级别
+const (
+	LintSeverityError   = "error"
+	LintSeverityWarning = "warning"
+)
+
+// 检查问题代码
+const (
+	LintUndeclaredPlaceholder = "UNDECLARED_PLACEHOLDER" // 使用了未声明的占位符
+	LintUnusedVariable        = "UNUSED_VARIABLE"        // 声明了但未使用的变量
+	LintTypeConflict          = "TYPE_CONFLICT"          // 不同模块声明的类型不一致
+	LintOptionsConflict       = "OPTIONS_CONFLICT"       // 不同模块声明的 select 选项不一致
+	LintInvalidSelectDefault  = "INVALID_SELECT_DEFAULT" // select 默认值不在 options 中
+	LintSuspiciousEscape      = "SUSPICIOUS_ESCAPE"      // 可能误转义的占位符
+	LintInvalidFrontMatter    = "INVALID_FRONT_MATTER"   // front-matter 无法解析
+	LintInvalidInclude        = "INVALID_INCLUDE"        // 引用的文件不存在或存在循环引用
+)
+
+// LintIssue 变量检查问题
+type LintIssue struct {
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Variable string `json:"variable"`
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message"`
+}
+
+// String 返回单行描述，用于构建日志
+func (i LintIssue) String() string {
+	location := i.File
+	if i.Line > 0 {
+		location = fmt.Sprintf("%s:%d", i.File, i.Line)
+	}
+	return fmt.Sprintf("[%s] %s: %s (%s)", strings.ToUpper(i.Severity), location, i.Message, i.Code)
+}
+
+// LintResult 变量检查结果
+type LintResult struct {
+	Files    int         `json:"files"`
+	Issues   []LintIssue `json:"issues"`
+	Errors   int         `json:"errors"`
+	Warnings int         `json:"warnings"`
+}
+
+// LintSrc 检查 src 目录下所有 Markdown 模块的变量使用情况
+func (s *VariableService) LintSrc() (*LintResult, error) {
+	var modules []string
+	err := filepath.Walk(s.srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != s.srcDir && (strings.HasPrefix(info.Name(), ".") || ignoredDirs[info.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(strings.ToLower(info.Name()), ".md") {
+			rel, err := filepath.Rel(filepath.Dir(s.srcDir), path)
+			if err == nil {
+				modules = append(modules, filepath.ToSlash(rel))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("扫描 src 目录失败: %w", err)
+	}
+
+	sort.Strings(modules)
+	return s.LintModules(modules)
+}
+
+// LintModules 检查指定模块的变量使用情况
+// 参数: modulePaths - 模块路径（相对于项目根目录，如 "src/01-概述.md"）
+func (s *VariableService) LintModules(modulePaths []string) (*LintResult, error) {
+	workDir := filepath.Dir(s.srcDir)
+	modulePaths = expandModulePatterns(workDir, modulePaths)
+
+	result := &LintResult{Issues: []LintIssue{}}
+	varsByFile := make(map[string][]VariableDeclaration)
+	includedDecls := make(map[string][]VariableDeclaration)
+	contents := make(map[string]string)
+	var files []string
+
+	for _, path := range modulePaths {
+		if !strings.HasSuffix(strings.ToLower(path), ".md") {
+			continue
+		}
+		fullPath := path
+		if !filepath.IsAbs(path) {
+			fullPath = filepath.Join(workDir, path)
+		}
+		data, err := os.ReadFile(filepath.Clean(fullPath))
+		if err != nil {
+			continue
+		}
+		files = append(files, path)
+		contents[path] = string(data)
+
+		decls, err := s.ExtractVariablesFromContent(string(data), path)
+		if err != nil {
+			result.Issues = append(result.Issues, LintIssue{
+				Code:     LintInvalidFrontMatter,
+				Severity: LintSeverityError,
+				File:     path,
+				Message:  fmt.Sprintf("front-matter 解析失败，模块中的变量都不会被替换: %v", err),
+			})
+			continue
+		}
+		varsByFile[path] = decls
+
+		// 被引用文件中声明的变量在本模块中同样会被替换
+		if HasIncludes(string(data)) {
+			_, included, err := s.ExpandIncludes(string(data), fullPath)
+			if err != nil {
+				result.Issues = append(result.Issues, LintIssue{
+					Code:     LintInvalidInclude,
+					Severity: LintSeverityError,
+					File:     path,
+					Message:  err.Error(),
+				})
+				continue
+			}
+			for _, incDecls := range included {
+				includedDecls[path] = append(includedDecls[path], incDecls...)
+			}
+		}
+	}
+	result.Files = len(files)
+
+	// 所有模块中声明过的变量
+	declaredAnywhere := make(map[string]bool)
+	for _, decls := range varsByFile {
+		for _, decl := range decls {
+			declaredAnywhere[decl.Name] = true
+		}
+	}
+
+	for _, path := range files {
+		result.Issues = append(result.Issues, lintModule(path, contents[path], varsByFile[path], includedDecls[path], declaredAnywhere)...)
+	}
+
+	// 跨模块冲突复用 MergeVariables 的判断
+	_, conflicts := s.MergeVariables(varsByFile)
+	for _, conflict := range conflicts {
+		code := LintTypeConflict
+		message := fmt.Sprintf("不同模块声明的类型不一致: %s vs %s", conflict.Expected, conflict.Actual)
+		if conflict.Message == "options conflict" {
+			code = LintOptionsConflict
+			message = fmt.Sprintf("不同模块声明的选项不一致: [%s] vs [%s]", conflict.Expected, conflict.Actual)
+		}
+		result.Issues = append(result.Issues, LintIssue{
+			Code:     code,
+			Severity: LintSeverityError,
+			Variable: conflict.Variable,
+			File:     conflict.File,
+			Message:  message,
+		})
+	}
+
+	sort.SliceStable(result.Issues, func(i, j int) bool {
+		if result.Issues[i].File != result.Issues[j].File {
+			return result.Issues[i].File < result.Issues[j].File
+		}
+		return result.Issues[i].Line < result.Issues[j].Line
+	})
+
+	for _, issue := range result.Issues {
+		if issue.Severity == LintSeverityError {
+			result.Errors++
+		} else {
+			result.Warnings++
+		}
+	}
+
+	return result, nil
+}
+
+// lintModule 检查单个模块
+// 构建时每个模块只替换自身及其引用文件中声明的变量，因此未声明/未使用都按模块判断
+func lintModule(path, content string, declarations, included []VariableDeclaration, declaredAnywhere map[string]bool) []LintIssue {
+	var issues []LintIssue
+
+	declared := make(map[string]VariableDeclaration)
+	for _, decl := range included {
+		declared[decl.Name] = decl
+	}
+	for _, decl := range declarations {
+		declared[decl.Name] = decl
+	}
+
+	// 屏蔽转义的占位符，保持偏移量不变以便计算行号
+	masked := escapedPlaceholderRegex.ReplaceAllStringFunc(content, func(m string) string {
+		return strings.Repeat(" ", len(m))
+	})
+	bodyStart := frontMatterEnd(content)
+	codeRanges := codeRegex.FindAllStringIndex(content, -1)
+
+	used := make(map[string]bool)
+	for _, loc := range placeholderRegex.FindAllStringSubmatchIndex(masked, -1) {
+		if loc[0] < bodyStart {
+			continue
+		}
+		name := masked[loc[2]:loc[3]]
+		used[name] = true
+		if _, ok := declared[name]; ok || inRanges(codeRanges, loc[0]) {
+			continue
+		}
+
+		message := fmt.Sprintf("占位符 {{%s}} 未声明，将以原文输出到文档中", name)
+		if declaredAnywhere[name] {
+			message = fmt.Sprintf("占位符 {{%s}} 只在其他模块中声明，本模块不会替换它", name)
+		}
+		issues = append(issues, LintIssue{
+			Code:     LintUndeclaredPlaceholder,
+			Severity: LintSeverityError,
+			Variable: name,
+			File:     path,
+			Line:     lineAt(content, loc[0]),
+			Message:  message,
+		})
+	}
+
+	for _, decl := range declarations {
+		line := declarationLine(content, decl.Name)
+
+		if !used[decl.Name] {
+			issues = append(issues, LintIssue{
+				Code:     LintUnusedVariable,
+				Severity: LintSeverityWarning,
+				Variable: decl.Name,
+				File:     path,
+				Line:     line,
+				Message:  fmt.Sprintf("变量 %s 已声明但未在本模块中使用", decl.Name),
+			})
+		}
+
+		if decl.Type == VarTypeSelect && decl.Default != nil {
+			def := fmt.Sprintf("%v", decl.Default)
+			valid := false
+			for _, opt := range decl.Options {
+				if opt == def {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				issues = append(issues, LintIssue{
+					Code:     LintInvalidSelectDefault,
+					Severity: LintSeverityError,
+					Variable: decl.Name,
+					File:     path,
+					Line:     line,
+					Message:  fmt.Sprintf("默认值 %q 不在选项 [%s] 中", def, strings.Join(decl.Options, ", ")),
+				})
+			}
+		}
+	}
+
+	// 转义的占位符正好是本模块声明的变量，很可能是误转义
+	for _, loc := range escapedPlaceholderRegex.FindAllStringSubmatchIndex(content, -1) {
+		if loc[0] < bodyStart {
+			continue
+		}
+		inner := content[loc[2]:loc[3]]
+		match := placeholderRegex.FindStringSubmatch(inner)
+		if match == nil || match[0] != inner {
+			continue
+		}
+		if _, ok := declared[match[1]]; !ok || inRanges(codeRanges, loc[0]) {
+			continue
+		}
+		issues = append(issues, LintIssue{
+			Code:     LintSuspiciousEscape,
+			Severity: LintSeverityWarning,
+			Variable: match[1],
+			File:     path,
+			Line:     lineAt(content, loc[0]),
+			Message:  fmt.Sprintf("\\{{%s}} 会原样输出，但 %s 是本模块声明的变量，确认是否需要转义", match[1], match[1]),
+		})
+	}
+
+	return issues
+}
+
+// inRanges 判断偏移量是否落在任一区间内
+func inRanges(ranges [][]int, offset int) bool {
+	for _, r := range ranges {
+		if offset >= r[0] && offset < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// frontMatterEnd 返回 front-matter 结束位置（没有 front-matter 时为 0）
+func frontMatterEnd(content string) int {
+	if !strings.HasPrefix(content, "---") {
+		return 0
+	}
+	endIndex := strings.Index(content[3:], "\n---")
+	if endIndex == -1 {
+		return 0
+	}
+	return endIndex + 7
+}
+
+// lineAt 计算偏移量所在的行号（从 1 开始）
+func lineAt(content string, offset int) int {
+	return strings.Count(content[:offset], "\n") + 1
+}
+
+// declarationLine 查找变量在 front-matter 中的声明行号
+func declarationLine(content, name string) int {
+	end := frontMatterEnd(content)
+	if end == 0 {
+		return 0
+	}
+	lines := strings.Split(content[:end], "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), name+":") && strings.HasPrefix(line, " ") {
+			return i + 1
+		}
+	}
+	return 0
+}
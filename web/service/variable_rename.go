@@ -0,0 +1,359 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 变量重命名的编辑类型
+const (
+	RenameEditDeclaration = "declaration" // 模块 front-matter 中的声明
+	RenameEditPlaceholder = "placeholder" // 正文中的 {{name}}
+	RenameEditConfigValue = "configValue" // 配置文件 variables 中的键
+)
+
+// VariableRenameEdit 单处修改
+type VariableRenameEdit struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Kind   string `json:"kind"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// VariableRenameResult 重命名结果
+type VariableRenameResult struct {
+	OldName string               `json:"oldName"`
+	NewName string               `json:"newName"`
+	DryRun  bool                 `json:"dryRun"`
+	Files   []string             `json:"files"`
+	Edits   []VariableRenameEdit `json:"edits"`
+	Skipped []string             `json:"skipped,omitempty"` // 使用了变量但无法自动修改的文件，需要手动修改
+}
+
+// RenameVariable 在所有模块和配置中重命名变量
+// 修改范围：src/**/*.md 和客户覆盖模块 clients/*/overrides/src/**/*.md 的 front-matter 声明和 {{old}} 占位符
+// （转义的 \{{old}} 保持不变）、clients/*/*.yaml 的 variables 键、客户 variables.yaml 和 src/_variables.yaml
+// dryRun 为 true 时只返回修改清单，不写入文件；写入时持有编辑器的保存锁
+func (s *VariableService) RenameVariable(oldName, newName string, dryRun bool) (*VariableRenameResult, error) {
+	if !ValidateVariableName(oldName) || !ValidateVariableName(newName) {
+		return nil, fmt.Errorf("变量名不合法: 必须以字母或下划线开头，只能包含字母、数字、下划线和点")
+	}
+	if oldName == newName {
+		return nil, fmt.Errorf("新旧变量名相同")
+	}
+
+	if !dryRun && s.saveLock != nil {
+		s.saveLock.Lock()
+		defer s.saveLock.Unlock()
+	}
+
+	result := &VariableRenameResult{
+		OldName: oldName,
+		NewName: newName,
+		DryRun:  dryRun,
+		Files:   []string{},
+		Edits:   []VariableRenameEdit{},
+	}
+	workDir := filepath.Dir(s.srcDir)
+	changed := make(map[string]string) // 绝对路径 -> 新内容
+
+	// 1. 模块文件（src 和各客户的覆盖模块目录）
+	moduleRoots := []string{s.srcDir}
+	clientDirs, _ := os.ReadDir(s.clientsDir)
+	for _, clientDir := range clientDirs {
+		overrideSrc := clientOverrideSrcDir(s.clientsDir, clientDir.Name())
+		if info, err := os.Stat(overrideSrc); clientDir.IsDir() && err == nil && info.IsDir() {
+			moduleRoots = append(moduleRoots, overrideSrc)
+		}
+	}
+	for _, root := range moduleRoots {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path != root && (strings.HasPrefix(info.Name(), ".") || ignoredDirs[info.Name()]) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.HasSuffix(strings.ToLower(info.Name()), ".md") {
+				return nil
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("读取 %s 失败: %w", path, err)
+			}
+			rel := relSlash(workDir, path)
+			updated, edits, err := renameInModule(string(data), rel, oldName, newName)
+			if errors.Is(err, errRenameUnsupported) {
+				result.Skipped = append(result.Skipped, rel)
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if len(edits) > 0 {
+				changed[path] = updated
+				result.Edits = append(result.Edits, edits...)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. 全局变量文件和客户配置
+	yamlFiles := []string{filepath.Join(s.srcDir, globalVariablesFile)}
+	for _, clientDir := range clientDirs {
+		if !clientDir.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.clientsDir, clientDir.Name()))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".yaml" && ext != ".yml") || entry.Name() == "metadata.yaml" {
+				continue
+			}
+			yamlFiles = append(yamlFiles, filepath.Join(s.clientsDir, clientDir.Name(), entry.Name()))
+		}
+	}
+
+	for _, path := range yamlFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// 变量值文件允许把变量直接写在顶层
+		topLevel := filepath.Base(path) == globalVariablesFile || filepath.Base(path) == clientVariablesFile
+		rel := relSlash(workDir, path)
+		updated, edits, err := renameYAMLVariableKey(string(data), rel, oldName, newName, topLevel)
+		if errors.Is(err, errRenameUnsupported) {
+			result.Skipped = append(result.Skipped, rel)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(edits) > 0 {
+			changed[path] = updated
+			result.Edits = append(result.Edits, edits...)
+		}
+	}
+
+	for path := range changed {
+		result.Files = append(result.Files, relSlash(workDir, path))
+	}
+	sort.Strings(result.Files)
+	sort.Strings(result.Skipped)
+	sort.SliceStable(result.Edits, func(i, j int) bool {
+		if result.Edits[i].File != result.Edits[j].File {
+			return result.Edits[i].File < result.Edits[j].File
+		}
+		return result.Edits[i].Line < result.Edits[j].Line
+	})
+
+	if dryRun || len(changed) == 0 {
+		return result, nil
+	}
+
+	if err := writeFilesAtomically(changed); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[VariableService] 变量已重命名: %s -> %s (%d 个文件, %d 处修改)", oldName, newName, len(result.Files), len(result.Edits))
+	return result, nil
+}
+
+// renameInModule 重命名模块中的变量声明和占位符
+func renameInModule(content, file, oldName, newName string) (string, []VariableRenameEdit, error) {
+	var edits []VariableRenameEdit
+
+	// front-matter 中的声明
+	bodyStart := frontMatterEnd(content)
+	if bodyStart > 0 {
+		fmContent := content[3 : bodyStart-4]
+		fm, _, err := parseFrontMatter(content)
+		if err != nil {
+			return "", nil, fmt.Errorf("解析 %s 的 front-matter 失败: %w", file, err)
+		}
+		if _, exists := fm.Variables[newName]; exists {
+			if _, hasOld := fm.Variables[oldName]; hasOld {
+				return "", nil, fmt.Errorf("%s 中已经声明了变量 %s", file, newName)
+			}
+		}
+		updatedFM, fmEdits, err := renameYAMLVariableKey(fmContent, file, oldName, newName, false)
+		if err != nil {
+			return "", nil, err
+		}
+		for i := range fmEdits {
+			fmEdits[i].Kind = RenameEditDeclaration
+		}
+		edits = append(edits, fmEdits...)
+		content = content[:3] + updatedFM + content[bodyStart-4:]
+		bodyStart = frontMatterEnd(content)
+	}
+
+	// 正文中的占位符，与 RenderContent 一致：转义的 \{{old}} 不替换
+	escaped := escapedPlaceholderRegex.FindAllStringIndex(content, -1)
+	newPlaceholder := "{{" + newName + "}}"
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range placeholderRegex.FindAllStringSubmatchIndex(content, -1) {
+		if loc[0] < bodyStart || content[loc[2]:loc[3]] != oldName || inRanges(escaped, loc[0]) {
+			continue
+		}
+		lineStart, lineText := lineContaining(content, loc[0])
+		edits = append(edits, VariableRenameEdit{
+			File:   file,
+			Line:   lineAt(content, loc[0]),
+			Kind:   RenameEditPlaceholder,
+			Before: strings.TrimSpace(lineText),
+			After:  strings.TrimSpace(lineText[:loc[0]-lineStart] + newPlaceholder + lineText[loc[1]-lineStart:]),
+		})
+		b.WriteString(content[last:loc[0]])
+		b.WriteString(newPlaceholder)
+		last = loc[1]
+	}
+	b.WriteString(content[last:])
+
+	return b.String(), edits, nil
+}
+
+// errRenameUnsupported 变量键的写法无法自动修改，文件列入 VariableRenameResult.Skipped
+var errRenameUnsupported = errors.New("无法自动修改变量键")
+
+// renameYAMLVariableKey 重命名 YAML 中 variables 节（或顶层）下的变量键
+// 只修改键所在的那一行，保留注释和格式
+func renameYAMLVariableKey(content, file, oldName, newName string, topLevel bool) (string, []VariableRenameEdit, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return "", nil, fmt.Errorf("解析 %s 失败: %w", file, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return content, nil, nil
+	}
+
+	root := doc.Content[0]
+	vars := mappingValue(root, "variables")
+	if vars == nil && topLevel {
+		vars = root
+	}
+	if vars == nil || vars.Kind != yaml.MappingNode {
+		return content, nil, nil
+	}
+
+	var keyNode *yaml.Node
+	for i := 0; i+1 < len(vars.Content); i += 2 {
+		switch vars.Content[i].Value {
+		case oldName:
+			keyNode = vars.Content[i]
+		case newName:
+			if mappingValue(vars, oldName) != nil {
+				return "", nil, fmt.Errorf("%s 中已经存在变量 %s", file, newName)
+			}
+		}
+	}
+	if keyNode == nil {
+		return content, nil, nil
+	}
+
+	// 按键节点的位置替换（也适用于流式映射 {old: x}），位置上不是该键时（如多行键）无法自动修改
+	lines := strings.Split(content, "\n")
+	idx, col := keyNode.Line-1, keyNode.Column-1
+	if idx < 0 || idx >= len(lines) || col < 0 || col > len([]rune(lines[idx])) {
+		return "", nil, errRenameUnsupported
+	}
+	before := lines[idx]
+	prefix, rest := string([]rune(before)[:col]), string([]rune(before)[col:])
+	quote := ""
+	if keyNode.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 && rest != "" {
+		quote = rest[:1]
+	}
+	if !strings.HasPrefix(rest, quote+oldName+quote) {
+		return "", nil, errRenameUnsupported
+	}
+	after := prefix + quote + newName + quote + rest[len(quote+oldName+quote):]
+	lines[idx] = after
+
+	return strings.Join(lines, "\n"), []VariableRenameEdit{{
+		File:   file,
+		Line:   keyNode.Line,
+		Kind:   RenameEditConfigValue,
+		Before: strings.TrimSpace(before),
+		After:  strings.TrimSpace(after),
+	}}, nil
+}
+
+// mappingValue 获取映射节点中指定键的值节点
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// lineContaining 返回偏移量所在行的起始位置和整行内容
+func lineContaining(content string, offset int) (int, string) {
+	start := strings.LastIndex(content[:offset], "\n") + 1
+	end := strings.Index(content[offset:], "\n")
+	if end == -1 {
+		return start, content[start:]
+	}
+	return start, content[start : offset+end]
+}
+
+// relSlash 返回相对于 base 的路径（使用正斜杠）
+func relSlash(base, path string) string {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// writeFilesAtomically 写入多个文件，任一文件写入失败时恢复已写入的文件
+func writeFilesAtomically(files map[string]string) error {
+	originals := make(map[string][]byte)
+	for path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("读取 %s 失败: %w", path, err)
+		}
+		originals[path] = data
+	}
+
+	var written []string
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			for _, done := range written {
+				if restoreErr := os.WriteFile(done, originals[done], 0644); restoreErr != nil {
+					log.Printf("[VariableService] 警告: 回滚 %s 失败: %v", done, restoreErr)
+				}
+			}
+			return fmt.Errorf("写入 %s 失败（已回滚其他文件）: %w", path, err)
+		}
+		written = append(written, path)
+	}
+	return nil
+}
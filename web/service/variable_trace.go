@@ -0,0 +1,226 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 变量值来源
+const (
+	VarSourceDefault = "default" // 模块 front-matter 中的默认值
+	VarSourceGlobal  = "global"  // src/_variables.yaml
+	VarSourceClient  = "client"  // clients/<client>/variables.yaml
+	VarSourceDocType = "docType" // 文档类型配置中的 variables 节
+	VarSourceRequest = "request" // 请求覆盖值
+)
+
+// VariableOrigin 某一层级提供的变量值
+type VariableOrigin struct {
+	Source string      `json:"source"`
+	File   string      `json:"file,omitempty"`
+	Value  interface{} `json:"value"`
+}
+
+// VariableTrace 单个变量的解析过程
+type VariableTrace struct {
+	Name        string              `json:"name"`
+	Value       interface{}         `json:"value"`                // 最终值（未解析时为 nil）
+	Resolved    bool                `json:"resolved"`             // 是否有最终值
+	Source      string              `json:"source,omitempty"`     // 最终值来源
+	SourceFile  string              `json:"sourceFile,omitempty"` // 最终值所在文件
+	Declaration VariableDeclaration `json:"declaration"`
+	DeclaredIn  []string            `json:"declaredIn"`           // 声明该变量的模块
+	Overridden  []VariableOrigin    `json:"overridden,omitempty"` // 被覆盖的低优先级值
+}
+
+// UnrenderedPlaceholder 构建后仍会保留原样的占位符
+type UnrenderedPlaceholder struct {
+	Name   string `json:"name"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// EffectiveVariables 变量解析结果
+type EffectiveVariables struct {
+	Variables  []VariableTrace         `json:"variables"`
+	Conflicts  []ValidationError       `json:"conflicts,omitempty"`
+	Unrendered []UnrenderedPlaceholder `json:"unrendered,omitempty"`
+}
+
+// TraceValues 追踪模块中每个变量的最终值及其来源
+// 参数: clientName - 客户名称, modulePaths - 模块路径（相对于项目根目录）, sources - 各层级变量值
+func (s *VariableService) TraceValues(clientName, docTypeName string, modulePaths []string, sources VariableSources) (*EffectiveVariables, error) {
+	workDir := filepath.Dir(s.srcDir)
+	modulePaths = expandModulePatterns(workDir, modulePaths)
+
+	varsByFile := make(map[string][]VariableDeclaration)
+	renderDecls := make(map[string][]VariableDeclaration) // 渲染每个模块时可用的声明（含被引用文件）
+	contents := make(map[string]string)
+	for _, path := range modulePaths {
+		fullPath := path
+		if !filepath.IsAbs(path) {
+			fullPath = filepath.Join(workDir, path)
+		}
+		data, err := os.ReadFile(filepath.Clean(fullPath))
+		if err != nil {
+			continue // 与构建一致，跳过不存在的模块
+		}
+
+		decls, err := s.ExtractVariablesFromContent(string(data), path)
+		if err != nil {
+			return nil, fmt.Errorf("解析 %s 的 front-matter 失败: %w", path, err)
+		}
+		if len(decls) > 0 {
+			varsByFile[path] = decls
+		}
+
+		// 与构建一致：先展开引用，被引用文件的变量在本模块中同样会被替换
+		content, included, err := s.ExpandIncludes(string(data), fullPath)
+		if err != nil {
+			return nil, err
+		}
+		contents[path] = content
+		renderDecls[path] = decls
+		for file, incDecls := range included {
+			varsByFile[file] = incDecls
+			renderDecls[path] = append(renderDecls[path], incDecls...)
+		}
+	}
+
+	merged, conflicts := s.MergeVariables(varsByFile)
+
+	layers := []struct {
+		source string
+		file   string
+		values map[string]interface{}
+	}{
+		{VarSourceGlobal, "src/" + globalVariablesFile, sources.Global},
+		{VarSourceClient, "clients/" + clientName + "/" + clientVariablesFile, sources.Client},
+		{VarSourceDocType, "clients/" + clientName + "/" + docTypeName + ".yaml", sources.DocType},
+		{VarSourceRequest, "", sources.Request},
+	}
+
+	result := &EffectiveVariables{
+		Variables: []VariableTrace{},
+		Conflicts: conflicts,
+	}
+
+	for _, decl := range merged {
+		trace := VariableTrace{
+			Name:        decl.Name,
+			Declaration: decl,
+		}
+		for file, decls := range varsByFile {
+			for _, d := range decls {
+				if d.Name == decl.Name {
+					trace.DeclaredIn = append(trace.DeclaredIn, file)
+				}
+			}
+		}
+		sort.Strings(trace.DeclaredIn)
+
+		var origins []VariableOrigin
+		if decl.Default != nil {
+			origins = append(origins, VariableOrigin{Source: VarSourceDefault, File: decl.SourceFile, Value: decl.Default})
+		}
+		for _, layer := range layers {
+			if val, ok := layer.values[decl.Name]; ok {
+				origins = append(origins, VariableOrigin{Source: layer.source, File: layer.file, Value: val})
+			}
+		}
+
+		if len(origins) > 0 {
+			final := origins[len(origins)-1]
+			trace.Value = final.Value
+			trace.Resolved = true
+			trace.Source = final.Source
+			trace.SourceFile = final.File
+			trace.Overridden = origins[:len(origins)-1]
+		}
+
+		result.Variables = append(result.Variables, trace)
+	}
+
+	sort.Slice(result.Variables, func(i, j int) bool {
+		return result.Variables[i].Name < result.Variables[j].Name
+	})
+
+	resolved := sources.Merge()
+	for _, path := range modulePaths {
+		content, ok := contents[path]
+		if !ok || !strings.HasSuffix(strings.ToLower(path), ".md") {
+			continue
+		}
+		result.Unrendered = append(result.Unrendered, findUnrenderedPlaceholders(content, path, renderDecls[path], resolved)...)
+	}
+
+	return result, nil
+}
+
+// findUnrenderedPlaceholders 找出渲染后仍保留原样的占位符
+// 构建时每个模块只替换自身 front-matter 中声明的变量（与 RenderContent 一致）
+func findUnrenderedPlaceholders(content, file string, declarations []VariableDeclaration, values map[string]interface{}) []UnrenderedPlaceholder {
+	declared := make(map[string]*VariableDeclaration)
+	for i := range declarations {
+		declared[declarations[i].Name] = &declarations[i]
+	}
+
+	// 转义的占位符不参与渲染，先屏蔽掉（保持偏移量不变以便计算行号）
+	masked := escapedPlaceholderRegex.ReplaceAllStringFunc(content, func(m string) string {
+		return strings.Repeat(" ", len(m))
+	})
+
+	var result []UnrenderedPlaceholder
+	for _, loc := range placeholderRegex.FindAllStringSubmatchIndex(masked, -1) {
+		name := masked[loc[2]:loc[3]]
+		line := strings.Count(content[:loc[0]], "\n") + 1
+
+		decl, ok := declared[name]
+		if !ok {
+			result = append(result, UnrenderedPlaceholder{
+				Name:   name,
+				File:   file,
+				Line:   line,
+				Reason: "变量未在该模块的 front-matter 中声明",
+			})
+			continue
+		}
+		if _, ok := values[name]; !ok && decl.Default == nil {
+			result = append(result, UnrenderedPlaceholder{
+				Name:   name,
+				File:   file,
+				Line:   line,
+				Reason: "变量没有默认值，且未在任何层级中赋值",
+			})
+		}
+	}
+
+	return result
+}
+
+// expandModulePatterns 展开模块列表中的通配符（如 src/*.md），与构建脚本保持一致
+func expandModulePatterns(workDir string, modules []string) []string {
+	var result []string
+	for _, module := range modules {
+		if !strings.Contains(module, "*") {
+			result = append(result, module)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(workDir, module))
+		if err != nil {
+			continue
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if rel, err := filepath.Rel(workDir, match); err == nil {
+				result = append(result, filepath.ToSlash(rel))
+			}
+		}
+	}
+	return result
+}
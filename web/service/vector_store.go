@@ -111,6 +111,22 @@ func (vs *VectorStore) AddDocuments(docs []Document) {
 	vs.index.Documents = append(vs.index.Documents, docs...)
 }
 
+// RemoveFile 移除某个文件的所有文档块，返回移除的数量
+func (vs *VectorStore) RemoveFile(filePath string) int {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	kept := vs.index.Documents[:0]
+	for _, doc := range vs.index.Documents {
+		if filepath.ToSlash(doc.Metadata.FilePath) != filePath {
+			kept = append(kept, doc)
+		}
+	}
+	removed := len(vs.index.Documents) - len(kept)
+	vs.index.Documents = kept
+	return removed
+}
+
 // Clear 清空索引
 func (vs *VectorStore) Clear() {
 	vs.mu.Lock()
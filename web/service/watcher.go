@@ -0,0 +1,250 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 文件变更类型
+const (
+	FileCreated  = "created"
+	FileModified = "modified"
+	FileDeleted  = "deleted"
+)
+
+// WatchEvent 监视目录中的一个文件变更
+type WatchEvent struct {
+	Root    string     `json:"root"` // 监视目录的名称（src、clients、templates、fonts）
+	Path    string     `json:"path"` // 相对于监视目录的路径（使用 /）
+	Type    string     `json:"type"`
+	Size    int64      `json:"size,omitempty"`
+	ModTime *time.Time `json:"modTime,omitempty"` // 删除时为空
+	ETag    string     `json:"etag,omitempty"`    // Markdown 文件的内容 ETag（与读取模块时的一致）
+}
+
+// fileStamp 轮询时记录的文件状态
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// watchRoot 一个监视目录
+type watchRoot struct {
+	name string
+	dir  string
+}
+
+// fileSubscriber 变更订阅者
+type fileSubscriber struct {
+	id   int
+	name string
+	fn   func([]WatchEvent)
+}
+
+// FileWatcher 轮询方式的文件变更监视（不依赖操作系统的文件通知，便于跨平台）
+// 发现 Web 界面之外的修改（如在服务器上执行 git pull）时通知订阅者
+type FileWatcher struct {
+	roots    []watchRoot
+	interval time.Duration
+
+	mu          sync.Mutex
+	files       map[string]fileStamp // 键为 root/path
+	subscribers []fileSubscriber
+	nextID      int
+	stop        chan struct{}
+}
+
+// NewFileWatcher 创建文件监视器，roots 为名称到目录的映射；interval 为 0 时不监视
+func NewFileWatcher(roots map[string]string, interval time.Duration) *FileWatcher {
+	w := &FileWatcher{interval: interval}
+	for name, dir := range roots {
+		w.roots = append(w.roots, watchRoot{name: name, dir: dir})
+	}
+	sort.Slice(w.roots, func(i, j int) bool { return w.roots[i].name < w.roots[j].name })
+	return w
+}
+
+// Subscribe 注册变更回调，每轮发现变更时按注册顺序调用一次（在监视器的协程中执行，耗时操作需要自行异步处理）
+// 返回取消订阅的函数
+func (w *FileWatcher) Subscribe(name string, fn func([]WatchEvent)) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.nextID++
+	id := w.nextID
+	w.subscribers = append(w.subscribers, fileSubscriber{id: id, name: name, fn: fn})
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		for i, sub := range w.subscribers {
+			if sub.id == id {
+				w.subscribers = append(w.subscribers[:i:i], w.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Enabled 是否在监视文件变化
+func (w *FileWatcher) Enabled() bool {
+	return w.interval > 0
+}
+
+// Start 记录当前状态并开始轮询
+func (w *FileWatcher) Start() {
+	if w.interval <= 0 {
+		log.Printf("[Watcher] 文件监视已关闭")
+		return
+	}
+	w.mu.Lock()
+	w.files = w.scan()
+	w.stop = make(chan struct{})
+	stop := w.stop
+	w.mu.Unlock()
+
+	log.Printf("[Watcher] 开始监视 %d 个目录，间隔 %s，当前 %d 个文件", len(w.roots), w.interval, len(w.files))
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				w.Poll()
+			}
+		}
+	}()
+}
+
+// Stop 停止轮询
+func (w *FileWatcher) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
+
+// Poll 立即检查一次变更并通知订阅者，返回发现的变更
+func (w *FileWatcher) Poll() []WatchEvent {
+	w.mu.Lock()
+	current := w.scan()
+	changes := diffStamps(w.files, current)
+	w.files = current
+	subscribers := append([]fileSubscriber(nil), w.subscribers...)
+	w.mu.Unlock()
+
+	if len(changes) == 0 {
+		return nil
+	}
+	for i := range changes {
+		w.fillETag(&changes[i])
+	}
+	log.Printf("[Watcher] 发现 %d 个文件变更", len(changes))
+	for _, sub := range subscribers {
+		w.notify(sub, changes)
+	}
+	return changes
+}
+
+// notify 调用订阅者，回调出错时不影响其他订阅者
+func (w *FileWatcher) notify(sub fileSubscriber, changes []WatchEvent) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("[Watcher] 订阅者 %s 处理变更失败: %v", sub.name, err)
+		}
+	}()
+	sub.fn(changes)
+}
+
+// scan 遍历所有监视目录（跳过以 . 开头的文件和目录）
+func (w *FileWatcher) scan() map[string]fileStamp {
+	files := make(map[string]fileStamp)
+	for _, root := range w.roots {
+		filepath.WalkDir(root.dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// 目录不存在或无法读取时跳过
+				return nil
+			}
+			if path != root.dir && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			rel, err := filepath.Rel(root.dir, path)
+			if err != nil {
+				return nil
+			}
+			files[root.name+"/"+filepath.ToSlash(rel)] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+			return nil
+		})
+	}
+	return files
+}
+
+// diffStamps 比较两次扫描的结果，按路径排序
+func diffStamps(before, after map[string]fileStamp) []WatchEvent {
+	var changes []WatchEvent
+	for key, stamp := range after {
+		old, ok := before[key]
+		switch {
+		case !ok:
+			changes = append(changes, newWatchEvent(key, FileCreated, stamp))
+		case old.size != stamp.size || !old.modTime.Equal(stamp.modTime):
+			changes = append(changes, newWatchEvent(key, FileModified, stamp))
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			changes = append(changes, newWatchEvent(key, FileDeleted, fileStamp{}))
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Root != changes[j].Root {
+			return changes[i].Root < changes[j].Root
+		}
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// newWatchEvent 由 root/path 形式的键创建变更
+func newWatchEvent(key, changeType string, stamp fileStamp) WatchEvent {
+	root, path, _ := strings.Cut(key, "/")
+	change := WatchEvent{Root: root, Path: path, Type: changeType, Size: stamp.size}
+	if changeType != FileDeleted {
+		change.ModTime = &stamp.modTime
+	}
+	return change
+}
+
+// fillETag 为新增或修改的 Markdown 文件计算内容 ETag，编辑器据此判断已打开的模块是否需要重新加载
+func (w *FileWatcher) fillETag(change *WatchEvent) {
+	if change.Type == FileDeleted || !strings.HasSuffix(strings.ToLower(change.Path), ".md") {
+		return
+	}
+	for _, root := range w.roots {
+		if root.name != change.Root {
+			continue
+		}
+		if content, err := os.ReadFile(filepath.Join(root.dir, filepath.FromSlash(change.Path))); err == nil {
+			change.ETag = ContentETag(content)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Package service 提供业务逻辑服务
+package service
+
+import (
+	"archive/zip"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	docxStyleRegex     = regexp.MustCompile(`(?s)<w:style\b([^>]*)>(.*?)</w:style>`)
+	docxStyleIDRegex   = regexp.MustCompile(`w:styleId="([^"]*)"`)
+	docxStyleNameRegex = regexp.MustCompile(`<w:name w:val="([^"]*)"`)
+	// Pandoc 生成的表格统一使用参考文档中名为 Table 的样式
+	docxTableStyleRegex = regexp.MustCompile(`<w:tblStyle w:val="Table"\s*/>`)
+)
+
+// ValidateWordOptions 按配置 Schema 校验请求中的 Word 选项（与配置中的选项合并后），不通过时返回 *ConfigValidationError
+// 请求中的选项直接写入临时配置，不经过保存配置时的校验
+func (s *BuildService) ValidateWordOptions(req BuildRequest) error {
+	if req.WordOptions.IsZero() {
+		return nil
+	}
+	data, err := yaml.Marshal(map[string]interface{}{"word_options": s.resolveWordOptions(req)})
+	if err != nil {
+		return fmt.Errorf("序列化 Word 选项失败: %w", err)
+	}
+	errs := ValidateConfigData(data)
+	if len(errs) == 0 {
+		return nil
+	}
+	for i := range errs {
+		// 行号是序列化后的位置，对请求没有意义
+		errs[i].Line, errs[i].Column = 0, 0
+	}
+	return &ConfigValidationError{Errors: errs}
+}
+
+// mergeWordOptions 合并 Word 选项，override 中设置的字段优先
+func mergeWordOptions(base, override *WordOptions) *WordOptions {
+	if override.IsZero() {
+		return base
+	}
+	result := &WordOptions{}
+	if base != nil {
+		*result = *base
+	}
+	if override.Toc != nil {
+		result.Toc = override.Toc
+	}
+	if override.TocDepth != 0 {
+		result.TocDepth = override.TocDepth
+	}
+	if override.NumberSections != nil {
+		result.NumberSections = override.NumberSections
+	}
+	if override.HighlightStyle != "" {
+		result.HighlightStyle = override.HighlightStyle
+	}
+	if override.PageBreakBeforeChapter != nil {
+		result.PageBreakBeforeChapter = override.PageBreakBeforeChapter
+	}
+	if override.TableStyle != "" {
+		result.TableStyle = override.TableStyle
+	}
+	if override.FigurePrefix != "" {
+		result.FigurePrefix = override.FigurePrefix
+	}
+	if override.TablePrefix != "" {
+		result.TablePrefix = override.TablePrefix
+	}
+	if override.ReferenceDoc != "" {
+		result.ReferenceDoc = override.ReferenceDoc
+	}
+	return result
+}
+
+// applyDocxTableStyle 把 Word 文档中所有表格的样式改为 styleName
+// styleName 可以是样式名称或样式 ID，样式必须在参考文档中定义
+func applyDocxTableStyle(path, styleName string) error {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("打开 Word 文档失败: %w", err)
+	}
+	defer reader.Close()
+
+	files := make(map[string]*zip.File)
+	for _, f := range reader.File {
+		files[f.Name] = f
+	}
+	stylesXML, err := readZipFile(files["word/styles.xml"])
+	if err != nil {
+		return fmt.Errorf("读取样式失败: %w", err)
+	}
+	styleID, ok := findDocxTableStyle(stylesXML, styleName)
+	if !ok {
+		return fmt.Errorf("参考文档中没有表格样式: %s", styleName)
+	}
+	documentXML, err := readZipFile(files["word/document.xml"])
+	if err != nil {
+		return fmt.Errorf("读取文档内容失败: %w", err)
+	}
+	updated := docxTableStyleRegex.ReplaceAllString(documentXML, `<w:tblStyle w:val="`+html.EscapeString(styleID)+`" />`)
+	if updated == documentXML {
+		return nil
+	}
+
+	tmpPath := path + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	writer := zip.NewWriter(out)
+	for _, f := range reader.File {
+		if f.Name != "word/document.xml" {
+			err = writer.Copy(f)
+		} else {
+			var w io.Writer
+			w, err = writer.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate, Modified: f.Modified})
+			if err == nil {
+				_, err = io.WriteString(w, updated)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("写入 Word 文档失败: %w", err)
+	}
+	reader.Close()
+	return os.Rename(tmpPath, path)
+}
+
+// findDocxTableStyle 在 styles.xml 中按名称或样式 ID 查找表格样式（不区分大小写），返回样式 ID
+// 中文版 Word 的内置样式在文件中仍使用英文名称（如 网格型 为 Table Grid）
+func findDocxTableStyle(stylesXML, name string) (string, bool) {
+	for _, match := range docxStyleRegex.FindAllStringSubmatch(stylesXML, -1) {
+		attrs, body := match[1], match[2]
+		if !strings.Contains(attrs, `w:type="table"`) {
+			continue
+		}
+		id := docxStyleIDRegex.FindStringSubmatch(attrs)
+		if id == nil {
+			continue
+		}
+		styleName := ""
+		if n := docxStyleNameRegex.FindStringSubmatch(body); n != nil {
+			styleName = html.UnescapeString(n[1])
+		}
+		if strings.EqualFold(id[1], name) || strings.EqualFold(styleName, name) {
+			return id[1], true
+		}
+	}
+	return "", false
+}
+
+// readZipFile 读取压缩包中的文本文件
+func readZipFile(f *zip.File) (string, error) {
+	if f == nil {
+		return "", fmt.Errorf("文件不存在")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -6,6 +6,10 @@ let generatedFiles = [];
 let availableModules = [];
 let availableTemplates = [];
 let selectedModules = [];
+let moduleConditions = {}; // 模块路径 -> 包含条件（when）
+let templateVarCatalogs = []; // 输出模板的变量目录
+let templateVarValues = {}; // 模板变量名 -> 值
+let loadedWordOptions = {}; // 编辑的配置中原有的 Word 选项（保留界面不处理的字段）
 let currentEditConfig = null; // 当前编辑的配置
 let currentClient = null; // 当前选中的客户信息
 let moduleTree = null; // 模块树形结构
@@ -57,8 +61,69 @@ document.addEventListener('DOMContentLoaded', function() {
     if (typeof initGitPanel === 'function') {
         initGitPanel();
     }
+
+    // 接收文件变化推送
+    initFileWatch();
 });
 
+// ==================== 文件变化 ====================
+
+// 订阅服务器推送的文件变化（包括在服务器上执行 git pull 等界面之外的修改），刷新受影响的客户和资源列表
+function initFileWatch() {
+    const source = new EventSource('/api/watch/stream');
+    source.addEventListener('changed', function(e) {
+        onFilesChanged(JSON.parse(e.data).changes || []);
+    });
+    source.onerror = function() {
+        source.close();
+        setTimeout(initFileWatch, 5000);
+    };
+}
+
+async function onFilesChanged(changes) {
+    const clientSelect = document.getElementById('clientSelect');
+    const changedClients = new Set();
+    let clientListChanged = false;
+    let resourcesChanged = false;
+
+    changes.forEach(function(change) {
+        if (change.root === 'clients') {
+            changedClients.add(change.path.split('/')[0]);
+            if (change.type !== 'modified') clientListChanged = true;
+        } else if (change.root === 'templates' || change.root === 'fonts') {
+            resourcesChanged = true;
+        }
+    });
+
+    changedClients.forEach(function(name) {
+        clearPreviewCache(name);
+    });
+
+    // 新增或删除了配置文件时刷新客户列表，保留当前选择
+    if (clientListChanged && clientSelect) {
+        const selected = clientSelect.value;
+        await loadClients();
+        if (selected && window.clientsData && window.clientsData.some(function(c) { return c.name === selected; })) {
+            clientSelect.value = selected;
+            currentClient = window.clientsData.find(function(c) { return c.name === selected; });
+            updateLockButton();
+        } else if (selected) {
+            onClientChange();
+            showWarningToast('客户配置 ' + selected + ' 已在服务器上被删除');
+            return;
+        }
+    }
+
+    // 当前客户的配置有变化时重新加载文档类型
+    if (clientSelect && changedClients.has(clientSelect.value)) {
+        onClientChange();
+    }
+
+    if (resourcesChanged && typeof resourcePanelOpen !== 'undefined' && resourcePanelOpen) {
+        loadCurrentTabData();
+    }
+}
+
 // ==================== 主题控制 ====================
 
 function initTheme() {
@@ -589,6 +654,27 @@ async function onClientChange() {
     }
 }
 
+// 客户整体的锁定（没有时返回 null）
+function getClientLock() {
+    if (!currentClient || !currentClient.locks) return null;
+    return currentClient.locks.find(function(lock) { return !lock.docType; }) || null;
+}
+
+// 锁定说明
+function describeLock(lock) {
+    const parts = [];
+    if (lock.owner) parts.push('锁定人: ' + lock.owner);
+    if (lock.reason) parts.push('原因: ' + lock.reason);
+    if (lock.expiresAt) parts.push('到期: ' + new Date(lock.expiresAt).toLocaleString());
+    return parts.length > 0 ? parts.join('\n') : '已锁定';
+}
+
+// 锁定是否阻止当前用户修改（锁定人自己可以修改）
+function lockBlocksMe(lock) {
+    if (!lock) return false;
+    return !lock.owner || !window.currentUser || lock.owner !== window.currentUser.username;
+}
+
 // 更新锁定按钮状态
 function updateLockButton() {
     const lockBtn = document.getElementById('lockBtn');
@@ -606,7 +692,8 @@ function updateLockButton() {
     if (currentClient.locked) {
         lockIcon.textContent = '🔒';
         lockBtn.classList.add('locked');
-        lockBtn.title = '点击解锁配置';
+        const lock = getClientLock();
+        lockBtn.title = (lock ? describeLock(lock) + '\n' : '') + '点击解锁配置';
     } else {
         lockIcon.textContent = '🔓';
         lockBtn.classList.remove('locked');
@@ -614,6 +701,49 @@ function updateLockButton() {
     }
 }
 
+// 锁定或解锁客户（docType 为空时）或单个文档类型
+async function setConfigLock(clientName, docType, lock) {
+    let url = '/api/lock/' + encodeURIComponent(clientName);
+    if (docType) url += '/' + encodeURIComponent(docType);
+    const target = docType ? `文档类型 "${docType}"` : `客户配置 "${currentClient.displayName || clientName}"`;
+    
+    let body = null;
+    if (lock) {
+        const reason = prompt(`锁定${target}后，其他人不能修改配置、修改只被该客户使用的模块或生成正式版文档。\n请输入锁定原因（可选）：`, '');
+        if (reason === null) return false; // 用户取消
+        body = JSON.stringify({ reason: reason.trim() });
+    } else if (!confirm(`确定解锁${target}吗？`)) {
+        return false;
+    }
+    
+    const response = await fetch(url, {
+        method: lock ? 'POST' : 'DELETE',
+        headers: { 'Content-Type': 'application/json' },
+        body: body
+    });
+    const data = await response.json();
+    if (!data.success) throw new Error(data.error);
+    
+    // 重新获取锁定状态并更新本地数据
+    const statusResp = await fetch('/api/lock/' + encodeURIComponent(clientName));
+    const status = await statusResp.json();
+    if (status.success) {
+        currentClient.locks = status.data.locks || [];
+        currentClient.locked = !!getClientLock();
+        if (window.clientsData) {
+            const client = window.clientsData.find(c => c.name === clientName);
+            if (client) {
+                client.locks = currentClient.locks;
+                client.locked = currentClient.locked;
+            }
+        }
+        documentTypes.forEach(function(doc) {
+            doc.lock = currentClient.locks.find(function(l) { return l.docType === doc.name; }) || null;
+        });
+    }
+    return true;
+}
+
 // 切换客户锁定状态
 async function toggleClientLock() {
     if (!currentClient) return;
@@ -621,46 +751,27 @@ async function toggleClientLock() {
     const isLocked = currentClient.locked;
     const action = isLocked ? '解锁' : '锁定';
     
-    // 弹出密码输入框
-    const password = prompt(`请输入管理密码以${action}客户配置 "${currentClient.displayName || currentClient.name}"：`);
-    if (password === null) return; // 用户取消
-    
-    if (!password.trim()) {
-        alert('密码不能为空');
-        return;
-    }
-    
     try {
-        const url = '/api/lock/' + encodeURIComponent(currentClient.name);
-        const method = isLocked ? 'DELETE' : 'POST';
-        
-        const response = await fetch(url, { 
-            method: method,
-            headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ password: password })
-        });
-        const data = await response.json();
-        
-        if (!data.success) throw new Error(data.error);
-        
-        // 更新本地状态
-        currentClient.locked = !isLocked;
-        
-        // 更新 clientsData 中的状态
-        if (window.clientsData) {
-            const client = window.clientsData.find(c => c.name === currentClient.name);
-            if (client) client.locked = currentClient.locked;
-        }
-        
+        if (!await setConfigLock(currentClient.name, '', !isLocked)) return;
         updateLockButton();
         renderDocList();
-        
         alert(`客户配置已${action}`);
     } catch (e) {
         alert(`${action}失败: ` + e.message);
     }
 }
 
+// 切换文档类型锁定状态
+async function toggleDocLock(docType, locked) {
+    const action = locked ? '解锁' : '锁定';
+    try {
+        if (!await setConfigLock(currentClient.name, docType, !locked)) return;
+        renderDocList();
+    } catch (e) {
+        alert(`${action}失败: ` + e.message);
+    }
+}
+
 // 渲染文档列表
 function renderDocList() {
     const docList = document.getElementById('docList');
@@ -672,10 +783,13 @@ function renderDocList() {
     }
     
     const isCustomClient = currentClient && currentClient.isCustom;
-    const isLocked = currentClient && currentClient.locked;
+    const clientLock = getClientLock();
     
     docList.innerHTML = '';
     documentTypes.forEach(function(doc) {
+        const lock = clientLock || doc.lock;
+        const isLocked = lockBlocksMe(lock);
+        const lockTitle = lock ? describeLock(lock) : '';
         const item = document.createElement('div');
         item.className = 'doc-item';
         
@@ -688,6 +802,13 @@ function renderDocList() {
             badge.textContent = '(默认)';
             name.appendChild(badge);
         }
+        if (doc.lock) {
+            const lockBadge = document.createElement('span');
+            lockBadge.className = 'badge';
+            lockBadge.textContent = '🔒';
+            lockBadge.title = lockTitle;
+            name.appendChild(lockBadge);
+        }
         
         const actions = document.createElement('div');
         actions.className = 'doc-actions';
@@ -704,7 +825,7 @@ function renderDocList() {
         editBtn.textContent = '编辑';
         if (isLocked) {
             editBtn.disabled = true;
-            editBtn.title = '客户配置已锁定';
+            editBtn.title = lockTitle;
         } else {
             editBtn.onclick = function() { editConfig(currentClient.name, doc.name); };
         }
@@ -717,13 +838,23 @@ function renderDocList() {
             delBtn.textContent = '删除';
             if (isLocked) {
                 delBtn.disabled = true;
-                delBtn.title = '客户配置已锁定';
+                delBtn.title = lockTitle;
             } else {
                 delBtn.onclick = function() { confirmDeleteConfig(currentClient.name, doc.name); };
             }
             actions.appendChild(delBtn);
         }
         
+        // 客户整体未锁定时可以单独锁定文档类型
+        if (!clientLock) {
+            const lockDocBtn = document.createElement('button');
+            lockDocBtn.className = 'btn btn-ghost btn-sm';
+            lockDocBtn.textContent = doc.lock ? '解锁' : '锁定';
+            lockDocBtn.title = doc.lock ? lockTitle : '锁定该文档类型';
+            lockDocBtn.onclick = function() { toggleDocLock(doc.name, !!doc.lock); };
+            actions.appendChild(lockDocBtn);
+        }
+        
         item.appendChild(name);
         item.appendChild(actions);
         docList.appendChild(item);
@@ -947,29 +1078,232 @@ async function showConfigModal(editMode = false) {
     if (searchInput) searchInput.value = '';
     
     // 加载模块和模板列表
-    await Promise.all([loadModules(), loadTemplates()]);
+    await Promise.all([loadModules(), loadTemplates(), loadTemplateVarCatalogs()]);
     
     // 初始化搜索事件
     initModuleSearch();
     
+    const upstreamRow = document.getElementById('cfgUpstreamRow');
     if (editMode && currentEditConfig) {
         modalTitle.textContent = '编辑配置';
         fillConfigForm(currentEditConfig);
         // 编辑模式下禁用客户名称和文档类型名称
         document.getElementById('cfgClientName').disabled = true;
         document.getElementById('cfgDocTypeName').disabled = true;
+        if (upstreamRow) upstreamRow.style.display = 'none';
     } else {
         modalTitle.textContent = '新建配置';
         resetConfigForm();
         document.getElementById('cfgClientName').disabled = false;
         document.getElementById('cfgDocTypeName').disabled = false;
         currentEditConfig = null;
+        if (upstreamRow) upstreamRow.style.display = '';
+        loadUpstreamOptions();
     }
     
     openModal(modal);
     updateFilenamePreview();
 }
 
+// 加载可作为来源的标准配置（预置客户的文档类型）
+async function loadUpstreamOptions() {
+    const select = document.getElementById('cfgUpstream');
+    if (!select) return;
+    select.innerHTML = '<option value="">不使用（从空白开始）</option>';
+    
+    const standardClients = (window.clientsData || []).filter(c => !c.isCustom);
+    for (const client of standardClients) {
+        try {
+            const response = await fetch('/api/clients/' + encodeURIComponent(client.name) + '/docs');
+            const data = await response.json();
+            if (!data.success) continue;
+            
+            const group = document.createElement('optgroup');
+            group.label = client.displayName || client.name;
+            (data.data.documentTypes || []).forEach(dt => {
+                const opt = document.createElement('option');
+                opt.value = client.name + '/' + dt.name;
+                opt.textContent = dt.displayName || dt.name;
+                group.appendChild(opt);
+            });
+            if (group.children.length > 0) select.appendChild(group);
+        } catch (e) {
+            console.error('加载标准配置失败:', e);
+        }
+    }
+}
+
+// 选择标准配置后，用它的内容填充表单（保留已输入的客户名称和文档类型）
+async function onUpstreamChange() {
+    const select = document.getElementById('cfgUpstream');
+    if (!select || !select.value) return;
+    
+    const [client, docType] = select.value.split('/');
+    try {
+        const url = '/api/configs/' + encodeURIComponent(client) + '/' + encodeURIComponent(docType);
+        const response = await fetch(url);
+        const data = await response.json();
+        if (!data.success) throw new Error(data.error);
+        
+        const clientName = document.getElementById('cfgClientName').value;
+        const docTypeName = document.getElementById('cfgDocTypeName').value || docType;
+        fillConfigForm(Object.assign({}, data.data.config, {
+            clientName: clientName,
+            displayName: clientName,
+            docTypeName: docTypeName
+        }));
+        updateFilenamePreview();
+    } catch (e) {
+        alert('加载标准配置失败: ' + e.message);
+        select.value = '';
+    }
+}
+
+// 加载输出模板的变量目录（只加载一次）
+async function loadTemplateVarCatalogs() {
+    if (templateVarCatalogs.length > 0) return;
+    try {
+        const response = await fetch('/api/template-variables');
+        const data = await response.json();
+        if (data.success) templateVarCatalogs = data.data.catalogs || [];
+    } catch (e) {
+        console.error('加载模板变量目录失败:', e);
+    }
+}
+
+// 查找模板变量的定义
+function findTemplateVar(name) {
+    for (const catalog of templateVarCatalogs) {
+        const def = (catalog.variables || []).find(v => v.name === name);
+        if (def) return def;
+    }
+    return null;
+}
+
+// 渲染已设置的模板变量和「添加变量」下拉框
+function renderTemplateVars() {
+    const select = document.getElementById('tplVarAdd');
+    const list = document.getElementById('templateVarList');
+    if (!select || !list) return;
+    
+    select.innerHTML = '<option value="">选择要设置的变量...</option>';
+    templateVarCatalogs.forEach(catalog => {
+        const group = document.createElement('optgroup');
+        group.label = catalog.description;
+        (catalog.variables || []).forEach(v => {
+            if (v.name in templateVarValues) return;
+            const opt = document.createElement('option');
+            opt.value = v.name;
+            opt.textContent = v.name + ' - ' + v.description;
+            group.appendChild(opt);
+        });
+        if (group.children.length > 0) select.appendChild(group);
+    });
+    
+    list.innerHTML = '';
+    const names = Object.keys(templateVarValues);
+    if (names.length === 0) {
+        list.innerHTML = '<p class="form-hint">未设置模板变量，使用模板的默认值</p>';
+        return;
+    }
+    names.forEach(name => {
+        const def = findTemplateVar(name) || { name: name, type: 'string', description: '未知变量（保存时会被拒绝）' };
+        const row = document.createElement('div');
+        row.className = 'args-row';
+        
+        const label = document.createElement('label');
+        label.textContent = name;
+        label.title = def.description;
+        row.appendChild(label);
+        row.appendChild(createTemplateVarInput(def, templateVarValues[name]));
+        
+        const removeBtn = document.createElement('button');
+        removeBtn.type = 'button';
+        removeBtn.className = 'btn btn-ghost btn-sm';
+        removeBtn.textContent = '×';
+        removeBtn.title = '移除（使用模板默认值）';
+        removeBtn.onclick = () => {
+            delete templateVarValues[name];
+            renderTemplateVars();
+        };
+        row.appendChild(removeBtn);
+        list.appendChild(row);
+    });
+}
+
+// 按变量类型创建输入控件
+function createTemplateVarInput(def, value) {
+    let input;
+    if (def.type === 'boolean') {
+        input = document.createElement('input');
+        input.type = 'checkbox';
+        input.checked = value === true;
+        input.onchange = () => { templateVarValues[def.name] = input.checked; };
+    } else if (def.type === 'enum') {
+        input = document.createElement('select');
+        (def.values || []).forEach(v => {
+            const opt = document.createElement('option');
+            opt.value = v;
+            opt.textContent = v;
+            input.appendChild(opt);
+        });
+        input.value = value;
+        input.onchange = () => { templateVarValues[def.name] = input.value; };
+    } else if (def.type === 'color') {
+        input = document.createElement('input');
+        input.type = 'color';
+        input.value = '#' + (value || '000000');
+        input.onchange = () => { templateVarValues[def.name] = input.value.replace('#', '').toUpperCase(); };
+    } else if (def.type === 'number') {
+        input = document.createElement('input');
+        input.type = 'number';
+        input.step = 'any';
+        if (def.min !== undefined) input.min = def.min;
+        if (def.max !== undefined) input.max = def.max;
+        input.value = value;
+        input.onchange = () => { templateVarValues[def.name] = input.value === '' ? '' : parseFloat(input.value); };
+    } else {
+        input = document.createElement('input');
+        input.type = 'text';
+        input.value = value || '';
+        input.placeholder = def.type === 'path' ? '相对于项目根目录，如 src/images/logo.png' : (def.default || '');
+        input.oninput = () => { templateVarValues[def.name] = input.value; };
+    }
+    input.title = def.description;
+    return input;
+}
+
+// 添加模板变量（初始值取模板默认值）
+function addTemplateVar(name) {
+    if (!name) return;
+    const def = findTemplateVar(name);
+    let value = '';
+    if (def) {
+        if (def.type === 'boolean') {
+            value = def.default !== 'true';
+        } else if (def.type === 'number') {
+            value = def.default ? parseFloat(def.default) : (def.min !== undefined ? def.min : 0);
+        } else if (def.type === 'enum') {
+            value = def.default || (def.values || [])[0] || '';
+        } else if (def.type === 'color') {
+            value = def.default || '000000';
+        }
+    }
+    templateVarValues[name] = value;
+    renderTemplateVars();
+}
+
+// 收集模板变量（去掉空值）
+function collectTemplateVars() {
+    const result = {};
+    Object.keys(templateVarValues).forEach(name => {
+        const value = templateVarValues[name];
+        if (value === '' || value === null || (typeof value === 'number' && isNaN(value))) return;
+        result[name] = value;
+    });
+    return result;
+}
+
 // 隐藏配置模态框
 function hideConfigModal() {
     const modal = document.getElementById('configModal');
@@ -1220,6 +1554,12 @@ function renderSelectedModules() {
             label.appendChild(dirTag);
         }
         
+        // 包含条件（点击编辑）
+        const condition = document.createElement('span');
+        condition.className = 'module-condition' + (moduleConditions[path] ? ' active' : '');
+        condition.textContent = moduleConditions[path] ? '条件: ' + formatModuleCondition(moduleConditions[path]) : '条件';
+        condition.title = '设置包含条件，如 format == "pdf"';
+        
         // 拖拽手柄
         const handle = document.createElement('span');
         handle.className = 'drag-handle';
@@ -1227,11 +1567,16 @@ function renderSelectedModules() {
         
         item.appendChild(order);
         item.appendChild(label);
+        item.appendChild(condition);
         item.appendChild(handle);
         
         // 点击移除
         item.onclick = (e) => {
             if (e.target.classList.contains('drag-handle')) return;
+            if (e.target.classList.contains('module-condition')) {
+                editModuleCondition(path);
+                return;
+            }
             removeModule(path);
         };
         
@@ -1246,6 +1591,52 @@ function renderSelectedModules() {
     });
 }
 
+// 格式化模块条件（字符串为表达式，对象为键值匹配）
+function formatModuleCondition(when) {
+    if (typeof when === 'string') return when;
+    return Object.entries(when)
+        .map(([key, val]) => key + '=' + (Array.isArray(val) ? val.join('|') : val))
+        .join(', ');
+}
+
+// 编辑模块包含条件（留空表示总是包含）
+function editModuleCondition(path) {
+    const current = moduleConditions[path];
+    const initial = current === undefined ? '' : (typeof current === 'string' ? current : JSON.stringify(current));
+    const input = prompt('包含条件（留空表示总是包含）\n表达式如 format == "pdf" && environment != "测试环境"\n也可以输入 JSON 对象，如 {"format": "pdf"}', initial);
+    if (input === null) return;
+    
+    const text = input.trim();
+    if (!text) {
+        delete moduleConditions[path];
+    } else if (text.startsWith('{')) {
+        try {
+            moduleConditions[path] = JSON.parse(text);
+        } catch (e) {
+            alert('条件格式无效: ' + e.message);
+            return;
+        }
+    } else {
+        moduleConditions[path] = text;
+    }
+    renderSelectedModules();
+}
+
+// 把配置中的模块条目拆分为路径列表和条件
+function loadModuleEntries(entries) {
+    moduleConditions = {};
+    return (entries || []).map(entry => {
+        if (typeof entry === 'string') return entry;
+        if (entry.when) moduleConditions[entry.path] = entry.when;
+        return entry.path;
+    });
+}
+
+// 生成保存用的模块条目（带条件的模块保存为对象）
+function buildModuleEntries() {
+    return selectedModules.map(path => moduleConditions[path] ? { path: path, when: moduleConditions[path] } : path);
+}
+
 // 根据路径查找模块
 function findModuleByPath(path) {
     // 先在扁平列表中查找
@@ -1567,8 +1958,16 @@ function resetConfigForm() {
     setVal('pdfHeaderLeft', '\\leftmark');
     setVal('pdfHeaderRight', '\\thepage');
     
+    // Word 选项重置
+    loadedWordOptions = {};
+    fillWordOptions({});
+    
     selectedModules = [];
+    moduleConditions = {};
     renderTransferUI();
+    
+    templateVarValues = {};
+    renderTemplateVars();
 }
 function fillConfigForm(config) {
     console.log('fillConfigForm 收到配置:', JSON.stringify(config, null, 2));
@@ -1666,9 +2065,59 @@ function fillConfigForm(config) {
     setVal('pdfHeaderLeft', pdf['header-left'] || '\\leftmark');
     setVal('pdfHeaderRight', pdf['header-right'] || '\\thepage');
     
+    // Word 选项
+    loadedWordOptions = Object.assign({}, config.wordOptions || {});
+    fillWordOptions(loadedWordOptions);
+    
     // 模块列表
-    selectedModules = config.modules || [];
+    selectedModules = loadModuleEntries(config.modules);
     renderTransferUI();
+    
+    // 模板变量
+    templateVarValues = Object.assign({}, config.templateVariables || {});
+    renderTemplateVars();
+}
+
+// 填充 Word 选项（开关类选项为空表示跟随通用设置）
+function fillWordOptions(word) {
+    const setVal = (id, val) => { const el = document.getElementById(id); if (el) el.value = val; };
+    const boolVal = (val) => val === true ? 'true' : (val === false ? 'false' : '');
+    
+    setVal('wordToc', boolVal(word.toc));
+    setVal('wordTocDepth', word['toc-depth'] ? String(word['toc-depth']) : '');
+    setVal('wordNumberSections', boolVal(word['number-sections']));
+    setVal('wordHighlightStyle', word['highlight-style'] || '');
+    const pageBreak = document.getElementById('wordPageBreak');
+    if (pageBreak) pageBreak.checked = word['page-break-before-chapter'] === true;
+    setVal('wordTableStyle', word['table-style'] || '');
+    setVal('wordFigurePrefix', word['figure-prefix'] || '');
+    setVal('wordTablePrefix', word['table-prefix'] || '');
+}
+
+// 收集 Word 选项（保留配置中界面不处理的字段，如 reference-doc）
+function collectWordOptions() {
+    const getVal = (id) => { const el = document.getElementById(id); return el ? el.value.trim() : ''; };
+    const toBool = (val) => val === '' ? null : val === 'true';
+    const pageBreak = document.getElementById('wordPageBreak');
+    
+    const word = Object.assign({}, loadedWordOptions, {
+        toc: toBool(getVal('wordToc')),
+        'toc-depth': getVal('wordTocDepth') ? parseInt(getVal('wordTocDepth'), 10) : null,
+        'number-sections': toBool(getVal('wordNumberSections')),
+        'highlight-style': getVal('wordHighlightStyle'),
+        'page-break-before-chapter': pageBreak && pageBreak.checked ? true : null,
+        'table-style': getVal('wordTableStyle'),
+        'figure-prefix': getVal('wordFigurePrefix'),
+        'table-prefix': getVal('wordTablePrefix')
+    });
+    
+    // 清理空值
+    Object.keys(word).forEach(key => {
+        if (word[key] === '' || word[key] === null) {
+            delete word[key];
+        }
+    });
+    return word;
 }
 
 // 更新文件名预览
@@ -1825,14 +2274,21 @@ async function submitConfig() {
         docTypeName: docTypeName,
         displayName: displayName || clientName,
         template: template,
-        modules: selectedModules,
+        modules: buildModuleEntries(),
         pandocArgs: pandocArgs,
         outputPattern: outputPattern || '{client}_' + docTypeName + '_{date}.docx',
         pdfOptions: pdfOptions,
+        wordOptions: collectWordOptions(),
+        templateVariables: collectTemplateVars(),
         variables: variables,
         metadata: Object.keys(metadata).length > 0 ? metadata : null
     };
     
+    // 新建时记录复制来源，之后可以与标准配置对比
+    if (!currentEditConfig && getVal('cfgUpstream')) {
+        configData.upstream = getVal('cfgUpstream');
+    }
+    
     const submitBtn = document.querySelector('.modal-footer .btn-primary');
     setLoading(submitBtn, true);
     
@@ -1845,13 +2301,29 @@ async function submitConfig() {
             method = 'PUT';
         }
         
-        const response = await fetch(url, {
+        let response = await fetch(url, {
             method: method,
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify(configData)
         });
         
-        const data = await response.json();
+        let data = await response.json();
+        
+        // 不在允许列表中的 Pandoc 参数需要管理员确认
+        if (!data.success && data.code === 'PANDOC_ARGS_REJECTED') {
+            const reasons = ((data.data && data.data.errors) || []).map(e => '  ' + e.arg + '：' + e.message).join('\n');
+            if (!window.currentUser || window.currentUser.role !== 'admin') {
+                throw new Error(data.error + '\n请联系管理员确认这些参数');
+            }
+            if (!confirm('以下 Pandoc 参数不在允许列表中：\n' + reasons + '\n\n确认以管理员身份允许这些参数？')) throw new Error(data.error);
+            configData.approvePandocArgs = true;
+            response = await fetch(url, {
+                method: method,
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(configData)
+            });
+            data = await response.json();
+        }
         if (!data.success) throw new Error(data.error);
         
         alert(currentEditConfig ? '配置更新成功' : '配置创建成功');
@@ -1907,7 +2379,7 @@ function confirmDeleteConfig(clientName, docTypeName) {
     
     if (!modal) return;
     
-    message.textContent = '确定要删除配置 "' + docTypeName + '" 吗？此操作不可恢复。';
+    message.textContent = '确定要删除配置 "' + docTypeName + '" 吗？删除后可以从回收站恢复。';
     confirmBtn.onclick = function() { deleteConfig(clientName, docTypeName); };
     
     openModal(modal);
@@ -1929,7 +2401,7 @@ async function deleteConfig(clientName, docTypeName) {
         if (!data.success) throw new Error(data.error);
         
         hideConfirmModal();
-        alert('配置删除成功');
+        alert(data.data && data.data.trashId ? '配置已移入回收站' : '配置删除成功');
         loadClients(); // 刷新客户列表
         
         // 刷新文档列表
@@ -0,0 +1,74 @@
+/**
+ * 登录状态
+ * - 接口返回 401 时跳转到登录页，登录后回到当前页面
+ * - 在页面顶部显示当前用户和退出按钮
+ */
+(function () {
+    const originalFetch = window.fetch.bind(window);
+
+    function redirectToLogin() {
+        const next = location.pathname + location.search + location.hash;
+        location.href = '/login?next=' + encodeURIComponent(next);
+    }
+
+    window.fetch = async function (input, init) {
+        const response = await originalFetch(input, init);
+        const url = typeof input === 'string' ? input : (input && input.url) || '';
+        if (response.status === 401 && url.indexOf('/api/') !== -1 && url.indexOf('/api/auth/login') === -1) {
+            const data = await response.clone().json().catch(() => null);
+            if (data && data.code === 'UNAUTHORIZED') {
+                redirectToLogin();
+            }
+        }
+        return response;
+    };
+
+    async function logout() {
+        await originalFetch('/api/auth/logout', { method: 'POST' }).catch(() => null);
+        redirectToLogin();
+    }
+
+    const roleNames = {
+        viewer: '查看者',
+        author: '作者',
+        builder: '构建者',
+        admin: '管理员'
+    };
+
+    async function showCurrentUser() {
+        const response = await window.fetch('/api/auth/me').catch(() => null);
+        if (!response || !response.ok) {
+            return;
+        }
+        const result = await response.json();
+        const user = result.data && result.data.user;
+        if (!user) {
+            return;
+        }
+        window.currentUser = user;
+
+        const container = document.querySelector('.header-actions') || document.querySelector('.header-right');
+        if (!container) {
+            return;
+        }
+        const badge = document.createElement('span');
+        badge.className = 'header-user';
+        badge.textContent = (user.displayName || user.username) + '（' + (roleNames[user.role] || user.role) + '）';
+        if (user.clients && user.clients.length > 0) {
+            badge.title = '可访问的客户: ' + user.clients.join('、');
+        }
+        const button = document.createElement('button');
+        button.className = 'header-btn header-logout-btn';
+        button.type = 'button';
+        button.textContent = '退出';
+        button.addEventListener('click', logout);
+        container.appendChild(badge);
+        container.appendChild(button);
+    }
+
+    if (document.readyState === 'loading') {
+        document.addEventListener('DOMContentLoaded', showCurrentUser);
+    } else {
+        showCurrentUser();
+    }
+})();
@@ -5,6 +5,8 @@
 let vditorInstance = null;
 let currentEditPath = null;
 let originalContent = '';
+let currentEtag = ''; // 读取模块时的 ETag，保存时通过 If-Match 传回
+let baseContent = ''; // 与 currentEtag 对应的服务器内容，用于自动合并其他人的修改
 let hasUnsavedChanges = false;
 let editorReady = false; // 编辑器是否已完全初始化
 
@@ -112,6 +114,8 @@ async function openEditor(modulePath) {
 
         currentEditPath = modulePath;
         const content = data.data.content || '';
+        currentEtag = data.data.etag || '';
+        baseContent = content;
 
         // 更新标题
         const fileName = modulePath.split('/').pop();
@@ -226,21 +230,38 @@ async function saveModule() {
     try {
         const response = await fetch('/api/editor/module', {
             method: 'PUT',
-            headers: { 'Content-Type': 'application/json' },
+            headers: {
+                'Content-Type': 'application/json',
+                'If-Match': currentEtag
+            },
             body: JSON.stringify({
                 path: currentEditPath,
-                content: content
+                content: content,
+                base: baseContent
             })
         });
 
         const data = await response.json();
 
+        if (data.code === 'EDIT_CONFLICT') {
+            resolveSaveConflict(data);
+            return;
+        }
         if (!data.success) {
             throw new Error(data.error || '保存失败');
         }
 
-        // 更新原始内容
-        originalContent = content;
+        // 更新原始内容（其他人的修改已自动合并时换成合并后的内容）
+        currentEtag = data.data.etag;
+        if (data.data.merged) {
+            vditorInstance.setValue(data.data.content);
+            baseContent = data.data.content;
+            originalContent = data.data.content;
+            showToast('已自动合并其他人的修改', 'info');
+        } else {
+            baseContent = content;
+            originalContent = content;
+        }
         hasUnsavedChanges = false;
         updateSaveButtonState();
 
@@ -261,6 +282,31 @@ async function saveModule() {
     }
 }
 
+// 处理保存冲突：模块已被其他人修改且无法自动合并
+function resolveSaveConflict(data) {
+    const current = data.data.current;
+    const merge = data.data.merge;
+
+    if (merge && confirm(`模块已被其他人修改，有 ${merge.conflicts} 处冲突。\n\n确定：载入合并结果，冲突处用 <<<<<<< 和 >>>>>>> 标出，处理后再保存\n取消：不合并`)) {
+        vditorInstance.setValue(merge.content);
+    } else if (confirm('模块已被其他人修改。\n\n确定：用当前编辑的内容覆盖服务器上的版本（其他人的修改将丢失）\n取消：暂不保存')) {
+        currentEtag = current.etag;
+        baseContent = current.content;
+        saveModule();
+        return;
+    } else {
+        showToast('未保存: ' + data.error, 'warning');
+        return;
+    }
+
+    // 以服务器上的当前版本为基础继续编辑
+    currentEtag = current.etag;
+    baseContent = current.content;
+    hasUnsavedChanges = true;
+    updateSaveButtonState();
+    showToast('请处理标出的冲突后再保存', 'warning');
+}
+
 // 关闭编辑器
 function closeEditor() {
     if (hasUnsavedChanges) {
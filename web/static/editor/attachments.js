@@ -447,8 +447,10 @@
             const data = await response.json();
 
             if (data.success) {
-                EditorApp.Utils.showToast('附件已重命名', 'success');
+                const refs = data.data.references || [];
+                EditorApp.Utils.showToast(refs.length > 0 ? `附件已重命名，已更新 ${refs.length} 处引用` : '附件已重命名', 'success');
                 loadAttachments(tab.path);
+                reloadReferencingTabs(refs);
             } else {
                 EditorApp.Utils.showToast('重命名失败: ' + data.error, 'error');
             }
@@ -458,6 +460,20 @@
         }
     }
 
+    // 引用被服务器修改的已打开模块：没有未保存修改时重新加载，否则保存时自动合并
+    function reloadReferencingTabs(refs) {
+        const state = EditorApp.State.getState();
+        const modules = new Set(refs.map(ref => ref.module));
+        state.tabs.forEach(tab => {
+            if (!modules.has(tab.path) || tab.type === 'image') return;
+            if (tab.isDirty) {
+                EditorApp.Utils.showToast(`${tab.title} 中的图片引用已在服务器上更新，保存时会自动合并`, 'warning', 5000);
+            } else if (EditorApp.Vditor) {
+                EditorApp.Vditor.reloadContent(tab);
+            }
+        });
+    }
+
     // 删除附件
     async function deleteAttachment(attachment) {
         if (!confirm(`确定要删除附件 "${attachment.name}" 吗？`)) {
@@ -473,23 +489,42 @@
         const fullPath = dir ? dir + '/' + attachment.path : attachment.path;
 
         try {
-            const response = await fetch('/api/editor/module?path=' + encodeURIComponent(fullPath), {
-                method: 'DELETE'
-            });
-            const data = await response.json();
-
-            if (data.success) {
-                EditorApp.Utils.showToast('附件已删除', 'success');
-                loadAttachments(tab.path);
-            } else {
-                EditorApp.Utils.showToast('删除失败: ' + data.error, 'error');
-            }
+            const result = await deleteImage(fullPath);
+            if (!result) return;
+            EditorApp.Utils.showToast(result.trashId ? '附件已移入回收站' : '附件已删除', 'success');
+            loadAttachments(tab.path);
         } catch (e) {
             console.error('删除附件失败:', e);
-            EditorApp.Utils.showToast('删除失败', 'error');
+            EditorApp.Utils.showToast('删除失败: ' + e.message, 'error');
         }
     }
 
+    // 删除图片（path 相对于 src）：仍被模块引用时列出引用位置，确认后强制删除
+    // 返回删除结果，取消时返回 null
+    async function deleteImage(path) {
+        let data = await requestDeleteImage(path, false);
+        if (data.code === 'IMAGE_IN_USE') {
+            const refs = data.data.references || [];
+            const lines = refs.slice(0, 10).map(ref => `  ${ref.module}:${ref.line}  ${ref.target}`);
+            if (refs.length > 10) lines.push(`  …共 ${refs.length} 处`);
+            if (!confirm(`${data.error}\n\n${lines.join('\n')}\n\n仍然删除吗？这些位置在构建时会缺少图片。`)) {
+                return null;
+            }
+            data = await requestDeleteImage(path, true);
+        }
+        if (!data.success) throw new Error(data.error);
+        return data.data;
+    }
+
+    async function requestDeleteImage(path, force) {
+        const headers = EditorApp.Presence ? EditorApp.Presence.sourceHeaders() : {};
+        const response = await fetch('/api/editor/image/' + encodeURIComponent(path) + (force ? '?force=true' : ''), {
+            method: 'DELETE',
+            headers: headers
+        });
+        return response.json();
+    }
+
     // 初始化附件面板事件
     function init() {
         const state = EditorApp.State.getState();
@@ -592,6 +627,7 @@
         closePreview: closeAttachmentPreview,
         rename: renameAttachment,
         delete: deleteAttachment,
+        deleteImage: deleteImage,
         showContextMenu: showAttachmentContextMenu,
         hideContextMenu: hideAttachmentContextMenu,
         onContextAction: onAttachmentContextAction,
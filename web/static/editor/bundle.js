@@ -186,6 +186,7 @@ EditorApp.State = (function() {
         contextMenuTarget: null,
         pendingCloseTabId: null,
         renameTarget: null,
+        renamePreviewPath: null, // 已预览引用修改的新路径
 
         // 拖拽排序
         draggingPath: null,
@@ -2724,6 +2725,28 @@ EditorApp.Vditor = (function() {
 
     // ==================== 文件内容 ====================
 
+    // 转换相对路径图片为绝对路径（用于编辑器显示）
+    function toEditorContent(content, path) {
+        const linkBase = EditorApp.Utils.calculateLinkBase(path);
+        return content.replace(
+            /!\[([^\]]*)\]\((?!https?:\/\/|\/)(images\/[^)]+)\)/gi,
+            (_, alt, src) => {
+                // 移除开头的 ./
+                const cleanSrc = src.replace(/^\.\//, '');
+                return `![${alt}](${linkBase}${cleanSrc})`;
+            }
+        );
+    }
+
+    // 用服务器返回的内容替换编辑器中的内容
+    function applyServerContent(tab, content) {
+        tab.content = toEditorContent(content, tab.path);
+        const editor = state.editors.get(tab.id);
+        if (editor) {
+            editor.setValue(tab.content);
+        }
+    }
+
     async function loadContent(tab) {
         try {
             const response = await fetch('/api/editor/module?path=' + encodeURIComponent(tab.path));
@@ -2731,21 +2754,11 @@ EditorApp.Vditor = (function() {
 
             if (!data.success) throw new Error(data.error);
 
-            let content = data.data.content;
-            
-            // 转换相对路径图片为绝对路径（用于编辑器显示）
-            const linkBase = EditorApp.Utils.calculateLinkBase(tab.path);
-            content = content.replace(
-                /!\[([^\]]*)\]\((?!https?:\/\/|\/)(images\/[^)]+)\)/gi,
-                (_, alt, src) => {
-                    // 移除开头的 ./
-                    const cleanSrc = src.replace(/^\.\//, '');
-                    return `![${alt}](${linkBase}${cleanSrc})`;
-                }
-            );
-
-            tab.content = content;
+            tab.content = toEditorContent(data.data.content, tab.path);
             tab.originalContent = data.data.content;
+            // 保存时用于检测和合并其他人的修改
+            tab.etag = data.data.etag;
+            tab.baseContent = data.data.content;
 
             if (state.activeTabId === tab.id) {
                 show(tab);
@@ -2756,6 +2769,23 @@ EditorApp.Vditor = (function() {
         }
     }
 
+    // 重新加载服务器上的内容（其他人保存后，没有未保存修改的标签自动更新）
+    async function reloadContent(tab) {
+        try {
+            const response = await fetch('/api/editor/module?path=' + encodeURIComponent(tab.path));
+            const data = await response.json();
+            if (!data.success) throw new Error(data.error);
+
+            tab.etag = data.data.etag;
+            tab.baseContent = data.data.content;
+            applyServerContent(tab, data.data.content);
+            tab.originalContent = tab.content;
+            tab.isDirty = false;
+        } catch (e) {
+            console.error('重新加载文件失败:', e);
+        }
+    }
+
     async function saveCurrentFile(silent = false) {
         const tab = state.tabs.find(t => t.id === state.activeTabId);
         if (!tab || !tab.isDirty) return;
@@ -2772,16 +2802,34 @@ EditorApp.Vditor = (function() {
 
             const response = await fetch('/api/editor/module', {
                 method: 'PUT',
-                headers: { 'Content-Type': 'application/json' },
+                headers: Object.assign({
+                    'Content-Type': 'application/json',
+                    'If-Match': tab.etag || ''
+                }, EditorApp.Presence ? EditorApp.Presence.sourceHeaders() : {}),
                 body: JSON.stringify({
                     path: tab.path,
-                    content: contentToSave
+                    content: contentToSave,
+                    base: tab.baseContent
                 })
             });
 
             const data = await response.json();
+            if (data.code === 'EDIT_CONFLICT') {
+                await resolveConflict(tab, data, silent);
+                return;
+            }
             if (!data.success) throw new Error(data.error);
 
+            tab.etag = data.data.etag;
+            tab.conflictEtag = null;
+            if (data.data.merged) {
+                // 其他人的修改已自动合并，编辑器换成合并后的内容
+                tab.baseContent = data.data.content;
+                applyServerContent(tab, data.data.content);
+                EditorApp.Utils.showToast('已自动合并其他人的修改', 'info');
+            } else {
+                tab.baseContent = contentToSave;
+            }
             tab.originalContent = tab.content;
             tab.isDirty = false;
 
@@ -2805,6 +2853,37 @@ EditorApp.Vditor = (function() {
         }
     }
 
+    // 处理保存冲突：文件已被其他人修改且无法自动合并
+    async function resolveConflict(tab, data, silent) {
+        const current = data.data.current;
+        const merge = data.data.merge;
+        const fileName = tab.path.split('/').pop();
+
+        // 自动保存时同一个服务器版本只提示一次
+        if (silent && tab.conflictEtag === current.etag) return;
+        tab.conflictEtag = current.etag;
+
+        if (merge && confirm(`${fileName} 已被其他人修改，有 ${merge.conflicts} 处冲突。\n\n确定：载入合并结果，冲突处用 <<<<<<< 和 >>>>>>> 标出，处理后再保存\n取消：不合并`)) {
+            tab.etag = current.etag;
+            tab.baseContent = current.content;
+            applyServerContent(tab, merge.content);
+            tab.isDirty = true;
+            if (EditorApp.Tabs) {
+                EditorApp.Tabs.render();
+            }
+            EditorApp.Utils.showToast('请处理标出的冲突后再保存', 'warning');
+            return;
+        }
+
+        if (confirm(`${fileName} 已被其他人修改。\n\n确定：用当前编辑的内容覆盖服务器上的版本（其他人的修改将丢失）\n取消：暂不保存`)) {
+            tab.etag = current.etag;
+            tab.baseContent = current.content;
+            await saveCurrentFile(silent);
+            return;
+        }
+        EditorApp.Utils.showToast('未保存: ' + data.error, 'warning');
+    }
+
     // ==================== 编辑器管理 ====================
 
     function show(tab) {
@@ -3124,6 +3203,7 @@ EditorApp.Vditor = (function() {
     // 导出公共接口
     return {
         loadContent: loadContent,
+        reloadContent: reloadContent,
         saveCurrentFile: saveCurrentFile,
         show: show,
         create: create,
@@ -3997,6 +4077,11 @@ window.toggleGitSection = EditorApp.Git.toggleSection;
 
     // ==================== 文件操作功能 ====================
 
+    // 修改模块的请求带上推送连接 ID，其他人会收到通知，自己不会
+    function presenceHeaders() {
+        return EditorApp.Presence ? EditorApp.Presence.sourceHeaders() : {};
+    }
+
     function showNewFileModal() {
         const state = EditorApp.State.getState();
         const modal = document.getElementById('newFileModal');
@@ -4029,7 +4114,7 @@ window.toggleGitSection = EditorApp.Git.toggleSection;
         try {
             const response = await fetch('/api/editor/module', {
                 method: 'POST',
-                headers: { 'Content-Type': 'application/json' },
+                headers: Object.assign({ 'Content-Type': 'application/json' }, presenceHeaders()),
                 body: JSON.stringify({ path })
             });
 
@@ -4046,13 +4131,24 @@ window.toggleGitSection = EditorApp.Git.toggleSection;
         }
     }
 
+    // 重命名预览中修改类型的名称
+    const RENAME_KIND_LABELS = {
+        move: '移动',
+        override: '客户覆盖',
+        config: '客户配置',
+        order: '排序',
+        link: '链接',
+        include: '引用'
+    };
+
     function showRenameModal() {
         const state = EditorApp.State.getState();
         if (!state.contextMenuTarget) return;
 
         const modal = document.getElementById('renameModal');
-        document.getElementById('newFileName').value = state.contextMenuTarget.name;
+        document.getElementById('newFileName').value = state.contextMenuTarget.path;
         state.renameTarget = state.contextMenuTarget;
+        resetRenamePreview();
 
         EditorApp.Utils.openModal(modal);
     }
@@ -4061,45 +4157,96 @@ window.toggleGitSection = EditorApp.Git.toggleSection;
         const state = EditorApp.State.getState();
         EditorApp.Utils.closeModal(document.getElementById('renameModal'));
         state.renameTarget = null;
+        resetRenamePreview();
+    }
+
+    function resetRenamePreview() {
+        const state = EditorApp.State.getState();
+        state.renamePreviewPath = null;
+        const preview = document.getElementById('renamePreview');
+        preview.innerHTML = '';
+        preview.style.display = 'none';
+        document.getElementById('renameConfirmBtn').textContent = '确认';
+    }
+
+    async function requestRename(oldPath, newPath, dryRun) {
+        const response = await fetch('/api/editor/module/' + encodeURIComponent(oldPath) + '/rename', {
+            method: 'PUT',
+            headers: Object.assign({ 'Content-Type': 'application/json' }, presenceHeaders()),
+            body: JSON.stringify({ newPath, dryRun })
+        });
+        const data = await response.json();
+        if (!data.success) throw new Error(data.error);
+        return data.data;
+    }
+
+    // 列出重命名会修改的引用，返回是否有需要确认的修改
+    function renderRenamePreview(result) {
+        const changes = result.changes.filter(c => c.kind !== 'move');
+        if (changes.length === 0) return false;
+
+        const preview = document.getElementById('renamePreview');
+        preview.innerHTML = '';
+        const summary = document.createElement('div');
+        summary.className = 'rename-preview-summary';
+        summary.textContent = `将同时修改 ${result.files.length} 个文件中的 ${changes.length} 处引用：`;
+        preview.appendChild(summary);
+
+        const list = document.createElement('ul');
+        list.className = 'rename-preview-list';
+        changes.forEach(change => {
+            const item = document.createElement('li');
+            const location = change.line ? `${change.file}:${change.line}` : change.file;
+            item.textContent = `[${RENAME_KIND_LABELS[change.kind] || change.kind}] ${location}  ${change.before} → ${change.after}`;
+            list.appendChild(item);
+        });
+        preview.appendChild(list);
+        preview.style.display = 'block';
+        document.getElementById('renameConfirmBtn').textContent = '确认重命名';
+        return true;
     }
 
     async function confirmRename() {
         const state = EditorApp.State.getState();
         if (!state.renameTarget) return;
 
-        const newName = document.getElementById('newFileName').value.trim();
-        if (!newName) {
-            EditorApp.Utils.showToast('请输入新文件名', 'warning');
+        const newPath = document.getElementById('newFileName').value.trim().replace(/^\/+/, '');
+        if (!newPath) {
+            EditorApp.Utils.showToast('请输入新路径', 'warning');
             return;
         }
 
         const oldPath = state.renameTarget.path;
-        const dir = oldPath.substring(0, oldPath.lastIndexOf('/'));
-        const newPath = dir ? dir + '/' + newName : newName;
+        if (newPath === oldPath) {
+            hideRenameModal();
+            return;
+        }
 
         try {
-            const response = await fetch('/api/editor/module/' + encodeURIComponent(oldPath) + '/rename', {
-                method: 'PUT',
-                headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({ newPath })
-            });
-
-            const data = await response.json();
-            if (!data.success) throw new Error(data.error);
+            // 先预览要修改的引用，确认后再执行
+            if (state.renamePreviewPath !== newPath) {
+                const preview = await requestRename(oldPath, newPath, true);
+                state.renamePreviewPath = newPath;
+                if (renderRenamePreview(preview)) return;
+            }
 
+            const result = await requestRename(oldPath, newPath, false);
             hideRenameModal();
-            EditorApp.Utils.showToast('重命名成功', 'success');
-
-            // 更新标签
-            const tab = state.tabs.find(t => t.path === oldPath);
-            if (tab) {
-                tab.path = newPath;
-                tab.title = newName.replace('.md', '');
-                EditorApp.Tabs.render();
-            }
+            const refs = result.result.files.length;
+            EditorApp.Utils.showToast(refs > 0 ? `重命名成功，已更新 ${refs} 个文件中的引用` : '重命名成功', 'success');
+
+            // 更新标签（移动目录时更新其中所有已打开的模块）
+            state.tabs.forEach(tab => {
+                if (tab.path === oldPath || tab.path.startsWith(oldPath + '/')) {
+                    tab.path = newPath + tab.path.substring(oldPath.length);
+                    tab.title = tab.path.split('/').pop().replace('.md', '');
+                }
+            });
+            EditorApp.Tabs.render();
 
             await EditorApp.Tree.load();
         } catch (e) {
+            resetRenamePreview();
             EditorApp.Utils.showToast('重命名失败: ' + e.message, 'error');
         }
     }
@@ -4110,7 +4257,7 @@ window.toggleGitSection = EditorApp.Git.toggleSection;
 
         const modal = document.getElementById('deleteModal');
         const message = document.getElementById('deleteMessage');
-        message.textContent = `确定要删除 "${state.contextMenuTarget.name}" 吗？此操作不可撤销。`;
+        message.textContent = `确定要删除 "${state.contextMenuTarget.name}" 吗？删除后可以在回收站中恢复。`;
 
         EditorApp.Utils.openModal(modal);
     }
@@ -4127,20 +4274,23 @@ window.toggleGitSection = EditorApp.Git.toggleSection;
         const isImage = state.contextMenuTarget.type === 'image';
 
         try {
-            // 根据文件类型选择不同的 API
-            const apiUrl = isImage 
-                ? '/api/editor/image/' + encodeURIComponent(path)
-                : '/api/editor/module/' + encodeURIComponent(path);
-            
-            const response = await fetch(apiUrl, {
-                method: 'DELETE'
-            });
-
-            const data = await response.json();
-            if (!data.success) throw new Error(data.error);
+            let result;
+            if (isImage) {
+                // 仍被模块引用的图片需要再次确认
+                result = await EditorApp.Attachments.deleteImage(path);
+                if (!result) return;
+            } else {
+                const response = await fetch('/api/editor/module/' + encodeURIComponent(path), {
+                    method: 'DELETE',
+                    headers: presenceHeaders()
+                });
+                const data = await response.json();
+                if (!data.success) throw new Error(data.error);
+                result = data.data;
+            }
 
             hideDeleteModal();
-            EditorApp.Utils.showToast('删除成功', 'success');
+            EditorApp.Utils.showToast(result && result.trashId ? '已移入回收站' : '删除成功', 'success');
 
             // 关闭相关标签
             const tab = state.tabs.find(t => t.path === path);
@@ -4154,6 +4304,89 @@ window.toggleGitSection = EditorApp.Git.toggleSection;
         }
     }
 
+    // ==================== 回收站 ====================
+
+    const TRASH_KIND_LABELS = { module: '模块', image: '图片' };
+
+    async function showTrashModal() {
+        EditorApp.Utils.openModal(document.getElementById('trashModal'));
+        await loadTrash();
+    }
+
+    function hideTrashModal() {
+        EditorApp.Utils.closeModal(document.getElementById('trashModal'));
+    }
+
+    async function loadTrash() {
+        const list = document.getElementById('trashList');
+        list.innerHTML = '<div class="trash-empty">加载中...</div>';
+        try {
+            const response = await fetch('/api/trash');
+            const data = await response.json();
+            if (!data.success) throw new Error(data.error);
+
+            // 编辑器只处理模块和图片，配置和资源在首页恢复
+            const items = (data.data.items || []).filter(item => TRASH_KIND_LABELS[item.kind]);
+            if (items.length === 0) {
+                list.innerHTML = '<div class="trash-empty">回收站是空的</div>';
+                return;
+            }
+            list.innerHTML = '';
+            items.forEach(item => {
+                const row = document.createElement('div');
+                row.className = 'trash-item';
+
+                const info = document.createElement('div');
+                info.className = 'trash-item-info';
+                const name = document.createElement('div');
+                name.className = 'trash-item-name';
+                name.textContent = item.name;
+                const meta = document.createElement('div');
+                meta.className = 'trash-item-meta';
+                meta.textContent = `${TRASH_KIND_LABELS[item.kind]} · ${item.deletedBy || '未知'} 删除于 ${new Date(item.deletedAt).toLocaleString()}`;
+                info.appendChild(name);
+                info.appendChild(meta);
+
+                const button = document.createElement('button');
+                button.className = 'btn btn-secondary btn-sm';
+                button.textContent = '恢复';
+                button.addEventListener('click', () => restoreTrashItem(item));
+
+                row.appendChild(info);
+                row.appendChild(button);
+                list.appendChild(row);
+            });
+        } catch (e) {
+            list.innerHTML = '<div class="trash-empty">加载失败</div>';
+            EditorApp.Utils.showToast('加载回收站失败: ' + e.message, 'error');
+        }
+    }
+
+    async function restoreTrashItem(item, onConflict) {
+        try {
+            const response = await fetch('/api/trash/' + encodeURIComponent(item.id) + '/restore', {
+                method: 'POST',
+                headers: Object.assign({ 'Content-Type': 'application/json' }, presenceHeaders()),
+                body: JSON.stringify({ onConflict: onConflict || 'fail' })
+            });
+            const data = await response.json();
+            if (data.code === 'TRASH_CONFLICT') {
+                if (confirm(`"${item.name}" 的位置已有同名文件。\n\n确定：恢复为新的文件名（文件名后加上"-恢复"）\n取消：不恢复`)) {
+                    await restoreTrashItem(item, 'rename');
+                }
+                return;
+            }
+            if (!data.success) throw new Error(data.error);
+
+            const restored = data.data.result.files[0].replace(/^src\//, '');
+            EditorApp.Utils.showToast('已恢复: ' + restored, 'success');
+            await EditorApp.Tree.load();
+            await loadTrash();
+        } catch (e) {
+            EditorApp.Utils.showToast('恢复失败: ' + e.message, 'error');
+        }
+    }
+
     // ==================== 右键菜单 ====================
 
     function showContextMenu(e, item) {
@@ -4190,7 +4423,7 @@ window.toggleGitSection = EditorApp.Git.toggleSection;
             // 其他文件类型：显示所有菜单项
             if (newItem) newItem.style.display = 'block';
             if (newFolderItem) newFolderItem.style.display = 'block';
-            if (renameItem) renameItem.style.display = isDirectory ? 'none' : 'block';
+            if (renameItem) renameItem.style.display = 'block';
             dividers.forEach(d => d.style.display = 'block');
             if (deleteItem) deleteItem.style.display = 'block';
             // 只对文件显示历史选项
@@ -4273,13 +4506,16 @@ window.toggleGitSection = EditorApp.Git.toggleSection;
         showRenameModal: showRenameModal,
         hideRenameModal: hideRenameModal,
         confirmRename: confirmRename,
+        resetRenamePreview: resetRenamePreview,
         showDeleteModal: showDeleteModal,
         hideDeleteModal: hideDeleteModal,
         confirmDelete: confirmDelete,
         showContextMenu: showContextMenu,
         hideContextMenu: hideContextMenu,
         onContextMenu: onContextMenu,
-        onContextAction: onContextAction
+        onContextAction: onContextAction,
+        showTrashModal: showTrashModal,
+        hideTrashModal: hideTrashModal
     };
 
     // 暴露到全局作用域（向后兼容）
@@ -4289,6 +4525,7 @@ window.toggleGitSection = EditorApp.Git.toggleSection;
     window.showRenameModal = showRenameModal;
     window.hideRenameModal = hideRenameModal;
     window.confirmRename = confirmRename;
+    window.resetRenamePreview = resetRenamePreview;
     window.showDeleteModal = showDeleteModal;
     window.hideDeleteModal = hideDeleteModal;
     window.confirmDelete = confirmDelete;
@@ -4296,6 +4533,8 @@ window.toggleGitSection = EditorApp.Git.toggleSection;
     window.hideContextMenu = hideContextMenu;
     window.onContextMenu = onContextMenu;
     window.onContextAction = onContextAction;
+    window.showTrashModal = showTrashModal;
+    window.hideTrashModal = hideTrashModal;
 
 })();
 // 知识库编辑器 - 附件面板模块
@@ -4747,8 +4986,10 @@ window.toggleGitSection = EditorApp.Git.toggleSection;
             const data = await response.json();
 
             if (data.success) {
-                EditorApp.Utils.showToast('附件已重命名', 'success');
+                const refs = data.data.references || [];
+                EditorApp.Utils.showToast(refs.length > 0 ? `附件已重命名，已更新 ${refs.length} 处引用` : '附件已重命名', 'success');
                 loadAttachments(tab.path);
+                reloadReferencingTabs(refs);
             } else {
                 EditorApp.Utils.showToast('重命名失败: ' + data.error, 'error');
             }
@@ -4758,6 +4999,20 @@ window.toggleGitSection = EditorApp.Git.toggleSection;
         }
     }
 
+    // 引用被服务器修改的已打开模块：没有未保存修改时重新加载，否则保存时自动合并
+    function reloadReferencingTabs(refs) {
+        const state = EditorApp.State.getState();
+        const modules = new Set(refs.map(ref => ref.module));
+        state.tabs.forEach(tab => {
+            if (!modules.has(tab.path) || tab.type === 'image') return;
+            if (tab.isDirty) {
+                EditorApp.Utils.showToast(`${tab.title} 中的图片引用已在服务器上更新，保存时会自动合并`, 'warning', 5000);
+            } else if (EditorApp.Vditor) {
+                EditorApp.Vditor.reloadContent(tab);
+            }
+        });
+    }
+
     // 删除附件
     async function deleteAttachment(attachment) {
         if (!confirm(`确定要删除附件 "${attachment.name}" 吗？`)) {
@@ -4773,21 +5028,40 @@ window.toggleGitSection = EditorApp.Git.toggleSection;
         const fullPath = dir ? dir + '/' + attachment.path : attachment.path;
 
         try {
-            const response = await fetch('/api/editor/module?path=' + encodeURIComponent(fullPath), {
-                method: 'DELETE'
-            });
-            const data = await response.json();
-
-            if (data.success) {
-                EditorApp.Utils.showToast('附件已删除', 'success');
-                loadAttachments(tab.path);
-            } else {
-                EditorApp.Utils.showToast('删除失败: ' + data.error, 'error');
-            }
+            const result = await deleteImage(fullPath);
+            if (!result) return;
+            EditorApp.Utils.showToast(result.trashId ? '附件已移入回收站' : '附件已删除', 'success');
+            loadAttachments(tab.path);
         } catch (e) {
             console.error('删除附件失败:', e);
-            EditorApp.Utils.showToast('删除失败', 'error');
+            EditorApp.Utils.showToast('删除失败: ' + e.message, 'error');
+        }
+    }
+
+    // 删除图片（path 相对于 src）：仍被模块引用时列出引用位置，确认后强制删除
+    // 返回删除结果，取消时返回 null
+    async function deleteImage(path) {
+        let data = await requestDeleteImage(path, false);
+        if (data.code === 'IMAGE_IN_USE') {
+            const refs = data.data.references || [];
+            const lines = refs.slice(0, 10).map(ref => `  ${ref.module}:${ref.line}  ${ref.target}`);
+            if (refs.length > 10) lines.push(`  …共 ${refs.length} 处`);
+            if (!confirm(`${data.error}\n\n${lines.join('\n')}\n\n仍然删除吗？这些位置在构建时会缺少图片。`)) {
+                return null;
+            }
+            data = await requestDeleteImage(path, true);
         }
+        if (!data.success) throw new Error(data.error);
+        return data.data;
+    }
+
+    async function requestDeleteImage(path, force) {
+        const headers = EditorApp.Presence ? EditorApp.Presence.sourceHeaders() : {};
+        const response = await fetch('/api/editor/image/' + encodeURIComponent(path) + (force ? '?force=true' : ''), {
+            method: 'DELETE',
+            headers: headers
+        });
+        return response.json();
     }
 
     // 初始化附件面板事件
@@ -4892,6 +5166,7 @@ window.toggleGitSection = EditorApp.Git.toggleSection;
         closePreview: closeAttachmentPreview,
         rename: renameAttachment,
         delete: deleteAttachment,
+        deleteImage: deleteImage,
         showContextMenu: showAttachmentContextMenu,
         hideContextMenu: hideAttachmentContextMenu,
         onContextAction: onAttachmentContextAction,
@@ -5390,6 +5665,13 @@ EditorApp.CommandPalette = (function() {
             action: () => EditorApp.Files && EditorApp.Files.showNewModal()
         });
 
+        register({
+            id: 'file.trash',
+            label: '回收站',
+            category: '文件',
+            action: () => EditorApp.Files && EditorApp.Files.showTrashModal()
+        });
+
         register({
             id: 'file.refresh',
             label: '刷新文件树',
@@ -6231,6 +6513,333 @@ EditorApp.VersionHistory = (function() {
         getCommits: getCommits
     };
 })();
+// 知识库编辑器 - 在线状态模块
+// 显示谁在查看或编辑哪个模块，编辑时获取编辑锁，并提示其他人对模块的保存、重命名和删除
+
+window.EditorApp = window.EditorApp || {};
+
+EditorApp.Presence = (function() {
+    'use strict';
+
+    const state = EditorApp.State.getState();
+
+    const CHECK_INTERVAL = 2000;      // 检查当前标签变化的间隔
+    const HEARTBEAT_INTERVAL = 20000; // 心跳间隔（服务器 60 秒未收到心跳视为离开）
+    const RECONNECT_DELAY = 5000;
+
+    let eventSource = null;
+    let connectionId = null;
+    let presence = [];
+    let locks = [];
+    let lastReport = { path: null, mode: null, time: 0 };
+    let heldLockPath = null;     // 本连接持有编辑锁的模块
+    let warnedLockPath = null;   // 已提示过被他人编辑的模块
+
+    // ==================== 连接 ====================
+
+    function init() {
+        connect();
+        setInterval(tick, CHECK_INTERVAL);
+        window.addEventListener('beforeunload', () => {
+            if (eventSource) eventSource.close();
+        });
+    }
+
+    function connect() {
+        eventSource = new EventSource('/api/editor/presence/stream');
+
+        eventSource.addEventListener('hello', (e) => {
+            const event = JSON.parse(e.data);
+            connectionId = event.connectionId;
+            lastReport = { path: null, mode: null, time: 0 };
+            heldLockPath = null;
+            updateState(event);
+            tick();
+        });
+        eventSource.addEventListener('presence', (e) => updateState(JSON.parse(e.data)));
+        ['saved', 'created', 'renamed', 'deleted'].forEach(type => {
+            eventSource.addEventListener(type, (e) => onModuleEvent(JSON.parse(e.data)));
+        });
+
+        eventSource.onerror = () => {
+            // 连接断开（服务器重启或心跳超时被清理）后重新连接
+            eventSource.close();
+            connectionId = null;
+            setTimeout(connect, RECONNECT_DELAY);
+        };
+    }
+
+    function getConnectionId() {
+        return connectionId;
+    }
+
+    // 修改模块的请求带上连接 ID，推送时据此忽略自己的操作
+    function sourceHeaders() {
+        return connectionId ? { 'X-Editor-Connection': connectionId } : {};
+    }
+
+    // ==================== 心跳和编辑锁 ====================
+
+    function activeTab() {
+        return state.tabs.find(t => t.id === state.activeTabId && t.type !== 'image') || null;
+    }
+
+    function tick() {
+        if (!connectionId) return;
+        renderTabs(); // 标签重新渲染后补上标记
+
+        const tab = activeTab();
+        const path = tab ? tab.path : '';
+        const mode = tab && tab.isDirty ? 'editing' : 'viewing';
+
+        // 有未保存修改时获取编辑锁，保存或关闭后释放
+        const wantLock = tab && tab.isDirty ? tab.path : null;
+        if (heldLockPath && heldLockPath !== wantLock) {
+            releaseLock(heldLockPath);
+        }
+        if (wantLock && heldLockPath !== wantLock && warnedLockPath !== wantLock) {
+            acquireLock(wantLock, false);
+        }
+
+        const now = Date.now();
+        if (path === lastReport.path && mode === lastReport.mode && now - lastReport.time < HEARTBEAT_INTERVAL) {
+            return;
+        }
+        lastReport = { path, mode, time: now };
+        fetch('/api/editor/presence', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ connectionId, path, mode })
+        }).catch(e => console.error('上报在线状态失败:', e));
+    }
+
+    async function acquireLock(path, force) {
+        try {
+            const response = await fetch('/api/editor/edit-lock', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ connectionId, path, force })
+            });
+            const data = await response.json();
+            if (data.success) {
+                heldLockPath = path;
+                warnedLockPath = null;
+                return;
+            }
+            if (data.code === 'EDIT_LOCKED') {
+                // 编辑锁只是提示，仍然可以继续编辑，保存时会自动合并
+                warnedLockPath = path;
+                EditorApp.Utils.showToast(data.error + '，保存时会尝试合并双方的修改', 'warning', 5000);
+            }
+        } catch (e) {
+            console.error('获取编辑锁失败:', e);
+        }
+    }
+
+    function releaseLock(path) {
+        heldLockPath = null;
+        const query = '?connectionId=' + encodeURIComponent(connectionId) + '&path=' + encodeURIComponent(path);
+        fetch('/api/editor/edit-lock' + query, { method: 'DELETE' }).catch(() => null);
+    }
+
+    // ==================== 事件处理 ====================
+
+    function updateState(event) {
+        presence = event.presence || [];
+        locks = event.locks || [];
+        // 其他人释放编辑锁后允许再次获取
+        if (warnedLockPath && !locks.some(l => l.path === warnedLockPath)) {
+            warnedLockPath = null;
+        }
+        render();
+    }
+
+    function isOwnEvent(event) {
+        if (event.source) return event.source === connectionId;
+        // 没有带连接 ID 的请求，按操作人判断
+        return window.currentUser && event.actor === window.currentUser.username;
+    }
+
+    function onModuleEvent(event) {
+        if (isOwnEvent(event)) return;
+
+        const who = event.displayName || event.actor || '其他人';
+        const name = event.path.split('/').pop();
+
+        switch (event.type) {
+            case 'saved': {
+                const tab = state.tabs.find(t => t.path === event.path);
+                if (!tab || tab.etag === event.etag) break;
+                if (tab.isDirty) {
+                    EditorApp.Utils.showToast(`${who} 保存了 ${name}，你保存时会自动合并双方的修改`, 'warning', 5000);
+                } else if (EditorApp.Vditor) {
+                    EditorApp.Vditor.reloadContent(tab);
+                    EditorApp.Utils.showToast(`${who} 保存了 ${name}，已更新为最新内容`, 'info');
+                }
+                break;
+            }
+            case 'created':
+                if (EditorApp.Tree) EditorApp.Tree.load();
+                break;
+            case 'renamed':
+                state.tabs.forEach(tab => {
+                    if (tab.path === event.oldPath || tab.path.startsWith(event.oldPath + '/')) {
+                        tab.path = event.path + tab.path.substring(event.oldPath.length);
+                        tab.title = tab.path.split('/').pop().replace('.md', '');
+                    }
+                });
+                if (EditorApp.Tabs) EditorApp.Tabs.render();
+                if (EditorApp.Tree) EditorApp.Tree.load();
+                EditorApp.Utils.showToast(`${who} 把 ${event.oldPath} 重命名为 ${event.path}`, 'info');
+                break;
+            case 'deleted':
+                if (EditorApp.Tree) EditorApp.Tree.load();
+                if (state.tabs.some(t => t.path === event.path)) {
+                    EditorApp.Utils.showToast(`${who} 删除了 ${name}，关闭前可以另存当前内容`, 'warning', 5000);
+                }
+                break;
+        }
+    }
+
+    // ==================== 渲染 ====================
+
+    function displayName(entry) {
+        return entry.displayName || entry.user || entry.owner;
+    }
+
+    function render() {
+        renderIndicator();
+        renderTabs();
+    }
+
+    // 顶部显示在线的其他用户
+    function renderIndicator() {
+        const container = document.getElementById('presenceIndicator');
+        if (!container) return;
+
+        const me = window.currentUser ? window.currentUser.username : null;
+        const others = new Map();
+        presence.forEach(entry => {
+            if (entry.user === me) return;
+            const item = others.get(entry.user) || { name: displayName(entry), paths: [] };
+            if (entry.path) {
+                item.paths.push((entry.mode === 'editing' ? '编辑 ' : '查看 ') + entry.path);
+            }
+            others.set(entry.user, item);
+        });
+
+        if (others.size === 0) {
+            container.style.display = 'none';
+            return;
+        }
+        container.style.display = '';
+        container.innerHTML = '';
+        others.forEach(item => {
+            const avatar = document.createElement('span');
+            avatar.className = 'presence-avatar';
+            avatar.textContent = item.name.charAt(0).toUpperCase();
+            avatar.title = item.name + (item.paths.length ? '\n' + item.paths.join('\n') : '（在线）');
+            container.appendChild(avatar);
+        });
+    }
+
+    // 在标签上标出其他人正在查看或编辑的模块
+    function renderTabs() {
+        document.querySelectorAll('.tab-item').forEach(item => {
+            const tab = state.tabs.find(t => t.id === item.dataset.id);
+            const old = item.querySelector('.tab-presence');
+            if (old) old.remove();
+            if (!tab) return;
+
+            const lock = locks.find(l => l.path === tab.path && l.connectionId !== connectionId);
+            const viewers = presence.filter(p => p.path === tab.path && p.connectionId !== connectionId);
+            if (!lock && viewers.length === 0) return;
+
+            const badge = document.createElement('span');
+            badge.className = 'tab-presence' + (lock ? ' is-locked' : '');
+            badge.textContent = lock ? '✎' : '●';
+            badge.title = lock
+                ? displayName(lock) + ' 正在编辑'
+                : viewers.map(displayName).join('、') + ' 正在查看';
+            item.insertBefore(badge, item.querySelector('.tab-close'));
+        });
+    }
+
+    return {
+        init: init,
+        getConnectionId: getConnectionId,
+        sourceHeaders: sourceHeaders,
+        render: render
+    };
+})();
+// 知识库编辑器 - 文件变化模块
+// 接收服务器推送的文件变化（包括在服务器上执行 git pull 等界面之外的修改），刷新文件树和未修改的已打开模块
+
+window.EditorApp = window.EditorApp || {};
+
+EditorApp.Watch = (function() {
+    'use strict';
+
+    const state = EditorApp.State.getState();
+
+    const RECONNECT_DELAY = 5000;
+    const TREE_RELOAD_DELAY = 500; // 合并短时间内的多次变化（如 git pull 分多轮被发现）
+
+    let eventSource = null;
+    let treeTimer = null;
+
+    function init() {
+        connect();
+        window.addEventListener('beforeunload', () => {
+            if (eventSource) eventSource.close();
+        });
+    }
+
+    function connect() {
+        eventSource = new EventSource('/api/watch/stream');
+        eventSource.addEventListener('changed', (e) => onChanged(JSON.parse(e.data).changes || []));
+        eventSource.onerror = () => {
+            eventSource.close();
+            setTimeout(connect, RECONNECT_DELAY);
+        };
+    }
+
+    function onChanged(changes) {
+        const srcChanges = changes.filter(c => c.root === 'src');
+        if (srcChanges.length === 0) return;
+
+        // 新增或删除文件时刷新文件树
+        if (srcChanges.some(c => c.type !== 'modified')) {
+            clearTimeout(treeTimer);
+            treeTimer = setTimeout(() => {
+                if (EditorApp.Tree) EditorApp.Tree.load();
+            }, TREE_RELOAD_DELAY);
+        }
+
+        srcChanges.forEach(change => {
+            const tab = state.tabs.find(t => t.path === change.path && t.type !== 'image');
+            if (!tab) return;
+            const name = change.path.split('/').pop();
+
+            if (change.type === 'deleted') {
+                EditorApp.Utils.showToast(`${name} 已在服务器上被删除，关闭前可以另存当前内容`, 'warning', 5000);
+                return;
+            }
+            // 内容与已打开的一致（包括自己刚保存的修改）时不处理
+            if (!change.etag || tab.etag === change.etag) return;
+            if (tab.isDirty) {
+                EditorApp.Utils.showToast(`${name} 在服务器上被修改，你保存时会自动合并双方的修改`, 'warning', 5000);
+            } else if (EditorApp.Vditor) {
+                EditorApp.Vditor.reloadContent(tab);
+                EditorApp.Utils.showToast(`${name} 在服务器上被修改，已更新为最新内容`, 'info');
+            }
+        });
+    }
+
+    return {
+        init: init
+    };
+})();
 // 知识库编辑器 - 主入口模块
 // 负责初始化所有模块和绑定全局事件
 
@@ -6326,6 +6935,8 @@ EditorApp.VersionHistory = (function() {
         if (EditorApp.AutoSave) EditorApp.AutoSave.init();
         if (EditorApp.Breadcrumb) EditorApp.Breadcrumb.init();
         if (EditorApp.VersionHistory) EditorApp.VersionHistory.init();
+        if (EditorApp.Presence) EditorApp.Presence.init();
+        if (EditorApp.Watch) EditorApp.Watch.init();
 
         // 初始化 AI 聊天模块
         initChatModule();
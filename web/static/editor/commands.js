@@ -108,6 +108,13 @@ EditorApp.CommandPalette = (function() {
             action: () => EditorApp.Files && EditorApp.Files.showNewModal()
         });
 
+        register({
+            id: 'file.trash',
+            label: '回收站',
+            category: '文件',
+            action: () => EditorApp.Files && EditorApp.Files.showTrashModal()
+        });
+
         register({
             id: 'file.refresh',
             label: '刷新文件树',
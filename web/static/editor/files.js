@@ -8,6 +8,11 @@
 
     // ==================== 文件操作功能 ====================
 
+    // 修改模块的请求带上推送连接 ID，其他人会收到通知，自己不会
+    function presenceHeaders() {
+        return EditorApp.Presence ? EditorApp.Presence.sourceHeaders() : {};
+    }
+
     function showNewFileModal() {
         const state = EditorApp.State.getState();
         const modal = document.getElementById('newFileModal');
@@ -40,7 +45,7 @@
         try {
             const response = await fetch('/api/editor/module', {
                 method: 'POST',
-                headers: { 'Content-Type': 'application/json' },
+                headers: Object.assign({ 'Content-Type': 'application/json' }, presenceHeaders()),
                 body: JSON.stringify({ path })
             });
 
@@ -57,13 +62,24 @@
         }
     }
 
+    // 重命名预览中修改类型的名称
+    const RENAME_KIND_LABELS = {
+        move: '移动',
+        override: '客户覆盖',
+        config: '客户配置',
+        order: '排序',
+        link: '链接',
+        include: '引用'
+    };
+
     function showRenameModal() {
         const state = EditorApp.State.getState();
         if (!state.contextMenuTarget) return;
 
         const modal = document.getElementById('renameModal');
-        document.getElementById('newFileName').value = state.contextMenuTarget.name;
+        document.getElementById('newFileName').value = state.contextMenuTarget.path;
         state.renameTarget = state.contextMenuTarget;
+        resetRenamePreview();
 
         EditorApp.Utils.openModal(modal);
     }
@@ -72,45 +88,96 @@
         const state = EditorApp.State.getState();
         EditorApp.Utils.closeModal(document.getElementById('renameModal'));
         state.renameTarget = null;
+        resetRenamePreview();
+    }
+
+    function resetRenamePreview() {
+        const state = EditorApp.State.getState();
+        state.renamePreviewPath = null;
+        const preview = document.getElementById('renamePreview');
+        preview.innerHTML = '';
+        preview.style.display = 'none';
+        document.getElementById('renameConfirmBtn').textContent = '确认';
+    }
+
+    async function requestRename(oldPath, newPath, dryRun) {
+        const response = await fetch('/api/editor/module/' + encodeURIComponent(oldPath) + '/rename', {
+            method: 'PUT',
+            headers: Object.assign({ 'Content-Type': 'application/json' }, presenceHeaders()),
+            body: JSON.stringify({ newPath, dryRun })
+        });
+        const data = await response.json();
+        if (!data.success) throw new Error(data.error);
+        return data.data;
+    }
+
+    // 列出重命名会修改的引用，返回是否有需要确认的修改
+    function renderRenamePreview(result) {
+        const changes = result.changes.filter(c => c.kind !== 'move');
+        if (changes.length === 0) return false;
+
+        const preview = document.getElementById('renamePreview');
+        preview.innerHTML = '';
+        const summary = document.createElement('div');
+        summary.className = 'rename-preview-summary';
+        summary.textContent = `将同时修改 ${result.files.length} 个文件中的 ${changes.length} 处引用：`;
+        preview.appendChild(summary);
+
+        const list = document.createElement('ul');
+        list.className = 'rename-preview-list';
+        changes.forEach(change => {
+            const item = document.createElement('li');
+            const location = change.line ? `${change.file}:${change.line}` : change.file;
+            item.textContent = `[${RENAME_KIND_LABELS[change.kind] || change.kind}] ${location}  ${change.before} → ${change.after}`;
+            list.appendChild(item);
+        });
+        preview.appendChild(list);
+        preview.style.display = 'block';
+        document.getElementById('renameConfirmBtn').textContent = '确认重命名';
+        return true;
     }
 
     async function confirmRename() {
         const state = EditorApp.State.getState();
         if (!state.renameTarget) return;
 
-        const newName = document.getElementById('newFileName').value.trim();
-        if (!newName) {
-            EditorApp.Utils.showToast('请输入新文件名', 'warning');
+        const newPath = document.getElementById('newFileName').value.trim().replace(/^\/+/, '');
+        if (!newPath) {
+            EditorApp.Utils.showToast('请输入新路径', 'warning');
             return;
         }
 
         const oldPath = state.renameTarget.path;
-        const dir = oldPath.substring(0, oldPath.lastIndexOf('/'));
-        const newPath = dir ? dir + '/' + newName : newName;
+        if (newPath === oldPath) {
+            hideRenameModal();
+            return;
+        }
 
         try {
-            const response = await fetch('/api/editor/module/' + encodeURIComponent(oldPath) + '/rename', {
-                method: 'PUT',
-                headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({ newPath })
-            });
-
-            const data = await response.json();
-            if (!data.success) throw new Error(data.error);
+            // 先预览要修改的引用，确认后再执行
+            if (state.renamePreviewPath !== newPath) {
+                const preview = await requestRename(oldPath, newPath, true);
+                state.renamePreviewPath = newPath;
+                if (renderRenamePreview(preview)) return;
+            }
 
+            const result = await requestRename(oldPath, newPath, false);
             hideRenameModal();
-            EditorApp.Utils.showToast('重命名成功', 'success');
-
-            // 更新标签
-            const tab = state.tabs.find(t => t.path === oldPath);
-            if (tab) {
-                tab.path = newPath;
-                tab.title = newName.replace('.md', '');
-                EditorApp.Tabs.render();
-            }
+            const refs = result.result.files.length;
+            EditorApp.Utils.showToast(refs > 0 ? `重命名成功，已更新 ${refs} 个文件中的引用` : '重命名成功', 'success');
+
+            // 更新标签（移动目录时更新其中所有已打开的模块）
+            state.tabs.forEach(tab => {
+                if (tab.path === oldPath || tab.path.startsWith(oldPath + '/')) {
+                    tab.path = newPath + tab.path.substring(oldPath.length);
+                    tab.title = tab.path.split('/').pop().replace('.md', '');
+                }
+            });
+            EditorApp.Tabs.render();
 
             await EditorApp.Tree.load();
         } catch (e) {
+            resetRenamePreview();
             EditorApp.Utils.showToast('重命名失败: ' + e.message, 'error');
         }
     }
@@ -121,7 +188,7 @@
 
         const modal = document.getElementById('deleteModal');
         const message = document.getElementById('deleteMessage');
-        message.textContent = `确定要删除 "${state.contextMenuTarget.name}" 吗？此操作不可撤销。`;
+        message.textContent = `确定要删除 "${state.contextMenuTarget.name}" 吗？删除后可以在回收站中恢复。`;
 
         EditorApp.Utils.openModal(modal);
     }
@@ -138,20 +205,23 @@
         const isImage = state.contextMenuTarget.type === 'image';
 
         try {
-            // 根据文件类型选择不同的 API
-            const apiUrl = isImage 
-                ? '/api/editor/image/' + encodeURIComponent(path)
-                : '/api/editor/module/' + encodeURIComponent(path);
-            
-            const response = await fetch(apiUrl, {
-                method: 'DELETE'
-            });
-
-            const data = await response.json();
-            if (!data.success) throw new Error(data.error);
+            let result;
+            if (isImage) {
+                // 仍被模块引用的图片需要再次确认
+                result = await EditorApp.Attachments.deleteImage(path);
+                if (!result) return;
+            } else {
+                const response = await fetch('/api/editor/module/' + encodeURIComponent(path), {
+                    method: 'DELETE',
+                    headers: presenceHeaders()
+                });
+                const data = await response.json();
+                if (!data.success) throw new Error(data.error);
+                result = data.data;
+            }
 
             hideDeleteModal();
-            EditorApp.Utils.showToast('删除成功', 'success');
+            EditorApp.Utils.showToast(result && result.trashId ? '已移入回收站' : '删除成功', 'success');
 
             // 关闭相关标签
             const tab = state.tabs.find(t => t.path === path);
@@ -165,6 +235,89 @@
         }
     }
 
+    // ==================== 回收站 ====================
+
+    const TRASH_KIND_LABELS = { module: '模块', image: '图片' };
+
+    async function showTrashModal() {
+        EditorApp.Utils.openModal(document.getElementById('trashModal'));
+        await loadTrash();
+    }
+
+    function hideTrashModal() {
+        EditorApp.Utils.closeModal(document.getElementById('trashModal'));
+    }
+
+    async function loadTrash() {
+        const list = document.getElementById('trashList');
+        list.innerHTML = '<div class="trash-empty">加载中...</div>';
+        try {
+            const response = await fetch('/api/trash');
+            const data = await response.json();
+            if (!data.success) throw new Error(data.error);
+
+            // 编辑器只处理模块和图片，配置和资源在首页恢复
+            const items = (data.data.items || []).filter(item => TRASH_KIND_LABELS[item.kind]);
+            if (items.length === 0) {
+                list.innerHTML = '<div class="trash-empty">回收站是空的</div>';
+                return;
+            }
+            list.innerHTML = '';
+            items.forEach(item => {
+                const row = document.createElement('div');
+                row.className = 'trash-item';
+
+                const info = document.createElement('div');
+                info.className = 'trash-item-info';
+                const name = document.createElement('div');
+                name.className = 'trash-item-name';
+                name.textContent = item.name;
+                const meta = document.createElement('div');
+                meta.className = 'trash-item-meta';
+                meta.textContent = `${TRASH_KIND_LABELS[item.kind]} · ${item.deletedBy || '未知'} 删除于 ${new Date(item.deletedAt).toLocaleString()}`;
+                info.appendChild(name);
+                info.appendChild(meta);
+
+                const button = document.createElement('button');
+                button.className = 'btn btn-secondary btn-sm';
+                button.textContent = '恢复';
+                button.addEventListener('click', () => restoreTrashItem(item));
+
+                row.appendChild(info);
+                row.appendChild(button);
+                list.appendChild(row);
+            });
+        } catch (e) {
+            list.innerHTML = '<div class="trash-empty">加载失败</div>';
+            EditorApp.Utils.showToast('加载回收站失败: ' + e.message, 'error');
+        }
+    }
+
+    async function restoreTrashItem(item, onConflict) {
+        try {
+            const response = await fetch('/api/trash/' + encodeURIComponent(item.id) + '/restore', {
+                method: 'POST',
+                headers: Object.assign({ 'Content-Type': 'application/json' }, presenceHeaders()),
+                body: JSON.stringify({ onConflict: onConflict || 'fail' })
+            });
+            const data = await response.json();
+            if (data.code === 'TRASH_CONFLICT') {
+                if (confirm(`"${item.name}" 的位置已有同名文件。\n\n确定：恢复为新的文件名（文件名后加上"-恢复"）\n取消：不恢复`)) {
+                    await restoreTrashItem(item, 'rename');
+                }
+                return;
+            }
+            if (!data.success) throw new Error(data.error);
+
+            const restored = data.data.result.files[0].replace(/^src\//, '');
+            EditorApp.Utils.showToast('已恢复: ' + restored, 'success');
+            await EditorApp.Tree.load();
+            await loadTrash();
+        } catch (e) {
+            EditorApp.Utils.showToast('恢复失败: ' + e.message, 'error');
+        }
+    }
+
     // ==================== 右键菜单 ====================
 
     function showContextMenu(e, item) {
@@ -201,7 +354,7 @@
             // 其他文件类型：显示所有菜单项
             if (newItem) newItem.style.display = 'block';
             if (newFolderItem) newFolderItem.style.display = 'block';
-            if (renameItem) renameItem.style.display = isDirectory ? 'none' : 'block';
+            if (renameItem) renameItem.style.display = 'block';
             dividers.forEach(d => d.style.display = 'block');
             if (deleteItem) deleteItem.style.display = 'block';
             // 只对文件显示历史选项
@@ -284,13 +437,16 @@
         showRenameModal: showRenameModal,
         hideRenameModal: hideRenameModal,
         confirmRename: confirmRename,
+        resetRenamePreview: resetRenamePreview,
         showDeleteModal: showDeleteModal,
         hideDeleteModal: hideDeleteModal,
         confirmDelete: confirmDelete,
         showContextMenu: showContextMenu,
         hideContextMenu: hideContextMenu,
         onContextMenu: onContextMenu,
-        onContextAction: onContextAction
+        onContextAction: onContextAction,
+        showTrashModal: showTrashModal,
+        hideTrashModal: hideTrashModal
     };
 
     // 暴露到全局作用域（向后兼容）
@@ -300,6 +456,7 @@
     window.showRenameModal = showRenameModal;
     window.hideRenameModal = hideRenameModal;
     window.confirmRename = confirmRename;
+    window.resetRenamePreview = resetRenamePreview;
     window.showDeleteModal = showDeleteModal;
     window.hideDeleteModal = hideDeleteModal;
     window.confirmDelete = confirmDelete;
@@ -307,5 +464,7 @@
     window.hideContextMenu = hideContextMenu;
     window.onContextMenu = onContextMenu;
     window.onContextAction = onContextAction;
+    window.showTrashModal = showTrashModal;
+    window.hideTrashModal = hideTrashModal;
 
 })();
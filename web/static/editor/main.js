@@ -45,6 +45,8 @@
         if (EditorApp.AutoSave) EditorApp.AutoSave.init();
         if (EditorApp.Breadcrumb) EditorApp.Breadcrumb.init();
         if (EditorApp.VersionHistory) EditorApp.VersionHistory.init();
+        if (EditorApp.Presence) EditorApp.Presence.init();
+        if (EditorApp.Watch) EditorApp.Watch.init();
 
         // 初始化 AI 聊天模块
         initChatModule();
@@ -0,0 +1,259 @@
+// 知识库编辑器 - 在线状态模块
+// 显示谁在查看或编辑哪个模块，编辑时获取编辑锁，并提示其他人对模块的保存、重命名和删除
+
+window.EditorApp = window.EditorApp || {};
+
+EditorApp.Presence = (function() {
+    'use strict';
+
+    const state = EditorApp.State.getState();
+
+    const CHECK_INTERVAL = 2000;      // 检查当前标签变化的间隔
+    const HEARTBEAT_INTERVAL = 20000; // 心跳间隔（服务器 60 秒未收到心跳视为离开）
+    const RECONNECT_DELAY = 5000;
+
+    let eventSource = null;
+    let connectionId = null;
+    let presence = [];
+    let locks = [];
+    let lastReport = { path: null, mode: null, time: 0 };
+    let heldLockPath = null;     // 本连接持有编辑锁的模块
+    let warnedLockPath = null;   // 已提示过被他人编辑的模块
+
+    // ==================== 连接 ====================
+
+    function init() {
+        connect();
+        setInterval(tick, CHECK_INTERVAL);
+        window.addEventListener('beforeunload', () => {
+            if (eventSource) eventSource.close();
+        });
+    }
+
+    function connect() {
+        eventSource = new EventSource('/api/editor/presence/stream');
+
+        eventSource.addEventListener('hello', (e) => {
+            const event = JSON.parse(e.data);
+            connectionId = event.connectionId;
+            lastReport = { path: null, mode: null, time: 0 };
+            heldLockPath = null;
+            updateState(event);
+            tick();
+        });
+        eventSource.addEventListener('presence', (e) => updateState(JSON.parse(e.data)));
+        ['saved', 'created', 'renamed', 'deleted'].forEach(type => {
+            eventSource.addEventListener(type, (e) => onModuleEvent(JSON.parse(e.data)));
+        });
+
+        eventSource.onerror = () => {
+            // 连接断开（服务器重启或心跳超时被清理）后重新连接
+            eventSource.close();
+            connectionId = null;
+            setTimeout(connect, RECONNECT_DELAY);
+        };
+    }
+
+    function getConnectionId() {
+        return connectionId;
+    }
+
+    // 修改模块的请求带上连接 ID，推送时据此忽略自己的操作
+    function sourceHeaders() {
+        return connectionId ? { 'X-Editor-Connection': connectionId } : {};
+    }
+
+    // ==================== 心跳和编辑锁 ====================
+
+    function activeTab() {
+        return state.tabs.find(t => t.id === state.activeTabId && t.type !== 'image') || null;
+    }
+
+    function tick() {
+        if (!connectionId) return;
+        renderTabs(); // 标签重新渲染后补上标记
+
+        const tab = activeTab();
+        const path = tab ? tab.path : '';
+        const mode = tab && tab.isDirty ? 'editing' : 'viewing';
+
+        // 有未保存修改时获取编辑锁，保存或关闭后释放
+        const wantLock = tab && tab.isDirty ? tab.path : null;
+        if (heldLockPath && heldLockPath !== wantLock) {
+            releaseLock(heldLockPath);
+        }
+        if (wantLock && heldLockPath !== wantLock && warnedLockPath !== wantLock) {
+            acquireLock(wantLock, false);
+        }
+
+        const now = Date.now();
+        if (path === lastReport.path && mode === lastReport.mode && now - lastReport.time < HEARTBEAT_INTERVAL) {
+            return;
+        }
+        lastReport = { path, mode, time: now };
+        fetch('/api/editor/presence', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ connectionId, path, mode })
+        }).catch(e => console.error('上报在线状态失败:', e));
+    }
+
+    async function acquireLock(path, force) {
+        try {
+            const response = await fetch('/api/editor/edit-lock', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ connectionId, path, force })
+            });
+            const data = await response.json();
+            if (data.success) {
+                heldLockPath = path;
+                warnedLockPath = null;
+                return;
+            }
+            if (data.code === 'EDIT_LOCKED') {
+                // 编辑锁只是提示，仍然可以继续编辑，保存时会自动合并
+                warnedLockPath = path;
+                EditorApp.Utils.showToast(data.error + '，保存时会尝试合并双方的修改', 'warning', 5000);
+            }
+        } catch (e) {
+            console.error('获取编辑锁失败:', e);
+        }
+    }
+
+    function releaseLock(path) {
+        heldLockPath = null;
+        const query = '?connectionId=' + encodeURIComponent(connectionId) + '&path=' + encodeURIComponent(path);
+        fetch('/api/editor/edit-lock' + query, { method: 'DELETE' }).catch(() => null);
+    }
+
+    // ==================== 事件处理 ====================
+
+    function updateState(event) {
+        presence = event.presence || [];
+        locks = event.locks || [];
+        // 其他人释放编辑锁后允许再次获取
+        if (warnedLockPath && !locks.some(l => l.path === warnedLockPath)) {
+            warnedLockPath = null;
+        }
+        render();
+    }
+
+    function isOwnEvent(event) {
+        if (event.source) return event.source === connectionId;
+        // 没有带连接 ID 的请求，按操作人判断
+        return window.currentUser && event.actor === window.currentUser.username;
+    }
+
+    function onModuleEvent(event) {
+        if (isOwnEvent(event)) return;
+
+        const who = event.displayName || event.actor || '其他人';
+        const name = event.path.split('/').pop();
+
+        switch (event.type) {
+            case 'saved': {
+                const tab = state.tabs.find(t => t.path === event.path);
+                if (!tab || tab.etag === event.etag) break;
+                if (tab.isDirty) {
+                    EditorApp.Utils.showToast(`${who} 保存了 ${name}，你保存时会自动合并双方的修改`, 'warning', 5000);
+                } else if (EditorApp.Vditor) {
+                    EditorApp.Vditor.reloadContent(tab);
+                    EditorApp.Utils.showToast(`${who} 保存了 ${name}，已更新为最新内容`, 'info');
+                }
+                break;
+            }
+            case 'created':
+                if (EditorApp.Tree) EditorApp.Tree.load();
+                break;
+            case 'renamed':
+                state.tabs.forEach(tab => {
+                    if (tab.path === event.oldPath || tab.path.startsWith(event.oldPath + '/')) {
+                        tab.path = event.path + tab.path.substring(event.oldPath.length);
+                        tab.title = tab.path.split('/').pop().replace('.md', '');
+                    }
+                });
+                if (EditorApp.Tabs) EditorApp.Tabs.render();
+                if (EditorApp.Tree) EditorApp.Tree.load();
+                EditorApp.Utils.showToast(`${who} 把 ${event.oldPath} 重命名为 ${event.path}`, 'info');
+                break;
+            case 'deleted':
+                if (EditorApp.Tree) EditorApp.Tree.load();
+                if (state.tabs.some(t => t.path === event.path)) {
+                    EditorApp.Utils.showToast(`${who} 删除了 ${name}，关闭前可以另存当前内容`, 'warning', 5000);
+                }
+                break;
+        }
+    }
+
+    // ==================== 渲染 ====================
+
+    function displayName(entry) {
+        return entry.displayName || entry.user || entry.owner;
+    }
+
+    function render() {
+        renderIndicator();
+        renderTabs();
+    }
+
+    // 顶部显示在线的其他用户
+    function renderIndicator() {
+        const container = document.getElementById('presenceIndicator');
+        if (!container) return;
+
+        const me = window.currentUser ? window.currentUser.username : null;
+        const others = new Map();
+        presence.forEach(entry => {
+            if (entry.user === me) return;
+            const item = others.get(entry.user) || { name: displayName(entry), paths: [] };
+            if (entry.path) {
+                item.paths.push((entry.mode === 'editing' ? '编辑 ' : '查看 ') + entry.path);
+            }
+            others.set(entry.user, item);
+        });
+
+        if (others.size === 0) {
+            container.style.display = 'none';
+            return;
+        }
+        container.style.display = '';
+        container.innerHTML = '';
+        others.forEach(item => {
+            const avatar = document.createElement('span');
+            avatar.className = 'presence-avatar';
+            avatar.textContent = item.name.charAt(0).toUpperCase();
+            avatar.title = item.name + (item.paths.length ? '\n' + item.paths.join('\n') : '（在线）');
+            container.appendChild(avatar);
+        });
+    }
+
+    // 在标签上标出其他人正在查看或编辑的模块
+    function renderTabs() {
+        document.querySelectorAll('.tab-item').forEach(item => {
+            const tab = state.tabs.find(t => t.id === item.dataset.id);
+            const old = item.querySelector('.tab-presence');
+            if (old) old.remove();
+            if (!tab) return;
+
+            const lock = locks.find(l => l.path === tab.path && l.connectionId !== connectionId);
+            const viewers = presence.filter(p => p.path === tab.path && p.connectionId !== connectionId);
+            if (!lock && viewers.length === 0) return;
+
+            const badge = document.createElement('span');
+            badge.className = 'tab-presence' + (lock ? ' is-locked' : '');
+            badge.textContent = lock ? '✎' : '●';
+            badge.title = lock
+                ? displayName(lock) + ' 正在编辑'
+                : viewers.map(displayName).join('、') + ' 正在查看';
+            item.insertBefore(badge, item.querySelector('.tab-close'));
+        });
+    }
+
+    return {
+        init: init,
+        getConnectionId: getConnectionId,
+        sourceHeaders: sourceHeaders,
+        render: render
+    };
+})();
@@ -39,6 +39,7 @@ EditorApp.State = (function() {
         contextMenuTarget: null,
         pendingCloseTabId: null,
         renameTarget: null,
+        renamePreviewPath: null, // 已预览引用修改的新路径
 
         // 拖拽排序
         draggingPath: null,
@@ -103,6 +103,28 @@ EditorApp.Vditor = (function() {
 
     // ==================== 文件内容 ====================
 
+    // 转换相对路径图片为绝对路径（用于编辑器显示）
+    function toEditorContent(content, path) {
+        const linkBase = EditorApp.Utils.calculateLinkBase(path);
+        return content.replace(
+            /!\[([^\]]*)\]\((?!https?:\/\/|\/)(images\/[^)]+)\)/gi,
+            (_, alt, src) => {
+                // 移除开头的 ./
+                const cleanSrc = src.replace(/^\.\//, '');
+                return `![${alt}](${linkBase}${cleanSrc})`;
+            }
+        );
+    }
+
+    // 用服务器返回的内容替换编辑器中的内容
+    function applyServerContent(tab, content) {
+        tab.content = toEditorContent(content, tab.path);
+        const editor = state.editors.get(tab.id);
+        if (editor) {
+            editor.setValue(tab.content);
+        }
+    }
+
     async function loadContent(tab) {
         try {
             const response = await fetch('/api/editor/module?path=' + encodeURIComponent(tab.path));
@@ -110,21 +132,11 @@ EditorApp.Vditor = (function() {
 
             if (!data.success) throw new Error(data.error);
 
-            let content = data.data.content;
-            
-            // 转换相对路径图片为绝对路径（用于编辑器显示）
-            const linkBase = EditorApp.Utils.calculateLinkBase(tab.path);
-            content = content.replace(
-                /!\[([^\]]*)\]\((?!https?:\/\/|\/)(images\/[^)]+)\)/gi,
-                (_, alt, src) => {
-                    // 移除开头的 ./
-                    const cleanSrc = src.replace(/^\.\//, '');
-                    return `![${alt}](${linkBase}${cleanSrc})`;
-                }
-            );
-
-            tab.content = content;
+            tab.content = toEditorContent(data.data.content, tab.path);
             tab.originalContent = data.data.content;
+            // 保存时用于检测和合并其他人的修改
+            tab.etag = data.data.etag;
+            tab.baseContent = data.data.content;
 
             if (state.activeTabId === tab.id) {
                 show(tab);
@@ -135,6 +147,23 @@ EditorApp.Vditor = (function() {
         }
     }
 
+    // 重新加载服务器上的内容（其他人保存后，没有未保存修改的标签自动更新）
+    async function reloadContent(tab) {
+        try {
+            const response = await fetch('/api/editor/module?path=' + encodeURIComponent(tab.path));
+            const data = await response.json();
+            if (!data.success) throw new Error(data.error);
+
+            tab.etag = data.data.etag;
+            tab.baseContent = data.data.content;
+            applyServerContent(tab, data.data.content);
+            tab.originalContent = tab.content;
+            tab.isDirty = false;
+        } catch (e) {
+            console.error('重新加载文件失败:', e);
+        }
+    }
+
     async function saveCurrentFile(silent = false) {
         const tab = state.tabs.find(t => t.id === state.activeTabId);
         if (!tab || !tab.isDirty) return;
@@ -151,16 +180,34 @@ EditorApp.Vditor = (function() {
 
             const response = await fetch('/api/editor/module', {
                 method: 'PUT',
-                headers: { 'Content-Type': 'application/json' },
+                headers: Object.assign({
+                    'Content-Type': 'application/json',
+                    'If-Match': tab.etag || ''
+                }, EditorApp.Presence ? EditorApp.Presence.sourceHeaders() : {}),
                 body: JSON.stringify({
                     path: tab.path,
-                    content: contentToSave
+                    content: contentToSave,
+                    base: tab.baseContent
                 })
             });
 
             const data = await response.json();
+            if (data.code === 'EDIT_CONFLICT') {
+                await resolveConflict(tab, data, silent);
+                return;
+            }
             if (!data.success) throw new Error(data.error);
 
+            tab.etag = data.data.etag;
+            tab.conflictEtag = null;
+            if (data.data.merged) {
+                // 其他人的修改已自动合并，编辑器换成合并后的内容
+                tab.baseContent = data.data.content;
+                applyServerContent(tab, data.data.content);
+                EditorApp.Utils.showToast('已自动合并其他人的修改', 'info');
+            } else {
+                tab.baseContent = contentToSave;
+            }
             tab.originalContent = tab.content;
             tab.isDirty = false;
 
@@ -184,6 +231,37 @@ EditorApp.Vditor = (function() {
         }
     }
 
+    // 处理保存冲突：文件已被其他人修改且无法自动合并
+    async function resolveConflict(tab, data, silent) {
+        const current = data.data.current;
+        const merge = data.data.merge;
+        const fileName = tab.path.split('/').pop();
+
+        // 自动保存时同一个服务器版本只提示一次
+        if (silent && tab.conflictEtag === current.etag) return;
+        tab.conflictEtag = current.etag;
+
+        if (merge && confirm(`${fileName} 已被其他人修改，有 ${merge.conflicts} 处冲突。\n\n确定：载入合并结果，冲突处用 <<<<<<< 和 >>>>>>> 标出，处理后再保存\n取消：不合并`)) {
+            tab.etag = current.etag;
+            tab.baseContent = current.content;
+            applyServerContent(tab, merge.content);
+            tab.isDirty = true;
+            if (EditorApp.Tabs) {
+                EditorApp.Tabs.render();
+            }
+            EditorApp.Utils.showToast('请处理标出的冲突后再保存', 'warning');
+            return;
+        }
+
+        if (confirm(`${fileName} 已被其他人修改。\n\n确定：用当前编辑的内容覆盖服务器上的版本（其他人的修改将丢失）\n取消：暂不保存`)) {
+            tab.etag = current.etag;
+            tab.baseContent = current.content;
+            await saveCurrentFile(silent);
+            return;
+        }
+        EditorApp.Utils.showToast('未保存: ' + data.error, 'warning');
+    }
+
     // ==================== 编辑器管理 ====================
 
     function show(tab) {
@@ -503,6 +581,7 @@ EditorApp.Vditor = (function() {
     // 导出公共接口
     return {
         loadContent: loadContent,
+        reloadContent: reloadContent,
         saveCurrentFile: saveCurrentFile,
         show: show,
         create: create,
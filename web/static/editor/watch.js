@@ -0,0 +1,68 @@
+// 知识库编辑器 - 文件变化模块
+// 接收服务器推送的文件变化（包括在服务器上执行 git pull 等界面之外的修改），刷新文件树和未修改的已打开模块
+
+window.EditorApp = window.EditorApp || {};
+
+EditorApp.Watch = (function() {
+    'use strict';
+
+    const state = EditorApp.State.getState();
+
+    const RECONNECT_DELAY = 5000;
+    const TREE_RELOAD_DELAY = 500; // 合并短时间内的多次变化（如 git pull 分多轮被发现）
+
+    let eventSource = null;
+    let treeTimer = null;
+
+    function init() {
+        connect();
+        window.addEventListener('beforeunload', () => {
+            if (eventSource) eventSource.close();
+        });
+    }
+
+    function connect() {
+        eventSource = new EventSource('/api/watch/stream');
+        eventSource.addEventListener('changed', (e) => onChanged(JSON.parse(e.data).changes || []));
+        eventSource.onerror = () => {
+            eventSource.close();
+            setTimeout(connect, RECONNECT_DELAY);
+        };
+    }
+
+    function onChanged(changes) {
+        const srcChanges = changes.filter(c => c.root === 'src');
+        if (srcChanges.length === 0) return;
+
+        // 新增或删除文件时刷新文件树
+        if (srcChanges.some(c => c.type !== 'modified')) {
+            clearTimeout(treeTimer);
+            treeTimer = setTimeout(() => {
+                if (EditorApp.Tree) EditorApp.Tree.load();
+            }, TREE_RELOAD_DELAY);
+        }
+
+        srcChanges.forEach(change => {
+            const tab = state.tabs.find(t => t.path === change.path && t.type !== 'image');
+            if (!tab) return;
+            const name = change.path.split('/').pop();
+
+            if (change.type === 'deleted') {
+                EditorApp.Utils.showToast(`${name} 已在服务器上被删除，关闭前可以另存当前内容`, 'warning', 5000);
+                return;
+            }
+            // 内容与已打开的一致（包括自己刚保存的修改）时不处理
+            if (!change.etag || tab.etag === change.etag) return;
+            if (tab.isDirty) {
+                EditorApp.Utils.showToast(`${name} 在服务器上被修改，你保存时会自动合并双方的修改`, 'warning', 5000);
+            } else if (EditorApp.Vditor) {
+                EditorApp.Vditor.reloadContent(tab);
+                EditorApp.Utils.showToast(`${name} 在服务器上被修改，已更新为最新内容`, 'info');
+            }
+        });
+    }
+
+    return {
+        init: init
+    };
+})();